@@ -0,0 +1,589 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	"encoding/json"
+
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+const (
+	// ConversionDataAnnotation keeps the hub object on v1alpha2 objects
+	// so that fields which v1alpha2 cannot represent are restored on the way back
+	ConversionDataAnnotation = "infrastructure.cluster.x-k8s.io/conversion-data"
+)
+
+// ConvertTo converts this NifcloudCluster to the Hub version (v1alpha3)
+func (src *NifcloudCluster) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*infrav1alpha3.NifcloudCluster)
+	dst.ObjectMeta = src.ObjectMeta
+
+	dst.Spec = infrav1alpha3.NifcloudClusterSpec{
+		NetworkSpec:              convertNetworkSpecToHub(src.Spec.NetworkSpec),
+		Zone:                     src.Spec.Zone,
+		Region:                   src.Spec.Region,
+		SSHKeyName:               src.Spec.SSHKeyName,
+		ControlPlaneLoadBalancer: convertLoadBalancerSpecToHub(src.Spec.ControlPlaneLoadBalancer),
+	}
+	// v1alpha2 reports the endpoint in status, the first one is the control plane endpoint
+	if len(src.Status.APIEndpoints) > 0 {
+		dst.Spec.ControlPlaneEndpoint = infrav1alpha3.APIEndpoint(src.Status.APIEndpoints[0])
+	}
+
+	dst.Status = infrav1alpha3.NifcloudClusterStatus{
+		Network:        convertNetworkToHub(src.Status.Network),
+		Bastion:        convertInstanceToHub(src.Status.Bastion),
+		Ready:          src.Status.Ready,
+		FailureReason:  src.Status.ErrorReason,
+		FailureMessage: src.Status.ErrorMessage,
+	}
+
+	restored := &infrav1alpha3.NifcloudCluster{}
+	if ok, err := unmarshalConversionData(dst, restored); err != nil || !ok {
+		return err
+	}
+	dst.Spec.IngressRules = restored.Spec.IngressRules
+	dst.Spec.AllowControllerIP = restored.Spec.AllowControllerIP
+	dst.Spec.Bastion = restored.Spec.Bastion
+	dst.Spec.IdentityRef = restored.Spec.IdentityRef
+	dst.Spec.SSHKey = restored.Spec.SSHKey
+	dst.Status.KeyPairName = restored.Status.KeyPairName
+	dst.Status.Conditions = restored.Status.Conditions
+	restoreExistingResources(dst, restored)
+	return nil
+}
+
+// restoreExistingResources restores the existing resources given in the spec
+// and the marks of them in the status, which v1alpha2 cannot represent
+func restoreExistingResources(dst, restored *infrav1alpha3.NifcloudCluster) {
+	dst.Spec.NetworkSpec.EndpointIP = restored.Spec.NetworkSpec.EndpointIP
+	dst.Spec.NetworkSpec.SecurityGroupOverrides = restored.Spec.NetworkSpec.SecurityGroupOverrides
+	if dst.Spec.NetworkSpec.PrivateLAN != nil && restored.Spec.NetworkSpec.PrivateLAN != nil {
+		dst.Spec.NetworkSpec.PrivateLAN.ID = restored.Spec.NetworkSpec.PrivateLAN.ID
+	}
+	if dst.Spec.ControlPlaneLoadBalancer != nil && restored.Spec.ControlPlaneLoadBalancer != nil {
+		dst.Spec.ControlPlaneLoadBalancer.Name = restored.Spec.ControlPlaneLoadBalancer.Name
+	}
+
+	network := &dst.Status.Network
+	network.EndpointAddress = restored.Status.Network.EndpointAddress
+	for role, sg := range network.SecurityGroups {
+		sg.Unmanaged = restored.Status.Network.SecurityGroups[role].Unmanaged
+		network.SecurityGroups[role] = sg
+	}
+	if network.PrivateLAN != nil && restored.Status.Network.PrivateLAN != nil {
+		network.PrivateLAN.Unmanaged = restored.Status.Network.PrivateLAN.Unmanaged
+	}
+	if network.APIServerLoadBalancer != nil && restored.Status.Network.APIServerLoadBalancer != nil {
+		network.APIServerLoadBalancer.Unmanaged = restored.Status.Network.APIServerLoadBalancer.Unmanaged
+	}
+}
+
+// ConvertFrom converts from the Hub version (v1alpha3) to this version
+func (dst *NifcloudCluster) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*infrav1alpha3.NifcloudCluster)
+	dst.ObjectMeta = src.ObjectMeta
+
+	dst.Spec = NifcloudClusterSpec{
+		NetworkSpec:              convertNetworkSpecFromHub(src.Spec.NetworkSpec),
+		Zone:                     src.Spec.Zone,
+		Region:                   src.Spec.Region,
+		SSHKeyName:               src.Spec.SSHKeyName,
+		ControlPlaneLoadBalancer: convertLoadBalancerSpecFromHub(src.Spec.ControlPlaneLoadBalancer),
+	}
+
+	dst.Status = NifcloudClusterStatus{
+		Network:      convertNetworkFromHub(src.Status.Network),
+		Bastion:      convertInstanceFromHub(src.Status.Bastion),
+		Ready:        src.Status.Ready,
+		ErrorReason:  src.Status.FailureReason,
+		ErrorMessage: src.Status.FailureMessage,
+	}
+	if !src.Spec.ControlPlaneEndpoint.IsZero() {
+		dst.Status.APIEndpoints = []APIEndpoint{APIEndpoint(src.Spec.ControlPlaneEndpoint)}
+	}
+	return marshalConversionData(src, dst)
+}
+
+// ConvertTo converts this NifcloudClusterList to the Hub version (v1alpha3)
+func (src *NifcloudClusterList) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*infrav1alpha3.NifcloudClusterList)
+	dst.ListMeta = src.ListMeta
+	dst.Items = make([]infrav1alpha3.NifcloudCluster, len(src.Items))
+	for i := range src.Items {
+		if err := src.Items[i].ConvertTo(&dst.Items[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1alpha3) to this version
+func (dst *NifcloudClusterList) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*infrav1alpha3.NifcloudClusterList)
+	dst.ListMeta = src.ListMeta
+	dst.Items = make([]NifcloudCluster, len(src.Items))
+	for i := range src.Items {
+		if err := dst.Items[i].ConvertFrom(&src.Items[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConvertTo converts this NifcloudMachine to the Hub version (v1alpha3)
+func (src *NifcloudMachine) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*infrav1alpha3.NifcloudMachine)
+	dst.ObjectMeta = src.ObjectMeta
+
+	dst.Spec = convertMachineSpecToHub(src.Spec)
+	dst.Status = infrav1alpha3.NifcloudMachineStatus{
+		Ready:             src.Status.Ready,
+		Addresses:         src.Status.Address,
+		SendBootstrap:     src.Status.SendBootstrap,
+		BootstrapDelivery: infrav1alpha3.BootstrapDelivery(src.Status.BootstrapDelivery),
+		FailureReason:     src.Status.ErrorReason,
+		FailureMessage:    src.Status.ErrorMessage,
+	}
+	if src.Status.InstanceState != nil {
+		state := infrav1alpha3.InstanceState(*src.Status.InstanceState)
+		dst.Status.InstanceState = &state
+	}
+
+	restored := &infrav1alpha3.NifcloudMachine{}
+	if ok, err := unmarshalConversionData(dst, restored); err != nil || !ok {
+		return err
+	}
+	dst.Spec.ImageLookup = restored.Spec.ImageLookup
+	dst.Spec.Volumes = restored.Spec.Volumes
+	dst.Status.ImageID = restored.Status.ImageID
+	dst.Status.ControlPlaneEndpointAttached = restored.Status.ControlPlaneEndpointAttached
+	dst.Status.Volumes = restored.Status.Volumes
+	dst.Status.Conditions = restored.Status.Conditions
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1alpha3) to this version
+func (dst *NifcloudMachine) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*infrav1alpha3.NifcloudMachine)
+	dst.ObjectMeta = src.ObjectMeta
+
+	dst.Spec = convertMachineSpecFromHub(src.Spec)
+	dst.Status = NifcloudMachineStatus{
+		Ready:             src.Status.Ready,
+		Address:           src.Status.Addresses,
+		SendBootstrap:     src.Status.SendBootstrap,
+		BootstrapDelivery: BootstrapDelivery(src.Status.BootstrapDelivery),
+		ErrorReason:       src.Status.FailureReason,
+		ErrorMessage:      src.Status.FailureMessage,
+	}
+	if src.Status.InstanceState != nil {
+		state := InstanceState(*src.Status.InstanceState)
+		dst.Status.InstanceState = &state
+	}
+	return marshalConversionData(src, dst)
+}
+
+// ConvertTo converts this NifcloudMachineList to the Hub version (v1alpha3)
+func (src *NifcloudMachineList) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*infrav1alpha3.NifcloudMachineList)
+	dst.ListMeta = src.ListMeta
+	dst.Items = make([]infrav1alpha3.NifcloudMachine, len(src.Items))
+	for i := range src.Items {
+		if err := src.Items[i].ConvertTo(&dst.Items[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1alpha3) to this version
+func (dst *NifcloudMachineList) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*infrav1alpha3.NifcloudMachineList)
+	dst.ListMeta = src.ListMeta
+	dst.Items = make([]NifcloudMachine, len(src.Items))
+	for i := range src.Items {
+		if err := dst.Items[i].ConvertFrom(&src.Items[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConvertTo converts this NifcloudMachineTemplate to the Hub version (v1alpha3)
+func (src *NifcloudMachineTemplate) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*infrav1alpha3.NifcloudMachineTemplate)
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Spec.Template.Spec = convertMachineSpecToHub(src.Spec.Template.Spec)
+
+	restored := &infrav1alpha3.NifcloudMachineTemplate{}
+	if ok, err := unmarshalConversionData(dst, restored); err != nil || !ok {
+		return err
+	}
+	dst.Spec.Template.Spec.ImageLookup = restored.Spec.Template.Spec.ImageLookup
+	dst.Spec.Template.Spec.Volumes = restored.Spec.Template.Spec.Volumes
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1alpha3) to this version
+func (dst *NifcloudMachineTemplate) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*infrav1alpha3.NifcloudMachineTemplate)
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Spec.Template.Spec = convertMachineSpecFromHub(src.Spec.Template.Spec)
+	return marshalConversionData(src, dst)
+}
+
+// ConvertTo converts this NifcloudMachineTemplateList to the Hub version (v1alpha3)
+func (src *NifcloudMachineTemplateList) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*infrav1alpha3.NifcloudMachineTemplateList)
+	dst.ListMeta = src.ListMeta
+	dst.Items = make([]infrav1alpha3.NifcloudMachineTemplate, len(src.Items))
+	for i := range src.Items {
+		if err := src.Items[i].ConvertTo(&dst.Items[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1alpha3) to this version
+func (dst *NifcloudMachineTemplateList) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*infrav1alpha3.NifcloudMachineTemplateList)
+	dst.ListMeta = src.ListMeta
+	dst.Items = make([]NifcloudMachineTemplate, len(src.Items))
+	for i := range src.Items {
+		if err := dst.Items[i].ConvertFrom(&src.Items[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// marshalConversionData stores src without its metadata in the annotation of dst
+func marshalConversionData(src runtime.Object, dst metav1.Object) error {
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(src)
+	if err != nil {
+		return err
+	}
+	unstructured.RemoveNestedField(u, "metadata")
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+
+	// dst shares metadata with src, copy annotations before adding
+	annotations := make(map[string]string, len(dst.GetAnnotations())+1)
+	for k, v := range dst.GetAnnotations() {
+		annotations[k] = v
+	}
+	annotations[ConversionDataAnnotation] = string(data)
+	dst.SetAnnotations(annotations)
+	return nil
+}
+
+// unmarshalConversionData restores the object stored by marshalConversionData
+// and removes the annotation from from, it returns false when nothing is stored
+func unmarshalConversionData(from metav1.Object, to interface{}) (bool, error) {
+	data, ok := from.GetAnnotations()[ConversionDataAnnotation]
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal([]byte(data), to); err != nil {
+		return false, err
+	}
+
+	annotations := make(map[string]string, len(from.GetAnnotations()))
+	for k, v := range from.GetAnnotations() {
+		if k != ConversionDataAnnotation {
+			annotations[k] = v
+		}
+	}
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	from.SetAnnotations(annotations)
+	return true, nil
+}
+
+func convertMachineSpecToHub(in NifcloudMachineSpec) infrav1alpha3.NifcloudMachineSpec {
+	return infrav1alpha3.NifcloudMachineSpec{
+		ProviderID:        in.ProviderID,
+		InstanceID:        in.InstanceID,
+		ImageID:           in.ImageID,
+		AvailabilityZone:  in.AvailabilityZone,
+		KeyName:           in.KeyName,
+		InstanceType:      in.InstanceType,
+		PublicType:        infrav1alpha3.PublicType(in.PublicType),
+		NetworkInterfaces: in.NetworkInterfaces,
+		BootstrapDelivery: infrav1alpha3.BootstrapDelivery(in.BootstrapDelivery),
+	}
+}
+
+func convertMachineSpecFromHub(in infrav1alpha3.NifcloudMachineSpec) NifcloudMachineSpec {
+	return NifcloudMachineSpec{
+		ProviderID:        in.ProviderID,
+		InstanceID:        in.InstanceID,
+		ImageID:           in.ImageID,
+		AvailabilityZone:  in.AvailabilityZone,
+		KeyName:           in.KeyName,
+		InstanceType:      in.InstanceType,
+		PublicType:        PublicType(in.PublicType),
+		NetworkInterfaces: in.NetworkInterfaces,
+		BootstrapDelivery: BootstrapDelivery(in.BootstrapDelivery),
+	}
+}
+
+func convertNetworkSpecToHub(in NetworkSpec) infrav1alpha3.NetworkSpec {
+	out := infrav1alpha3.NetworkSpec{}
+	if lan := in.PrivateLAN; lan != nil {
+		out.PrivateLAN = &infrav1alpha3.PrivateLANSpec{
+			CidrBlock: lan.CidrBlock,
+			Zone:      lan.Zone,
+		}
+		if r := lan.Router; r != nil {
+			out.PrivateLAN.Router = &infrav1alpha3.RouterSpec{
+				Type:      r.Type,
+				IPAddress: r.IPAddress,
+			}
+			if r.DHCP != nil {
+				dhcp := infrav1alpha3.DHCPSpec(*r.DHCP)
+				out.PrivateLAN.Router.DHCP = &dhcp
+			}
+		}
+	}
+	return out
+}
+
+func convertNetworkSpecFromHub(in infrav1alpha3.NetworkSpec) NetworkSpec {
+	out := NetworkSpec{}
+	if lan := in.PrivateLAN; lan != nil {
+		out.PrivateLAN = &PrivateLANSpec{
+			CidrBlock: lan.CidrBlock,
+			Zone:      lan.Zone,
+		}
+		if r := lan.Router; r != nil {
+			out.PrivateLAN.Router = &RouterSpec{
+				Type:      r.Type,
+				IPAddress: r.IPAddress,
+			}
+			if r.DHCP != nil {
+				dhcp := DHCPSpec(*r.DHCP)
+				out.PrivateLAN.Router.DHCP = &dhcp
+			}
+		}
+	}
+	return out
+}
+
+func convertLoadBalancerSpecToHub(in *LoadBalancerSpec) *infrav1alpha3.LoadBalancerSpec {
+	if in == nil {
+		return nil
+	}
+	out := &infrav1alpha3.LoadBalancerSpec{
+		NetworkVolume: in.NetworkVolume,
+		BalancingType: in.BalancingType,
+	}
+	if in.HealthCheck != nil {
+		hc := infrav1alpha3.LoadBalancerHealthCheck(*in.HealthCheck)
+		out.HealthCheck = &hc
+	}
+	return out
+}
+
+func convertLoadBalancerSpecFromHub(in *infrav1alpha3.LoadBalancerSpec) *LoadBalancerSpec {
+	if in == nil {
+		return nil
+	}
+	out := &LoadBalancerSpec{
+		NetworkVolume: in.NetworkVolume,
+		BalancingType: in.BalancingType,
+	}
+	if in.HealthCheck != nil {
+		hc := LoadBalancerHealthCheck(*in.HealthCheck)
+		out.HealthCheck = &hc
+	}
+	return out
+}
+
+func convertNetworkToHub(in Network) infrav1alpha3.Network {
+	out := infrav1alpha3.Network{}
+	if in.SecurityGroups != nil {
+		out.SecurityGroups = make(map[infrav1alpha3.SecurityGroupRole]infrav1alpha3.SecurityGroup, len(in.SecurityGroups))
+		for role, sg := range in.SecurityGroups {
+			out.SecurityGroups[infrav1alpha3.SecurityGroupRole(role)] = infrav1alpha3.SecurityGroup{
+				ID:           sg.ID,
+				Name:         sg.Name,
+				IngressRules: convertIngressRulesToHub(sg.IngressRules),
+			}
+		}
+	}
+	if lb := in.APIServerLoadBalancer; lb != nil {
+		out.APIServerLoadBalancer = &infrav1alpha3.LoadBalancer{
+			Name:        lb.Name,
+			DNSName:     lb.DNSName,
+			Port:        lb.Port,
+			HealthCheck: infrav1alpha3.LoadBalancerHealthCheck(lb.HealthCheck),
+			Instances:   lb.Instances,
+		}
+	}
+	if lan := in.PrivateLAN; lan != nil {
+		out.PrivateLAN = &infrav1alpha3.PrivateLAN{
+			ID:        lan.ID,
+			Name:      lan.Name,
+			CidrBlock: lan.CidrBlock,
+			Zone:      lan.Zone,
+			State:     lan.State,
+		}
+	}
+	if in.Router != nil {
+		router := infrav1alpha3.Router(*in.Router)
+		out.Router = &router
+	}
+	return out
+}
+
+func convertNetworkFromHub(in infrav1alpha3.Network) Network {
+	out := Network{}
+	if in.SecurityGroups != nil {
+		out.SecurityGroups = make(map[SecurityGroupRole]SecurityGroup, len(in.SecurityGroups))
+		for role, sg := range in.SecurityGroups {
+			out.SecurityGroups[SecurityGroupRole(role)] = SecurityGroup{
+				ID:           sg.ID,
+				Name:         sg.Name,
+				IngressRules: convertIngressRulesFromHub(sg.IngressRules),
+			}
+		}
+	}
+	if lb := in.APIServerLoadBalancer; lb != nil {
+		out.APIServerLoadBalancer = &LoadBalancer{
+			Name:        lb.Name,
+			DNSName:     lb.DNSName,
+			Port:        lb.Port,
+			HealthCheck: LoadBalancerHealthCheck(lb.HealthCheck),
+			Instances:   lb.Instances,
+		}
+	}
+	if lan := in.PrivateLAN; lan != nil {
+		out.PrivateLAN = &PrivateLAN{
+			ID:        lan.ID,
+			Name:      lan.Name,
+			CidrBlock: lan.CidrBlock,
+			Zone:      lan.Zone,
+			State:     lan.State,
+		}
+	}
+	if in.Router != nil {
+		router := Router(*in.Router)
+		out.Router = &router
+	}
+	return out
+}
+
+func convertIngressRulesToHub(in IngressRules) infrav1alpha3.IngressRules {
+	if in == nil {
+		return nil
+	}
+	out := make(infrav1alpha3.IngressRules, 0, len(in))
+	for _, r := range in {
+		if r == nil {
+			continue
+		}
+		out = append(out, &infrav1alpha3.IngressRule{
+			ID:                      r.ID,
+			Name:                    r.Name,
+			Description:             r.Description,
+			Protocol:                infrav1alpha3.SecurityGroupProtocol(r.Protocol),
+			FromPort:                r.FromPort,
+			ToPort:                  r.ToPort,
+			CidrBlocks:              r.CidrBlocks,
+			SourceSecurityGroupName: r.SourceSecurityGroupName,
+		})
+	}
+	return out
+}
+
+func convertIngressRulesFromHub(in infrav1alpha3.IngressRules) IngressRules {
+	if in == nil {
+		return nil
+	}
+	out := make(IngressRules, 0, len(in))
+	for _, r := range in {
+		if r == nil {
+			continue
+		}
+		out = append(out, &IngressRule{
+			ID:                      r.ID,
+			Name:                    r.Name,
+			Description:             r.Description,
+			Protocol:                SecurityGroupProtocol(r.Protocol),
+			FromPort:                r.FromPort,
+			ToPort:                  r.ToPort,
+			CidrBlocks:              r.CidrBlocks,
+			SourceSecurityGroupName: r.SourceSecurityGroupName,
+		})
+	}
+	return out
+}
+
+func convertInstanceToHub(in *Instance) *infrav1alpha3.Instance {
+	if in == nil {
+		return nil
+	}
+	return &infrav1alpha3.Instance{
+		UID:               in.UID,
+		ID:                in.ID,
+		Zone:              in.Zone,
+		State:             infrav1alpha3.InstanceState(in.State),
+		Type:              in.Type,
+		ImageID:           in.ImageID,
+		UserData:          in.UserData,
+		SecurityGroups:    in.SecurityGroups,
+		SSHKeyName:        in.SSHKeyName,
+		Tag:               infrav1alpha3.Tag(in.Tag),
+		PublicIP:          in.PublicIP,
+		PrivateIP:         in.PrivateIP,
+		Addresses:         in.Addresses,
+		NetworkInterfaces: in.NetworkInterfaces,
+	}
+}
+
+func convertInstanceFromHub(in *infrav1alpha3.Instance) *Instance {
+	if in == nil {
+		return nil
+	}
+	return &Instance{
+		UID:               in.UID,
+		ID:                in.ID,
+		Zone:              in.Zone,
+		State:             InstanceState(in.State),
+		Type:              in.Type,
+		ImageID:           in.ImageID,
+		UserData:          in.UserData,
+		SecurityGroups:    in.SecurityGroups,
+		SSHKeyName:        in.SSHKeyName,
+		Tag:               Tag(in.Tag),
+		PublicIP:          in.PublicIP,
+		PrivateIP:         in.PrivateIP,
+		Addresses:         in.Addresses,
+		NetworkInterfaces: in.NetworkInterfaces,
+	}
+}
@@ -0,0 +1,296 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/cluster-api/errors"
+)
+
+func TestNifcloudClusterConversion(t *testing.T) {
+	src := &NifcloudCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+		Spec: NifcloudClusterSpec{
+			Zone:       "east-11",
+			Region:     "jp-east-1",
+			SSHKeyName: "key",
+			NetworkSpec: NetworkSpec{
+				PrivateLAN: &PrivateLANSpec{
+					CidrBlock: "192.168.0.0/24",
+					Router: &RouterSpec{
+						IPAddress: "192.168.0.1",
+						DHCP:      &DHCPSpec{StartIPAddress: "192.168.0.100", StopIPAddress: "192.168.0.200"},
+					},
+				},
+			},
+			ControlPlaneLoadBalancer: &LoadBalancerSpec{
+				NetworkVolume: 10,
+				HealthCheck:   &LoadBalancerHealthCheck{Target: "TCP:6443", Interval: 10},
+			},
+		},
+		Status: NifcloudClusterStatus{
+			Ready: true,
+			Network: Network{
+				SecurityGroups: map[SecurityGroupRole]SecurityGroup{
+					SecurityGroupControlPlane: {
+						ID:   "fw1",
+						Name: "fw1",
+						IngressRules: IngressRules{
+							{Protocol: SecurityGroupProtocolTCP, FromPort: 6443, ToPort: 6443, CidrBlocks: []string{"0.0.0.0/0"}},
+						},
+					},
+				},
+				APIServerLoadBalancer: &LoadBalancer{Name: "lb", DNSName: "203.0.113.1", Port: 6443, Instances: []string{"i1"}},
+				PrivateLAN:            &PrivateLAN{ID: "net-0001", Name: "lan"},
+				Router:                &Router{ID: "rtr-0001", Name: "router"},
+			},
+			Bastion:      &Instance{ID: "bastion", State: InstanceRunning, Tag: Tag{"role": "bastion"}},
+			APIEndpoints: []APIEndpoint{{Host: "203.0.113.1", Port: 6443}},
+			ErrorReason:  "reason",
+			ErrorMessage: "message",
+		},
+	}
+
+	hub := &infrav1alpha3.NifcloudCluster{}
+	if err := src.ConvertTo(hub); err != nil {
+		t.Fatal(err)
+	}
+	if want := (infrav1alpha3.APIEndpoint{Host: "203.0.113.1", Port: 6443}); hub.Spec.ControlPlaneEndpoint != want {
+		t.Errorf("got endpoint[%+v], want[%+v]", hub.Spec.ControlPlaneEndpoint, want)
+	}
+	if hub.Status.FailureReason != "reason" || hub.Status.FailureMessage != "message" {
+		t.Errorf("failure is not converted: %+v", hub.Status)
+	}
+
+	dst := &NifcloudCluster{}
+	if err := dst.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	delete(dst.Annotations, ConversionDataAnnotation)
+	if len(dst.Annotations) == 0 {
+		dst.Annotations = nil
+	}
+	if !cmp.Equal(src, dst) {
+		t.Errorf("round trip mismatch (-want +got):\n%s", cmp.Diff(src, dst))
+	}
+}
+
+func TestNifcloudClusterConversionRestoresHubFields(t *testing.T) {
+	hub := &infrav1alpha3.NifcloudCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "test-cluster",
+			Namespace:   "default",
+			Annotations: map[string]string{"foo": "bar"},
+		},
+		Spec: infrav1alpha3.NifcloudClusterSpec{
+			Zone:                 "east-11",
+			ControlPlaneEndpoint: infrav1alpha3.APIEndpoint{Host: "203.0.113.1", Port: 6443},
+			IngressRules: map[infrav1alpha3.SecurityGroupRole]infrav1alpha3.IngressRules{
+				infrav1alpha3.SecurityGroupControlPlane: {
+					{Protocol: infrav1alpha3.SecurityGroupProtocolTCP, FromPort: 22, ToPort: 22, CidrBlocks: []string{"198.51.100.0/24"}},
+				},
+			},
+			AllowControllerIP: true,
+			SSHKey:            &infrav1alpha3.SSHKeySpec{SecretRef: &infrav1alpha3.SSHKeySecretReference{Name: "ssh-key"}},
+			NetworkSpec: infrav1alpha3.NetworkSpec{
+				PrivateLAN:             &infrav1alpha3.PrivateLANSpec{ID: "net-0001"},
+				SecurityGroupOverrides: map[infrav1alpha3.SecurityGroupRole]string{infrav1alpha3.SecurityGroupNode: "existing"},
+			},
+			ControlPlaneLoadBalancer: &infrav1alpha3.LoadBalancerSpec{Name: "existinglb"},
+		},
+		Status: infrav1alpha3.NifcloudClusterStatus{
+			Ready:       true,
+			KeyPairName: "capi0123456789abcdef",
+			Network: infrav1alpha3.Network{
+				SecurityGroups: map[infrav1alpha3.SecurityGroupRole]infrav1alpha3.SecurityGroup{
+					infrav1alpha3.SecurityGroupNode: {ID: "owner", Name: "existing", Unmanaged: true},
+				},
+				PrivateLAN:            &infrav1alpha3.PrivateLAN{ID: "net-0001", Name: "existing", Unmanaged: true},
+				APIServerLoadBalancer: &infrav1alpha3.LoadBalancer{Name: "existinglb", Port: 6443, Unmanaged: true},
+			},
+			Conditions: infrav1alpha3.Conditions{
+				{
+					Type:               infrav1alpha3.SecurityGroupsReadyCondition,
+					Status:             corev1.ConditionFalse,
+					Severity:           infrav1alpha3.ConditionSeverityError,
+					LastTransitionTime: metav1.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC),
+					Reason:             infrav1alpha3.IngressRulesAuthorizationFailedReason,
+					Message:            "failed",
+				},
+			},
+		},
+	}
+
+	spoke := &NifcloudCluster{}
+	if err := spoke.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := hub.Annotations[ConversionDataAnnotation]; ok {
+		t.Error("conversion data is written to the hub object")
+	}
+
+	restored := &infrav1alpha3.NifcloudCluster{}
+	if err := spoke.ConvertTo(restored); err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(hub, restored) {
+		t.Errorf("round trip mismatch (-want +got):\n%s", cmp.Diff(hub, restored))
+	}
+}
+
+func TestNifcloudMachineConversion(t *testing.T) {
+	state := InstanceRunning
+	reason := errors.CreateMachineError
+	src := &NifcloudMachine{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-machine", Namespace: "default"},
+		Spec: NifcloudMachineSpec{
+			ProviderID:        pointer.StringPtr("nifcloud:////uid"),
+			ImageID:           "image",
+			AvailabilityZone:  pointer.StringPtr("east-11"),
+			InstanceType:      "medium",
+			PublicType:        PublicTypePrivate,
+			NetworkInterfaces: []string{"net-0001"},
+			BootstrapDelivery: BootstrapDeliverySCP,
+		},
+		Status: NifcloudMachineStatus{
+			Ready:             true,
+			Address:           []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "192.168.0.10"}},
+			InstanceState:     &state,
+			SendBootstrap:     true,
+			BootstrapDelivery: BootstrapDeliverySCP,
+			ErrorReason:       &reason,
+			ErrorMessage:      pointer.StringPtr("message"),
+		},
+	}
+
+	hub := &infrav1alpha3.NifcloudMachine{}
+	if err := src.ConvertTo(hub); err != nil {
+		t.Fatal(err)
+	}
+	if len(hub.Status.Addresses) != 1 || hub.Status.FailureReason == nil || *hub.Status.FailureReason != reason {
+		t.Errorf("status is not converted: %+v", hub.Status)
+	}
+
+	dst := &NifcloudMachine{}
+	if err := dst.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	delete(dst.Annotations, ConversionDataAnnotation)
+	if len(dst.Annotations) == 0 {
+		dst.Annotations = nil
+	}
+	if !cmp.Equal(src, dst) {
+		t.Errorf("round trip mismatch (-want +got):\n%s", cmp.Diff(src, dst))
+	}
+}
+
+func TestNifcloudMachineConversionRestoresHubFields(t *testing.T) {
+	hub := &infrav1alpha3.NifcloudMachine{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-machine", Namespace: "default"},
+		Spec: infrav1alpha3.NifcloudMachineSpec{
+			InstanceType: "medium",
+			ImageLookup:  &infrav1alpha3.ImageLookup{NamePattern: "k8s-{{.KubernetesVersion}}", OSFamily: "ubuntu"},
+			Volumes:      []infrav1alpha3.Volume{{Name: "etcd", Size: 100, Purpose: infrav1alpha3.VolumePurposeEtcd, Retain: true}},
+		},
+		Status: infrav1alpha3.NifcloudMachineStatus{
+			Ready:                        true,
+			ControlPlaneEndpointAttached: true,
+			ImageID:                      "55395",
+			Volumes:                      []infrav1alpha3.VolumeStatus{{Name: "etcd", ID: "vol001", Status: "in-use", Device: "SCSI (0:1)"}},
+			Conditions: infrav1alpha3.Conditions{
+				{
+					Type:               infrav1alpha3.InstanceReadyCondition,
+					Status:             corev1.ConditionTrue,
+					LastTransitionTime: metav1.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC),
+				},
+			},
+		},
+	}
+
+	spoke := &NifcloudMachine{}
+	if err := spoke.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	restored := &infrav1alpha3.NifcloudMachine{}
+	if err := spoke.ConvertTo(restored); err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(hub, restored) {
+		t.Errorf("round trip mismatch (-want +got):\n%s", cmp.Diff(hub, restored))
+	}
+}
+
+func TestNifcloudMachineTemplateConversion(t *testing.T) {
+	src := &NifcloudMachineTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-template", Namespace: "default"},
+		Spec: NifcloudMachineTemplateSpec{
+			Template: NifcloudMachineTemplateResource{
+				Spec: NifcloudMachineSpec{ImageID: "image", InstanceType: "large", KeyName: "key"},
+			},
+		},
+	}
+
+	hub := &infrav1alpha3.NifcloudMachineTemplate{}
+	if err := src.ConvertTo(hub); err != nil {
+		t.Fatal(err)
+	}
+	dst := &NifcloudMachineTemplate{}
+	if err := dst.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	delete(dst.Annotations, ConversionDataAnnotation)
+	if len(dst.Annotations) == 0 {
+		dst.Annotations = nil
+	}
+	if !cmp.Equal(src, dst) {
+		t.Errorf("round trip mismatch (-want +got):\n%s", cmp.Diff(src, dst))
+	}
+}
+
+func TestNifcloudMachineTemplateConversionRestoresHubFields(t *testing.T) {
+	hub := &infrav1alpha3.NifcloudMachineTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-template", Namespace: "default"},
+		Spec: infrav1alpha3.NifcloudMachineTemplateSpec{
+			Template: infrav1alpha3.NifcloudMachineTemplateResource{
+				Spec: infrav1alpha3.NifcloudMachineSpec{
+					InstanceType: "large",
+					ImageLookup:  &infrav1alpha3.ImageLookup{Owner: "self"},
+					Volumes:      []infrav1alpha3.Volume{{Name: "docker", Size: 200, DiskType: "2", Purpose: infrav1alpha3.VolumePurposeContainerRuntime}},
+				},
+			},
+		},
+	}
+
+	spoke := &NifcloudMachineTemplate{}
+	if err := spoke.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	restored := &infrav1alpha3.NifcloudMachineTemplate{}
+	if err := spoke.ConvertTo(restored); err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(hub, restored) {
+		t.Errorf("round trip mismatch (-want +got):\n%s", cmp.Diff(hub, restored))
+	}
+}
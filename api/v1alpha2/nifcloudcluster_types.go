@@ -40,6 +40,11 @@ type NifcloudClusterSpec struct {
 
 	// SSHKeyName is the name of ssh key to attach to the bastion
 	SSHKeyName string `json:"sshKeyName,omitempty"`
+
+	// ControlPlaneLoadBalancer is a load balancer in front of the control plane API endpoint
+	// when it is not set, a public IP is associated to one of control plane instances
+	// +optional
+	ControlPlaneLoadBalancer *LoadBalancerSpec `json:"controlPlaneLoadBalancer,omitempty"`
 }
 
 // NifcloudClusterStatus defines the observed state of NifcloudCluster
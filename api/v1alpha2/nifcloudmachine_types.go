@@ -49,14 +49,24 @@ type NifcloudMachineSpec struct {
 	InstanceType string `json:"instanceType,omitempty"`
 
 	// PublicType specifies whether this machine get public IP address or not
+	// "private" machine must not be connected to the common global network
 	// +optional
-	PublicType string `json:"publicType,omitempty"`
+	// +kubebuilder:validation:Enum=public;private
+	PublicType PublicType `json:"publicType,omitempty"`
 
 	// NetworkInterfaces is a list of nifcloud networkInterfaceSet
 	// max 2 entry : public,private
+	// public is net-COMMON_GLOBAL, private is net-COMMON_PRIVATE or a private LAN
 	// +optional
 	// +kubebuilder:validation:MaxItems=2
 	NetworkInterfaces []string `json:"networkInterfaces,omitempty"`
+
+	// BootstrapDelivery specifies how bootstrap data is delivered to this machine
+	// "userdata" (default) embeds it in the instance userdata,
+	// "scp" copies it over SSH from the controller after the instance is running
+	// +optional
+	// +kubebuilder:validation:Enum=userdata;scp
+	BootstrapDelivery BootstrapDelivery `json:"bootstrapDelivery,omitempty"`
 }
 
 // NifcloudMachineStatus defines the observed state of NifcloudMachine
@@ -73,6 +83,10 @@ type NifcloudMachineStatus struct {
 	// Bootstrap data has been sended to server
 	SendBootstrap bool `json:"sendBootstrap,omitempty"`
 
+	// BootstrapDelivery is the delivery path actually used to send bootstrap data
+	// +optional
+	BootstrapDelivery BootstrapDelivery `json:"bootstrapDelivery,omitempty"`
+
 	// +optional
 	ErrorReason *errors.MachineStatusError `json:"errorReason,omitempty"`
 	// +optional
@@ -0,0 +1,56 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NifcloudMachineTemplateSpec defines the desired state of NifcloudMachineTemplate
+type NifcloudMachineTemplateSpec struct {
+	Template NifcloudMachineTemplateResource `json:"template"`
+}
+
+// NifcloudMachineTemplateResource describes the data needed to create a NifcloudMachine from a template
+type NifcloudMachineTemplateResource struct {
+	// Spec is the specification of the desired behavior of the machine
+	Spec NifcloudMachineSpec `json:"spec"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=nifcloudmachinetemplates,scope=Namespaced,categories=cluster-api
+
+// NifcloudMachineTemplate is the Schema for the nifcloudmachinetemplates API
+type NifcloudMachineTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec NifcloudMachineTemplateSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// NifcloudMachineTemplateList contains a list of NifcloudMachineTemplate
+type NifcloudMachineTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []NifcloudMachineTemplate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&NifcloudMachineTemplate{}, &NifcloudMachineTemplateList{})
+}
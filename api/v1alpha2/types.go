@@ -34,9 +34,153 @@ type APIEndpoint struct {
 type Network struct {
 	// SecurityGroups is a map from a name of role/kind to spesific role filewall
 	SecurityGroups map[SecurityGroupRole]SecurityGroup `json:"securityGroups,omitempty"`
+
+	// APIServerLoadBalancer is the load balancer in front of control plane instances
+	// +optional
+	APIServerLoadBalancer *LoadBalancer `json:"apiServerLoadBalancer,omitempty"`
+
+	// PrivateLAN is the private LAN of the cluster
+	// +optional
+	PrivateLAN *PrivateLAN `json:"privateLAN,omitempty"`
+
+	// Router is the router of the private LAN
+	// +optional
+	Router *Router `json:"router,omitempty"`
 }
 
 type NetworkSpec struct {
+	// PrivateLAN is a managed private LAN which every machine of the cluster is connected to
+	// +optional
+	PrivateLAN *PrivateLANSpec `json:"privateLAN,omitempty"`
+}
+
+// PrivateLANSpec defines the desired state of nifcloud private LAN
+type PrivateLANSpec struct {
+	// CidrBlock is an address range of the private LAN
+	CidrBlock string `json:"cidrBlock"`
+
+	// Zone is a nifcloud zone which the private LAN lives on
+	// defaults to the zone of the cluster
+	// +optional
+	Zone string `json:"zone,omitempty"`
+
+	// Router connects the private LAN to the internet and serves DHCP
+	// +optional
+	Router *RouterSpec `json:"router,omitempty"`
+}
+
+// RouterSpec defines the desired state of nifcloud router
+type RouterSpec struct {
+	// Type is a size of the router
+	// +optional
+	// +kubebuilder:validation:Enum=small;medium;large
+	Type string `json:"type,omitempty"`
+
+	// IPAddress is an address of the router in the private LAN
+	IPAddress string `json:"ipAddress"`
+
+	// DHCP configures a DHCP server on the private LAN side of the router
+	// +optional
+	DHCP *DHCPSpec `json:"dhcp,omitempty"`
+}
+
+// DHCPSpec defines a DHCP address pool served by the router
+type DHCPSpec struct {
+	// StartIPAddress is the first address leased to machines
+	StartIPAddress string `json:"startIPAddress"`
+
+	// StopIPAddress is the last address leased to machines
+	StopIPAddress string `json:"stopIPAddress"`
+}
+
+// PrivateLAN defines nifcloud private LAN
+type PrivateLAN struct {
+	// ID is a network id of the private LAN
+	ID string `json:"id"`
+
+	// Name is a name of the private LAN
+	Name string `json:"name"`
+
+	// CidrBlock is an address range of the private LAN
+	CidrBlock string `json:"cidrBlock,omitempty"`
+
+	// Zone is a nifcloud zone which the private LAN lives on
+	Zone string `json:"zone,omitempty"`
+
+	// State is current state of the private LAN
+	State string `json:"state,omitempty"`
+}
+
+// Router defines nifcloud router
+type Router struct {
+	// ID is an identifier of the router
+	ID string `json:"id"`
+
+	// Name is a name of the router
+	Name string `json:"name"`
+
+	// State is current state of the router
+	State string `json:"state,omitempty"`
+
+	// DHCPConfigID is an identifier of the DHCP config attached to the router
+	// +optional
+	DHCPConfigID string `json:"dhcpConfigID,omitempty"`
+}
+
+// LoadBalancerSpec defines the desired state of nifcloud load balancer
+type LoadBalancerSpec struct {
+	// NetworkVolume is a bandwidth of the load balancer in Mbps
+	// +optional
+	// +kubebuilder:validation:Enum=10;20;30;40;100;200;300;400;500;600;700;800;900;1000;1500;2000
+	NetworkVolume int64 `json:"networkVolume,omitempty"`
+
+	// BalancingType is a balancing algorithm, 1: round robin, 2: least connection
+	// +optional
+	// +kubebuilder:validation:Enum=1;2
+	BalancingType int64 `json:"balancingType,omitempty"`
+
+	// HealthCheck configures how the load balancer checks control plane instances
+	// +optional
+	HealthCheck *LoadBalancerHealthCheck `json:"healthCheck,omitempty"`
+}
+
+// LoadBalancerHealthCheck defines the health check of nifcloud load balancer
+type LoadBalancerHealthCheck struct {
+	// Target is a protocol and port to check such as "TCP:6443"
+	// +optional
+	Target string `json:"target,omitempty"`
+
+	// Interval is a period of the check in seconds
+	// +optional
+	// +kubebuilder:validation:Minimum=5
+	// +kubebuilder:validation:Maximum=300
+	Interval int64 `json:"interval,omitempty"`
+
+	// UnhealthyThreshold is a count of failures to mark the instance unhealthy
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=10
+	UnhealthyThreshold int64 `json:"unhealthyThreshold,omitempty"`
+}
+
+// LoadBalancer defines nifcloud load balancer
+type LoadBalancer struct {
+	// Name is a name of the load balancer
+	Name string `json:"name"`
+
+	// DNSName is the virtual IP address of the load balancer
+	DNSName string `json:"dnsName,omitempty"`
+
+	// Port is a port on which both the load balancer and instances listen
+	Port int64 `json:"port"`
+
+	// HealthCheck is the current health check of the load balancer
+	// +optional
+	HealthCheck LoadBalancerHealthCheck `json:"healthCheck,omitempty"`
+
+	// Instances is a list of instance ids registered with the load balancer
+	// +optional
+	Instances []string `json:"instances,omitempty"`
 }
 
 // InstanceState describes the state of an nifcloud instance.
@@ -49,6 +193,33 @@ var (
 	InstanceWaiting = InstanceState("waiting")
 )
 
+// BootstrapDelivery describes how bootstrap data is delivered to an instance.
+type BootstrapDelivery string
+
+var (
+	// bootstrap data is embedded in the instance userdata as a cloud-init document
+	BootstrapDeliveryUserData = BootstrapDelivery("userdata")
+	// bootstrap data is copied to the running instance over SSH by the controller
+	BootstrapDeliverySCP = BootstrapDelivery("scp")
+)
+
+// PublicType describes whether an instance is reachable from the internet.
+type PublicType string
+
+var (
+	// instance is connected to the common global network
+	PublicTypePublic = PublicType("public")
+	// instance is only connected to private networks
+	PublicTypePrivate = PublicType("private")
+)
+
+const (
+	// NetworkCommonGlobal is the network id of the common global network
+	NetworkCommonGlobal = "net-COMMON_GLOBAL"
+	// NetworkCommonPrivate is the network id of the common private network
+	NetworkCommonPrivate = "net-COMMON_PRIVATE"
+)
+
 // SecurityGroupRole defines the unique role of a security group.
 type SecurityGroupRole string
 
@@ -0,0 +1,129 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha3
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConditionType is the type of the condition
+type ConditionType string
+
+// ConditionSeverity expresses how serious a condition which is not True is
+type ConditionSeverity string
+
+const (
+	// ConditionSeverityError means the reconciliation failed and needs attention
+	ConditionSeverityError ConditionSeverity = "Error"
+	// ConditionSeverityWarning means the reconciliation is not progressing as expected
+	ConditionSeverityWarning ConditionSeverity = "Warning"
+	// ConditionSeverityInfo means the reconciliation is in progress
+	ConditionSeverityInfo ConditionSeverity = "Info"
+	// ConditionSeverityNone is used for the conditions which are True
+	ConditionSeverityNone ConditionSeverity = ""
+)
+
+// Condition describes an aspect of the observed state of the resource
+type Condition struct {
+	// Type of the condition in CamelCase
+	Type ConditionType `json:"type"`
+
+	// Status of the condition, one of True, False or Unknown
+	Status corev1.ConditionStatus `json:"status"`
+
+	// Severity is set only when Status is False
+	// +optional
+	Severity ConditionSeverity `json:"severity,omitempty"`
+
+	// LastTransitionTime is the last time the condition changed its status
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// Reason is the reason of the last transition in CamelCase
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Message is a human readable description of the transition
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// Conditions is a list of conditions with unique types
+type Conditions []Condition
+
+const (
+	// ReadyCondition summarizes the other conditions of the resource
+	ReadyCondition ConditionType = "Ready"
+)
+
+// conditions of NifcloudCluster
+const (
+	// SecurityGroupsReadyCondition reports the security groups are created and the ingress rules are authorized
+	SecurityGroupsReadyCondition ConditionType = "SecurityGroupsReady"
+	// SecurityGroupReconciliationFailedReason is used when the security groups cannot be described or created
+	SecurityGroupReconciliationFailedReason = "SecurityGroupReconciliationFailed"
+	// IngressRulesAuthorizationFailedReason is used when the ingress rules cannot be authorized or revoked
+	IngressRulesAuthorizationFailedReason = "IngressRulesAuthorizationFailed"
+
+	// SSHKeyReadyCondition reports the ssh key of the cluster is imported as a key pair
+	SSHKeyReadyCondition ConditionType = "SSHKeyReady"
+	// SSHKeyImportFailedReason is used when the public key cannot be read or imported
+	SSHKeyImportFailedReason = "SSHKeyImportFailed"
+
+	// EndpointReadyCondition reports the control plane endpoint is allocated
+	EndpointReadyCondition ConditionType = "EndpointReady"
+	// EndpointAllocationFailedReason is used when the address or the load balancer of the endpoint cannot be prepared
+	EndpointAllocationFailedReason = "EndpointAllocationFailed"
+)
+
+// conditions of NifcloudMachine
+const (
+	// InstanceReadyCondition reports the instance is provisioned and running
+	InstanceReadyCondition ConditionType = "InstanceReady"
+	// InstanceProvisionFailedReason is used when the instance cannot be run
+	InstanceProvisionFailedReason = "InstanceProvisionFailed"
+	// ImageNotFoundReason is used when no image matches the image lookup of the machine
+	ImageNotFoundReason = "ImageNotFound"
+	// InstanceNotReadyReason is used while the instance is in transition
+	InstanceNotReadyReason = "InstanceNotReady"
+	// InstanceStoppedReason is used when the instance is stopped unexpectedly
+	InstanceStoppedReason = "InstanceStopped"
+	// InstanceDeletingReason is used while the instance is being deleted
+	InstanceDeletingReason = "InstanceDeleting"
+
+	// AddressAssociatedCondition reports the control plane instance is reachable by the control plane endpoint,
+	// either the endpoint address is associated or the load balancer registers the instance
+	AddressAssociatedCondition ConditionType = "AddressAssociated"
+	// AddressAssociationFailedReason is used when the instance cannot be attached to the endpoint
+	AddressAssociationFailedReason = "AddressAssociationFailed"
+
+	// BootstrapDeliveredCondition reports the bootstrap data is delivered to the instance
+	BootstrapDeliveredCondition ConditionType = "BootstrapDelivered"
+	// WaitingForBootstrapDataReason is used while the bootstrap provider has not generated the data
+	WaitingForBootstrapDataReason = "WaitingForBootstrapData"
+	// WaitingForInstanceReason is used while the instance is not ready to receive the data over scp
+	WaitingForInstanceReason = "WaitingForInstance"
+	// BootstrapDeliveryFailedReason is used when sending the data over scp fails
+	BootstrapDeliveryFailedReason = "BootstrapDeliveryFailed"
+
+	// VolumesAttachedCondition reports the additional volumes are created and attached to the instance
+	VolumesAttachedCondition ConditionType = "VolumesAttached"
+	// VolumesAttachingReason is used while the volumes are being created or attached
+	VolumesAttachingReason = "VolumesAttaching"
+	// VolumeProvisionFailedReason is used when the volumes cannot be created or attached
+	VolumeProvisionFailedReason = "VolumeProvisionFailed"
+)
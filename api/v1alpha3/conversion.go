@@ -0,0 +1,35 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha3
+
+// Hub marks NifcloudCluster as a conversion hub.
+func (*NifcloudCluster) Hub() {}
+
+// Hub marks NifcloudClusterList as a conversion hub.
+func (*NifcloudClusterList) Hub() {}
+
+// Hub marks NifcloudMachine as a conversion hub.
+func (*NifcloudMachine) Hub() {}
+
+// Hub marks NifcloudMachineList as a conversion hub.
+func (*NifcloudMachineList) Hub() {}
+
+// Hub marks NifcloudMachineTemplate as a conversion hub.
+func (*NifcloudMachineTemplate) Hub() {}
+
+// Hub marks NifcloudMachineTemplateList as a conversion hub.
+func (*NifcloudMachineTemplateList) Hub() {}
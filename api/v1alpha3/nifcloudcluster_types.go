@@ -0,0 +1,138 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha3
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// Finalizer is a label to allow ReconcileCluster to clean up
+	// all resouces associated with NifcloudClustr before removing
+	// from api server
+	ClusterFinalizer = "nifcloudcluster.infrastructure.cluster.x-k8s.io"
+)
+
+// NifcloudClusterSpec defines the desired state of NifcloudCluster
+type NifcloudClusterSpec struct {
+	// NetworkSpec includes nifcloud network configurations
+	NetworkSpec NetworkSpec `json:"networkSpec,omitempty"`
+
+	// Zone is a nifcloud zone which cluster lives on
+	Zone string `json:"zone,omitempty"`
+
+	// Region ins a nifcloud region
+	Region string `json:"region,omitempty"`
+
+	// IdentityRef is a reference to the credentials of nifcloud used by this cluster,
+	// the credentials given by environment variables of the controller are used when it is not set
+	// +optional
+	IdentityRef *NifcloudIdentityReference `json:"identityRef,omitempty"`
+
+	// SSHKeyName is the name of ssh key to attach to the bastion
+	SSHKeyName string `json:"sshKeyName,omitempty"`
+
+	// SSHKey is imported as a key pair owned by the cluster, which is deleted with the cluster,
+	// the bastion and machines without their own key names use it
+	// +optional
+	SSHKey *SSHKeySpec `json:"sshKey,omitempty"`
+
+	// Bastion configures the bastion host of the cluster
+	// +optional
+	Bastion BastionSpec `json:"bastion,omitempty"`
+
+	// ControlPlaneEndpoint represents the endpoint used to communicate with the control plane
+	// +optional
+	ControlPlaneEndpoint APIEndpoint `json:"controlPlaneEndpoint"`
+
+	// ControlPlaneLoadBalancer is a load balancer in front of the control plane API endpoint
+	// when it is not set, a public IP is associated to one of control plane instances
+	// +optional
+	ControlPlaneLoadBalancer *LoadBalancerSpec `json:"controlPlaneLoadBalancer,omitempty"`
+
+	// IngressRules are ingress rules authorized to the security group of each role
+	// in addition to the rules which the controller manages
+	// +optional
+	IngressRules map[SecurityGroupRole]IngressRules `json:"ingressRules,omitempty"`
+
+	// AllowControllerIP authorizes SSH and Kubernetes API from the public IP of the controller,
+	// the IP is looked up over the internet on every reconciliation
+	// +optional
+	AllowControllerIP bool `json:"allowControllerIP,omitempty"`
+}
+
+// NifcloudClusterStatus defines the observed state of NifcloudCluster
+type NifcloudClusterStatus struct {
+	// cluster network configurations
+	Network Network `json:"network,omitempty"`
+
+	// bastion instatnce information
+	Bastion *Instance `json:"bastion,omitempty"`
+
+	// KeyPairName is the name of the key pair imported from the ssh key of the spec
+	// +optional
+	KeyPairName string `json:"keyPairName,omitempty"`
+
+	// cluster resource is ready to available or not
+	Ready bool `json:"ready,omitempty"`
+
+	// Conditions report the progress of each step of the reconciliation
+	// +optional
+	Conditions Conditions `json:"conditions,omitempty"`
+
+	// +optional
+	FailureReason string `json:"failureReason,omitempty"`
+	// +optional
+	FailureMessage string `json:"failureMessage,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=nifcloudclusters,scope=Namespaced,categories=cluster-api
+// +kubebuilder:storageversion
+// +kubebuilder:subresource:status
+
+// NifcloudCluster is the Schema for the nifcloudclusters API
+type NifcloudCluster struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   NifcloudClusterSpec   `json:"spec,omitempty"`
+	Status NifcloudClusterStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// NifcloudClusterList contains a list of NifcloudCluster
+type NifcloudClusterList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []NifcloudCluster `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&NifcloudCluster{}, &NifcloudClusterList{})
+}
+
+// GetConditions returns the conditions of the cluster
+func (c *NifcloudCluster) GetConditions() Conditions {
+	return c.Status.Conditions
+}
+
+// SetConditions replaces the conditions of the cluster
+func (c *NifcloudCluster) SetConditions(conditions Conditions) {
+	c.Status.Conditions = conditions
+}
@@ -0,0 +1,304 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha3
+
+import (
+	"net"
+	"reflect"
+
+	"golang.org/x/crypto/ssh"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+const (
+	// DefaultRegion is the region used when NifcloudCluster does not specify it
+	DefaultRegion = "jp-east-1"
+
+	// DefaultBastionInstanceType is the instance type of the bastion when it is not specified
+	DefaultBastionInstanceType = "e-small"
+)
+
+// supportedSecurityGroupRoles are the roles which can be configured in the spec
+var supportedSecurityGroupRoles = []string{string(SecurityGroupBastion), string(SecurityGroupControlPlane), string(SecurityGroupNode)}
+
+// regionZones is a list of zones in each region, the first one is used as default
+var regionZones = map[string][]string{
+	"jp-east-1": {"east-11", "east-12", "east-13", "east-14"},
+	"jp-east-2": {"jp-east-21"},
+	"jp-east-3": {"jp-east-31"},
+	"jp-east-4": {"jp-east-41"},
+	"jp-west-1": {"west-11", "west-12", "west-13"},
+	"jp-west-2": {"jp-west-21"},
+	"jp-west-3": {"jp-west-31"},
+	"us-east-1": {"us-east-11"},
+}
+
+func (r *NifcloudCluster) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// +kubebuilder:webhook:verbs=create;update,path=/mutate-infrastructure-cluster-x-k8s-io-v1alpha3-nifcloudcluster,mutating=true,failurePolicy=fail,groups=infrastructure.cluster.x-k8s.io,resources=nifcloudclusters,versions=v1alpha3,name=default.nifcloudcluster.infrastructure.cluster.x-k8s.io
+// +kubebuilder:webhook:verbs=create;update,path=/validate-infrastructure-cluster-x-k8s-io-v1alpha3-nifcloudcluster,mutating=false,failurePolicy=fail,groups=infrastructure.cluster.x-k8s.io,resources=nifcloudclusters,versions=v1alpha3,name=validation.nifcloudcluster.infrastructure.cluster.x-k8s.io
+
+var _ webhook.Defaulter = &NifcloudCluster{}
+var _ webhook.Validator = &NifcloudCluster{}
+
+// Default fills region, zone and the bastion instance type which are not specified
+func (r *NifcloudCluster) Default() {
+	if r.Spec.Region == "" {
+		r.Spec.Region = DefaultRegion
+	}
+	if zones, ok := regionZones[r.Spec.Region]; ok && r.Spec.Zone == "" {
+		r.Spec.Zone = zones[0]
+	}
+	if r.Spec.Bastion.Enabled && r.Spec.Bastion.InstanceType == "" {
+		r.Spec.Bastion.InstanceType = DefaultBastionInstanceType
+	}
+}
+
+// ValidateCreate implements webhook.Validator
+func (r *NifcloudCluster) ValidateCreate() error {
+	return r.toError(r.validateSpec())
+}
+
+// ValidateUpdate rejects changes of the fields which cannot be applied to existing resources
+func (r *NifcloudCluster) ValidateUpdate(old runtime.Object) error {
+	oldCluster, ok := old.(*NifcloudCluster)
+	if !ok {
+		return apierrors.NewBadRequest("expected a NifcloudCluster")
+	}
+
+	allErrs := r.validateSpec()
+	specPath := field.NewPath("spec")
+	// empty values are allowed to be filled by defaulting
+	if oldCluster.Spec.Region != "" && r.Spec.Region != oldCluster.Spec.Region {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("region"), "cannot be modified"))
+	}
+	if oldCluster.Spec.Zone != "" && r.Spec.Zone != oldCluster.Spec.Zone {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("zone"), "cannot be modified"))
+	}
+	if !reflect.DeepEqual(r.Spec.NetworkSpec, oldCluster.Spec.NetworkSpec) {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("networkSpec"), "cannot be modified"))
+	}
+	// health check can be updated, but the endpoint cannot be switched
+	if (r.Spec.ControlPlaneLoadBalancer == nil) != (oldCluster.Spec.ControlPlaneLoadBalancer == nil) {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("controlPlaneLoadBalancer"), "cannot be added or removed"))
+	} else if r.Spec.ControlPlaneLoadBalancer != nil && r.Spec.ControlPlaneLoadBalancer.Name != oldCluster.Spec.ControlPlaneLoadBalancer.Name {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("controlPlaneLoadBalancer", "name"), "cannot be modified"))
+	}
+	// the key pair is imported once, instances keep the key they are created with
+	if !reflect.DeepEqual(r.Spec.SSHKey, oldCluster.Spec.SSHKey) {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("sshKey"), "cannot be modified"))
+	}
+	// the endpoint is filled by the controller once, machines have already joined to it
+	if !oldCluster.Spec.ControlPlaneEndpoint.IsZero() && r.Spec.ControlPlaneEndpoint != oldCluster.Spec.ControlPlaneEndpoint {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("controlPlaneEndpoint"), "cannot be modified"))
+	}
+
+	return r.toError(allErrs)
+}
+
+// ValidateDelete implements webhook.Validator
+func (r *NifcloudCluster) ValidateDelete() error {
+	return nil
+}
+
+func (r *NifcloudCluster) validateSpec() field.ErrorList {
+	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	// reject only the zone which is known to be in another region
+	for region, zones := range regionZones {
+		if region != r.Spec.Region && contains(zones, r.Spec.Zone) {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("zone"), r.Spec.Zone, "zone belongs to region "+region))
+		}
+	}
+
+	networkPath := specPath.Child("networkSpec")
+	if lan := r.Spec.NetworkSpec.PrivateLAN; lan != nil {
+		allErrs = append(allErrs, lan.validate(networkPath.Child("privateLAN"))...)
+	}
+	if ip := r.Spec.NetworkSpec.EndpointIP; ip != "" {
+		if net.ParseIP(ip) == nil {
+			allErrs = append(allErrs, field.Invalid(networkPath.Child("endpointIP"), ip, "must be a valid IP address"))
+		}
+		if r.Spec.ControlPlaneLoadBalancer != nil {
+			allErrs = append(allErrs, field.Forbidden(networkPath.Child("endpointIP"), "cannot be used with controlPlaneLoadBalancer"))
+		}
+	}
+	for role, name := range r.Spec.NetworkSpec.SecurityGroupOverrides {
+		overridePath := networkPath.Child("securityGroupOverrides").Key(string(role))
+		if !contains(supportedSecurityGroupRoles, string(role)) {
+			allErrs = append(allErrs, field.NotSupported(overridePath, role, supportedSecurityGroupRoles))
+			continue
+		}
+		if name == "" {
+			allErrs = append(allErrs, field.Required(overridePath, "name of the security group must be specified"))
+		}
+	}
+
+	if lb := r.Spec.ControlPlaneLoadBalancer; lb != nil && lb.Name != "" {
+		// the existing load balancer is used as-is
+		if lb.NetworkVolume != 0 || lb.BalancingType != 0 || lb.HealthCheck != nil {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("controlPlaneLoadBalancer"),
+				"networkVolume, balancingType and healthCheck cannot be configured for an existing load balancer"))
+		}
+	}
+
+	if ref := r.Spec.IdentityRef; ref != nil {
+		refPath := specPath.Child("identityRef")
+		switch ref.Kind {
+		case IdentityKindSecret, IdentityKindClusterIdentity:
+		default:
+			allErrs = append(allErrs, field.NotSupported(refPath.Child("kind"), ref.Kind,
+				[]string{string(IdentityKindSecret), string(IdentityKindClusterIdentity)}))
+		}
+		if ref.Name == "" {
+			allErrs = append(allErrs, field.Required(refPath.Child("name"), "name of the identity must be specified"))
+		}
+	}
+
+	if key := r.Spec.SSHKey; key != nil {
+		keyPath := specPath.Child("sshKey")
+		switch {
+		case key.PublicKey == "" && key.SecretRef == nil:
+			allErrs = append(allErrs, field.Required(keyPath, "either publicKey or secretRef must be specified"))
+		case key.PublicKey != "" && key.SecretRef != nil:
+			allErrs = append(allErrs, field.Forbidden(keyPath, "publicKey and secretRef cannot be specified together"))
+		case key.PublicKey != "":
+			if _, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key.PublicKey)); err != nil {
+				allErrs = append(allErrs, field.Invalid(keyPath.Child("publicKey"), key.PublicKey, "must be a public key in the authorized_keys format"))
+			}
+		case key.SecretRef.Name == "":
+			allErrs = append(allErrs, field.Required(keyPath.Child("secretRef", "name"), "name of the secret must be specified"))
+		}
+	}
+
+	bastionPath := specPath.Child("bastion")
+	if r.Spec.Bastion.Enabled && r.Spec.Bastion.ImageID == "" {
+		allErrs = append(allErrs, field.Required(bastionPath.Child("imageID"), "image of the bastion must be specified"))
+	}
+	for i, cidr := range r.Spec.Bastion.AllowedCIDRBlocks {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			allErrs = append(allErrs, field.Invalid(bastionPath.Child("allowedCIDRBlocks").Index(i), cidr, "must be a valid CIDR block"))
+		}
+	}
+
+	rulesPath := specPath.Child("ingressRules")
+	for role, rules := range r.Spec.IngressRules {
+		if !contains(supportedSecurityGroupRoles, string(role)) {
+			allErrs = append(allErrs, field.NotSupported(rulesPath.Key(string(role)), role, supportedSecurityGroupRoles))
+			continue
+		}
+		for i, rule := range rules {
+			if rule == nil {
+				allErrs = append(allErrs, field.Required(rulesPath.Key(string(role)).Index(i), "rule must not be null"))
+				continue
+			}
+			allErrs = append(allErrs, rule.validate(rulesPath.Key(string(role)).Index(i))...)
+		}
+	}
+
+	return allErrs
+}
+
+func (r *NifcloudCluster) toError(allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("NifcloudCluster").GroupKind(), r.Name, allErrs)
+}
+
+// validate checks the addresses of the router and DHCP are in the private LAN
+func (s *PrivateLANSpec) validate(path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	// the address range of the existing private LAN is only needed to place the router
+	if s.ID != "" && s.CidrBlock == "" {
+		if s.Router != nil {
+			allErrs = append(allErrs, field.Required(path.Child("cidrBlock"), "must be specified to create a router"))
+		}
+		return allErrs
+	}
+
+	_, cidr, err := net.ParseCIDR(s.CidrBlock)
+	if err != nil {
+		return append(allErrs, field.Invalid(path.Child("cidrBlock"), s.CidrBlock, "must be a valid CIDR block"))
+	}
+	if s.Router == nil {
+		return allErrs
+	}
+
+	routerPath := path.Child("router")
+	if ip := net.ParseIP(s.Router.IPAddress); ip == nil || !cidr.Contains(ip) {
+		allErrs = append(allErrs, field.Invalid(routerPath.Child("ipAddress"), s.Router.IPAddress, "must be an address in cidrBlock"))
+	}
+	if s.Router.DHCP != nil {
+		dhcpPath := routerPath.Child("dhcp")
+		if ip := net.ParseIP(s.Router.DHCP.StartIPAddress); ip == nil || !cidr.Contains(ip) {
+			allErrs = append(allErrs, field.Invalid(dhcpPath.Child("startIPAddress"), s.Router.DHCP.StartIPAddress, "must be an address in cidrBlock"))
+		}
+		if ip := net.ParseIP(s.Router.DHCP.StopIPAddress); ip == nil || !cidr.Contains(ip) {
+			allErrs = append(allErrs, field.Invalid(dhcpPath.Child("stopIPAddress"), s.Router.DHCP.StopIPAddress, "must be an address in cidrBlock"))
+		}
+	}
+	return allErrs
+}
+
+// validate checks the port range and the sources of the rule
+func (i *IngressRule) validate(path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	switch i.Protocol {
+	case SecurityGroupProtocolTCP, SecurityGroupProtocolUDP:
+		if i.FromPort < 1 || i.FromPort > 65535 {
+			allErrs = append(allErrs, field.Invalid(path.Child("fromPort"), i.FromPort, "must be between 1 and 65535"))
+		}
+		if i.ToPort < i.FromPort || i.ToPort > 65535 {
+			allErrs = append(allErrs, field.Invalid(path.Child("toPort"), i.ToPort, "must be between fromPort and 65535"))
+		}
+	case SecurityGroupProtocolAny:
+	default:
+		allErrs = append(allErrs, field.NotSupported(path.Child("protocol"), i.Protocol,
+			[]string{string(SecurityGroupProtocolAny), string(SecurityGroupProtocolTCP), string(SecurityGroupProtocolUDP)}))
+	}
+
+	if len(i.CidrBlocks) == 0 && len(i.SourceSecurityGroupName) == 0 {
+		allErrs = append(allErrs, field.Required(path, "either cidrBlocks or sourceSecurityGroupName must be specified"))
+	}
+	for j, cidr := range i.CidrBlocks {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			allErrs = append(allErrs, field.Invalid(path.Child("cidrBlocks").Index(j), cidr, "must be a valid CIDR block"))
+		}
+	}
+	return allErrs
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
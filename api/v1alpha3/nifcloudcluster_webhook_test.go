@@ -0,0 +1,322 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1alpha3
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testPublicKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAILNuZbHsU2Yywz610ov4KhgmVxcbjcRFbPvpn2nEpt7k capi@example.com"
+
+func TestNifcloudCluster_Default(t *testing.T) {
+	cases := []struct {
+		name string
+		in   NifcloudClusterSpec
+		want NifcloudClusterSpec
+	}{
+		{
+			name: "empty spec",
+			in:   NifcloudClusterSpec{},
+			want: NifcloudClusterSpec{Region: "jp-east-1", Zone: "east-11"},
+		},
+		{
+			name: "zone of specified region",
+			in:   NifcloudClusterSpec{Region: "jp-west-1"},
+			want: NifcloudClusterSpec{Region: "jp-west-1", Zone: "west-11"},
+		},
+		{
+			name: "keep specified zone",
+			in:   NifcloudClusterSpec{Region: "jp-east-1", Zone: "east-13"},
+			want: NifcloudClusterSpec{Region: "jp-east-1", Zone: "east-13"},
+		},
+		{
+			name: "instance type of enabled bastion",
+			in:   NifcloudClusterSpec{Bastion: BastionSpec{Enabled: true}},
+			want: NifcloudClusterSpec{Region: "jp-east-1", Zone: "east-11", Bastion: BastionSpec{Enabled: true, InstanceType: DefaultBastionInstanceType}},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &NifcloudCluster{Spec: tt.in}
+			c.Default()
+			if !cmp.Equal(c.Spec, tt.want) {
+				t.Errorf("got[%+v], want[%+v]", c.Spec, tt.want)
+			}
+		})
+	}
+}
+
+func TestNifcloudCluster_ValidateCreate(t *testing.T) {
+	privateLAN := func(cidr, router, start, stop string) NetworkSpec {
+		return NetworkSpec{
+			PrivateLAN: &PrivateLANSpec{
+				CidrBlock: cidr,
+				Router: &RouterSpec{
+					IPAddress: router,
+					DHCP:      &DHCPSpec{StartIPAddress: start, StopIPAddress: stop},
+				},
+			},
+		}
+	}
+
+	ingressRules := func(role SecurityGroupRole, rules ...*IngressRule) NifcloudClusterSpec {
+		return NifcloudClusterSpec{IngressRules: map[SecurityGroupRole]IngressRules{role: rules}}
+	}
+
+	cases := []struct {
+		name    string
+		spec    NifcloudClusterSpec
+		wantErr bool
+	}{
+		{
+			name: "valid private LAN",
+			spec: NifcloudClusterSpec{
+				Region:      "jp-east-1",
+				Zone:        "east-11",
+				NetworkSpec: privateLAN("192.168.0.0/24", "192.168.0.1", "192.168.0.100", "192.168.0.200"),
+			},
+		},
+		{
+			name:    "zone in another region",
+			spec:    NifcloudClusterSpec{Region: "jp-east-1", Zone: "west-11"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid cidr block",
+			spec:    NifcloudClusterSpec{NetworkSpec: privateLAN("192.168.0.0", "192.168.0.1", "192.168.0.100", "192.168.0.200")},
+			wantErr: true,
+		},
+		{
+			name:    "dhcp range out of private LAN",
+			spec:    NifcloudClusterSpec{NetworkSpec: privateLAN("192.168.0.0/24", "192.168.0.1", "192.168.1.100", "192.168.1.200")},
+			wantErr: true,
+		},
+		{
+			name: "valid identity reference",
+			spec: NifcloudClusterSpec{IdentityRef: &NifcloudIdentityReference{Kind: IdentityKindSecret, Name: "nifcloud-credentials"}},
+		},
+		{
+			name:    "identity reference of unknown kind",
+			spec:    NifcloudClusterSpec{IdentityRef: &NifcloudIdentityReference{Kind: "ConfigMap", Name: "nifcloud-credentials"}},
+			wantErr: true,
+		},
+		{
+			name:    "identity reference without name",
+			spec:    NifcloudClusterSpec{IdentityRef: &NifcloudIdentityReference{Kind: IdentityKindClusterIdentity}},
+			wantErr: true,
+		},
+		{
+			name: "inline ssh key",
+			spec: NifcloudClusterSpec{SSHKey: &SSHKeySpec{PublicKey: testPublicKey}},
+		},
+		{
+			name: "ssh key in secret",
+			spec: NifcloudClusterSpec{SSHKey: &SSHKeySpec{SecretRef: &SSHKeySecretReference{Name: "ssh-key"}}},
+		},
+		{
+			name:    "ssh key without public key",
+			spec:    NifcloudClusterSpec{SSHKey: &SSHKeySpec{}},
+			wantErr: true,
+		},
+		{
+			name:    "ssh key both inline and in secret",
+			spec:    NifcloudClusterSpec{SSHKey: &SSHKeySpec{PublicKey: testPublicKey, SecretRef: &SSHKeySecretReference{Name: "ssh-key"}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid inline ssh key",
+			spec:    NifcloudClusterSpec{SSHKey: &SSHKeySpec{PublicKey: "ssh-rsa invalid"}},
+			wantErr: true,
+		},
+		{
+			name:    "ssh key secret without name",
+			spec:    NifcloudClusterSpec{SSHKey: &SSHKeySpec{SecretRef: &SSHKeySecretReference{Key: "id_rsa.pub"}}},
+			wantErr: true,
+		},
+		{
+			name:    "bastion with invalid allowed cidr block",
+			spec:    NifcloudClusterSpec{Bastion: BastionSpec{Enabled: true, ImageID: "1", AllowedCIDRBlocks: []string{"198.51.100.0/24", "198.51.100.1"}}},
+			wantErr: true,
+		},
+		{
+			name:    "bastion without image",
+			spec:    NifcloudClusterSpec{Bastion: BastionSpec{Enabled: true, AllowedCIDRBlocks: []string{"198.51.100.0/24"}}},
+			wantErr: true,
+		},
+		{
+			name: "bastion with image",
+			spec: NifcloudClusterSpec{Bastion: BastionSpec{Enabled: true, ImageID: "1", AllowedCIDRBlocks: []string{"198.51.100.0/24"}}},
+		},
+		{
+			name: "valid ingress rules",
+			spec: ingressRules(SecurityGroupControlPlane,
+				&IngressRule{Protocol: SecurityGroupProtocolTCP, FromPort: 22, ToPort: 22, CidrBlocks: []string{"198.51.100.0/24"}},
+				&IngressRule{Protocol: SecurityGroupProtocolAny, SourceSecurityGroupName: []string{"bastion"}},
+			),
+		},
+		{
+			name:    "ingress rules of unknown role",
+			spec:    ingressRules("unknown", &IngressRule{Protocol: SecurityGroupProtocolAny, CidrBlocks: []string{"10.0.0.0/8"}}),
+			wantErr: true,
+		},
+		{
+			name:    "ingress rule with invalid port range",
+			spec:    ingressRules(SecurityGroupNode, &IngressRule{Protocol: SecurityGroupProtocolTCP, FromPort: 443, ToPort: 80, CidrBlocks: []string{"10.0.0.0/8"}}),
+			wantErr: true,
+		},
+		{
+			name:    "ingress rule without source",
+			spec:    ingressRules(SecurityGroupNode, &IngressRule{Protocol: SecurityGroupProtocolAny}),
+			wantErr: true,
+		},
+		{
+			name:    "ingress rule with invalid cidr block",
+			spec:    ingressRules(SecurityGroupNode, &IngressRule{Protocol: SecurityGroupProtocolAny, CidrBlocks: []string{"10.0.0.0"}}),
+			wantErr: true,
+		},
+		{
+			name: "existing resources",
+			spec: NifcloudClusterSpec{NetworkSpec: NetworkSpec{
+				PrivateLAN:             &PrivateLANSpec{ID: "net-0001"},
+				EndpointIP:             "203.0.113.1",
+				SecurityGroupOverrides: map[SecurityGroupRole]string{SecurityGroupNode: "existing"},
+			}},
+		},
+		{
+			name:    "router on existing private LAN without cidr block",
+			spec:    NifcloudClusterSpec{NetworkSpec: NetworkSpec{PrivateLAN: &PrivateLANSpec{ID: "net-0001", Router: &RouterSpec{IPAddress: "192.168.0.1"}}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid endpoint IP",
+			spec:    NifcloudClusterSpec{NetworkSpec: NetworkSpec{EndpointIP: "203.0.113"}},
+			wantErr: true,
+		},
+		{
+			name: "endpoint IP with load balancer",
+			spec: NifcloudClusterSpec{
+				NetworkSpec:              NetworkSpec{EndpointIP: "203.0.113.1"},
+				ControlPlaneLoadBalancer: &LoadBalancerSpec{},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "security group override of unknown role",
+			spec:    NifcloudClusterSpec{NetworkSpec: NetworkSpec{SecurityGroupOverrides: map[SecurityGroupRole]string{"etcd": "existing"}}},
+			wantErr: true,
+		},
+		{
+			name:    "security group override without name",
+			spec:    NifcloudClusterSpec{NetworkSpec: NetworkSpec{SecurityGroupOverrides: map[SecurityGroupRole]string{SecurityGroupNode: ""}}},
+			wantErr: true,
+		},
+		{
+			name: "existing load balancer",
+			spec: NifcloudClusterSpec{ControlPlaneLoadBalancer: &LoadBalancerSpec{Name: "existinglb"}},
+		},
+		{
+			name:    "existing load balancer with health check",
+			spec:    NifcloudClusterSpec{ControlPlaneLoadBalancer: &LoadBalancerSpec{Name: "existinglb", HealthCheck: &LoadBalancerHealthCheck{Interval: 30}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &NifcloudCluster{Spec: tt.spec}
+			err := c.ValidateCreate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error[%v], wantErr[%v]", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNifcloudCluster_ValidateUpdate(t *testing.T) {
+	cases := []struct {
+		name    string
+		old     NifcloudClusterSpec
+		new     NifcloudClusterSpec
+		wantErr bool
+	}{
+		{
+			name: "fill empty region and zone",
+			old:  NifcloudClusterSpec{},
+			new:  NifcloudClusterSpec{Region: "jp-east-1", Zone: "east-11"},
+		},
+		{
+			name:    "change zone",
+			old:     NifcloudClusterSpec{Region: "jp-east-1", Zone: "east-11"},
+			new:     NifcloudClusterSpec{Region: "jp-east-1", Zone: "east-12"},
+			wantErr: true,
+		},
+		{
+			name:    "add load balancer",
+			old:     NifcloudClusterSpec{},
+			new:     NifcloudClusterSpec{ControlPlaneLoadBalancer: &LoadBalancerSpec{}},
+			wantErr: true,
+		},
+		{
+			name: "change health check of load balancer",
+			old:  NifcloudClusterSpec{ControlPlaneLoadBalancer: &LoadBalancerSpec{}},
+			new: NifcloudClusterSpec{ControlPlaneLoadBalancer: &LoadBalancerSpec{
+				HealthCheck: &LoadBalancerHealthCheck{Interval: 30},
+			}},
+		},
+		{
+			name: "fill control plane endpoint",
+			old:  NifcloudClusterSpec{},
+			new:  NifcloudClusterSpec{ControlPlaneEndpoint: APIEndpoint{Host: "203.0.113.1", Port: 6443}},
+		},
+		{
+			name:    "switch to existing load balancer",
+			old:     NifcloudClusterSpec{ControlPlaneLoadBalancer: &LoadBalancerSpec{}},
+			new:     NifcloudClusterSpec{ControlPlaneLoadBalancer: &LoadBalancerSpec{Name: "existinglb"}},
+			wantErr: true,
+		},
+		{
+			name:    "add ssh key",
+			old:     NifcloudClusterSpec{},
+			new:     NifcloudClusterSpec{SSHKey: &SSHKeySpec{PublicKey: testPublicKey}},
+			wantErr: true,
+		},
+		{
+			name:    "change secret of ssh key",
+			old:     NifcloudClusterSpec{SSHKey: &SSHKeySpec{SecretRef: &SSHKeySecretReference{Name: "ssh-key"}}},
+			new:     NifcloudClusterSpec{SSHKey: &SSHKeySpec{SecretRef: &SSHKeySecretReference{Name: "another-key"}}},
+			wantErr: true,
+		},
+		{
+			name:    "change control plane endpoint",
+			old:     NifcloudClusterSpec{ControlPlaneEndpoint: APIEndpoint{Host: "203.0.113.1", Port: 6443}},
+			new:     NifcloudClusterSpec{ControlPlaneEndpoint: APIEndpoint{Host: "203.0.113.2", Port: 6443}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &NifcloudCluster{Spec: tt.new}
+			err := c.ValidateUpdate(&NifcloudCluster{Spec: tt.old})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error[%v], wantErr[%v]", err, tt.wantErr)
+			}
+		})
+	}
+}
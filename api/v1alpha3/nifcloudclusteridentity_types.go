@@ -0,0 +1,57 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha3
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NifcloudClusterIdentitySpec defines the credentials shared by NifcloudClusters across namespaces
+type NifcloudClusterIdentitySpec struct {
+	// SecretRef is the secret holding accessKey, secretKey and optionally region
+	SecretRef corev1.SecretReference `json:"secretRef"`
+
+	// AllowedNamespaces are the namespaces of NifcloudClusters allowed to use this identity,
+	// every namespace is allowed when it is empty
+	// +optional
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=nifcloudclusteridentities,scope=Cluster,categories=cluster-api
+
+// NifcloudClusterIdentity is the Schema for the nifcloudclusteridentities API
+type NifcloudClusterIdentity struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec NifcloudClusterIdentitySpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// NifcloudClusterIdentityList contains a list of NifcloudClusterIdentity
+type NifcloudClusterIdentityList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []NifcloudClusterIdentity `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&NifcloudClusterIdentity{}, &NifcloudClusterIdentityList{})
+}
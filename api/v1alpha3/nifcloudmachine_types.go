@@ -0,0 +1,161 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha3
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/cluster-api/errors"
+)
+
+const (
+	// MachineFinalizer allow reconciler to clean up Nifcloud Machine resources
+	// before removing these instances
+	MachineFinalizer = "nifcloudmachine.infrastructure.cluster.x-k8s.io"
+)
+
+// NifcloudMachineSpec defines the desired state of NifcloudMachine
+type NifcloudMachineSpec struct {
+	// the identifier for the provider's machine instance
+	ProviderID *string `json:"providerID,omitempty"`
+
+	// InstanceID is corresponding to nifcloud `instance id`
+	InstanceID string `json:"instanceID,omitempty"`
+
+	// ImageID is instance os image
+	ImageID string `json:"imageID,omitempty"`
+
+	// ImageLookup selects the newest image matching the conditions when ImageID is not specified
+	// +optional
+	ImageLookup *ImageLookup `json:"imageLookup,omitempty"`
+
+	// AvailabilityZone is reference to nifcloud availability zone for this instance
+	AvailabilityZone *string `json:"availabilityZone,omitempty"`
+
+	// KeyName is a ssh key name to attach to this instance
+	KeyName string `json:"keyName,omitempty"`
+
+	// InstanceType is reference to nifcloud instance type
+	InstanceType string `json:"instanceType,omitempty"`
+
+	// PublicType specifies whether this machine get public IP address or not
+	// "private" machine must not be connected to the common global network
+	// +optional
+	// +kubebuilder:validation:Enum=public;private
+	PublicType PublicType `json:"publicType,omitempty"`
+
+	// NetworkInterfaces is a list of nifcloud networkInterfaceSet
+	// max 2 entry : public,private
+	// public is net-COMMON_GLOBAL, private is net-COMMON_PRIVATE or a private LAN
+	// +optional
+	// +kubebuilder:validation:MaxItems=2
+	NetworkInterfaces []string `json:"networkInterfaces,omitempty"`
+
+	// BootstrapDelivery specifies how bootstrap data is delivered to this machine
+	// "userdata" (default) embeds it in the instance userdata,
+	// "scp" copies it over SSH from the controller after the instance is running
+	// +optional
+	// +kubebuilder:validation:Enum=userdata;scp
+	BootstrapDelivery BootstrapDelivery `json:"bootstrapDelivery,omitempty"`
+
+	// Volumes are additional disks which are created and attached after the instance gets running
+	// they are attached in the order of the list, and formatted and mounted by the userdata
+	// max 24 entry : the volumes are found as /dev/sdb to /dev/sdy
+	// +optional
+	// +kubebuilder:validation:MaxItems=24
+	Volumes []Volume `json:"volumes,omitempty"`
+}
+
+// NifcloudMachineStatus defines the observed state of NifcloudMachine
+type NifcloudMachineStatus struct {
+	// Ready is a flag whether this resouce is available or not
+	Ready bool `json:"ready"`
+
+	// Addresses contains the addresses assigned to the instance
+	Addresses []v1.NodeAddress `json:"addresses,omitempty"`
+
+	// InstanceState is the state of the nifcloud instance
+	InstanceState *InstanceState `json:"instanceState,omitempty"`
+
+	// ImageID is the image which the instance is created from, resolved by the image lookup if needed
+	// +optional
+	ImageID string `json:"imageID,omitempty"`
+
+	// ControlPlaneEndpointAttached is set once the control plane instance is registered with the load balancer
+	// or associated with the endpoint address
+	// +optional
+	ControlPlaneEndpointAttached bool `json:"controlPlaneEndpointAttached,omitempty"`
+
+	// Bootstrap data has been sended to server
+	SendBootstrap bool `json:"sendBootstrap,omitempty"`
+
+	// BootstrapDelivery is the delivery path actually used to send bootstrap data
+	// +optional
+	BootstrapDelivery BootstrapDelivery `json:"bootstrapDelivery,omitempty"`
+
+	// Volumes are the additional disks created for the machine
+	// +optional
+	Volumes []VolumeStatus `json:"volumes,omitempty"`
+
+	// Conditions report the progress of each step of the reconciliation
+	// +optional
+	Conditions Conditions `json:"conditions,omitempty"`
+
+	// FailureReason is set when there is a terminal problem reconciling the machine
+	// +optional
+	FailureReason *errors.MachineStatusError `json:"failureReason,omitempty"`
+	// FailureMessage is a human readable description of FailureReason
+	// +optional
+	FailureMessage *string `json:"failureMessage,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resouce:path=nifcloudmachines,scope=Namespaced,categories=cluster-api
+// +kubebuilder:subresouce:status
+// +kubebuilder:storageversion
+
+// NifcloudMachine is the Schema for the nifcloudmachines API
+type NifcloudMachine struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   NifcloudMachineSpec   `json:"spec,omitempty"`
+	Status NifcloudMachineStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// NifcloudMachineList contains a list of NifcloudMachine
+type NifcloudMachineList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []NifcloudMachine `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&NifcloudMachine{}, &NifcloudMachineList{})
+}
+
+// GetConditions returns the conditions of the machine
+func (m *NifcloudMachine) GetConditions() Conditions {
+	return m.Status.Conditions
+}
+
+// SetConditions replaces the conditions of the machine
+func (m *NifcloudMachine) SetConditions(conditions Conditions) {
+	m.Status.Conditions = conditions
+}
@@ -0,0 +1,225 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha3
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+const (
+	// DefaultInstanceType is the instance type used when NifcloudMachine does not specify it
+	// kubeadm requires 2 CPUs at least
+	DefaultInstanceType = "medium"
+
+	// maxVolumes is the number of volumes which get the devices following the root disk
+	maxVolumes = 24
+)
+
+func (r *NifcloudMachine) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// +kubebuilder:webhook:verbs=create;update,path=/mutate-infrastructure-cluster-x-k8s-io-v1alpha3-nifcloudmachine,mutating=true,failurePolicy=fail,groups=infrastructure.cluster.x-k8s.io,resources=nifcloudmachines,versions=v1alpha3,name=default.nifcloudmachine.infrastructure.cluster.x-k8s.io
+// +kubebuilder:webhook:verbs=create;update,path=/validate-infrastructure-cluster-x-k8s-io-v1alpha3-nifcloudmachine,mutating=false,failurePolicy=fail,groups=infrastructure.cluster.x-k8s.io,resources=nifcloudmachines,versions=v1alpha3,name=validation.nifcloudmachine.infrastructure.cluster.x-k8s.io
+
+var _ webhook.Defaulter = &NifcloudMachine{}
+var _ webhook.Validator = &NifcloudMachine{}
+
+// Default fills instance type which is not specified
+func (r *NifcloudMachine) Default() {
+	r.Spec.setDefaults()
+}
+
+// ValidateCreate implements webhook.Validator
+func (r *NifcloudMachine) ValidateCreate() error {
+	return r.toError(r.Spec.validate(field.NewPath("spec")))
+}
+
+// ValidateUpdate rejects changes of the fields which cannot be applied to the running instance
+func (r *NifcloudMachine) ValidateUpdate(old runtime.Object) error {
+	oldMachine, ok := old.(*NifcloudMachine)
+	if !ok {
+		return apierrors.NewBadRequest("expected a NifcloudMachine")
+	}
+
+	specPath := field.NewPath("spec")
+	allErrs := r.Spec.validate(specPath)
+
+	// instance type of machines created before defaulting is filled on update
+	if oldMachine.Spec.InstanceType == "" {
+		oldMachine = oldMachine.DeepCopy()
+		oldMachine.Spec.setDefaults()
+	}
+
+	immutables := []struct {
+		name     string
+		old, new interface{}
+	}{
+		{name: "imageID", old: oldMachine.Spec.ImageID, new: r.Spec.ImageID},
+		{name: "imageLookup", old: oldMachine.Spec.ImageLookup, new: r.Spec.ImageLookup},
+		{name: "instanceType", old: oldMachine.Spec.InstanceType, new: r.Spec.InstanceType},
+		{name: "keyName", old: oldMachine.Spec.KeyName, new: r.Spec.KeyName},
+		{name: "availabilityZone", old: oldMachine.Spec.AvailabilityZone, new: r.Spec.AvailabilityZone},
+		{name: "publicType", old: oldMachine.Spec.PublicType, new: r.Spec.PublicType},
+		{name: "networkInterfaces", old: oldMachine.Spec.NetworkInterfaces, new: r.Spec.NetworkInterfaces},
+		{name: "bootstrapDelivery", old: oldMachine.Spec.BootstrapDelivery, new: r.Spec.BootstrapDelivery},
+		{name: "volumes", old: oldMachine.Spec.Volumes, new: r.Spec.Volumes},
+	}
+	for _, f := range immutables {
+		if !reflect.DeepEqual(f.old, f.new) {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child(f.name), "cannot be modified"))
+		}
+	}
+
+	return r.toError(allErrs)
+}
+
+// ValidateDelete implements webhook.Validator
+func (r *NifcloudMachine) ValidateDelete() error {
+	return nil
+}
+
+func (r *NifcloudMachine) toError(allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("NifcloudMachine").GroupKind(), r.Name, allErrs)
+}
+
+func (s *NifcloudMachineSpec) setDefaults() {
+	if s.InstanceType == "" {
+		s.InstanceType = DefaultInstanceType
+	}
+}
+
+// validate checks the public type and the network interfaces are consistent
+// network interfaces accept one public network and one private network at most,
+// the image is given by either the id or the lookup, and volumes are checked by validateVolumes
+func (s *NifcloudMachineSpec) validate(path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	switch s.PublicType {
+	case "", PublicTypePublic, PublicTypePrivate:
+	default:
+		allErrs = append(allErrs, field.NotSupported(path.Child("publicType"), s.PublicType,
+			[]string{string(PublicTypePublic), string(PublicTypePrivate)}))
+	}
+
+	nicPath := path.Child("networkInterfaces")
+	if len(s.NetworkInterfaces) > 2 {
+		allErrs = append(allErrs, field.Invalid(nicPath, s.NetworkInterfaces, "must have at most 2 items"))
+	}
+	seen := map[string]bool{}
+	privates := 0
+	for i, id := range s.NetworkInterfaces {
+		if seen[id] {
+			allErrs = append(allErrs, field.Duplicate(nicPath.Index(i), id))
+			continue
+		}
+		seen[id] = true
+
+		if id != NetworkCommonGlobal {
+			privates++
+			if privates > 1 {
+				allErrs = append(allErrs, field.Invalid(nicPath.Index(i), id, "only one private network can be attached"))
+			}
+			continue
+		}
+		if s.PublicType == PublicTypePrivate {
+			allErrs = append(allErrs, field.Invalid(nicPath.Index(i), id, "private machine cannot be attached to the global network"))
+		}
+	}
+
+	if s.ImageLookup != nil {
+		lookupPath := path.Child("imageLookup")
+		if s.ImageID != "" {
+			allErrs = append(allErrs, field.Forbidden(lookupPath, "cannot be set with imageID"))
+		}
+		// the pattern is checked with a version as the version of the Machine is unknown here
+		name, err := s.ImageLookup.Name(ImageLookupParams{KubernetesVersion: "1.0.0"})
+		if err == nil {
+			_, err = filepath.Match(name, "")
+		}
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(lookupPath.Child("namePattern"), s.ImageLookup.NamePattern, err.Error()))
+		}
+	}
+
+	allErrs = append(allErrs, validateVolumes(path.Child("volumes"), s.Volumes)...)
+
+	return allErrs
+}
+
+// validateVolumes checks the volumes have unique names and mount points,
+// names are written in the description of nifcloud volumes as tags
+func validateVolumes(path *field.Path, volumes []Volume) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if len(volumes) > maxVolumes {
+		allErrs = append(allErrs, field.Invalid(path, len(volumes), fmt.Sprintf("must have at most %d items", maxVolumes)))
+	}
+	names := map[string]bool{}
+	mountPoints := map[string]bool{}
+	for i, v := range volumes {
+		p := path.Index(i)
+		if errs := validation.IsDNS1123Label(v.Name); len(errs) > 0 {
+			allErrs = append(allErrs, field.Invalid(p.Child("name"), v.Name, strings.Join(errs, ", ")))
+		} else if names[v.Name] {
+			allErrs = append(allErrs, field.Duplicate(p.Child("name"), v.Name))
+		}
+		names[v.Name] = true
+
+		if v.Size < 100 || v.Size%100 != 0 {
+			allErrs = append(allErrs, field.Invalid(p.Child("size"), v.Size, "must be a positive multiple of 100"))
+		}
+
+		switch v.Purpose {
+		case VolumePurposeEtcd, VolumePurposeContainerRuntime:
+		case VolumePurposeData:
+			if v.MountPath == "" {
+				allErrs = append(allErrs, field.Required(p.Child("mountPath"), "required for data volumes"))
+				continue
+			}
+		default:
+			allErrs = append(allErrs, field.NotSupported(p.Child("purpose"), v.Purpose,
+				[]string{string(VolumePurposeEtcd), string(VolumePurposeContainerRuntime), string(VolumePurposeData)}))
+			continue
+		}
+
+		mountPoint := v.MountPoint()
+		if !filepath.IsAbs(mountPoint) || filepath.Clean(mountPoint) == "/" {
+			allErrs = append(allErrs, field.Invalid(p.Child("mountPath"), v.MountPath, "must be an absolute path other than /"))
+		} else if mountPoints[filepath.Clean(mountPoint)] {
+			allErrs = append(allErrs, field.Duplicate(p.Child("mountPath"), mountPoint))
+		}
+		mountPoints[filepath.Clean(mountPoint)] = true
+	}
+
+	return allErrs
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1alpha3
+
+import (
+	"testing"
+
+	"k8s.io/utils/pointer"
+)
+
+func TestNifcloudMachine_ValidateCreate(t *testing.T) {
+	cases := []struct {
+		name    string
+		spec    NifcloudMachineSpec
+		wantErr bool
+	}{
+		{
+			name: "public and private network",
+			spec: NifcloudMachineSpec{NetworkInterfaces: []string{"net-COMMON_GLOBAL", "net-COMMON_PRIVATE"}},
+		},
+		{
+			name: "private machine on private network",
+			spec: NifcloudMachineSpec{PublicType: PublicTypePrivate, NetworkInterfaces: []string{"net-COMMON_PRIVATE"}},
+		},
+		{
+			name:    "unknown public type",
+			spec:    NifcloudMachineSpec{PublicType: "elastic"},
+			wantErr: true,
+		},
+		{
+			name:    "private machine on global network",
+			spec:    NifcloudMachineSpec{PublicType: PublicTypePrivate, NetworkInterfaces: []string{"net-COMMON_GLOBAL"}},
+			wantErr: true,
+		},
+		{
+			name:    "duplicated network",
+			spec:    NifcloudMachineSpec{NetworkInterfaces: []string{"net-COMMON_GLOBAL", "net-COMMON_GLOBAL"}},
+			wantErr: true,
+		},
+		{
+			name:    "two private networks",
+			spec:    NifcloudMachineSpec{NetworkInterfaces: []string{"net-COMMON_PRIVATE", "net-0001"}},
+			wantErr: true,
+		},
+		{
+			name: "image lookup",
+			spec: NifcloudMachineSpec{ImageLookup: &ImageLookup{NamePattern: "ubuntu-*-k8s-{{.KubernetesVersion}}", OSFamily: "ubuntu"}},
+		},
+		{
+			name:    "image lookup with image id",
+			spec:    NifcloudMachineSpec{ImageID: "55395", ImageLookup: &ImageLookup{OSFamily: "ubuntu"}},
+			wantErr: true,
+		},
+		{
+			name:    "image name pattern with unknown placeholder",
+			spec:    NifcloudMachineSpec{ImageLookup: &ImageLookup{NamePattern: "k8s-{{.Version}}"}},
+			wantErr: true,
+		},
+		{
+			name:    "malformed image name pattern",
+			spec:    NifcloudMachineSpec{ImageLookup: &ImageLookup{NamePattern: "k8s-[1.17"}},
+			wantErr: true,
+		},
+		{
+			name: "volumes",
+			spec: NifcloudMachineSpec{Volumes: []Volume{
+				{Name: "etcd", Size: 100, Purpose: VolumePurposeEtcd},
+				{Name: "docker", Size: 300, DiskType: "2", Purpose: VolumePurposeContainerRuntime, Retain: true},
+				{Name: "data", Size: 100, Purpose: VolumePurposeData, MountPath: "/mnt/data"},
+			}},
+		},
+		{
+			name:    "duplicated volume name",
+			spec:    NifcloudMachineSpec{Volumes: []Volume{{Name: "data", Size: 100, Purpose: VolumePurposeEtcd}, {Name: "data", Size: 100, Purpose: VolumePurposeContainerRuntime}}},
+			wantErr: true,
+		},
+		{
+			name:    "volume name with tag separator",
+			spec:    NifcloudMachineSpec{Volumes: []Volume{{Name: "etcd,data", Size: 100, Purpose: VolumePurposeEtcd}}},
+			wantErr: true,
+		},
+		{
+			name:    "volume size out of unit",
+			spec:    NifcloudMachineSpec{Volumes: []Volume{{Name: "etcd", Size: 150, Purpose: VolumePurposeEtcd}}},
+			wantErr: true,
+		},
+		{
+			name:    "data volume without mount path",
+			spec:    NifcloudMachineSpec{Volumes: []Volume{{Name: "data", Size: 100, Purpose: VolumePurposeData}}},
+			wantErr: true,
+		},
+		{
+			name:    "relative mount path",
+			spec:    NifcloudMachineSpec{Volumes: []Volume{{Name: "data", Size: 100, Purpose: VolumePurposeData, MountPath: "data"}}},
+			wantErr: true,
+		},
+		{
+			name:    "duplicated mount point",
+			spec:    NifcloudMachineSpec{Volumes: []Volume{{Name: "etcd", Size: 100, Purpose: VolumePurposeEtcd}, {Name: "data", Size: 100, Purpose: VolumePurposeData, MountPath: "/var/lib/etcd/"}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &NifcloudMachine{Spec: tt.spec}
+			err := m.ValidateCreate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error[%v], wantErr[%v]", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNifcloudMachine_ValidateUpdate(t *testing.T) {
+	cases := []struct {
+		name    string
+		old     NifcloudMachineSpec
+		new     NifcloudMachineSpec
+		wantErr bool
+	}{
+		{
+			name: "set provider id",
+			old:  NifcloudMachineSpec{ImageID: "55395", InstanceType: "medium"},
+			new:  NifcloudMachineSpec{ImageID: "55395", InstanceType: "medium", ProviderID: pointer.StringPtr("nifcloud:////uid")},
+		},
+		{
+			name: "fill default instance type",
+			old:  NifcloudMachineSpec{ImageID: "55395"},
+			new:  NifcloudMachineSpec{ImageID: "55395", InstanceType: DefaultInstanceType},
+		},
+		{
+			name:    "change image id",
+			old:     NifcloudMachineSpec{ImageID: "55395", InstanceType: "medium"},
+			new:     NifcloudMachineSpec{ImageID: "12345", InstanceType: "medium"},
+			wantErr: true,
+		},
+		{
+			name:    "change instance type",
+			old:     NifcloudMachineSpec{ImageID: "55395", InstanceType: "medium"},
+			new:     NifcloudMachineSpec{ImageID: "55395", InstanceType: "large"},
+			wantErr: true,
+		},
+		{
+			name:    "change image lookup",
+			old:     NifcloudMachineSpec{ImageLookup: &ImageLookup{OSFamily: "ubuntu"}, InstanceType: "medium"},
+			new:     NifcloudMachineSpec{ImageLookup: &ImageLookup{OSFamily: "centos"}, InstanceType: "medium"},
+			wantErr: true,
+		},
+		{
+			name:    "add volume",
+			old:     NifcloudMachineSpec{ImageID: "55395", InstanceType: "medium"},
+			new:     NifcloudMachineSpec{ImageID: "55395", InstanceType: "medium", Volumes: []Volume{{Name: "etcd", Size: 100, Purpose: VolumePurposeEtcd}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &NifcloudMachine{Spec: tt.new}
+			err := m.ValidateUpdate(&NifcloudMachine{Spec: tt.old})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error[%v], wantErr[%v]", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha3
+
+import (
+	"reflect"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+func (r *NifcloudMachineTemplate) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// +kubebuilder:webhook:verbs=create;update,path=/validate-infrastructure-cluster-x-k8s-io-v1alpha3-nifcloudmachinetemplate,mutating=false,failurePolicy=fail,groups=infrastructure.cluster.x-k8s.io,resources=nifcloudmachinetemplates,versions=v1alpha3,name=validation.nifcloudmachinetemplate.infrastructure.cluster.x-k8s.io
+
+var _ webhook.Validator = &NifcloudMachineTemplate{}
+
+// ValidateCreate validates the machine spec of the template
+func (r *NifcloudMachineTemplate) ValidateCreate() error {
+	allErrs := r.Spec.Template.Spec.validate(field.NewPath("spec", "template", "spec"))
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("NifcloudMachineTemplate").GroupKind(), r.Name, allErrs)
+}
+
+// ValidateUpdate rejects any change of the template
+// because machines which are already created from it are never updated
+func (r *NifcloudMachineTemplate) ValidateUpdate(old runtime.Object) error {
+	oldTemplate, ok := old.(*NifcloudMachineTemplate)
+	if !ok {
+		return apierrors.NewBadRequest("expected a NifcloudMachineTemplate")
+	}
+
+	if !reflect.DeepEqual(r.Spec, oldTemplate.Spec) {
+		return apierrors.NewInvalid(
+			GroupVersion.WithKind("NifcloudMachineTemplate").GroupKind(),
+			r.Name,
+			field.ErrorList{
+				field.Forbidden(field.NewPath("spec"), "NifcloudMachineTemplate spec is immutable"),
+			},
+		)
+	}
+	return nil
+}
+
+// ValidateDelete implements webhook.Validator
+func (r *NifcloudMachineTemplate) ValidateDelete() error {
+	return nil
+}
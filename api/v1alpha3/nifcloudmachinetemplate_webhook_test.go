@@ -0,0 +1,73 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha3
+
+import (
+	"testing"
+)
+
+func TestNifcloudMachineTemplate_ValidateUpdate(t *testing.T) {
+	newTemplate := func(instanceType string) *NifcloudMachineTemplate {
+		return &NifcloudMachineTemplate{
+			Spec: NifcloudMachineTemplateSpec{
+				Template: NifcloudMachineTemplateResource{
+					Spec: NifcloudMachineSpec{
+						InstanceType: instanceType,
+						ImageID:      "55395",
+					},
+				},
+			},
+		}
+	}
+
+	cases := []struct {
+		name    string
+		old     *NifcloudMachineTemplate
+		new     *NifcloudMachineTemplate
+		wantErr bool
+	}{
+		{
+			name: "unchanged template",
+			old:  newTemplate("medium"),
+			new:  newTemplate("medium"),
+		},
+		{
+			name:    "changed template spec",
+			old:     newTemplate("medium"),
+			new:     newTemplate("large"),
+			wantErr: true,
+		},
+		{
+			name: "changed metadata only",
+			old:  newTemplate("medium"),
+			new: func() *NifcloudMachineTemplate {
+				tmpl := newTemplate("medium")
+				tmpl.Labels = map[string]string{"nodepool": "nodepool-0"}
+				return tmpl
+			}(),
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.new.ValidateUpdate(tt.old)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error[%v], wantErr[%v]", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,598 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha3
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+type APIEndpoint struct {
+	// the hostname on which the API server is serving
+	Host string `json:"host"`
+
+	// the port on which the API server is serving
+	Port int32 `json:"port"`
+}
+
+// IsZero returns true if both host and port are zero values
+func (v APIEndpoint) IsZero() bool {
+	return v.Host == "" && v.Port == 0
+}
+
+type Network struct {
+	// SecurityGroups is a map from a name of role/kind to spesific role filewall
+	SecurityGroups map[SecurityGroupRole]SecurityGroup `json:"securityGroups,omitempty"`
+
+	// APIServerLoadBalancer is the load balancer in front of control plane instances
+	// +optional
+	APIServerLoadBalancer *LoadBalancer `json:"apiServerLoadBalancer,omitempty"`
+
+	// PrivateLAN is the private LAN of the cluster
+	// +optional
+	PrivateLAN *PrivateLAN `json:"privateLAN,omitempty"`
+
+	// Router is the router of the private LAN
+	// +optional
+	Router *Router `json:"router,omitempty"`
+
+	// EndpointAddress is the public IP used as the control plane endpoint
+	// +optional
+	EndpointAddress *Address `json:"endpointAddress,omitempty"`
+}
+
+type NetworkSpec struct {
+	// PrivateLAN is a managed private LAN which every machine of the cluster is connected to
+	// +optional
+	PrivateLAN *PrivateLANSpec `json:"privateLAN,omitempty"`
+
+	// EndpointIP is an existing public IP used as the control plane endpoint,
+	// the controller neither allocates nor releases it
+	// +optional
+	EndpointIP string `json:"endpointIP,omitempty"`
+
+	// SecurityGroupOverrides are names of existing security groups used for the roles as-is,
+	// the controller neither updates their rules nor deletes them
+	// +optional
+	SecurityGroupOverrides map[SecurityGroupRole]string `json:"securityGroupOverrides,omitempty"`
+}
+
+// PrivateLANSpec defines the desired state of nifcloud private LAN
+type PrivateLANSpec struct {
+	// ID is a network id of an existing private LAN used as-is,
+	// the controller does not delete it
+	// +optional
+	ID string `json:"id,omitempty"`
+
+	// CidrBlock is an address range of the private LAN,
+	// it is required unless an existing private LAN is given
+	// +optional
+	CidrBlock string `json:"cidrBlock,omitempty"`
+
+	// Zone is a nifcloud zone which the private LAN lives on
+	// defaults to the zone of the cluster
+	// +optional
+	Zone string `json:"zone,omitempty"`
+
+	// Router connects the private LAN to the internet and serves DHCP
+	// +optional
+	Router *RouterSpec `json:"router,omitempty"`
+}
+
+// RouterSpec defines the desired state of nifcloud router
+type RouterSpec struct {
+	// Type is a size of the router
+	// +optional
+	// +kubebuilder:validation:Enum=small;medium;large
+	Type string `json:"type,omitempty"`
+
+	// IPAddress is an address of the router in the private LAN
+	IPAddress string `json:"ipAddress"`
+
+	// DHCP configures a DHCP server on the private LAN side of the router
+	// +optional
+	DHCP *DHCPSpec `json:"dhcp,omitempty"`
+}
+
+// DHCPSpec defines a DHCP address pool served by the router
+type DHCPSpec struct {
+	// StartIPAddress is the first address leased to machines
+	StartIPAddress string `json:"startIPAddress"`
+
+	// StopIPAddress is the last address leased to machines
+	StopIPAddress string `json:"stopIPAddress"`
+}
+
+// PrivateLAN defines nifcloud private LAN
+type PrivateLAN struct {
+	// ID is a network id of the private LAN
+	ID string `json:"id"`
+
+	// Name is a name of the private LAN
+	Name string `json:"name"`
+
+	// CidrBlock is an address range of the private LAN
+	CidrBlock string `json:"cidrBlock,omitempty"`
+
+	// Zone is a nifcloud zone which the private LAN lives on
+	Zone string `json:"zone,omitempty"`
+
+	// State is current state of the private LAN
+	State string `json:"state,omitempty"`
+
+	// Unmanaged is true when the private LAN is given in the spec and not deleted by the controller
+	// +optional
+	Unmanaged bool `json:"unmanaged,omitempty"`
+}
+
+// Address defines nifcloud public IP address
+type Address struct {
+	// PublicIP is the public IP address
+	PublicIP string `json:"publicIP"`
+
+	// Unmanaged is true when the address is given in the spec and not released by the controller
+	// +optional
+	Unmanaged bool `json:"unmanaged,omitempty"`
+}
+
+// Router defines nifcloud router
+type Router struct {
+	// ID is an identifier of the router
+	ID string `json:"id"`
+
+	// Name is a name of the router
+	Name string `json:"name"`
+
+	// State is current state of the router
+	State string `json:"state,omitempty"`
+
+	// DHCPConfigID is an identifier of the DHCP config attached to the router
+	// +optional
+	DHCPConfigID string `json:"dhcpConfigID,omitempty"`
+}
+
+// IdentityKind is the kind of the object holding the credentials
+type IdentityKind string
+
+const (
+	// IdentityKindSecret refers to a secret in the namespace of the NifcloudCluster
+	IdentityKindSecret = IdentityKind("Secret")
+	// IdentityKindClusterIdentity refers to a cluster scoped NifcloudClusterIdentity
+	IdentityKindClusterIdentity = IdentityKind("NifcloudClusterIdentity")
+)
+
+// NifcloudIdentityReference refers to the object holding the credentials of nifcloud
+type NifcloudIdentityReference struct {
+	// Kind of the referent
+	// +kubebuilder:validation:Enum=Secret;NifcloudClusterIdentity
+	Kind IdentityKind `json:"kind"`
+
+	// Name of the referent
+	Name string `json:"name"`
+}
+
+// SSHKeySpec is the public key which is imported into nifcloud as the key pair of the cluster,
+// either the key itself or the secret which has it is given
+type SSHKeySpec struct {
+	// PublicKey is the public key in the authorized_keys format
+	// +optional
+	PublicKey string `json:"publicKey,omitempty"`
+
+	// SecretRef refers to the secret in the namespace of the cluster which has the public key
+	// +optional
+	SecretRef *SSHKeySecretReference `json:"secretRef,omitempty"`
+}
+
+// SSHKeySecretReference refers to the public key in a secret
+type SSHKeySecretReference struct {
+	// Name of the secret
+	Name string `json:"name"`
+
+	// Key of the public key in the data of the secret, "publicKey" is used when it is empty
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+// BastionSpec defines the desired state of the bastion host
+type BastionSpec struct {
+	// Enabled creates the bastion instance and its security group,
+	// machines accept SSH only from the bastion security group
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+
+	// InstanceType is the nifcloud instance type of the bastion
+	// +optional
+	InstanceType string `json:"instanceType,omitempty"`
+
+	// ImageID is the image of the bastion, it is required when the bastion is enabled
+	// +optional
+	ImageID string `json:"imageID,omitempty"`
+
+	// AllowedCIDRBlocks are the sources allowed to SSH into the bastion
+	// +optional
+	AllowedCIDRBlocks []string `json:"allowedCIDRBlocks,omitempty"`
+}
+
+// LoadBalancerSpec defines the desired state of nifcloud load balancer
+type LoadBalancerSpec struct {
+	// Name is a name of an existing load balancer used as-is,
+	// it has to listen on the API server port and the controller does not delete it
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// NetworkVolume is a bandwidth of the load balancer in Mbps
+	// +optional
+	// +kubebuilder:validation:Enum=10;20;30;40;100;200;300;400;500;600;700;800;900;1000;1500;2000
+	NetworkVolume int64 `json:"networkVolume,omitempty"`
+
+	// BalancingType is a balancing algorithm, 1: round robin, 2: least connection
+	// +optional
+	// +kubebuilder:validation:Enum=1;2
+	BalancingType int64 `json:"balancingType,omitempty"`
+
+	// HealthCheck configures how the load balancer checks control plane instances
+	// +optional
+	HealthCheck *LoadBalancerHealthCheck `json:"healthCheck,omitempty"`
+}
+
+// LoadBalancerHealthCheck defines the health check of nifcloud load balancer
+type LoadBalancerHealthCheck struct {
+	// Target is a protocol and port to check such as "TCP:6443"
+	// +optional
+	Target string `json:"target,omitempty"`
+
+	// Interval is a period of the check in seconds
+	// +optional
+	// +kubebuilder:validation:Minimum=5
+	// +kubebuilder:validation:Maximum=300
+	Interval int64 `json:"interval,omitempty"`
+
+	// UnhealthyThreshold is a count of failures to mark the instance unhealthy
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=10
+	UnhealthyThreshold int64 `json:"unhealthyThreshold,omitempty"`
+}
+
+// LoadBalancer defines nifcloud load balancer
+type LoadBalancer struct {
+	// Name is a name of the load balancer
+	Name string `json:"name"`
+
+	// DNSName is the virtual IP address of the load balancer
+	DNSName string `json:"dnsName,omitempty"`
+
+	// Port is a port on which both the load balancer and instances listen
+	Port int64 `json:"port"`
+
+	// HealthCheck is the current health check of the load balancer
+	// +optional
+	HealthCheck LoadBalancerHealthCheck `json:"healthCheck,omitempty"`
+
+	// Instances is a list of instance ids registered with the load balancer
+	// +optional
+	Instances []string `json:"instances,omitempty"`
+
+	// Unmanaged is true when the load balancer is given in the spec and not deleted by the controller
+	// +optional
+	Unmanaged bool `json:"unmanaged,omitempty"`
+}
+
+// InstanceState describes the state of an nifcloud instance.
+type InstanceState string
+
+var (
+	InstancePending = InstanceState("pending")
+	InstanceRunning = InstanceState("running")
+	InstanceStopped = InstanceState("stopped")
+	InstanceWaiting = InstanceState("waiting")
+)
+
+// BootstrapDelivery describes how bootstrap data is delivered to an instance.
+type BootstrapDelivery string
+
+var (
+	// bootstrap data is embedded in the instance userdata as a cloud-init document
+	BootstrapDeliveryUserData = BootstrapDelivery("userdata")
+	// bootstrap data is copied to the running instance over SSH by the controller
+	BootstrapDeliverySCP = BootstrapDelivery("scp")
+)
+
+// ImageLookup describes the conditions of the image which the instance runs
+type ImageLookup struct {
+	// NamePattern is a shell pattern of the image name, such as "ubuntu-*-k8s-{{.KubernetesVersion}}",
+	// {{.KubernetesVersion}} is replaced with the version of the Machine without the leading "v"
+	// +optional
+	NamePattern string `json:"namePattern,omitempty"`
+
+	// Owner is the owner of the image, "niftycloud" is used for the public images when it is omitted
+	// +optional
+	Owner string `json:"owner,omitempty"`
+
+	// OSFamily is compared with the platform of the image case-insensitively, such as "ubuntu"
+	// +optional
+	OSFamily string `json:"osFamily,omitempty"`
+}
+
+// ImageLookupParams are the values which replace the placeholders in the name pattern of ImageLookup
+type ImageLookupParams struct {
+	KubernetesVersion string
+}
+
+// Name returns the name pattern whose placeholders are replaced with the params
+func (l *ImageLookup) Name(params ImageLookupParams) (string, error) {
+	tpl, err := template.New("image").Parse(l.NamePattern)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse image name pattern %q: %w", l.NamePattern, err)
+	}
+	var out strings.Builder
+	if err := tpl.Execute(&out, params); err != nil {
+		return "", fmt.Errorf("failed to fill image name pattern %q: %w", l.NamePattern, err)
+	}
+	return out.String(), nil
+}
+
+// VolumePurpose describes what an additional volume is mounted for.
+type VolumePurpose string
+
+var (
+	// the volume is mounted at the data directory of etcd
+	VolumePurposeEtcd = VolumePurpose("etcd")
+	// the volume is mounted at the data root of the container runtime
+	VolumePurposeContainerRuntime = VolumePurpose("containerRuntime")
+	// the volume is mounted at the path given by the volume
+	VolumePurposeData = VolumePurpose("data")
+)
+
+const (
+	// EtcdMountPath is the data directory of etcd which kubeadm configures
+	EtcdMountPath = "/var/lib/etcd"
+	// ContainerRuntimeMountPath is the data root of docker installed by the userdata
+	ContainerRuntimeMountPath = "/var/lib/docker"
+)
+
+// Volume is an additional disk of the machine
+type Volume struct {
+	// Name identifies the volume in the machine
+	Name string `json:"name"`
+
+	// Size is the volume size in GB, in units of 100
+	// +kubebuilder:validation:Minimum=100
+	Size int64 `json:"size"`
+
+	// DiskType is the nifcloud disk type, such as "2" for High-Speed Storage A
+	// the default of nifcloud is used when it is omitted
+	// +optional
+	DiskType string `json:"diskType,omitempty"`
+
+	// Purpose decides where the volume is mounted
+	// +kubebuilder:validation:Enum=etcd;containerRuntime;data
+	Purpose VolumePurpose `json:"purpose"`
+
+	// MountPath overrides where the volume is mounted, it is required for "data" volumes
+	// +optional
+	MountPath string `json:"mountPath,omitempty"`
+
+	// Retain keeps the volume when the machine is deleted, it is only detached from the instance
+	// +optional
+	Retain bool `json:"retain,omitempty"`
+}
+
+// MountPoint returns where the volume is mounted in the instance
+func (v *Volume) MountPoint() string {
+	if v.MountPath != "" {
+		return v.MountPath
+	}
+	switch v.Purpose {
+	case VolumePurposeEtcd:
+		return EtcdMountPath
+	case VolumePurposeContainerRuntime:
+		return ContainerRuntimeMountPath
+	}
+	return ""
+}
+
+// VolumeStatus is the observed state of an additional disk of the machine
+type VolumeStatus struct {
+	// Name is the name of the volume in the machine spec
+	Name string `json:"name"`
+	// ID is the nifcloud volume id
+	ID string `json:"id"`
+	// Status is the nifcloud volume status, such as "in-use"
+	// +optional
+	Status string `json:"status,omitempty"`
+	// Device is the device which the volume is attached as, empty if it is detached
+	// +optional
+	Device string `json:"device,omitempty"`
+}
+
+// PublicType describes whether an instance is reachable from the internet.
+type PublicType string
+
+var (
+	// instance is connected to the common global network
+	PublicTypePublic = PublicType("public")
+	// instance is only connected to private networks
+	PublicTypePrivate = PublicType("private")
+)
+
+const (
+	// NetworkCommonGlobal is the network id of the common global network
+	NetworkCommonGlobal = "net-COMMON_GLOBAL"
+	// NetworkCommonPrivate is the network id of the common private network
+	NetworkCommonPrivate = "net-COMMON_PRIVATE"
+)
+
+// SecurityGroupRole defines the unique role of a security group.
+type SecurityGroupRole string
+
+var (
+	// SSH entry point role
+	SecurityGroupBastion = SecurityGroupRole("bastion")
+	// kubernets controleplane node role
+	SecurityGroupControlPlane = SecurityGroupRole("controlplane")
+	// kubernetes workload node role
+	SecurityGroupNode = SecurityGroupRole("node")
+)
+
+// SecurityGroup defines nifcloud firewall group
+type SecurityGroup struct {
+	// ID is an identifier
+	ID string `json:"id"`
+	// security(firewall) group name
+	Name string `json:"name"`
+	// ingress rules of the group
+	// +optional
+	IngressRules IngressRules `json:"ingressRules"`
+	// Unmanaged is true when the group is given in the spec, the controller neither updates its rules nor deletes it
+	// +optional
+	Unmanaged bool `json:"unmanaged,omitempty"`
+}
+
+func (s *SecurityGroup) String() string {
+	return fmt.Sprintf("id=%s/name=%s", s.ID, s.Name)
+}
+
+// SecurityGroupProtocol defines the protocol type for a security group rule.
+type SecurityGroupProtocol string
+
+var (
+	SecurityGroupProtocolAny = SecurityGroupProtocol("ANY")
+	SecurityGroupProtocolTCP = SecurityGroupProtocol("TCP")
+	SecurityGroupProtocolUDP = SecurityGroupProtocol("UDP")
+)
+
+// IngressRule defines an ingress rule of nifcloud firewall group
+type IngressRule struct {
+	// +optional
+	ID string `json:"id,omitempty"`
+	// +optional
+	Name string `json:"name,omitempty"`
+	// +optional
+	Description string `json:"description,omitempty"`
+	// +kubebuilder:validation:Enum=ANY;TCP;UDP
+	Protocol SecurityGroupProtocol `json:"protocol"`
+	// FromPort and ToPort are the port range of TCP and UDP rules
+	// +optional
+	FromPort int64 `json:"fromPort,omitempty"`
+	// +optional
+	ToPort int64 `json:"toPort,omitempty"`
+
+	// List of CIDR blocks to allow access from. Cannot be specified with SourceSecurityGroupID.
+	// +optional
+	CidrBlocks []string `json:"cidrBlocks,omitempty"`
+	// The security group id to allow access from. Cannot be specified with CidrBlocks.
+	// +optional
+	SourceSecurityGroupName []string `json:"sourceSecurityGroupName,omitempty"`
+}
+
+func (i IngressRule) String() string {
+	return fmt.Sprintf("protocol=%s/range[%d-%d]/description=%s", i.Protocol, i.FromPort, i.ToPort, i.Description)
+}
+
+type IngressRules []*IngressRule
+
+func (i IngressRules) Difference(o IngressRules) (out IngressRules) {
+	for _, x := range i {
+		found := false
+		for _, y := range o {
+			if x.Equals(y) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			out = append(out, x)
+		}
+	}
+	return
+}
+
+func (i *IngressRule) Equals(o *IngressRule) bool {
+	if len(i.CidrBlocks) != len(o.CidrBlocks) {
+		return false
+	}
+	if len(i.SourceSecurityGroupName) != len(o.SourceSecurityGroupName) {
+		return false
+	}
+
+	if len(i.CidrBlocks) != 0 {
+		sort.Strings(i.CidrBlocks)
+		sort.Strings(o.CidrBlocks)
+		for ii, v := range i.CidrBlocks {
+			if v != o.CidrBlocks[ii] {
+				return false
+			}
+		}
+	}
+	sort.Strings(i.SourceSecurityGroupName)
+	sort.Strings(o.SourceSecurityGroupName)
+	for ii, v := range i.SourceSecurityGroupName {
+		if v != o.SourceSecurityGroupName[ii] {
+			return false
+		}
+	}
+
+	if i.Description != o.Description || i.Protocol != o.Protocol {
+		return false
+	}
+
+	switch i.Protocol {
+	case SecurityGroupProtocolTCP, SecurityGroupProtocolUDP:
+		return i.FromPort == o.FromPort && i.ToPort == o.ToPort
+	}
+
+	return true
+}
+
+// DisableApiTermination should be false to delete server with NifcloudAPI
+const ApiTermination = false
+
+type Instance struct {
+	// UID is an instance identifier
+	UID string `json:"uid"`
+	// ID is a name of nifcloud instance
+	ID string `json:"id,omitemptuy"`
+	// Zone is machine location
+	Zone string `json:"zone,omitempty"`
+	// State is current state of nicloud instance
+	State InstanceState `json:"state,omitempty"`
+	// Type is machine type of nicloud instance
+	Type string `json:"type,omitempty"`
+	// ImageID is an image running on nicloud instance
+	ImageID string `json:"imageID,omitempty"`
+	// UserData is cloud-init script
+	UserData *string `json:"userData,omitempty"`
+	// security group names
+	SecurityGroups []string `json:"securityGroups,omitempty"`
+	// A name of SSh key pair
+	SSHKeyName string `json:"sshKeyName,omitempty"`
+	// tags in instance
+	Tag Tag `json:"tag,omitempty"`
+	// The public IPv4 address assigned to the instance
+	PublicIP string `json:"publicIP,omitempty"`
+	// The private IPv4 address assigned to the instance
+	PrivateIP string `json:"privateIP,omitempty"`
+	// Address containes a list of apiserver endpoints
+	Addresses []corev1.NodeAddress `json:"addresses,omitempty"`
+	// a list of networkinterface which attached the instance
+	NetworkInterfaces []string `json:"networkInterfaces,omitempty"`
+}
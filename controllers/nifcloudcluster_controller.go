@@ -21,15 +21,22 @@ import (
 
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
 	"sigs.k8s.io/cluster-api/util"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
-	infrav1alpha2 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha2"
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
 	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/scope"
 	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/services/computing"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/conditions"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/paused"
 )
 
 // NifcloudClusterReconciler reconciles a NifcloudCluster object
@@ -37,11 +44,17 @@ type NifcloudClusterReconciler struct {
 	client.Client
 	Log      logr.Logger
 	Recorder record.EventRecorder
+	// ClientCache shares nifcloud clients of each identity with NifcloudMachineReconciler
+	ClientCache *scope.ClientCache
+	// pausedObjects reports the pause of each NifcloudCluster once
+	pausedObjects paused.Transitions
 }
 
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=nifcloudclusters,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=nifcloudclusters/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters;clusters/status,verbs=get;list;watch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=nifcloudclusteridentities,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
 
 func (r *NifcloudClusterReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, reterr error) {
 	ctx := context.Background()
@@ -49,7 +62,7 @@ func (r *NifcloudClusterReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result,
 
 	// Fetch cluster resources
 	log.Info("fetching Cluster Resources")
-	nifcloudCluster := &infrav1alpha2.NifcloudCluster{}
+	nifcloudCluster := &infrav1alpha3.NifcloudCluster{}
 	if err := r.Get(ctx, req.NamespacedName, nifcloudCluster); err != nil {
 		if apierrors.IsNotFound(err) {
 			return ctrl.Result{}, nil
@@ -69,9 +82,19 @@ func (r *NifcloudClusterReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result,
 
 	log = log.WithValues("cluster", cluster.Name)
 
+	if paused.IsPaused(cluster, nifcloudCluster) {
+		log.V(2).Info("NifcloudCluster or linked Cluster is paused, skipping reconciliation")
+		if r.pausedObjects.Paused(nifcloudCluster) {
+			r.Recorder.Eventf(nifcloudCluster, corev1.EventTypeNormal, "ReconciliationPaused", "Reconciliation is paused")
+		}
+		return ctrl.Result{}, nil
+	}
+	r.pausedObjects.Resumed(nifcloudCluster)
+
 	clusterScope, err := scope.NewClusterScope(scope.ClusterScopeParams{
 		Client:          r.Client,
 		Logger:          log,
+		ClientCache:     r.ClientCache,
 		Cluster:         cluster,
 		NifcloudCluster: nifcloudCluster,
 	})
@@ -80,6 +103,11 @@ func (r *NifcloudClusterReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result,
 	}
 
 	defer func() {
+		conditions.SetSummary(nifcloudCluster,
+			infrav1alpha3.SSHKeyReadyCondition,
+			infrav1alpha3.EndpointReadyCondition,
+			infrav1alpha3.SecurityGroupsReadyCondition,
+		)
 		if err := clusterScope.Close(); err != nil {
 			reterr = err
 		}
@@ -98,18 +126,30 @@ func reconcileCluster(clusterScope *scope.ClusterScope) (ctrl.Result, error) {
 	nifcloudCluster := clusterScope.NifcloudCluster
 
 	// Add Finalizer
-	if !util.Contains(nifcloudCluster.Finalizers, infrav1alpha2.ClusterFinalizer) {
-		nifcloudCluster.Finalizers = append(nifcloudCluster.Finalizers, infrav1alpha2.ClusterFinalizer)
-	}
+	controllerutil.AddFinalizer(nifcloudCluster, infrav1alpha3.ClusterFinalizer)
 
 	svc := computing.NewService(clusterScope)
 
+	if err := svc.ReconcileKeyPair(); err != nil {
+		return ctrl.Result{}, errors.Wrapf(err, "failed to reconcile key pair for NifcloudCluster %s/%s", nifcloudCluster.Namespace, nifcloudCluster.Name)
+	}
+
 	if err := svc.ReconcileNetwork(); err != nil {
 		return ctrl.Result{}, errors.Wrapf(err, "failed to reconcile network for NifcloudCluster %s/%s", nifcloudCluster.Namespace, nifcloudCluster.Name)
 	}
 
+	if err := svc.ReconcileBastion(); err != nil {
+		return ctrl.Result{}, errors.Wrapf(err, "failed to reconcile bastion for NifcloudCluster %s/%s", nifcloudCluster.Namespace, nifcloudCluster.Name)
+	}
+
 	nifcloudCluster.Status.Ready = true
 
+	// machines do not depend on the bastion, it is observed again until it settles
+	if svc.BastionInProgress() {
+		clusterScope.Info("Waiting for bastion host", "state", nifcloudCluster.Status.Bastion.State)
+		return ctrl.Result{RequeueAfter: instanceRequeueAfter}, nil
+	}
+
 	clusterScope.Info("Reconciled Cluster successfully")
 	return ctrl.Result{}, nil
 }
@@ -119,21 +159,62 @@ func reconcileDelete(clusterScope *scope.ClusterScope) (ctrl.Result, error) {
 
 	svc := computing.NewService(clusterScope)
 
+	// the bastion holds its security group, so it has to be deleted before the network
+	if err := svc.DeleteBastion(); err != nil {
+		return ctrl.Result{}, err
+	}
+	if clusterScope.NifcloudCluster.Status.Bastion != nil {
+		clusterScope.Info("Waiting for bastion host to be deleted", "state", clusterScope.NifcloudCluster.Status.Bastion.State)
+		return ctrl.Result{RequeueAfter: instanceRequeueAfter}, nil
+	}
+
 	if err := svc.DeleteEndpoint(); err != nil {
 		return ctrl.Result{}, err
 	}
 
+	// the bastion and the machines which use the key pair are deleted already
+	if err := svc.DeleteKeyPair(); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	if err := svc.DeleteNetwork(); err != nil {
 		return ctrl.Result{}, err
 	}
 
-	clusterScope.NifcloudCluster.Finalizers = util.Filter(clusterScope.NifcloudCluster.Finalizers, infrav1alpha2.ClusterFinalizer)
+	controllerutil.RemoveFinalizer(clusterScope.NifcloudCluster, infrav1alpha3.ClusterFinalizer)
 
 	return ctrl.Result{}, nil
 }
 
 func (r *NifcloudClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&infrav1alpha2.NifcloudCluster{}).
+		For(&infrav1alpha3.NifcloudCluster{}).
+		Watches(
+			&source.Kind{Type: &clusterv1.Cluster{}},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(ClusterToNifcloudCluster)},
+		).
+		WithEventFilter(paused.ResourceNotPaused(r.Log)).
 		Complete(r)
 }
+
+// ClusterToNifcloudCluster maps the Cluster to the NifcloudCluster it refers to,
+// the version is ignored because the cluster may refer to any served version
+func ClusterToNifcloudCluster(o handler.MapObject) []ctrl.Request {
+	c, ok := o.Object.(*clusterv1.Cluster)
+	if !ok {
+		return nil
+	}
+
+	ref := c.Spec.InfrastructureRef
+	if ref == nil || ref.GroupVersionKind().GroupKind() != infrav1alpha3.GroupVersion.WithKind("NifcloudCluster").GroupKind() {
+		return nil
+	}
+	return []ctrl.Request{
+		{
+			NamespacedName: client.ObjectKey{
+				Namespace: c.Namespace,
+				Name:      ref.Name,
+			},
+		},
+	}
+}
@@ -21,7 +21,7 @@ import (
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
-	infrav1alpha2 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha2"
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -37,7 +37,7 @@ var _ = Describe("NifcloudClusterReconciler", func() {
 				Log:    log.Log,
 			}
 
-			cluster := &infrav1alpha2.NifcloudCluster{
+			cluster := &infrav1alpha3.NifcloudCluster{
 				ObjectMeta: metav1.ObjectMeta{Name: "hoge", Namespace: "default"},
 			}
 
@@ -28,32 +28,49 @@ import (
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
 
-	infrav1alpha2 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha2"
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
 	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/scope"
 	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/services"
 	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/services/computing"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/conditions"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/paused"
 	"golang.org/x/crypto/ssh"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
 	"sigs.k8s.io/cluster-api/controllers/noderefutil"
 	capierrors "sigs.k8s.io/cluster-api/errors"
 	"sigs.k8s.io/cluster-api/util"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
+// instanceRequeueAfter is the interval to observe instances in transition,
+// reconcilers do not wait for nifcloud inside a reconciliation
+const instanceRequeueAfter = 15 * time.Second
+
 // NifcloudMachineReconciler reconciles a NifcloudMachine object
 type NifcloudMachineReconciler struct {
 	client.Client
-	Log            logr.Logger
-	Recorder       record.EventRecorder
+	Log      logr.Logger
+	Recorder record.EventRecorder
+	// ClientCache shares nifcloud clients of each identity with NifcloudClusterReconciler
+	ClientCache    *scope.ClientCache
 	serviceFactory func(*scope.ClusterScope) services.NifcloudMachineInterface
+	// pausedObjects reports the pause of each NifcloudMachine once
+	pausedObjects paused.Transitions
 }
 
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=nifcloudmachines,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=nifcloudmachines/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machines;machines/status,verbs=get;list;watch
+// +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters;clusters/status,verbs=get;list;watch
 // +kubebuilder:rbac:groups="",resources=secrets;,verbs=get;list;watch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=nifcloudclusteridentities,verbs=get;list;watch
 // +kubebuilder:rbac:groups="",resources=events,verbs=get;list;watch;create;update;patch
 
 func (r *NifcloudMachineReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, reterr error) {
@@ -61,7 +78,7 @@ func (r *NifcloudMachineReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result,
 	logger := r.Log.WithValues("nifcloudmachine", req.NamespacedName)
 
 	// fetch nifcloud machine
-	nifcloudMachine := &infrav1alpha2.NifcloudMachine{}
+	nifcloudMachine := &infrav1alpha3.NifcloudMachine{}
 	err := r.Get(ctx, req.NamespacedName, nifcloudMachine)
 	if err != nil {
 		if apierrors.IsNotFound(err) {
@@ -91,7 +108,16 @@ func (r *NifcloudMachineReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result,
 
 	logger = logger.WithValues("cluster", cluster.Name)
 
-	nifcloudCluster := &infrav1alpha2.NifcloudCluster{}
+	if paused.IsPaused(cluster, nifcloudMachine) {
+		logger.V(2).Info("NifcloudMachine or linked Cluster is paused, skipping reconciliation")
+		if r.pausedObjects.Paused(nifcloudMachine) {
+			r.Recorder.Eventf(nifcloudMachine, corev1.EventTypeNormal, "ReconciliationPaused", "Reconciliation is paused")
+		}
+		return ctrl.Result{}, nil
+	}
+	r.pausedObjects.Resumed(nifcloudMachine)
+
+	nifcloudCluster := &infrav1alpha3.NifcloudCluster{}
 
 	nifcloudClusterName := client.ObjectKey{
 		Namespace: nifcloudMachine.Namespace,
@@ -107,6 +133,7 @@ func (r *NifcloudMachineReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result,
 	clusterScope, err := scope.NewClusterScope(scope.ClusterScopeParams{
 		Client:          r.Client,
 		Logger:          logger,
+		ClientCache:     r.ClientCache,
 		Cluster:         cluster,
 		NifcloudCluster: nifcloudCluster,
 	})
@@ -127,6 +154,12 @@ func (r *NifcloudMachineReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result,
 	}
 
 	defer func() {
+		conditions.SetSummary(nifcloudMachine,
+			infrav1alpha3.InstanceReadyCondition,
+			infrav1alpha3.AddressAssociatedCondition,
+			infrav1alpha3.BootstrapDeliveredCondition,
+			infrav1alpha3.VolumesAttachedCondition,
+		)
 		if err := machineScope.Close(); err != nil && reterr == nil {
 			reterr = err
 		}
@@ -148,57 +181,102 @@ func (r *NifcloudMachineReconciler) reconcileDelete(machineScope *scope.MachineS
 	}
 
 	if instance == nil {
-		machineScope.V(2).Info("Unable to locate Nifcloud Instance by ID")
-		r.Recorder.Eventf(machineScope.NifcloudMachine, corev1.EventTypeWarning, "NoInstanceFound", "Unable to locate Nifcloud Instance by ID")
-		machineScope.NifcloudMachine.Finalizers = util.Filter(machineScope.NifcloudMachine.Finalizers, infrav1alpha2.MachineFinalizer)
+		// the instance has disappeared after the deletion started by previous reconciliations
+		if machineScope.GetInstanceState() != nil {
+			machineScope.Info("Nifcloud server successfully terminated")
+			r.Recorder.Eventf(machineScope.NifcloudMachine, corev1.EventTypeNormal, "SuccessfullyTerminated", "Terminated instance %q", *machineScope.GetInstanceID())
+		} else {
+			machineScope.V(2).Info("Unable to locate Nifcloud Instance by ID")
+			r.Recorder.Eventf(machineScope.NifcloudMachine, corev1.EventTypeWarning, "NoInstanceFound", "Unable to locate Nifcloud Instance by ID")
+		}
+		machineScope.SetControlPlaneEndpointAttached(false)
+		controllerutil.RemoveFinalizer(machineScope.NifcloudMachine, infrav1alpha3.MachineFinalizer)
 		return ctrl.Result{}, nil
 	}
 
 	machineScope.V(3).Info("Nifcloud server found matching deleted NifcludInstance", "instance-id", instance.ID)
 
-	switch instance.State {
-	case infrav1alpha2.InstanceStopped:
-		machineScope.Info("Terminating Nifcloud server", "instance-id", instance.ID)
-		if err := svc.TerminateInstance(instance.ID); err != nil {
-			r.Recorder.Eventf(machineScope.NifcloudMachine, corev1.EventTypeWarning, "FailedTerminate", "FailedTerminate", "Failed to terminate server %q: %v", instance.ID, err)
-			return ctrl.Result{}, fmt.Errorf("failed to terminate server: %w", err)
+	// the instance is detached from the resources of the cluster before it is terminated,
+	// and each step is confirmed by observing the resources again in the next reconciliation
+	machineScope.SetNotReady()
+	detached, err := svc.DetachControlPlaneEndpoint(instance.ID)
+	if err != nil {
+		r.Recorder.Eventf(machineScope.NifcloudMachine, corev1.EventTypeWarning, "FailedDetachControlPlaneEndpoint", "Failed to detach server %q from control plane endpoint: %v", instance.ID, err)
+		return ctrl.Result{}, fmt.Errorf("failed to detach server from control plane endpoint: %w", err)
+	}
+	if !detached {
+		machineScope.Info("Waiting for server to be detached from control plane endpoint", "instance-id", instance.ID)
+		conditions.MarkFalse(machineScope.NifcloudMachine, infrav1alpha3.InstanceReadyCondition,
+			infrav1alpha3.InstanceDeletingReason, infrav1alpha3.ConditionSeverityInfo, "detaching instance %q from control plane endpoint", instance.ID)
+		return ctrl.Result{RequeueAfter: instanceRequeueAfter}, nil
+	}
+	if machineScope.IsControlPlaneEndpointAttached() {
+		r.Recorder.Eventf(machineScope.NifcloudMachine, corev1.EventTypeNormal, "SuccessfulDetachControlPlaneEndpoint", "Detached server %q from control plane endpoint", instance.ID)
+		machineScope.SetControlPlaneEndpointAttached(false)
+	}
+
+	// security groups protect the instance until it stops
+	if instance.State == infrav1alpha3.InstanceStopped {
+		deregistered, err := svc.DeregisterInstanceFromSecurityGroups(instance.ID)
+		if err != nil {
+			r.Recorder.Eventf(machineScope.NifcloudMachine, corev1.EventTypeWarning, "FailedDeregisterSecurityGroups", "Failed to deregister server %q from security groups: %v", instance.ID, err)
+			return ctrl.Result{}, fmt.Errorf("failed to deregister server from security groups: %w", err)
 		}
-		machineScope.Info("Nifcloud server successfully terminated", "instance-id", instance.ID)
-		r.Recorder.Eventf(machineScope.NifcloudMachine, corev1.EventTypeNormal, "SuccessfullyTerminated", "Terminate instance %q", instance.ID)
-	case infrav1alpha2.InstancePending:
-		machineScope.Info("Nifcloud server is now shutting down, or terminating", "instance-id", instance.ID)
-	default:
-		machineScope.Info("Stopping and Terminating Nifcloud server", "instance-id", instance.ID)
-		if err := svc.StopAndTerminateInstanceWithTimeout(instance.ID); err != nil {
-			r.Recorder.Eventf(machineScope.NifcloudMachine, corev1.EventTypeWarning, "FailedStopAndTerminate", "Failed to stop and terminate server %q: %v", instance.ID, err)
-			return ctrl.Result{}, fmt.Errorf("failed to stop and terminate server: %w", err)
+		if !deregistered {
+			machineScope.Info("Waiting for server to be deregistered from security groups", "instance-id", instance.ID)
+			conditions.MarkFalse(machineScope.NifcloudMachine, infrav1alpha3.InstanceReadyCondition,
+				infrav1alpha3.InstanceDeletingReason, infrav1alpha3.ConditionSeverityInfo, "deregistering instance %q from security groups", instance.ID)
+			return ctrl.Result{RequeueAfter: instanceRequeueAfter}, nil
+		}
+
+		// volumes are detached before the termination, which deletes the volumes attached to the instance
+		released, err := svc.DeleteVolumes(machineScope, instance.ID)
+		if err != nil {
+			r.Recorder.Eventf(machineScope.NifcloudMachine, corev1.EventTypeWarning, "FailedDeleteVolumes", "Failed to delete volumes of server %q: %v", instance.ID, err)
+			return ctrl.Result{}, fmt.Errorf("failed to delete volumes: %w", err)
+		}
+		if !released {
+			machineScope.Info("Waiting for volumes to be detached and deleted", "instance-id", instance.ID)
+			conditions.MarkFalse(machineScope.NifcloudMachine, infrav1alpha3.InstanceReadyCondition,
+				infrav1alpha3.InstanceDeletingReason, infrav1alpha3.ConditionSeverityInfo, "detaching volumes from instance %q", instance.ID)
+			return ctrl.Result{RequeueAfter: instanceRequeueAfter}, nil
 		}
-		machineScope.Info("Nifcloud server successfully terminated", "instance-id", instance.ID)
-		r.Recorder.Eventf(machineScope.NifcloudMachine, corev1.EventTypeNormal, "SuccessfullyTerminated", "Terminate instance %q", instance.ID)
 	}
-	machineScope.NifcloudMachine.Finalizers = util.Filter(machineScope.NifcloudMachine.Finalizers, infrav1alpha2.MachineFinalizer)
-	return ctrl.Result{}, nil
+
+	// each reconciliation takes one step: stop, then terminate, then wait for the instance to disappear
+	machineScope.Info("Deleting Nifcloud server", "instance-id", instance.ID, "state", instance.State)
+	if err := svc.DeleteInstance(instance); err != nil {
+		r.Recorder.Eventf(machineScope.NifcloudMachine, corev1.EventTypeWarning, "FailedTerminate", "Failed to delete server %q: %v", instance.ID, err)
+		return ctrl.Result{}, fmt.Errorf("failed to delete server: %w", err)
+	}
+	machineScope.SetInstanceState(instance.State)
+	conditions.MarkFalse(machineScope.NifcloudMachine, infrav1alpha3.InstanceReadyCondition,
+		infrav1alpha3.InstanceDeletingReason, infrav1alpha3.ConditionSeverityInfo, "instance %q is %s", instance.ID, instance.State)
+
+	return ctrl.Result{RequeueAfter: instanceRequeueAfter}, nil
 }
 
 func (r *NifcloudMachineReconciler) reconcileMachine(ctx context.Context, machineScope *scope.MachineScope, clusterScope *scope.ClusterScope) (ctrl.Result, error) {
 	machineScope.Info("Reconcile NifcloudMachine")
-	if machineScope.NifcloudMachine.Status.ErrorReason != nil || machineScope.NifcloudMachine.Status.ErrorMessage != nil {
+	if machineScope.NifcloudMachine.Status.FailureReason != nil || machineScope.NifcloudMachine.Status.FailureMessage != nil {
 		machineScope.Info("Error state detected, skipping reconciliation")
 		return ctrl.Result{}, nil
 	}
 
-	if !util.Contains(machineScope.NifcloudMachine.Finalizers, infrav1alpha2.MachineFinalizer) {
-		machineScope.V(1).Info("Adding Cluster API Provider Nifcloud finalizer")
-		machineScope.NifcloudMachine.Finalizers = append(machineScope.NifcloudMachine.Finalizers, infrav1alpha2.MachineFinalizer)
-	}
+	controllerutil.AddFinalizer(machineScope.NifcloudMachine, infrav1alpha3.MachineFinalizer)
 
 	if !machineScope.Cluster.Status.InfrastructureReady {
 		machineScope.Info("Cluster infrastructure is not ready yet")
 		return ctrl.Result{}, nil
 	}
 
-	if machineScope.Machine.Spec.Bootstrap.Data == nil {
+	if ok, err := machineScope.LoadBootstrapData(ctx); err != nil {
+		r.Recorder.Eventf(machineScope.NifcloudMachine, corev1.EventTypeWarning, "FailedLoadBootstrapData", "Failed to load bootstrap data: %v", err)
+		return ctrl.Result{}, err
+	} else if !ok {
 		machineScope.Info("Bootstrap data is not yet available")
+		conditions.MarkFalse(machineScope.NifcloudMachine, infrav1alpha3.BootstrapDeliveredCondition,
+			infrav1alpha3.WaitingForBootstrapDataReason, infrav1alpha3.ConditionSeverityInfo, "bootstrap data is not yet available")
 		return ctrl.Result{}, nil
 	}
 
@@ -210,12 +288,15 @@ func (r *NifcloudMachineReconciler) reconcileMachine(ctx context.Context, machin
 	}
 	if instance == nil {
 		machineScope.Info("Nifcloud instance cannot be found")
-		machineScope.SetErrorReason(capierrors.UpdateMachineError)
-		machineScope.SetErrorMessage(fmt.Errorf("Nifcloud instance cannot be found"))
+		machineScope.SetFailureReason(capierrors.UpdateMachineError)
+		machineScope.SetFailureMessage(fmt.Errorf("Nifcloud instance cannot be found"))
 		return ctrl.Result{}, nil
 	}
 
-	machineScope.SetProviderID(fmt.Sprintf("nifcloud:////%s", instance.UID))
+	// instances which are just requested to run may not have the unique id yet
+	if instance.UID != "" {
+		machineScope.SetProviderID(fmt.Sprintf("nifcloud:////%s", instance.UID))
+	}
 
 	existingInstanceState := machineScope.GetInstanceState()
 	machineScope.SetInstanceState(instance.State)
@@ -225,48 +306,98 @@ func (r *NifcloudMachineReconciler) reconcileMachine(ctx context.Context, machin
 		machineScope.Info("Nifcloud instance state changed", "state", instance.State, "instance-id", *instanceID)
 	}
 
+	useSCP := machineScope.BootstrapDelivery() == infrav1alpha3.BootstrapDeliverySCP
+
 	switch instance.State {
-	case infrav1alpha2.InstancePending, infrav1alpha2.InstanceStopped:
-		machineScope.UnsetSendBootstrap()
-		break
-	case infrav1alpha2.InstanceRunning:
+	case infrav1alpha3.InstancePending, infrav1alpha3.InstanceWaiting:
+		// the instance is being created, observe it again instead of waiting here
+		if useSCP {
+			machineScope.UnsetSendBootstrap()
+		}
+		machineScope.SetAddresses(instance.Addresses)
+		conditions.MarkFalse(machineScope.NifcloudMachine, infrav1alpha3.InstanceReadyCondition,
+			infrav1alpha3.InstanceNotReadyReason, infrav1alpha3.ConditionSeverityInfo, "instance is %s", instance.State)
+		return ctrl.Result{RequeueAfter: instanceRequeueAfter}, nil
+	case infrav1alpha3.InstanceStopped:
+		if useSCP {
+			machineScope.UnsetSendBootstrap()
+		}
+		conditions.MarkFalse(machineScope.NifcloudMachine, infrav1alpha3.InstanceReadyCondition,
+			infrav1alpha3.InstanceStoppedReason, infrav1alpha3.ConditionSeverityError, "instance is %s", instance.State)
+		machineScope.SetFailureReason(capierrors.UpdateMachineError)
+		machineScope.SetFailureMessage(errors.Errorf("nifcloud instance state %q is unexpected", instance.State))
+	case infrav1alpha3.InstanceRunning:
+		if machineScope.IsControlPlane() && !machineScope.IsControlPlaneEndpointAttached() {
+			if err := svc.AttachControlPlaneEndpoint(instance.ID); err != nil {
+				r.Recorder.Eventf(machineScope.NifcloudMachine, corev1.EventTypeWarning, "FailedAttachControlPlaneEndpoint", "Failed to attach server %q to control plane endpoint: %v", instance.ID, err)
+				conditions.MarkFalse(machineScope.NifcloudMachine, infrav1alpha3.AddressAssociatedCondition,
+					infrav1alpha3.AddressAssociationFailedReason, infrav1alpha3.ConditionSeverityError, "%v", err)
+				return ctrl.Result{}, fmt.Errorf("failed to attach control plane endpoint: %w", err)
+			}
+			machineScope.SetControlPlaneEndpointAttached(true)
+		}
+		conditions.MarkTrue(machineScope.NifcloudMachine, infrav1alpha3.AddressAssociatedCondition)
+
+		// the userdata waits for the volumes, they are created one by one in the following reconciliations
+		attached, err := svc.ReconcileVolumes(machineScope, instance.ID)
+		if err != nil {
+			conditions.MarkFalse(machineScope.NifcloudMachine, infrav1alpha3.VolumesAttachedCondition,
+				infrav1alpha3.VolumeProvisionFailedReason, infrav1alpha3.ConditionSeverityError, "%v", err)
+			return ctrl.Result{}, fmt.Errorf("failed to reconcile volumes: %w", err)
+		}
+		if !attached {
+			conditions.MarkFalse(machineScope.NifcloudMachine, infrav1alpha3.VolumesAttachedCondition,
+				infrav1alpha3.VolumesAttachingReason, infrav1alpha3.ConditionSeverityInfo, "attaching volumes to instance %q", instance.ID)
+			machineScope.SetAddresses(instance.Addresses)
+			return ctrl.Result{RequeueAfter: instanceRequeueAfter}, nil
+		}
+		if len(machineScope.NifcloudMachine.Spec.Volumes) > 0 {
+			conditions.MarkTrue(machineScope.NifcloudMachine, infrav1alpha3.VolumesAttachedCondition)
+		}
+		conditions.MarkTrue(machineScope.NifcloudMachine, infrav1alpha3.InstanceReadyCondition)
 		machineScope.SetReady()
 	default:
 		machineScope.SetNotReady()
-		machineScope.UnsetSendBootstrap()
+		if useSCP {
+			machineScope.UnsetSendBootstrap()
+		}
 		machineScope.Info("nifcloud instance state is undefined", "state", instance.State, "instace-id", *instanceID)
-		machineScope.SetErrorReason(capierrors.UpdateMachineError)
-		machineScope.SetErrorMessage(errors.Errorf("nifcloud instance state %q is undefined", instance.State))
-	}
-
-	if instance.State == infrav1alpha2.InstanceStopped {
-		machineScope.SetErrorReason(capierrors.UpdateMachineError)
-		machineScope.SetErrorMessage(errors.Errorf("nifcloud instance state %q is unexpected", instance.State))
+		conditions.MarkFalse(machineScope.NifcloudMachine, infrav1alpha3.InstanceReadyCondition,
+			infrav1alpha3.InstanceNotReadyReason, infrav1alpha3.ConditionSeverityError, "instance state %q is undefined", instance.State)
+		machineScope.SetFailureReason(capierrors.UpdateMachineError)
+		machineScope.SetFailureMessage(errors.Errorf("nifcloud instance state %q is undefined", instance.State))
 	}
 
 	machineScope.SetAddresses(instance.Addresses)
 
-	// send bootstrap data over ssh
-	// because nifcldoud userData is limited 8KB
-	if !machineScope.IsSendBootstrap() && machineScope.NifcloudMachine.Status.Ready {
+	// send bootstrap data over ssh only when the machine opts in to it,
+	// otherwise bootstrap data has been embedded in userdata at creation
+	if useSCP && !machineScope.IsSendBootstrap() && !machineScope.NifcloudMachine.Status.Ready {
+		conditions.MarkFalse(machineScope.NifcloudMachine, infrav1alpha3.BootstrapDeliveredCondition,
+			infrav1alpha3.WaitingForInstanceReason, infrav1alpha3.ConditionSeverityInfo, "waiting for the instance to get running")
+	}
+	if useSCP && !machineScope.IsSendBootstrap() && machineScope.NifcloudMachine.Status.Ready {
 		machineScope.Info("wait for remote machine provisioning")
 		ip := instance.PublicIP
 		if machineScope.IsControlPlane() {
-			ip = machineScope.NifcloudCluster.Status.APIEndpoints[0].Host
+			ip = machineScope.NifcloudCluster.Spec.ControlPlaneEndpoint.Host
 		}
-		time.Sleep(3 * time.Second)
-		err := r.sendBootstrapDataWithSCP(machineScope, ip, "22")
-		if err != nil {
-			return ctrl.Result{}, err
+		// sshd may not be up just after the instance gets running, retry later instead of sleeping
+		if err := r.sendBootstrapDataWithSCP(machineScope, ip, "22"); err != nil {
+			machineScope.Info("failed to send bootstrap data, retrying", "error", err.Error())
+			conditions.MarkFalse(machineScope.NifcloudMachine, infrav1alpha3.BootstrapDeliveredCondition,
+				infrav1alpha3.BootstrapDeliveryFailedReason, infrav1alpha3.ConditionSeverityWarning, "%v", err)
+			return ctrl.Result{RequeueAfter: instanceRequeueAfter}, nil
 		}
-		machineScope.SetSendBootstrap()
+		machineScope.SetSendBootstrap(infrav1alpha3.BootstrapDeliverySCP)
+		conditions.MarkTrue(machineScope.NifcloudMachine, infrav1alpha3.BootstrapDeliveredCondition)
 		machineScope.Info("success to send bootstrap data to nifcloud server")
 	}
 
 	return ctrl.Result{}, nil
 }
 
-func (r *NifcloudMachineReconciler) getOrCreate(scope *scope.MachineScope, svc services.NifcloudMachineInterface) (*infrav1alpha2.Instance, error) {
+func (r *NifcloudMachineReconciler) getOrCreate(scope *scope.MachineScope, svc services.NifcloudMachineInterface) (*infrav1alpha3.Instance, error) {
 	instance, err := r.findInstance(scope, svc)
 	if err != nil {
 		return nil, err
@@ -278,12 +409,15 @@ func (r *NifcloudMachineReconciler) getOrCreate(scope *scope.MachineScope, svc s
 		if err != nil {
 			return nil, fmt.Errorf("failed to create Nifcloud instance for NifcloudMachine %s/%s: %w", scope.Namespace(), scope.Name(), err)
 		}
+		if scope.BootstrapDelivery() == infrav1alpha3.BootstrapDeliveryUserData {
+			scope.SetSendBootstrap(infrav1alpha3.BootstrapDeliveryUserData)
+		}
 	}
 
 	return instance, nil
 }
 
-func (r *NifcloudMachineReconciler) findInstance(scope *scope.MachineScope, svc services.NifcloudMachineInterface) (*infrav1alpha2.Instance, error) {
+func (r *NifcloudMachineReconciler) findInstance(scope *scope.MachineScope, svc services.NifcloudMachineInterface) (*infrav1alpha3.Instance, error) {
 	// Parse the ProviderID
 	_, err := noderefutil.NewProviderID(scope.GetProviderID())
 	if err != nil && err != noderefutil.ErrEmptyProviderID {
@@ -315,7 +449,12 @@ func (r *NifcloudMachineReconciler) getComputingService(scope *scope.ClusterScop
 }
 
 func (r *NifcloudMachineReconciler) sendBootstrapDataWithSCP(scope *scope.MachineScope, host, port string) error {
-	userData := scope.GetRawBootstrapData()
+	// the watcher script on the instance decodes base64 encoded bootstrap data
+	data, err := scope.GetBootstrapData()
+	if err != nil {
+		return err
+	}
+	userData := []byte(data)
 	reader := bytes.NewReader(userData)
 	pass := os.Getenv("CLUSTER_API_PRIVATE_KEY_PASS")
 
@@ -344,6 +483,92 @@ func (r *NifcloudMachineReconciler) sendBootstrapDataWithSCP(scope *scope.Machin
 
 func (r *NifcloudMachineReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&infrav1alpha2.NifcloudMachine{}).
+		For(&infrav1alpha3.NifcloudMachine{}).
+		Watches(
+			&source.Kind{Type: &clusterv1.Machine{}},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.MachineToNifcloudMachines)},
+		).
+		Watches(
+			&source.Kind{Type: &infrav1alpha3.NifcloudCluster{}},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.NifcloudClusterToNifcloudMachines)},
+		).
+		Watches(
+			&source.Kind{Type: &clusterv1.Cluster{}},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.ClusterToNifcloudMachines)},
+		).
+		WithEventFilter(paused.ResourceNotPaused(r.Log)).
 		Complete(r)
 }
+
+// MachineToNifcloudMachines maps the Machine to the NifcloudMachine it refers to
+func (r *NifcloudMachineReconciler) MachineToNifcloudMachines(o handler.MapObject) []ctrl.Request {
+	m, ok := o.Object.(*clusterv1.Machine)
+	if !ok {
+		return nil
+	}
+	return machineToNifcloudMachine(m)
+}
+
+// NifcloudClusterToNifcloudMachines maps the ready NifcloudCluster to all NifcloudMachines of the owner Cluster,
+// so that machines waiting for the infrastructure start without the resync period
+func (r *NifcloudMachineReconciler) NifcloudClusterToNifcloudMachines(o handler.MapObject) []ctrl.Request {
+	c, ok := o.Object.(*infrav1alpha3.NifcloudCluster)
+	if !ok || !c.Status.Ready {
+		return nil
+	}
+
+	cluster, err := util.GetOwnerCluster(context.TODO(), r.Client, c.ObjectMeta)
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			r.Log.Error(err, "failed to get owner cluster", "nifcloudCluster", c.Name, "namespace", c.Namespace)
+		}
+		return nil
+	}
+	if cluster == nil {
+		return nil
+	}
+	return r.clusterToNifcloudMachines(cluster.Namespace, cluster.Name)
+}
+
+// ClusterToNifcloudMachines maps the Cluster to all NifcloudMachines in the cluster
+func (r *NifcloudMachineReconciler) ClusterToNifcloudMachines(o handler.MapObject) []ctrl.Request {
+	c, ok := o.Object.(*clusterv1.Cluster)
+	if !ok {
+		return nil
+	}
+	return r.clusterToNifcloudMachines(c.Namespace, c.Name)
+}
+
+func (r *NifcloudMachineReconciler) clusterToNifcloudMachines(namespace, clusterName string) []ctrl.Request {
+	machines := &clusterv1.MachineList{}
+	if err := r.Client.List(context.TODO(), machines,
+		client.InNamespace(namespace),
+		client.MatchingLabels{clusterv1.ClusterLabelName: clusterName},
+	); err != nil {
+		r.Log.Error(err, "failed to list machines", "cluster", clusterName, "namespace", namespace)
+		return nil
+	}
+
+	requests := []ctrl.Request{}
+	for i := range machines.Items {
+		requests = append(requests, machineToNifcloudMachine(&machines.Items[i])...)
+	}
+	return requests
+}
+
+// machineToNifcloudMachine returns the request for the NifcloudMachine which the Machine refers to,
+// the version is ignored because the machine may refer to any served version
+func machineToNifcloudMachine(m *clusterv1.Machine) []ctrl.Request {
+	ref := m.Spec.InfrastructureRef
+	if ref.GroupVersionKind().GroupKind() != infrav1alpha3.GroupVersion.WithKind("NifcloudMachine").GroupKind() {
+		return nil
+	}
+	return []ctrl.Request{
+		{
+			NamespacedName: client.ObjectKey{
+				Namespace: m.Namespace,
+				Name:      ref.Name,
+			},
+		},
+	}
+}
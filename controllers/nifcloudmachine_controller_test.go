@@ -0,0 +1,442 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/aokumasan/nifcloud-sdk-go-v2/service/computing"
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
+	nferrors "github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/errors"
+	nffake "github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/fake"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/scope"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/services"
+)
+
+func newTestMachine(name, clusterName string, ref corev1.ObjectReference) *clusterv1.Machine {
+	return &clusterv1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels:    map[string]string{clusterv1.ClusterLabelName: clusterName},
+		},
+		Spec: clusterv1.MachineSpec{InfrastructureRef: ref},
+	}
+}
+
+func TestNifcloudMachineReconciler_mapFuncs(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clusterv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := infrav1alpha3.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	nifcloudMachineRef := func(version, name string) corev1.ObjectReference {
+		return corev1.ObjectReference{
+			APIVersion: infrav1alpha3.GroupVersion.Group + "/" + version,
+			Kind:       "NifcloudMachine",
+			Name:       name,
+		}
+	}
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+	}
+	machines := []runtime.Object{
+		newTestMachine("m1", "test-cluster", nifcloudMachineRef("v1alpha3", "nm1")),
+		newTestMachine("m2", "test-cluster", nifcloudMachineRef("v1alpha2", "nm2")),
+		newTestMachine("m3", "test-cluster", corev1.ObjectReference{APIVersion: "infrastructure.cluster.x-k8s.io/v1alpha2", Kind: "AWSMachine", Name: "am3"}),
+		newTestMachine("m4", "other-cluster", nifcloudMachineRef("v1alpha3", "nm4")),
+	}
+	r := &NifcloudMachineReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, append(machines, cluster)...),
+		Log:    log.Log,
+	}
+
+	request := func(name string) ctrl.Request {
+		return ctrl.Request{NamespacedName: client.ObjectKey{Namespace: "default", Name: name}}
+	}
+	ownedNifcloudCluster := func(ready bool) *infrav1alpha3.NifcloudCluster {
+		c := &infrav1alpha3.NifcloudCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-nifcloud-cluster",
+				Namespace: "default",
+				OwnerReferences: []metav1.OwnerReference{
+					{APIVersion: clusterv1.GroupVersion.String(), Kind: "Cluster", Name: "test-cluster"},
+				},
+			},
+		}
+		c.Status.Ready = ready
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		mapFunc handler.ToRequestsFunc
+		object  runtime.Object
+		want    []ctrl.Request
+	}{
+		{
+			name:    "machine refers to nifcloud machine",
+			mapFunc: r.MachineToNifcloudMachines,
+			object:  machines[0],
+			want:    []ctrl.Request{request("nm1")},
+		},
+		{
+			name:    "machine refers to another provider",
+			mapFunc: r.MachineToNifcloudMachines,
+			object:  machines[2],
+		},
+		{
+			name:    "cluster maps to nifcloud machines of the cluster",
+			mapFunc: r.ClusterToNifcloudMachines,
+			object:  cluster,
+			want:    []ctrl.Request{request("nm1"), request("nm2")},
+		},
+		{
+			name:    "ready nifcloud cluster maps to nifcloud machines of the owner",
+			mapFunc: r.NifcloudClusterToNifcloudMachines,
+			object:  ownedNifcloudCluster(true),
+			want:    []ctrl.Request{request("nm1"), request("nm2")},
+		},
+		{
+			name:    "nifcloud cluster which is not ready",
+			mapFunc: r.NifcloudClusterToNifcloudMachines,
+			object:  ownedNifcloudCluster(false),
+		},
+		{
+			name:    "nifcloud cluster without owner",
+			mapFunc: r.NifcloudClusterToNifcloudMachines,
+			object: &infrav1alpha3.NifcloudCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: "orphan", Namespace: "default"},
+				Status:     infrav1alpha3.NifcloudClusterStatus{Ready: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.mapFunc(handler.MapObject{Object: tt.object})
+			if len(got) == 0 && len(tt.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClusterToNifcloudCluster(t *testing.T) {
+	tests := []struct {
+		name string
+		ref  *corev1.ObjectReference
+		want []ctrl.Request
+	}{
+		{
+			name: "no infrastructure",
+		},
+		{
+			name: "refers to nifcloud cluster",
+			ref:  &corev1.ObjectReference{APIVersion: "infrastructure.cluster.x-k8s.io/v1alpha2", Kind: "NifcloudCluster", Name: "nc"},
+			want: []ctrl.Request{{NamespacedName: client.ObjectKey{Namespace: "default", Name: "nc"}}},
+		},
+		{
+			name: "refers to another provider",
+			ref:  &corev1.ObjectReference{APIVersion: "infrastructure.cluster.x-k8s.io/v1alpha2", Kind: "AWSCluster", Name: "ac"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &clusterv1.Cluster{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+				Spec:       clusterv1.ClusterSpec{InfrastructureRef: tt.ref},
+			}
+			got := ClusterToNifcloudCluster(handler.MapObject{Object: c})
+			if len(got) == 0 && len(tt.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeMachineService records the deletion steps requested by the reconciler
+type fakeMachineService struct {
+	services.NifcloudMachineInterface
+
+	instance     *infrav1alpha3.Instance
+	detached     bool
+	deregistered bool
+	// volumesKept makes the volumes remain attached to the instance
+	volumesKept bool
+
+	deregisterCalled    bool
+	deleteVolumesCalled bool
+	deleteCalled        bool
+}
+
+func (f *fakeMachineService) InstanceIfExists(_ *string) (*infrav1alpha3.Instance, error) {
+	return f.instance, nil
+}
+
+func (f *fakeMachineService) DetachControlPlaneEndpoint(_ string) (bool, error) {
+	return f.detached, nil
+}
+
+func (f *fakeMachineService) DeregisterInstanceFromSecurityGroups(_ string) (bool, error) {
+	f.deregisterCalled = true
+	return f.deregistered, nil
+}
+
+func (f *fakeMachineService) DeleteVolumes(_ *scope.MachineScope, _ string) (bool, error) {
+	f.deleteVolumesCalled = true
+	return !f.volumesKept, nil
+}
+
+func (f *fakeMachineService) DeleteInstance(_ *infrav1alpha3.Instance) error {
+	f.deleteCalled = true
+	return nil
+}
+
+func TestNifcloudMachineReconciler_reconcileDelete(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := infrav1alpha3.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		svc            *fakeMachineService
+		wantDeregister bool
+		wantVolumes    bool
+		wantDelete     bool
+		wantFinalizer  bool
+		wantAttached   bool
+	}{
+		{
+			name:          "wait for the instance to be detached from the endpoint",
+			svc:           &fakeMachineService{instance: &infrav1alpha3.Instance{ID: "test", State: infrav1alpha3.InstanceRunning}},
+			wantFinalizer: true,
+			wantAttached:  true,
+		},
+		{
+			name:          "stop the detached instance",
+			svc:           &fakeMachineService{instance: &infrav1alpha3.Instance{ID: "test", State: infrav1alpha3.InstanceRunning}, detached: true},
+			wantDelete:    true,
+			wantFinalizer: true,
+		},
+		{
+			name:           "wait for the stopped instance to be deregistered from security groups",
+			svc:            &fakeMachineService{instance: &infrav1alpha3.Instance{ID: "test", State: infrav1alpha3.InstanceStopped}, detached: true},
+			wantDeregister: true,
+			wantFinalizer:  true,
+		},
+		{
+			name:           "wait for the volumes to be detached from the deregistered instance",
+			svc:            &fakeMachineService{instance: &infrav1alpha3.Instance{ID: "test", State: infrav1alpha3.InstanceStopped}, detached: true, deregistered: true, volumesKept: true},
+			wantDeregister: true,
+			wantVolumes:    true,
+			wantFinalizer:  true,
+		},
+		{
+			name:           "terminate the deregistered instance",
+			svc:            &fakeMachineService{instance: &infrav1alpha3.Instance{ID: "test", State: infrav1alpha3.InstanceStopped}, detached: true, deregistered: true},
+			wantDeregister: true,
+			wantVolumes:    true,
+			wantDelete:     true,
+			wantFinalizer:  true,
+		},
+		{
+			name: "remove the finalizer once the instance disappears",
+			svc:  &fakeMachineService{detached: true, deregistered: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nifcloudMachine := &infrav1alpha3.NifcloudMachine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "test-machine",
+					Namespace:  "default",
+					Finalizers: []string{infrav1alpha3.MachineFinalizer},
+				},
+				Spec: infrav1alpha3.NifcloudMachineSpec{ProviderID: pointer.StringPtr("nifcloud:////test")},
+			}
+			nifcloudMachine.Status.ControlPlaneEndpointAttached = true
+			machineScope, err := scope.NewMachineScope(scope.MachineScopeParams{
+				Client:          fake.NewFakeClientWithScheme(scheme, nifcloudMachine),
+				Machine:         &clusterv1.Machine{},
+				Cluster:         &clusterv1.Cluster{},
+				NifcloudCluster: &infrav1alpha3.NifcloudCluster{},
+				NifcloudMachine: nifcloudMachine,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			clusterScope, err := scope.NewClusterScope(scope.ClusterScopeParams{
+				Cluster:         &clusterv1.Cluster{},
+				NifcloudCluster: &infrav1alpha3.NifcloudCluster{},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := &NifcloudMachineReconciler{
+				Log:      log.Log,
+				Recorder: record.NewFakeRecorder(10),
+				serviceFactory: func(*scope.ClusterScope) services.NifcloudMachineInterface {
+					return tt.svc
+				},
+			}
+			if _, err := r.reconcileDelete(machineScope, clusterScope); err != nil {
+				t.Fatalf("did not expect error: %v", err)
+			}
+
+			if tt.svc.deregisterCalled != tt.wantDeregister {
+				t.Errorf("expected deregistration %v, got %v", tt.wantDeregister, tt.svc.deregisterCalled)
+			}
+			if tt.svc.deleteVolumesCalled != tt.wantVolumes {
+				t.Errorf("expected volume deletion %v, got %v", tt.wantVolumes, tt.svc.deleteVolumesCalled)
+			}
+			if tt.svc.deleteCalled != tt.wantDelete {
+				t.Errorf("expected deletion %v, got %v", tt.wantDelete, tt.svc.deleteCalled)
+			}
+			if got := sets.NewString(nifcloudMachine.Finalizers...).Has(infrav1alpha3.MachineFinalizer); got != tt.wantFinalizer {
+				t.Errorf("expected finalizer %v, got %v", tt.wantFinalizer, got)
+			}
+			if got := nifcloudMachine.Status.ControlPlaneEndpointAttached; got != tt.wantAttached {
+				t.Errorf("expected attached %v, got %v", tt.wantAttached, got)
+			}
+		})
+	}
+}
+
+func TestNifcloudMachineReconciler_reconcileDelete_steps(t *testing.T) {
+	ctx := context.TODO()
+	scheme := runtime.NewScheme()
+	if err := infrav1alpha3.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	cloud := nffake.NewClient()
+	instanceID := scope.InstanceIDFromName("test-machine")
+
+	// a running control plane instance which has the endpoint address
+	if _, err := cloud.CreateSecurityGroup(ctx, &computing.CreateSecurityGroupInput{GroupName: pointer.StringPtr("testcp")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cloud.RunInstances(ctx, &computing.RunInstancesInput{
+		InstanceId:    pointer.StringPtr(instanceID),
+		SecurityGroup: []string{"testcp"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	addr, err := cloud.AllocateAddress(ctx, &computing.AllocateAddressInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cloud.AssociateAddress(ctx, &computing.AssociateAddressInput{
+		PublicIp:   addr.PublicIp,
+		InstanceId: pointer.StringPtr(instanceID),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	cloud.Advance()
+
+	nifcloudCluster := &infrav1alpha3.NifcloudCluster{
+		Spec: infrav1alpha3.NifcloudClusterSpec{
+			ControlPlaneEndpoint: infrav1alpha3.APIEndpoint{Host: *addr.PublicIp, Port: 6443},
+		},
+	}
+	nifcloudCluster.Status.Network.SecurityGroups = map[infrav1alpha3.SecurityGroupRole]infrav1alpha3.SecurityGroup{
+		infrav1alpha3.SecurityGroupControlPlane: {Name: "testcp"},
+	}
+	clusterScope, err := scope.NewClusterScope(scope.ClusterScopeParams{
+		Cluster:         &clusterv1.Cluster{},
+		NifcloudCluster: nifcloudCluster,
+		NifcloudClients: scope.NifcloudClients{Computing: cloud},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nifcloudMachine := &infrav1alpha3.NifcloudMachine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "test-machine",
+			Namespace:  "default",
+			Finalizers: []string{infrav1alpha3.MachineFinalizer},
+		},
+		Spec: infrav1alpha3.NifcloudMachineSpec{ProviderID: pointer.StringPtr("nifcloud:////" + instanceID)},
+	}
+	nifcloudMachine.Status.ControlPlaneEndpointAttached = true
+	machineScope, err := scope.NewMachineScope(scope.MachineScopeParams{
+		Client:          fake.NewFakeClientWithScheme(scheme, nifcloudMachine),
+		Machine:         &clusterv1.Machine{},
+		Cluster:         &clusterv1.Cluster{},
+		NifcloudCluster: nifcloudCluster,
+		NifcloudMachine: nifcloudMachine,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &NifcloudMachineReconciler{
+		Log:      log.Log,
+		Recorder: record.NewFakeRecorder(20),
+	}
+	// detach, stop, deregister, terminate and observe the termination
+	for i := 0; i < 10 && sets.NewString(nifcloudMachine.Finalizers...).Has(infrav1alpha3.MachineFinalizer); i++ {
+		if _, err := r.reconcileDelete(machineScope, clusterScope); err != nil {
+			t.Fatalf("did not expect error: %v", err)
+		}
+	}
+	if sets.NewString(nifcloudMachine.Finalizers...).Has(infrav1alpha3.MachineFinalizer) {
+		t.Fatal("expected the finalizer to be removed")
+	}
+
+	if _, err := cloud.DescribeInstances(ctx, &computing.DescribeInstancesInput{InstanceId: []string{instanceID}}); !nferrors.IsNotFound(err) {
+		t.Errorf("expected the instance to be terminated, got %v", err)
+	}
+	addrs, err := cloud.DescribeAddresses(ctx, &computing.DescribeAddressesInput{PublicIp: []string{*addr.PublicIp}})
+	if err != nil {
+		t.Fatalf("expected the endpoint address to be kept: %v", err)
+	}
+	if id := addrs.AddressesSet[0].InstanceId; id != nil && *id != "" {
+		t.Errorf("expected the endpoint address to be disassociated, got instance %q", *id)
+	}
+	if n := cloud.Calls("DeregisterInstancesFromSecurityGroup"); n != 1 {
+		t.Errorf("expected the instance to be deregistered from the security group once, got %d", n)
+	}
+	if n := cloud.Calls("TerminateInstances"); n != 1 {
+		t.Errorf("expected the instance to be terminated once, got %d", n)
+	}
+}
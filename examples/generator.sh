@@ -2,8 +2,7 @@
 
 # Versions
 CAPN_VERSION="v0.0.0"
-CAPI_VERSION="v0.2.8"
-CABPK_VERSION="v0.1.5"
+CAPI_VERSION="v0.3.6"
 CALICO_VERSION="v3.10"
 
 # Nifcloud Settings
@@ -20,9 +19,11 @@ export CLUSTER_NAME="${CLUSTER_NAME:-capi}"
 # 55395: photon-3
 export CONTROL_PLANE_IMAGE_ID="${CONTROL_PLANE_IMAGE_ID:-'55395'}"
 export NODE_IMAGE_ID="${NODE_IMAGE_ID:-'55395'}"
+export BASTION_IMAGE_ID="${BASTION_IMAGE_ID:-'55395'}"
 # kubeadm required 2x CPU
 export CONTROL_PLANE_INSTANCE_TYPE="${CONTROL_PLANE_INSTANCE_TYPE:-medium}"
 export NODE_INSTANCE_TYPE="${NODE_INSTANCE_TYPE:-medium}"
+export WORKER_MACHINE_COUNT="${WORKER_MACHINE_COUNT:-1}"
 
 # Output Settings
 SOURCE_DIR="$( cd "$( dirname "${BASH_SOURCE[0]}" )" >/dev/null && pwd )"
@@ -68,11 +69,11 @@ kustomize build "${SOURCE_DIR}/../config/default" | envsubst > "${COMPONENTS_NIF
 echo "Generated ${COMPONENTS_NIFCLOUD_GENERATED_FILE}"
 
 ## Cluster API
-kustomize build "github.com/kubernetes-sigs/cluster-api/config/default/?ref=${CAPI_VERSION}" > "${COMPONENTS_CLUSTER_API_GENERATED_FILE}"
+kustomize build "github.com/kubernetes-sigs/cluster-api/config/?ref=${CAPI_VERSION}" > "${COMPONENTS_CLUSTER_API_GENERATED_FILE}"
 echo "Generated ${COMPONENTS_CLUSTER_API_GENERATED_FILE}"
 
 ## Cluster API Bootstrap Provider kubeadm
-kustomize build "github.com/kubernetes-sigs/cluster-api-bootstrap-provider-kubeadm/config/default/?ref=${CABPK_VERSION}" > "${COMPONENTS_KUBEADM_GENERATED_FILE}"
+kustomize build "github.com/kubernetes-sigs/cluster-api/bootstrap/kubeadm/config/?ref=${CAPI_VERSION}" > "${COMPONENTS_KUBEADM_GENERATED_FILE}"
 echo "Generated ${COMPONENTS_KUBEADM_GENERATED_FILE}"
 
 # Download Network Plugin (Calico) manifest
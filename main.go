@@ -19,13 +19,19 @@ package main
 import (
 	"flag"
 	"os"
+	"time"
 
 	infrav1alpha2 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha2"
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
 	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/controllers"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/metrics"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/scope"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/scope/nifcloud"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/gc"
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
-	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
 	"sigs.k8s.io/cluster-api/util/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
@@ -41,15 +47,31 @@ func init() {
 	_ = clientgoscheme.AddToScheme(scheme)
 	_ = clusterv1.AddToScheme(scheme)
 	_ = infrav1alpha2.AddToScheme(scheme)
+	_ = infrav1alpha3.AddToScheme(scheme)
 	// +kubebuilder:scaffold:scheme
 }
 
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
+	var orphanGCInterval time.Duration
+	var orphanGCDryRun bool
+	clientOptions := nifcloud.DefaultClientOptions()
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
+	flag.DurationVar(&orphanGCInterval, "orphan-gc-interval", 0,
+		"The interval to collect nifcloud resources whose owners no longer exist. The collector is disabled with 0.")
+	flag.BoolVar(&orphanGCDryRun, "orphan-gc-dry-run", true,
+		"Only report orphaned nifcloud resources with events and metrics without deleting them.")
+	flag.Float64Var(&clientOptions.QPS, "nifcloud-api-qps", clientOptions.QPS,
+		"The number of requests per second to the nifcloud API for each account. The limit is disabled with 0.")
+	flag.IntVar(&clientOptions.Burst, "nifcloud-api-burst", clientOptions.Burst,
+		"The number of requests to the nifcloud API allowed at once beyond the QPS.")
+	flag.IntVar(&clientOptions.MaxRetries, "nifcloud-api-max-retries", clientOptions.MaxRetries,
+		"The number of retries of the requests to the nifcloud API which fail with throttling, server errors or resources in transition.")
+	flag.StringVar(&clientOptions.Endpoint, "nifcloud-endpoint", clientOptions.Endpoint,
+		"The URL of the nifcloud computing API which replaces the endpoint of the region, such as a local stand-in for tests.")
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(func(o *zap.Options) {
@@ -69,25 +91,67 @@ func main() {
 
 	record.InitFromRecorder(mgr.GetEventRecorderFor("nifcloud-controller"))
 
+	if err := metrics.RegisterClusterResourceCollector(mgr.GetClient()); err != nil {
+		setupLog.Error(err, "unable to register metrics")
+		os.Exit(1)
+	}
+
 	// setup machine controller
+	// clients are shared by the controllers, and recreated when the credentials are rotated
+	clientCache := scope.NewClientCache(nifcloud.NewNifcloudClientFactory(clientOptions))
+
 	if err = (&controllers.NifcloudMachineReconciler{
-		Client:   mgr.GetClient(),
-		Log:      ctrl.Log.WithName("controller").WithName("NifcloudCluser"),
-		Recorder: mgr.GetEventRecorderFor("nifcloudmachine-controller"),
+		Client:      mgr.GetClient(),
+		ClientCache: clientCache,
+		Log:         ctrl.Log.WithName("controller").WithName("NifcloudCluser"),
+		Recorder:    mgr.GetEventRecorderFor("nifcloudmachine-controller"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "NifcloudMachine")
 		os.Exit(1)
 	}
 	// setup cluster controller
 	if err = (&controllers.NifcloudClusterReconciler{
-		Client:   mgr.GetClient(),
-		Log:      ctrl.Log.WithName("controller").WithName("NifcloudCluster"),
-		Recorder: mgr.GetEventRecorderFor("nifcloudcluster-controller"),
+		Client:      mgr.GetClient(),
+		ClientCache: clientCache,
+		Log:         ctrl.Log.WithName("controller").WithName("NifcloudCluster"),
+		Recorder:    mgr.GetEventRecorderFor("nifcloudcluster-controller"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "NifcloudCluster")
 		os.Exit(1)
 	}
 
+	// collect resources leaked by failed reconciliations
+	if orphanGCInterval > 0 {
+		if err = mgr.Add(&gc.Collector{
+			Client:      mgr.GetClient(),
+			ClientCache: clientCache,
+			Log:         ctrl.Log.WithName("orphan-gc"),
+			Recorder:    mgr.GetEventRecorderFor("orphan-gc"),
+			Interval:    orphanGCInterval,
+			DryRun:      orphanGCDryRun,
+			Namespace:   os.Getenv("POD_NAMESPACE"),
+		}); err != nil {
+			setupLog.Error(err, "unable to add orphaned resource collector")
+			os.Exit(1)
+		}
+	}
+
+	// webhooks need serving certificates, disable them to run the manager locally
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&infrav1alpha3.NifcloudCluster{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "NifcloudCluster")
+			os.Exit(1)
+		}
+		if err = (&infrav1alpha3.NifcloudMachine{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "NifcloudMachine")
+			os.Exit(1)
+		}
+		if err = (&infrav1alpha3.NifcloudMachineTemplate{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "NifcloudMachineTemplate")
+			os.Exit(1)
+		}
+	}
+
 	// +kubebuilder:scaffold:builder
 
 	setupLog.Info("starting manager")
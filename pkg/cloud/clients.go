@@ -29,6 +29,7 @@ type Client interface {
 	ReleaseAddress(context.Context, *computing.ReleaseAddressInput) (*computing.ReleaseAddressOutput, error)
 	DescribeAddresses(context.Context, *computing.DescribeAddressesInput) (*computing.DescribeAddressesOutput, error)
 	DisassociateAddress(context.Context, *computing.DisassociateAddressInput) (*computing.DisassociateAddressOutput, error)
+	NiftyModifyAddressAttribute(context.Context, *computing.NiftyModifyAddressAttributeInput) (*computing.NiftyModifyAddressAttributeOutput, error)
 	DescribeInstances(context.Context, *computing.DescribeInstancesInput) (*computing.DescribeInstancesOutput, error)
 	DescribeImages(context.Context, *computing.DescribeImagesInput) (*computing.DescribeImagesOutput, error)
 	RunInstances(context.Context, *computing.RunInstancesInput) (*computing.RunInstancesOutput, error)
@@ -42,6 +43,30 @@ type Client interface {
 	RegisterInstancesWithSecurityGroup(context.Context, *computing.RegisterInstancesWithSecurityGroupInput) (*computing.RegisterInstancesWithSecurityGroupOutput, error)
 	DeregisterInstancesFromSecurityGroup(context.Context, *computing.DeregisterInstancesFromSecurityGroupInput) (*computing.DeregisterInstancesFromSecurityGroupOutput, error)
 	AssociateAddress(context.Context, *computing.AssociateAddressInput) (*computing.AssociateAddressOutput, error)
+	CreateLoadBalancer(context.Context, *computing.CreateLoadBalancerInput) (*computing.CreateLoadBalancerOutput, error)
+	DeleteLoadBalancer(context.Context, *computing.DeleteLoadBalancerInput) (*computing.DeleteLoadBalancerOutput, error)
+	DescribeLoadBalancers(context.Context, *computing.DescribeLoadBalancersInput) (*computing.DescribeLoadBalancersOutput, error)
+	ConfigureHealthCheck(context.Context, *computing.ConfigureHealthCheckInput) (*computing.ConfigureHealthCheckOutput, error)
+	RegisterInstancesWithLoadBalancer(context.Context, *computing.RegisterInstancesWithLoadBalancerInput) (*computing.RegisterInstancesWithLoadBalancerOutput, error)
+	DeregisterInstancesFromLoadBalancer(context.Context, *computing.DeregisterInstancesFromLoadBalancerInput) (*computing.DeregisterInstancesFromLoadBalancerOutput, error)
+	NiftyCreatePrivateLan(context.Context, *computing.NiftyCreatePrivateLanInput) (*computing.NiftyCreatePrivateLanOutput, error)
+	NiftyDeletePrivateLan(context.Context, *computing.NiftyDeletePrivateLanInput) (*computing.NiftyDeletePrivateLanOutput, error)
+	NiftyDescribePrivateLans(context.Context, *computing.NiftyDescribePrivateLansInput) (*computing.NiftyDescribePrivateLansOutput, error)
+	NiftyCreateRouter(context.Context, *computing.NiftyCreateRouterInput) (*computing.NiftyCreateRouterOutput, error)
+	NiftyDeleteRouter(context.Context, *computing.NiftyDeleteRouterInput) (*computing.NiftyDeleteRouterOutput, error)
+	NiftyDescribeRouters(context.Context, *computing.NiftyDescribeRoutersInput) (*computing.NiftyDescribeRoutersOutput, error)
+	NiftyCreateDhcpConfig(context.Context, *computing.NiftyCreateDhcpConfigInput) (*computing.NiftyCreateDhcpConfigOutput, error)
+	NiftyCreateDhcpIpAddressPool(context.Context, *computing.NiftyCreateDhcpIpAddressPoolInput) (*computing.NiftyCreateDhcpIpAddressPoolOutput, error)
+	NiftyDeleteDhcpConfig(context.Context, *computing.NiftyDeleteDhcpConfigInput) (*computing.NiftyDeleteDhcpConfigOutput, error)
+	NiftyDescribeDhcpConfigs(context.Context, *computing.NiftyDescribeDhcpConfigsInput) (*computing.NiftyDescribeDhcpConfigsOutput, error)
+	CreateVolume(context.Context, *computing.CreateVolumeInput) (*computing.CreateVolumeOutput, error)
+	AttachVolume(context.Context, *computing.AttachVolumeInput) (*computing.AttachVolumeOutput, error)
+	DetachVolume(context.Context, *computing.DetachVolumeInput) (*computing.DetachVolumeOutput, error)
+	DeleteVolume(context.Context, *computing.DeleteVolumeInput) (*computing.DeleteVolumeOutput, error)
+	DescribeVolumes(context.Context, *computing.DescribeVolumesInput) (*computing.DescribeVolumesOutput, error)
+	ImportKeyPair(context.Context, *computing.ImportKeyPairInput) (*computing.ImportKeyPairOutput, error)
+	DeleteKeyPair(context.Context, *computing.DeleteKeyPairInput) (*computing.DeleteKeyPairOutput, error)
+	DescribeKeyPairs(context.Context, *computing.DescribeKeyPairsInput) (*computing.DescribeKeyPairsOutput, error)
 	WaitUntilInstanceStopped(context.Context, *computing.DescribeInstancesInput) error
 	WaitUntilInstanceDeleted(context.Context, *computing.DescribeInstancesInput) error
 	WaitUntilInstanceRunning(context.Context, *computing.DescribeInstancesInput) error
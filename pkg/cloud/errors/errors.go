@@ -18,6 +18,7 @@ package errors
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/aws/awserr"
 )
@@ -29,7 +30,31 @@ const (
 	ResourceNotFound        = "InvalidResourceID.NotFound"
 	InvalidInstanceID       = "InvalidInstanceID.NotFound"
 	InvalidParameter        = "Client.InvalidParameterNotFound.Instance"
+	LoadBalancerNotFound    = "Client.InvalidParameterNotFound.LoadBalancer"
+	PrivateLanNotFound      = "Client.InvalidParameterNotFound.PrivateLanName"
+	NetworkIDNotFound       = "Client.InvalidParameterNotFound.NetworkId"
+	RouterNotFound          = "Client.InvalidParameterNotFound.RouterName"
+	RouterIDNotFound        = "Client.InvalidParameterNotFound.RouterId"
+	DhcpConfigNotFound      = "Client.InvalidParameterNotFound.DhcpConfigId"
 	SecurityGroupProcessing = "Server.ResourceIncorrectState.SecurityGroup.Processing"
+	GroupDuplicate          = "InvalidGroup.Duplicate"
+	AddressNotFound         = "Client.InvalidParameterNotFound.IpAddress"
+	InstanceDuplicate       = "Client.InvalidParameterDuplicate.InstanceId"
+	InstanceNotStopped      = "Client.ResourceIncorrectState.Instance.NotStopped"
+	InstanceProcessing      = "Server.ResourceIncorrectState.Instance.Processing"
+	VolumeNotFound          = "Client.InvalidParameterNotFound.Volume"
+	VolumeInUse             = "Client.ResourceIncorrectState.Volume.InUse"
+	VolumeNotInUse          = "Client.ResourceIncorrectState.Volume.NotInUse"
+	VolumeProcessing        = "Server.ResourceIncorrectState.Volume.Processing"
+	KeyPairNotFound         = "Client.InvalidParameterNotFound.KeyName"
+	KeyPairDuplicate        = "Client.InvalidParameterDuplicate.KeyName"
+
+	// codes returned when requests exceed the rate limit of the API
+	Throttling           = "Throttling"
+	RequestLimitExceeded = "RequestLimitExceeded"
+
+	// resourceIncorrectState is a part of the codes returned for resources in transition
+	resourceIncorrectState = ".ResourceIncorrectState"
 )
 
 var _error = &ServerError{}
@@ -117,6 +142,12 @@ func IsInvalidNotFoundError(err error) bool {
 			return true
 		case InvalidParameter:
 			return true
+		case LoadBalancerNotFound, PrivateLanNotFound, NetworkIDNotFound:
+			return true
+		case AddressNotFound, VolumeNotFound, KeyPairNotFound:
+			return true
+		case RouterNotFound, RouterIDNotFound, DhcpConfigNotFound:
+			return true
 		}
 	}
 
@@ -144,3 +175,36 @@ func IsIgnorableSecurityGroupError(err error) error {
 	}
 	return nil
 }
+
+// IsSecurityGroupProcessing returns true if the security group is still applying the previous request.
+func IsSecurityGroupProcessing(err error) bool {
+	code, ok := Code(err)
+	return ok && code == SecurityGroupProcessing
+}
+
+// IsThrottling returns true if the request is rejected by the rate limit of the API.
+func IsThrottling(err error) bool {
+	if code, ok := Code(err); ok && (code == Throttling || code == RequestLimitExceeded) {
+		return true
+	}
+	if reqErr, ok := err.(awserr.RequestFailure); ok {
+		return reqErr.StatusCode() == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// IsRetryable returns true if the request may succeed when it is sent again later,
+// throttling, errors of the server and resources in transition are retryable.
+func IsRetryable(err error) bool {
+	if IsThrottling(err) {
+		return true
+	}
+	if code, ok := Code(err); ok && strings.Contains(code, resourceIncorrectState) {
+		return true
+	}
+	if reqErr, ok := err.(awserr.RequestFailure); ok {
+		status := reqErr.StatusCode()
+		return status >= http.StatusInternalServerError && status != http.StatusNotImplemented
+	}
+	return false
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/aokumasan/nifcloud-sdk-go-v2/service/computing"
+
+	nferrors "github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/errors"
+)
+
+type address struct {
+	publicIP    string
+	zone        string
+	description string
+	instanceID  string
+}
+
+func (a *address) item() computing.AddressesSetItem {
+	return computing.AddressesSetItem{
+		PublicIp:         stringPtr(a.publicIP),
+		AvailabilityZone: stringPtr(a.zone),
+		Description:      stringPtr(a.description),
+		InstanceId:       stringPtr(a.instanceID),
+		Domain:           stringPtr("standard"),
+	}
+}
+
+func (c *Client) findAddress(ip *string) (*address, error) {
+	addr, ok := c.addresses[stringValue(ip)]
+	if !ok {
+		return nil, NewError(nferrors.AddressNotFound)
+	}
+	return addr, nil
+}
+
+// associate moves the address to the instance, empty id disassociates it
+func (c *Client) associate(addr *address, instanceID string) {
+	if current, ok := c.instances[addr.instanceID]; ok && current.elasticIP == addr.publicIP {
+		current.elasticIP = ""
+	}
+	addr.instanceID = instanceID
+	if i, ok := c.instances[instanceID]; ok {
+		i.elasticIP = addr.publicIP
+	}
+}
+
+func (c *Client) AllocateAddress(ctx context.Context, input *computing.AllocateAddressInput) (*computing.AllocateAddressOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("AllocateAddress"); err != nil {
+		return nil, err
+	}
+
+	n := c.nextID()
+	addr := &address{
+		publicIP: fmt.Sprintf("198.51.%d.%d", n/250, n%250+1),
+		zone:     DefaultZone,
+	}
+	if input.Placement != nil && stringValue(input.Placement.AvailabilityZone) != "" {
+		addr.zone = stringValue(input.Placement.AvailabilityZone)
+	}
+	if id := stringValue(input.InstanceId); id != "" {
+		if _, ok := c.instances[id]; !ok {
+			return nil, NewError(nferrors.InvalidParameter)
+		}
+		c.associate(addr, id)
+	}
+	c.addresses[addr.publicIP] = addr
+
+	return &computing.AllocateAddressOutput{
+		PublicIp:  stringPtr(addr.publicIP),
+		Domain:    stringPtr("standard"),
+		Placement: &computing.Placement{AvailabilityZone: stringPtr(addr.zone)},
+	}, nil
+}
+
+func (c *Client) ReleaseAddress(ctx context.Context, input *computing.ReleaseAddressInput) (*computing.ReleaseAddressOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("ReleaseAddress"); err != nil {
+		return nil, err
+	}
+
+	addr, err := c.findAddress(input.PublicIp)
+	if err != nil {
+		return nil, err
+	}
+	c.associate(addr, "")
+	delete(c.addresses, addr.publicIP)
+	return &computing.ReleaseAddressOutput{Return: boolPtr(true)}, nil
+}
+
+func (c *Client) DescribeAddresses(ctx context.Context, input *computing.DescribeAddressesInput) (*computing.DescribeAddressesOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("DescribeAddresses"); err != nil {
+		return nil, err
+	}
+
+	ips := input.PublicIp
+	if len(ips) == 0 {
+		for ip := range c.addresses {
+			ips = append(ips, ip)
+		}
+		sort.Strings(ips)
+	}
+	out := &computing.DescribeAddressesOutput{}
+	for _, ip := range ips {
+		addr, ok := c.addresses[ip]
+		if !ok {
+			return nil, NewError(nferrors.AddressNotFound)
+		}
+		out.AddressesSet = append(out.AddressesSet, addr.item())
+	}
+	return out, nil
+}
+
+func (c *Client) AssociateAddress(ctx context.Context, input *computing.AssociateAddressInput) (*computing.AssociateAddressOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("AssociateAddress"); err != nil {
+		return nil, err
+	}
+
+	addr, err := c.findAddress(input.PublicIp)
+	if err != nil {
+		return nil, err
+	}
+	id := stringValue(input.InstanceId)
+	if _, ok := c.instances[id]; !ok {
+		return nil, NewError(nferrors.InvalidParameter)
+	}
+	c.associate(addr, id)
+	return &computing.AssociateAddressOutput{Return: boolPtr(true)}, nil
+}
+
+func (c *Client) DisassociateAddress(ctx context.Context, input *computing.DisassociateAddressInput) (*computing.DisassociateAddressOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("DisassociateAddress"); err != nil {
+		return nil, err
+	}
+
+	addr, err := c.findAddress(input.PublicIp)
+	if err != nil {
+		return nil, err
+	}
+	c.associate(addr, "")
+	return &computing.DisassociateAddressOutput{Return: boolPtr(true)}, nil
+}
+
+func (c *Client) NiftyModifyAddressAttribute(ctx context.Context, input *computing.NiftyModifyAddressAttributeInput) (*computing.NiftyModifyAddressAttributeOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("NiftyModifyAddressAttribute"); err != nil {
+		return nil, err
+	}
+
+	addr, err := c.findAddress(input.PublicIp)
+	if err != nil {
+		return nil, err
+	}
+	if attr := stringValue(input.Attribute); attr != "description" {
+		return nil, fmt.Errorf("attribute %q of addresses is not supported by the fake client", attr)
+	}
+	addr.description = stringValue(input.Value)
+	return &computing.NiftyModifyAddressAttributeOutput{Return: boolPtr(true)}, nil
+}
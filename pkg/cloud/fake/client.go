@@ -0,0 +1,237 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fake provides an in-memory nifcloud computing backend for tests.
+// instances, addresses, security groups, volumes and key pairs are kept in memory and change their states
+// like the API does, the other resources are not supported yet.
+// Client is used in place of cloud.Client, and Server serves it over HTTP to the client of the SDK.
+package fake
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/aokumasan/nifcloud-sdk-go-v2/service/computing"
+	"github.com/aws/aws-sdk-go-v2/aws/awserr"
+
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud"
+	nferrors "github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/errors"
+)
+
+const (
+	// DefaultImageID is the image which DescribeImages returns unless images are given
+	DefaultImageID = "1"
+	// DefaultZone is the availability zone of the resources which are created without a zone
+	DefaultZone = "east-11"
+
+	ownerID = "fake-owner"
+)
+
+var _ cloud.Client = &Client{}
+
+// Client is an in-memory implementation of cloud.Client
+type Client struct {
+	// TransitionSteps is the number of DescribeInstances (DescribeVolumes for volumes) calls which observe
+	// the transitional state of an instance before it completes, zero completes transitions immediately
+	TransitionSteps int
+
+	mu             sync.Mutex
+	instances      map[string]*instance
+	addresses      map[string]*address
+	securityGroups map[string]*securityGroup
+	volumes        map[string]*volume
+	keyPairs       map[string]*keyPair
+	images         []computing.ImagesSetItem
+	faults         map[string][]error
+	calls          map[string]int
+	sequence       int
+}
+
+// NewClient returns an empty backend which has the default image
+func NewClient() *Client {
+	return &Client{
+		TransitionSteps: 1,
+		instances:       map[string]*instance{},
+		addresses:       map[string]*address{},
+		securityGroups:  map[string]*securityGroup{},
+		volumes:         map[string]*volume{},
+		keyPairs:        map[string]*keyPair{},
+		images: []computing.ImagesSetItem{
+			{
+				ImageId:         stringPtr(DefaultImageID),
+				Name:            stringPtr("default"),
+				ImageOwnerAlias: stringPtr("niftycloud"),
+			},
+		},
+		faults: map[string][]error{},
+		calls:  map[string]int{},
+	}
+}
+
+// ClientFactory creates clients which share the backend, regardless of the credentials
+type ClientFactory struct {
+	Client *Client
+}
+
+// CreateClient implements cloud.ClientFactory
+func (f *ClientFactory) CreateClient(accessKey, secretKey, region string) (cloud.Client, error) {
+	return f.Client, nil
+}
+
+// NewError returns the error which the API returns with the code
+func NewError(code string) error {
+	status := http.StatusBadRequest
+	switch {
+	case code == nferrors.Throttling || code == nferrors.RequestLimitExceeded:
+		status = http.StatusTooManyRequests
+	case strings.HasPrefix(code, "Server."):
+		status = http.StatusServiceUnavailable
+	}
+	return awserr.NewRequestFailure(awserr.New(code, code, nil), status, "fake-request")
+}
+
+// InjectError makes the next calls of the operation fail with the errors in order,
+// the operation is the name of the method, such as "RunInstances"
+func (c *Client) InjectError(operation string, errs ...error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.faults[operation] = append(c.faults[operation], errs...)
+}
+
+// Calls returns how many times the operation is called
+func (c *Client) Calls(operation string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls[operation]
+}
+
+// SetImages replaces the images which DescribeImages returns
+func (c *Client) SetImages(images ...computing.ImagesSetItem) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.images = images
+}
+
+// record counts the call of the operation, and returns the injected error if any
+func (c *Client) record(operation string) error {
+	c.calls[operation]++
+	if errs := c.faults[operation]; len(errs) > 0 {
+		c.faults[operation] = errs[1:]
+		return errs[0]
+	}
+	return nil
+}
+
+// nextID returns a number which is unique in the backend
+func (c *Client) nextID() int {
+	c.sequence++
+	return c.sequence
+}
+
+func unsupported(operation string) error {
+	return fmt.Errorf("%s is not supported by the fake client", operation)
+}
+
+func stringPtr(v string) *string {
+	return &v
+}
+
+func stringValue(v *string) string {
+	if v == nil {
+		return ""
+	}
+	return *v
+}
+
+func boolPtr(v bool) *bool {
+	return &v
+}
+
+func contains(vs []string, v string) bool {
+	for _, s := range vs {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) CreateLoadBalancer(ctx context.Context, input *computing.CreateLoadBalancerInput) (*computing.CreateLoadBalancerOutput, error) {
+	return nil, unsupported("CreateLoadBalancer")
+}
+
+func (c *Client) DeleteLoadBalancer(ctx context.Context, input *computing.DeleteLoadBalancerInput) (*computing.DeleteLoadBalancerOutput, error) {
+	return nil, unsupported("DeleteLoadBalancer")
+}
+
+func (c *Client) DescribeLoadBalancers(ctx context.Context, input *computing.DescribeLoadBalancersInput) (*computing.DescribeLoadBalancersOutput, error) {
+	return nil, unsupported("DescribeLoadBalancers")
+}
+
+func (c *Client) ConfigureHealthCheck(ctx context.Context, input *computing.ConfigureHealthCheckInput) (*computing.ConfigureHealthCheckOutput, error) {
+	return nil, unsupported("ConfigureHealthCheck")
+}
+
+func (c *Client) RegisterInstancesWithLoadBalancer(ctx context.Context, input *computing.RegisterInstancesWithLoadBalancerInput) (*computing.RegisterInstancesWithLoadBalancerOutput, error) {
+	return nil, unsupported("RegisterInstancesWithLoadBalancer")
+}
+
+func (c *Client) DeregisterInstancesFromLoadBalancer(ctx context.Context, input *computing.DeregisterInstancesFromLoadBalancerInput) (*computing.DeregisterInstancesFromLoadBalancerOutput, error) {
+	return nil, unsupported("DeregisterInstancesFromLoadBalancer")
+}
+
+func (c *Client) NiftyCreatePrivateLan(ctx context.Context, input *computing.NiftyCreatePrivateLanInput) (*computing.NiftyCreatePrivateLanOutput, error) {
+	return nil, unsupported("NiftyCreatePrivateLan")
+}
+
+func (c *Client) NiftyDeletePrivateLan(ctx context.Context, input *computing.NiftyDeletePrivateLanInput) (*computing.NiftyDeletePrivateLanOutput, error) {
+	return nil, unsupported("NiftyDeletePrivateLan")
+}
+
+func (c *Client) NiftyDescribePrivateLans(ctx context.Context, input *computing.NiftyDescribePrivateLansInput) (*computing.NiftyDescribePrivateLansOutput, error) {
+	return nil, unsupported("NiftyDescribePrivateLans")
+}
+
+func (c *Client) NiftyCreateRouter(ctx context.Context, input *computing.NiftyCreateRouterInput) (*computing.NiftyCreateRouterOutput, error) {
+	return nil, unsupported("NiftyCreateRouter")
+}
+
+func (c *Client) NiftyDeleteRouter(ctx context.Context, input *computing.NiftyDeleteRouterInput) (*computing.NiftyDeleteRouterOutput, error) {
+	return nil, unsupported("NiftyDeleteRouter")
+}
+
+func (c *Client) NiftyDescribeRouters(ctx context.Context, input *computing.NiftyDescribeRoutersInput) (*computing.NiftyDescribeRoutersOutput, error) {
+	return nil, unsupported("NiftyDescribeRouters")
+}
+
+func (c *Client) NiftyCreateDhcpConfig(ctx context.Context, input *computing.NiftyCreateDhcpConfigInput) (*computing.NiftyCreateDhcpConfigOutput, error) {
+	return nil, unsupported("NiftyCreateDhcpConfig")
+}
+
+func (c *Client) NiftyCreateDhcpIpAddressPool(ctx context.Context, input *computing.NiftyCreateDhcpIpAddressPoolInput) (*computing.NiftyCreateDhcpIpAddressPoolOutput, error) {
+	return nil, unsupported("NiftyCreateDhcpIpAddressPool")
+}
+
+func (c *Client) NiftyDeleteDhcpConfig(ctx context.Context, input *computing.NiftyDeleteDhcpConfigInput) (*computing.NiftyDeleteDhcpConfigOutput, error) {
+	return nil, unsupported("NiftyDeleteDhcpConfig")
+}
+
+func (c *Client) NiftyDescribeDhcpConfigs(ctx context.Context, input *computing.NiftyDescribeDhcpConfigsInput) (*computing.NiftyDescribeDhcpConfigsOutput, error) {
+	return nil, unsupported("NiftyDescribeDhcpConfigs")
+}
@@ -0,0 +1,544 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"encoding/base64"
+	"reflect"
+	"testing"
+
+	"github.com/aokumasan/nifcloud-sdk-go-v2/service/computing"
+
+	nferrors "github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/errors"
+)
+
+func describeState(c *Client, id string) (string, error) {
+	out, err := c.DescribeInstances(context.TODO(), &computing.DescribeInstancesInput{InstanceId: []string{id}})
+	if err != nil {
+		return "", err
+	}
+	return stringValue(out.ReservationSet[0].InstancesSet[0].InstanceState.Name), nil
+}
+
+func checkCode(t *testing.T, err error, code string) {
+	t.Helper()
+	if code == "" {
+		if err != nil {
+			t.Fatalf("did not expect error: %v", err)
+		}
+		return
+	}
+	if got, _ := nferrors.Code(err); got != code {
+		t.Fatalf("expected error code %q, got %v", code, err)
+	}
+}
+
+func TestClient_instanceLifecycle(t *testing.T) {
+	ctx := context.TODO()
+	c := NewClient()
+	if _, err := c.CreateSecurityGroup(ctx, &computing.CreateSecurityGroupInput{GroupName: stringPtr("sg")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the steps share the backend and run in order
+	steps := []struct {
+		name      string
+		do        func() error
+		wantState string
+		wantCode  string
+	}{
+		{
+			name: "run instance",
+			do: func() error {
+				_, err := c.RunInstances(ctx, &computing.RunInstancesInput{InstanceId: stringPtr("test"), SecurityGroup: []string{"sg"}})
+				return err
+			},
+			wantState: statePending,
+		},
+		{
+			name: "run the instance of the same id",
+			do: func() error {
+				_, err := c.RunInstances(ctx, &computing.RunInstancesInput{InstanceId: stringPtr("test")})
+				return err
+			},
+			wantCode:  nferrors.InstanceDuplicate,
+			wantState: stateRunning,
+		},
+		{
+			name: "terminate the running instance",
+			do: func() error {
+				_, err := c.TerminateInstances(ctx, &computing.TerminateInstancesInput{InstanceId: []string{"test"}})
+				return err
+			},
+			wantCode:  nferrors.InstanceNotStopped,
+			wantState: stateRunning,
+		},
+		{
+			name: "stop instance",
+			do: func() error {
+				_, err := c.StopInstances(ctx, &computing.StopInstancesInput{InstanceId: []string{"test"}})
+				return err
+			},
+			wantState: statePending,
+		},
+		{
+			name: "terminate the stopping instance",
+			do: func() error {
+				_, err := c.TerminateInstances(ctx, &computing.TerminateInstancesInput{InstanceId: []string{"test"}})
+				return err
+			},
+			wantCode:  nferrors.InstanceProcessing,
+			wantState: stateStopped,
+		},
+		{
+			name: "terminate instance",
+			do: func() error {
+				_, err := c.TerminateInstances(ctx, &computing.TerminateInstancesInput{InstanceId: []string{"test"}})
+				return err
+			},
+			wantState: stateWaiting,
+		},
+		{
+			name: "the terminated instance disappears",
+			do:   func() error { return nil },
+		},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			checkCode(t, step.do(), step.wantCode)
+
+			state, err := describeState(c, "test")
+			if step.wantState == "" {
+				if !nferrors.IsNotFound(err) {
+					t.Fatalf("expected not found error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("did not expect error: %v", err)
+			}
+			if state != step.wantState {
+				t.Errorf("expected state %q, got %q", step.wantState, state)
+			}
+		})
+	}
+
+	out, err := c.DescribeSecurityGroups(ctx, &computing.DescribeSecurityGroupsInput{GroupName: []string{"sg"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(out.SecurityGroupInfo[0].InstancesSet); n != 0 {
+		t.Errorf("expected the terminated instance to be deregistered from the security group, got %d instances", n)
+	}
+}
+
+func TestClient_WaitUntilInstanceRunning(t *testing.T) {
+	ctx := context.TODO()
+	c := NewClient()
+	c.TransitionSteps = 10
+	if _, err := c.RunInstances(ctx, &computing.RunInstancesInput{InstanceId: stringPtr("test")}); err != nil {
+		t.Fatal(err)
+	}
+
+	input := &computing.DescribeInstancesInput{InstanceId: []string{"test"}}
+	if err := c.WaitUntilInstanceRunning(ctx, input); err != nil {
+		t.Fatalf("did not expect error: %v", err)
+	}
+	if err := c.WaitUntilInstanceStopped(ctx, input); err == nil {
+		t.Fatal("expected error for the running instance")
+	}
+	if err := c.WaitUntilInstanceDeleted(ctx, input); err == nil {
+		t.Fatal("expected error for the running instance")
+	}
+}
+
+func TestClient_InjectError(t *testing.T) {
+	ctx := context.TODO()
+	c := NewClient()
+	c.InjectError("DescribeInstances", NewError(nferrors.Throttling), NewError(nferrors.AuthFailure))
+
+	tests := []struct {
+		name          string
+		wantCode      string
+		wantRetryable bool
+	}{
+		{
+			name:          "the first injected error",
+			wantCode:      nferrors.Throttling,
+			wantRetryable: true,
+		},
+		{
+			name:     "the second injected error",
+			wantCode: nferrors.AuthFailure,
+		},
+		{
+			name: "no error is left",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := c.DescribeInstances(ctx, &computing.DescribeInstancesInput{})
+			checkCode(t, err, tt.wantCode)
+			if got := nferrors.IsRetryable(err); got != tt.wantRetryable {
+				t.Errorf("expected retryable %v, got %v", tt.wantRetryable, got)
+			}
+		})
+	}
+	if n := c.Calls("DescribeInstances"); n != len(tests) {
+		t.Errorf("expected %d calls, got %d", len(tests), n)
+	}
+}
+
+func TestClient_securityGroupRules(t *testing.T) {
+	ctx := context.TODO()
+	c := NewClient()
+	if _, err := c.CreateSecurityGroup(ctx, &computing.CreateSecurityGroupInput{GroupName: stringPtr("sg")}); err != nil {
+		t.Fatal(err)
+	}
+	rule := computing.RequestIpPermissionsStruct{
+		IpProtocol:      stringPtr("TCP"),
+		FromPort:        int64Ptr(22),
+		ToPort:          int64Ptr(22),
+		RequestIpRanges: []computing.RequestIpRangesStruct{{CidrIp: stringPtr("0.0.0.0/0")}},
+	}
+
+	tests := []struct {
+		name      string
+		do        func() error
+		wantCode  string
+		wantRules int
+	}{
+		{
+			name: "create the security group of the same name",
+			do: func() error {
+				_, err := c.CreateSecurityGroup(ctx, &computing.CreateSecurityGroupInput{GroupName: stringPtr("sg")})
+				return err
+			},
+			wantCode: nferrors.GroupDuplicate,
+		},
+		{
+			name: "authorize rule",
+			do: func() error {
+				_, err := c.AuthorizeSecurityGroupIngress(ctx, &computing.AuthorizeSecurityGroupIngressInput{
+					GroupName:     stringPtr("sg"),
+					IpPermissions: []computing.RequestIpPermissionsStruct{rule},
+				})
+				return err
+			},
+			wantRules: 1,
+		},
+		{
+			name: "authorize the same rule",
+			do: func() error {
+				_, err := c.AuthorizeSecurityGroupIngress(ctx, &computing.AuthorizeSecurityGroupIngressInput{
+					GroupName:     stringPtr("sg"),
+					IpPermissions: []computing.RequestIpPermissionsStruct{rule},
+				})
+				return err
+			},
+			wantRules: 1,
+		},
+		{
+			name: "revoke rule",
+			do: func() error {
+				_, err := c.RevokeSecurityGroupIngress(ctx, &computing.RevokeSecurityGroupIngressInput{
+					GroupName:     stringPtr("sg"),
+					IpPermissions: []computing.RequestIpPermissionsStruct{rule},
+				})
+				return err
+			},
+		},
+		{
+			name: "revoke the revoked rule",
+			do: func() error {
+				_, err := c.RevokeSecurityGroupIngress(ctx, &computing.RevokeSecurityGroupIngressInput{
+					GroupName:     stringPtr("sg"),
+					IpPermissions: []computing.RequestIpPermissionsStruct{rule},
+				})
+				return err
+			},
+			wantCode: nferrors.PermissionNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkCode(t, tt.do(), tt.wantCode)
+
+			out, err := c.DescribeSecurityGroups(ctx, &computing.DescribeSecurityGroupsInput{
+				Filter: []computing.RequestFilterStruct{{Name: stringPtr("group-name"), RequestValue: []string{"sg"}}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := len(out.SecurityGroupInfo[0].IpPermissions); n != tt.wantRules {
+				t.Errorf("expected %d rules, got %d", tt.wantRules, n)
+			}
+		})
+	}
+}
+
+func TestClient_addresses(t *testing.T) {
+	ctx := context.TODO()
+	c := NewClient()
+	c.TransitionSteps = 0
+	if _, err := c.RunInstances(ctx, &computing.RunInstancesInput{InstanceId: stringPtr("test")}); err != nil {
+		t.Fatal(err)
+	}
+	allocated, err := c.AllocateAddress(ctx, &computing.AllocateAddressInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip := stringValue(allocated.PublicIp)
+
+	publicIP := func() string {
+		out, err := c.DescribeInstances(ctx, &computing.DescribeInstancesInput{InstanceId: []string{"test"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stringValue(out.ReservationSet[0].InstancesSet[0].IpAddress)
+	}
+	global := publicIP()
+
+	tests := []struct {
+		name         string
+		do           func() error
+		wantCode     string
+		wantPublicIP string
+	}{
+		{
+			name: "associate address",
+			do: func() error {
+				_, err := c.AssociateAddress(ctx, &computing.AssociateAddressInput{PublicIp: stringPtr(ip), InstanceId: stringPtr("test")})
+				return err
+			},
+			wantPublicIP: ip,
+		},
+		{
+			name: "associate address with unknown instance",
+			do: func() error {
+				_, err := c.AssociateAddress(ctx, &computing.AssociateAddressInput{PublicIp: stringPtr(ip), InstanceId: stringPtr("unknown")})
+				return err
+			},
+			wantCode:     nferrors.InvalidParameter,
+			wantPublicIP: ip,
+		},
+		{
+			name: "release address",
+			do: func() error {
+				_, err := c.ReleaseAddress(ctx, &computing.ReleaseAddressInput{PublicIp: stringPtr(ip)})
+				return err
+			},
+			wantPublicIP: global,
+		},
+		{
+			name: "describe the released address",
+			do: func() error {
+				_, err := c.DescribeAddresses(ctx, &computing.DescribeAddressesInput{PublicIp: []string{ip}})
+				return err
+			},
+			wantCode:     nferrors.AddressNotFound,
+			wantPublicIP: global,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkCode(t, tt.do(), tt.wantCode)
+			if got := publicIP(); got != tt.wantPublicIP {
+				t.Errorf("expected public IP %q, got %q", tt.wantPublicIP, got)
+			}
+		})
+	}
+}
+
+func TestClient_volumes(t *testing.T) {
+	ctx := context.TODO()
+	c := NewClient()
+	c.TransitionSteps = 0
+	if _, err := c.RunInstances(ctx, &computing.RunInstancesInput{InstanceId: stringPtr("test")}); err != nil {
+		t.Fatal(err)
+	}
+	created, err := c.CreateVolume(ctx, &computing.CreateVolumeInput{InstanceId: stringPtr("test"), Size: int64Ptr(100)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := stringValue(created.VolumeId)
+
+	// state returns the status of the volume and the instance which it is attached to
+	state := func() (string, string) {
+		out, err := c.DescribeVolumes(ctx, &computing.DescribeVolumesInput{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range out.VolumeSet {
+			if stringValue(v.VolumeId) != id {
+				continue
+			}
+			if len(v.AttachmentSet) == 0 {
+				return stringValue(v.Status), ""
+			}
+			return stringValue(v.Status), stringValue(v.AttachmentSet[0].InstanceId)
+		}
+		return "", ""
+	}
+
+	tests := []struct {
+		name         string
+		do           func() error
+		wantCode     string
+		wantStatus   string
+		wantInstance string
+	}{
+		{
+			name: "delete attached volume",
+			do: func() error {
+				_, err := c.DeleteVolume(ctx, &computing.DeleteVolumeInput{VolumeId: stringPtr(id)})
+				return err
+			},
+			wantCode:     nferrors.VolumeInUse,
+			wantStatus:   volumeInUse,
+			wantInstance: "test",
+		},
+		{
+			name: "detach volume",
+			do: func() error {
+				_, err := c.DetachVolume(ctx, &computing.DetachVolumeInput{VolumeId: stringPtr(id), InstanceId: stringPtr("test")})
+				return err
+			},
+			wantStatus: volumeAvailable,
+		},
+		{
+			name: "detach detached volume",
+			do: func() error {
+				_, err := c.DetachVolume(ctx, &computing.DetachVolumeInput{VolumeId: stringPtr(id)})
+				return err
+			},
+			wantCode:   nferrors.VolumeNotInUse,
+			wantStatus: volumeAvailable,
+		},
+		{
+			name: "attach volume",
+			do: func() error {
+				_, err := c.AttachVolume(ctx, &computing.AttachVolumeInput{VolumeId: stringPtr(id), InstanceId: stringPtr("test")})
+				return err
+			},
+			wantStatus:   volumeInUse,
+			wantInstance: "test",
+		},
+		{
+			name: "terminate instance with attached volume",
+			do: func() error {
+				if _, err := c.StopInstances(ctx, &computing.StopInstancesInput{InstanceId: []string{"test"}}); err != nil {
+					return err
+				}
+				_, err := c.TerminateInstances(ctx, &computing.TerminateInstancesInput{InstanceId: []string{"test"}})
+				return err
+			},
+		},
+		{
+			name: "describe the deleted volume",
+			do: func() error {
+				_, err := c.DescribeVolumes(ctx, &computing.DescribeVolumesInput{VolumeId: []string{id}})
+				return err
+			},
+			wantCode: nferrors.VolumeNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkCode(t, tt.do(), tt.wantCode)
+			if status, instance := state(); status != tt.wantStatus || instance != tt.wantInstance {
+				t.Errorf("expected volume %q attached to %q, got %q attached to %q", tt.wantStatus, tt.wantInstance, status, instance)
+			}
+		})
+	}
+}
+
+func TestClient_keyPairs(t *testing.T) {
+	ctx := context.TODO()
+	c := NewClient()
+	material := base64.StdEncoding.EncodeToString([]byte("ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAILNuZbHsU2Yywz610ov4KhgmVxcbjcRFbPvpn2nEpt7k capi@example.com"))
+
+	keyNames := func() []string {
+		out, err := c.DescribeKeyPairs(ctx, &computing.DescribeKeyPairsInput{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, k := range out.KeySet {
+			names = append(names, stringValue(k.KeyName))
+		}
+		return names
+	}
+
+	tests := []struct {
+		name      string
+		do        func() error
+		wantCode  string
+		wantNames []string
+	}{
+		{
+			name: "import key pair",
+			do: func() error {
+				_, err := c.ImportKeyPair(ctx, &computing.ImportKeyPairInput{KeyName: stringPtr("testkey"), PublicKeyMaterial: stringPtr(material)})
+				return err
+			},
+			wantNames: []string{"testkey"},
+		},
+		{
+			name: "import key pair with the same name",
+			do: func() error {
+				_, err := c.ImportKeyPair(ctx, &computing.ImportKeyPairInput{KeyName: stringPtr("testkey"), PublicKeyMaterial: stringPtr(material)})
+				return err
+			},
+			wantCode:  nferrors.KeyPairDuplicate,
+			wantNames: []string{"testkey"},
+		},
+		{
+			name: "import key pair which is not encoded",
+			do: func() error {
+				_, err := c.ImportKeyPair(ctx, &computing.ImportKeyPairInput{KeyName: stringPtr("plainkey"), PublicKeyMaterial: stringPtr("ssh-ed25519 AAAA")})
+				return err
+			},
+			wantCode:  codeInvalidPublicKey,
+			wantNames: []string{"testkey"},
+		},
+		{
+			name: "delete key pair",
+			do: func() error {
+				_, err := c.DeleteKeyPair(ctx, &computing.DeleteKeyPairInput{KeyName: stringPtr("testkey")})
+				return err
+			},
+		},
+		{
+			name: "describe the deleted key pair",
+			do: func() error {
+				_, err := c.DescribeKeyPairs(ctx, &computing.DescribeKeyPairsInput{KeyName: []string{"testkey"}})
+				return err
+			},
+			wantCode: nferrors.KeyPairNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkCode(t, tt.do(), tt.wantCode)
+			if got := keyNames(); !reflect.DeepEqual(got, tt.wantNames) {
+				t.Errorf("expected key pairs %v, got %v", tt.wantNames, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,449 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aokumasan/nifcloud-sdk-go-v2/service/computing"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/awserr"
+
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
+	nferrors "github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/errors"
+)
+
+var (
+	statePending = string(infrav1alpha3.InstancePending)
+	stateRunning = string(infrav1alpha3.InstanceRunning)
+	stateStopped = string(infrav1alpha3.InstanceStopped)
+	stateWaiting = string(infrav1alpha3.InstanceWaiting)
+)
+
+// stateDeleted ends the transition of terminating instances, it is never observed
+const stateDeleted = "deleted"
+
+type networkInterface struct {
+	networkID string
+	ip        string
+}
+
+type instance struct {
+	id           string
+	uniqueID     string
+	instanceType string
+	imageID      string
+	keyName      string
+	description  string
+	zone         string
+	launchTime   time.Time
+
+	state string
+	// next is the state which the current transition ends in, empty if the instance is not in transition
+	next  string
+	steps int
+
+	networkInterfaces []networkInterface
+	// elasticIP is the address associated with the instance which replaces the global IP
+	elasticIP string
+}
+
+func (i *instance) publicIP() string {
+	if i.elasticIP != "" {
+		return i.elasticIP
+	}
+	for _, ni := range i.networkInterfaces {
+		if ni.networkID == infrav1alpha3.NetworkCommonGlobal {
+			return ni.ip
+		}
+	}
+	return ""
+}
+
+func (i *instance) privateIP() string {
+	for _, ni := range i.networkInterfaces {
+		if ni.networkID != infrav1alpha3.NetworkCommonGlobal {
+			return ni.ip
+		}
+	}
+	return ""
+}
+
+func (i *instance) item() computing.InstancesSetItem {
+	launchTime := i.launchTime
+	item := computing.InstancesSetItem{
+		InstanceId:       stringPtr(i.id),
+		InstanceUniqueId: stringPtr(i.uniqueID),
+		InstanceType:     stringPtr(i.instanceType),
+		ImageId:          stringPtr(i.imageID),
+		KeyName:          stringPtr(i.keyName),
+		Description:      stringPtr(i.description),
+		InstanceState:    &computing.InstanceState{Name: stringPtr(i.state)},
+		Placement:        &computing.Placement{AvailabilityZone: stringPtr(i.zone)},
+		LaunchTime:       &launchTime,
+		IpAddress:        stringPtr(i.publicIP()),
+		PrivateIpAddress: stringPtr(i.privateIP()),
+	}
+	for index, ni := range i.networkInterfaces {
+		set := computing.NetworkInterfaceSetItem{
+			NetworkId:   stringPtr(ni.networkID),
+			DeviceIndex: int64Ptr(int64(index)),
+		}
+		if ni.networkID == infrav1alpha3.NetworkCommonGlobal {
+			set.Association = &computing.Association{PublicIp: stringPtr(i.publicIP())}
+		} else {
+			set.PrivateIpAddress = stringPtr(ni.ip)
+		}
+		item.NetworkInterfaceSet = append(item.NetworkInterfaceSet, set)
+	}
+	return item
+}
+
+// Advance completes every transition of the instances and the volumes immediately
+func (c *Client) Advance() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, i := range c.sortedInstances() {
+		if i.next != "" {
+			c.complete(i)
+		}
+	}
+	for _, v := range c.sortedVolumes() {
+		if v.done != nil {
+			c.completeVolume(v)
+		}
+	}
+}
+
+// transition starts the transition of the instance to the state
+func (c *Client) transition(i *instance, during, next string) {
+	i.state = during
+	i.next = next
+	i.steps = c.TransitionSteps
+	if i.steps <= 0 {
+		c.complete(i)
+	}
+}
+
+// advance takes a step of the transitions, it is called every time instances are observed
+func (c *Client) advance() {
+	for _, i := range c.sortedInstances() {
+		if i.next == "" {
+			continue
+		}
+		if i.steps <= 0 {
+			c.complete(i)
+			continue
+		}
+		i.steps--
+	}
+}
+
+func (c *Client) complete(i *instance) {
+	next := i.next
+	i.next = ""
+	i.steps = 0
+	if next != stateDeleted {
+		i.state = next
+		return
+	}
+
+	// resources which refer to the instance are released with it
+	delete(c.instances, i.id)
+	for _, sg := range c.securityGroups {
+		sg.deregister(i.id)
+	}
+	for _, addr := range c.addresses {
+		if addr.instanceID == i.id {
+			addr.instanceID = ""
+		}
+	}
+	// volumes which are still attached are deleted with the instance
+	for _, v := range c.volumes {
+		if v.instanceID == i.id {
+			delete(c.volumes, v.id)
+		}
+	}
+}
+
+func (c *Client) sortedInstances() []*instance {
+	res := make([]*instance, 0, len(c.instances))
+	for _, i := range c.instances {
+		res = append(res, i)
+	}
+	sort.Slice(res, func(a, b int) bool { return res[a].id < res[b].id })
+	return res
+}
+
+// findInstances returns the instances of the ids, or every instance if ids is empty
+func (c *Client) findInstances(ids []string) ([]*instance, error) {
+	if len(ids) == 0 {
+		return c.sortedInstances(), nil
+	}
+	res := make([]*instance, 0, len(ids))
+	for _, id := range ids {
+		i, ok := c.instances[id]
+		if !ok {
+			return nil, NewError(nferrors.InvalidParameter)
+		}
+		res = append(res, i)
+	}
+	return res, nil
+}
+
+func (c *Client) RunInstances(ctx context.Context, input *computing.RunInstancesInput) (*computing.RunInstancesOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("RunInstances"); err != nil {
+		return nil, err
+	}
+
+	n := c.nextID()
+	id := stringValue(input.InstanceId)
+	if id == "" {
+		id = fmt.Sprintf("fake%d", n)
+	}
+	if _, ok := c.instances[id]; ok {
+		return nil, NewError(nferrors.InstanceDuplicate)
+	}
+	for _, name := range input.SecurityGroup {
+		if _, ok := c.securityGroups[name]; !ok {
+			return nil, NewError(nferrors.GroupNotFound)
+		}
+	}
+
+	i := &instance{
+		id:           id,
+		uniqueID:     fmt.Sprintf("i-fake%08d", n),
+		instanceType: stringValue(input.InstanceType),
+		imageID:      stringValue(input.ImageId),
+		keyName:      stringValue(input.KeyName),
+		description:  stringValue(input.Description),
+		zone:         DefaultZone,
+		launchTime:   time.Now(),
+	}
+	if input.Placement != nil && stringValue(input.Placement.AvailabilityZone) != "" {
+		i.zone = stringValue(input.Placement.AvailabilityZone)
+	}
+	networks := []string{infrav1alpha3.NetworkCommonGlobal, infrav1alpha3.NetworkCommonPrivate}
+	if len(input.NetworkInterface) > 0 {
+		networks = networks[:0]
+		for _, ni := range input.NetworkInterface {
+			networks = append(networks, stringValue(ni.NetworkId))
+		}
+	}
+	for _, network := range networks {
+		ip := fmt.Sprintf("10.100.%d.%d", n/250, n%250+1)
+		if network == infrav1alpha3.NetworkCommonGlobal {
+			ip = fmt.Sprintf("203.0.%d.%d", n/250, n%250+1)
+		}
+		i.networkInterfaces = append(i.networkInterfaces, networkInterface{networkID: network, ip: ip})
+	}
+
+	c.instances[id] = i
+	for _, name := range input.SecurityGroup {
+		c.securityGroups[name].register(id)
+	}
+	c.transition(i, statePending, stateRunning)
+
+	return &computing.RunInstancesOutput{
+		InstancesSet:  []computing.InstancesSetItem{i.item()},
+		OwnerId:       stringPtr(ownerID),
+		ReservationId: stringPtr(fmt.Sprintf("r-fake%08d", n)),
+	}, nil
+}
+
+func (c *Client) DescribeInstances(ctx context.Context, input *computing.DescribeInstancesInput) (*computing.DescribeInstancesOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("DescribeInstances"); err != nil {
+		return nil, err
+	}
+
+	c.advance()
+	instances, err := c.findInstances(input.InstanceId)
+	if err != nil {
+		return nil, err
+	}
+
+	// each instance has its own reservation which is tagged like the instance
+	out := &computing.DescribeInstancesOutput{}
+	for _, i := range instances {
+		out.ReservationSet = append(out.ReservationSet, computing.ReservationSetItem{
+			Description:  stringPtr(i.description),
+			OwnerId:      stringPtr(ownerID),
+			InstancesSet: []computing.InstancesSetItem{i.item()},
+		})
+	}
+	return out, nil
+}
+
+func (c *Client) StopInstances(ctx context.Context, input *computing.StopInstancesInput) (*computing.StopInstancesOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("StopInstances"); err != nil {
+		return nil, err
+	}
+
+	instances, err := c.findInstances(input.InstanceId)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range instances {
+		if i.next != "" {
+			return nil, NewError(nferrors.InstanceProcessing)
+		}
+	}
+
+	out := &computing.StopInstancesOutput{}
+	for _, i := range instances {
+		if i.state == stateRunning {
+			c.transition(i, statePending, stateStopped)
+		}
+		out.InstancesSet = append(out.InstancesSet, i.item())
+	}
+	return out, nil
+}
+
+func (c *Client) TerminateInstances(ctx context.Context, input *computing.TerminateInstancesInput) (*computing.TerminateInstancesOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("TerminateInstances"); err != nil {
+		return nil, err
+	}
+
+	instances, err := c.findInstances(input.InstanceId)
+	if err != nil {
+		return nil, err
+	}
+	// only stopped instances are terminated
+	for _, i := range instances {
+		if i.next != "" {
+			return nil, NewError(nferrors.InstanceProcessing)
+		}
+		if i.state != stateStopped {
+			return nil, NewError(nferrors.InstanceNotStopped)
+		}
+	}
+
+	out := &computing.TerminateInstancesOutput{}
+	for _, i := range instances {
+		c.transition(i, stateWaiting, stateDeleted)
+		out.InstancesSet = append(out.InstancesSet, i.item())
+	}
+	return out, nil
+}
+
+func (c *Client) DescribeImages(ctx context.Context, input *computing.DescribeImagesInput) (*computing.DescribeImagesOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("DescribeImages"); err != nil {
+		return nil, err
+	}
+
+	out := &computing.DescribeImagesOutput{}
+	for _, image := range c.images {
+		if len(input.ImageId) > 0 && !contains(input.ImageId, stringValue(image.ImageId)) {
+			continue
+		}
+		// empty names do not filter images
+		if names := nonEmpty(input.ImageName); len(names) > 0 && !contains(names, stringValue(image.Name)) {
+			continue
+		}
+		// owners match either the alias or the id of the owner
+		if owners := nonEmpty(input.Owner); len(owners) > 0 &&
+			!contains(owners, stringValue(image.ImageOwnerAlias)) && !contains(owners, stringValue(image.ImageOwnerId)) {
+			continue
+		}
+		out.ImagesSet = append(out.ImagesSet, image)
+	}
+	return out, nil
+}
+
+func (c *Client) WaitUntilInstanceRunning(ctx context.Context, input *computing.DescribeInstancesInput) error {
+	return c.waitUntil("WaitUntilInstanceRunning", input.InstanceId, stateRunning)
+}
+
+func (c *Client) WaitUntilInstanceStopped(ctx context.Context, input *computing.DescribeInstancesInput) error {
+	return c.waitUntil("WaitUntilInstanceStopped", input.InstanceId, stateStopped)
+}
+
+func (c *Client) WaitUntilInstanceDeleted(ctx context.Context, input *computing.DescribeInstancesInput) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("WaitUntilInstanceDeleted"); err != nil {
+		return err
+	}
+
+	for _, id := range input.InstanceId {
+		i, ok := c.instances[id]
+		if !ok {
+			continue
+		}
+		if i.next != "" {
+			c.complete(i)
+		}
+		if _, ok := c.instances[id]; ok {
+			return notReady(id)
+		}
+	}
+	return nil
+}
+
+// waitUntil completes the transitions of the instances and checks that they end in the state
+func (c *Client) waitUntil(operation string, ids []string, state string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record(operation); err != nil {
+		return err
+	}
+
+	instances, err := c.findInstances(ids)
+	if err != nil {
+		return err
+	}
+	for _, i := range instances {
+		if i.next != "" {
+			c.complete(i)
+		}
+		if i.state != state {
+			return notReady(i.id)
+		}
+	}
+	return nil
+}
+
+func notReady(id string) error {
+	return awserr.New(aws.WaiterResourceNotReadyErrorCode, fmt.Sprintf("instance %q did not reach the state", id), nil)
+}
+
+func nonEmpty(vs []string) []string {
+	var res []string
+	for _, v := range vs {
+		if v != "" {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+func int64Ptr(v int64) *int64 {
+	return &v
+}
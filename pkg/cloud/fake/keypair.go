@@ -0,0 +1,117 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"encoding/base64"
+	"sort"
+
+	"github.com/aokumasan/nifcloud-sdk-go-v2/service/computing"
+	"golang.org/x/crypto/ssh"
+
+	nferrors "github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/errors"
+)
+
+// codeInvalidPublicKey is returned when the key material is not a base64 encoded public key
+const codeInvalidPublicKey = "Client.InvalidParameter.PublicKeyMaterial"
+
+type keyPair struct {
+	name        string
+	fingerprint string
+	description string
+}
+
+func (k *keyPair) item() computing.KeySetItem {
+	return computing.KeySetItem{
+		KeyName:        stringPtr(k.name),
+		KeyFingerprint: stringPtr(k.fingerprint),
+		Description:    stringPtr(k.description),
+	}
+}
+
+func (c *Client) ImportKeyPair(ctx context.Context, input *computing.ImportKeyPairInput) (*computing.ImportKeyPairOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("ImportKeyPair"); err != nil {
+		return nil, err
+	}
+
+	name := stringValue(input.KeyName)
+	if _, ok := c.keyPairs[name]; ok {
+		return nil, NewError(nferrors.KeyPairDuplicate)
+	}
+	material, err := base64.StdEncoding.DecodeString(stringValue(input.PublicKeyMaterial))
+	if err != nil {
+		return nil, NewError(codeInvalidPublicKey)
+	}
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(material)
+	if err != nil {
+		return nil, NewError(codeInvalidPublicKey)
+	}
+
+	k := &keyPair{
+		name:        name,
+		fingerprint: ssh.FingerprintLegacyMD5(publicKey),
+		description: stringValue(input.Description),
+	}
+	c.keyPairs[name] = k
+	return &computing.ImportKeyPairOutput{
+		KeyName:        stringPtr(k.name),
+		KeyFingerprint: stringPtr(k.fingerprint),
+	}, nil
+}
+
+func (c *Client) DeleteKeyPair(ctx context.Context, input *computing.DeleteKeyPairInput) (*computing.DeleteKeyPairOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("DeleteKeyPair"); err != nil {
+		return nil, err
+	}
+
+	name := stringValue(input.KeyName)
+	if _, ok := c.keyPairs[name]; !ok {
+		return nil, NewError(nferrors.KeyPairNotFound)
+	}
+	delete(c.keyPairs, name)
+	return &computing.DeleteKeyPairOutput{Return: boolPtr(true)}, nil
+}
+
+func (c *Client) DescribeKeyPairs(ctx context.Context, input *computing.DescribeKeyPairsInput) (*computing.DescribeKeyPairsOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("DescribeKeyPairs"); err != nil {
+		return nil, err
+	}
+
+	names := input.KeyName
+	if len(names) == 0 {
+		for name := range c.keyPairs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	out := &computing.DescribeKeyPairsOutput{}
+	for _, name := range names {
+		k, ok := c.keyPairs[name]
+		if !ok {
+			return nil, NewError(nferrors.KeyPairNotFound)
+		}
+		out.KeySet = append(out.KeySet, k.item())
+	}
+	return out, nil
+}
@@ -0,0 +1,250 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the requests and the responses follow the query protocol of the computing API which the SDK speaks,
+// parameters are form values named after the fields, and lists are numbered from 1 like "InstanceId.1"
+
+const timeFormat = "2006-01-02T15:04:05Z"
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// decodeQuery fills the input struct which v points to with the form values of the request
+func decodeQuery(values url.Values, v interface{}) error {
+	return decodeStruct(values, reflect.ValueOf(v).Elem(), "")
+}
+
+func decodeStruct(values url.Values, v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := queryName(field)
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		if err := decodeValue(values, v.Field(i), name, field.Tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeValue(values url.Values, v reflect.Value, name string, tag reflect.StructTag) error {
+	if !present(values, name) {
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		elem := reflect.New(v.Type().Elem())
+		if err := decodeValue(values, elem.Elem(), name, tag); err != nil {
+			return err
+		}
+		v.Set(elem)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b, err := base64.StdEncoding.DecodeString(values.Get(name))
+			if err != nil {
+				return fmt.Errorf("invalid value of %s: %w", name, err)
+			}
+			v.SetBytes(b)
+			return nil
+		}
+		prefix := name
+		if list := tag.Get("locationNameList"); list != "" && tag.Get("flattened") == "" {
+			prefix += "." + list
+		}
+		for n := 1; present(values, fmt.Sprintf("%s.%d", prefix, n)); n++ {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := decodeValue(values, elem, fmt.Sprintf("%s.%d", prefix, n), ""); err != nil {
+				return err
+			}
+			v.Set(reflect.Append(v, elem))
+		}
+	case reflect.Struct:
+		if v.Type() == timeType {
+			t, err := time.Parse(timeFormat, values.Get(name))
+			if err != nil {
+				return fmt.Errorf("invalid value of %s: %w", name, err)
+			}
+			v.Set(reflect.ValueOf(t))
+			return nil
+		}
+		return decodeStruct(values, v, name)
+	case reflect.String:
+		v.SetString(values.Get(name))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(values.Get(name))
+		if err != nil {
+			return fmt.Errorf("invalid value of %s: %w", name, err)
+		}
+		v.SetBool(b)
+	case reflect.Int64, reflect.Int:
+		n, err := strconv.ParseInt(values.Get(name), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid value of %s: %w", name, err)
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(values.Get(name), 64)
+		if err != nil {
+			return fmt.Errorf("invalid value of %s: %w", name, err)
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported parameter %s of type %s", name, v.Type())
+	}
+	return nil
+}
+
+// present returns true if the form has the value of the name or the values of its members
+func present(values url.Values, name string) bool {
+	if _, ok := values[name]; ok {
+		return true
+	}
+	for key := range values {
+		if strings.HasPrefix(key, name+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// queryName returns the name of the parameter for the field like the SDK does
+func queryName(field reflect.StructField) string {
+	if name := field.Tag.Get("queryName"); name != "" {
+		return name
+	}
+	name := field.Tag.Get("locationName")
+	if field.Tag.Get("flattened") != "" && field.Tag.Get("locationNameList") != "" {
+		name = field.Tag.Get("locationNameList")
+	}
+	if name == "" {
+		return field.Name
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// encodeResponse writes the output struct in the element of the name
+func encodeResponse(e *xml.Encoder, name string, v interface{}) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	if err := encodeStruct(e, reflect.ValueOf(v).Elem()); err != nil {
+		return err
+	}
+	if err := e.EncodeToken(start.End()); err != nil {
+		return err
+	}
+	return e.Flush()
+}
+
+func encodeStruct(e *xml.Encoder, v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := field.Tag.Get("locationName")
+		if name == "" {
+			name = field.Name
+		}
+		if err := encodeValue(e, v.Field(i), name, field.Tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeValue(e *xml.Encoder, v reflect.Value, name string, tag reflect.StructTag) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return encodeValue(e, v.Elem(), name, tag)
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return encodeElement(e, name, base64.StdEncoding.EncodeToString(v.Bytes()))
+		}
+		if tag.Get("flattened") != "" {
+			for i := 0; i < v.Len(); i++ {
+				if err := encodeValue(e, v.Index(i), name, ""); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		item := tag.Get("locationNameList")
+		if item == "" {
+			item = "member"
+		}
+		return encodeWrapped(e, name, func() error {
+			for i := 0; i < v.Len(); i++ {
+				if err := encodeValue(e, v.Index(i), item, ""); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	case reflect.Struct:
+		if v.Type() == timeType {
+			return encodeElement(e, name, v.Interface().(time.Time).UTC().Format(time.RFC3339))
+		}
+		return encodeWrapped(e, name, func() error {
+			return encodeStruct(e, v)
+		})
+	default:
+		return encodeElement(e, name, fmt.Sprint(v.Interface()))
+	}
+}
+
+func encodeWrapped(e *xml.Encoder, name string, inner func() error) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	if err := inner(); err != nil {
+		return err
+	}
+	return e.EncodeToken(start.End())
+}
+
+func encodeElement(e *xml.Encoder, name, text string) error {
+	return encodeWrapped(e, name, func() error {
+		return e.EncodeToken(xml.CharData(text))
+	})
+}
@@ -0,0 +1,268 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/aokumasan/nifcloud-sdk-go-v2/service/computing"
+
+	nferrors "github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/errors"
+)
+
+type securityGroup struct {
+	name        string
+	description string
+	zone        string
+	permissions []computing.IpPermissionsSetItem
+	instances   []string
+}
+
+func (sg *securityGroup) item() computing.SecurityGroupInfoSetItem {
+	item := computing.SecurityGroupInfoSetItem{
+		OwnerId:          stringPtr(ownerID),
+		GroupName:        stringPtr(sg.name),
+		GroupDescription: stringPtr(sg.description),
+		GroupStatus:      stringPtr("applied"),
+		AvailabilityZone: stringPtr(sg.zone),
+		IpPermissions:    append([]computing.IpPermissionsSetItem{}, sg.permissions...),
+	}
+	for _, id := range sg.instances {
+		item.InstancesSet = append(item.InstancesSet, computing.InstancesSetItem{InstanceId: stringPtr(id)})
+	}
+	return item
+}
+
+func (sg *securityGroup) register(id string) {
+	if !contains(sg.instances, id) {
+		sg.instances = append(sg.instances, id)
+	}
+}
+
+func (sg *securityGroup) deregister(id string) {
+	for index, v := range sg.instances {
+		if v == id {
+			sg.instances = append(sg.instances[:index], sg.instances[index+1:]...)
+			return
+		}
+	}
+}
+
+// indexOf returns the index of the rule which is the same as the permission, or -1 if not found
+func (sg *securityGroup) indexOf(p computing.IpPermissionsSetItem) int {
+	for index, rule := range sg.permissions {
+		rule.Description, p.Description = nil, nil
+		if reflect.DeepEqual(rule, p) {
+			return index
+		}
+	}
+	return -1
+}
+
+// permissionFromRequest returns the rule which the API stores for the request
+func permissionFromRequest(r computing.RequestIpPermissionsStruct) computing.IpPermissionsSetItem {
+	p := computing.IpPermissionsSetItem{
+		IpProtocol:  r.IpProtocol,
+		FromPort:    r.FromPort,
+		ToPort:      r.ToPort,
+		InOut:       r.InOut,
+		Description: r.Description,
+	}
+	for _, ipRange := range r.RequestIpRanges {
+		p.IpRanges = append(p.IpRanges, computing.IpRangesSetItem{CidrIp: ipRange.CidrIp})
+	}
+	for _, group := range r.RequestGroups {
+		p.Groups = append(p.Groups, computing.GroupsSetItem{GroupName: group.GroupName})
+	}
+	return p
+}
+
+func (c *Client) findSecurityGroup(name *string) (*securityGroup, error) {
+	sg, ok := c.securityGroups[stringValue(name)]
+	if !ok {
+		return nil, NewError(nferrors.GroupNotFound)
+	}
+	return sg, nil
+}
+
+func (c *Client) CreateSecurityGroup(ctx context.Context, input *computing.CreateSecurityGroupInput) (*computing.CreateSecurityGroupOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("CreateSecurityGroup"); err != nil {
+		return nil, err
+	}
+
+	name := stringValue(input.GroupName)
+	if _, ok := c.securityGroups[name]; ok {
+		return nil, NewError(nferrors.GroupDuplicate)
+	}
+	sg := &securityGroup{
+		name:        name,
+		description: stringValue(input.GroupDescription),
+		zone:        DefaultZone,
+	}
+	if input.Placement != nil && stringValue(input.Placement.AvailabilityZone) != "" {
+		sg.zone = stringValue(input.Placement.AvailabilityZone)
+	}
+	c.securityGroups[name] = sg
+	return &computing.CreateSecurityGroupOutput{Return: boolPtr(true)}, nil
+}
+
+func (c *Client) DeleteSecurityGroup(ctx context.Context, input *computing.DeleteSecurityGroupInput) (*computing.DeleteSecurityGroupOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("DeleteSecurityGroup"); err != nil {
+		return nil, err
+	}
+
+	sg, err := c.findSecurityGroup(input.GroupName)
+	if err != nil {
+		return nil, err
+	}
+	delete(c.securityGroups, sg.name)
+	return &computing.DeleteSecurityGroupOutput{Return: boolPtr(true)}, nil
+}
+
+func (c *Client) DescribeSecurityGroups(ctx context.Context, input *computing.DescribeSecurityGroupsInput) (*computing.DescribeSecurityGroupsOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("DescribeSecurityGroups"); err != nil {
+		return nil, err
+	}
+
+	for _, name := range input.GroupName {
+		if _, ok := c.securityGroups[name]; !ok {
+			return nil, NewError(nferrors.GroupNotFound)
+		}
+	}
+	names := make([]string, 0, len(c.securityGroups))
+	for name := range c.securityGroups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := &computing.DescribeSecurityGroupsOutput{}
+	for _, name := range names {
+		if len(input.GroupName) > 0 && !contains(input.GroupName, name) {
+			continue
+		}
+		matched := true
+		for _, filter := range input.Filter {
+			switch stringValue(filter.Name) {
+			case "group-name":
+				matched = matched && contains(filter.RequestValue, name)
+			default:
+				return nil, fmt.Errorf("filter %q of security groups is not supported by the fake client", stringValue(filter.Name))
+			}
+		}
+		if matched {
+			out.SecurityGroupInfo = append(out.SecurityGroupInfo, c.securityGroups[name].item())
+		}
+	}
+	return out, nil
+}
+
+func (c *Client) AuthorizeSecurityGroupIngress(ctx context.Context, input *computing.AuthorizeSecurityGroupIngressInput) (*computing.AuthorizeSecurityGroupIngressOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("AuthorizeSecurityGroupIngress"); err != nil {
+		return nil, err
+	}
+
+	sg, err := c.findSecurityGroup(input.GroupName)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range input.IpPermissions {
+		p := permissionFromRequest(r)
+		if sg.indexOf(p) < 0 {
+			sg.permissions = append(sg.permissions, p)
+		}
+	}
+	return &computing.AuthorizeSecurityGroupIngressOutput{Return: boolPtr(true)}, nil
+}
+
+func (c *Client) RevokeSecurityGroupIngress(ctx context.Context, input *computing.RevokeSecurityGroupIngressInput) (*computing.RevokeSecurityGroupIngressOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("RevokeSecurityGroupIngress"); err != nil {
+		return nil, err
+	}
+
+	sg, err := c.findSecurityGroup(input.GroupName)
+	if err != nil {
+		return nil, err
+	}
+	// every rule has to exist, otherwise none of them is revoked
+	indexes := make([]int, 0, len(input.IpPermissions))
+	for _, r := range input.IpPermissions {
+		index := sg.indexOf(permissionFromRequest(r))
+		if index < 0 {
+			return nil, NewError(nferrors.PermissionNotFound)
+		}
+		indexes = append(indexes, index)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(indexes)))
+	for _, index := range indexes {
+		sg.permissions = append(sg.permissions[:index], sg.permissions[index+1:]...)
+	}
+	return &computing.RevokeSecurityGroupIngressOutput{Return: boolPtr(true)}, nil
+}
+
+func (c *Client) RegisterInstancesWithSecurityGroup(ctx context.Context, input *computing.RegisterInstancesWithSecurityGroupInput) (*computing.RegisterInstancesWithSecurityGroupOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("RegisterInstancesWithSecurityGroup"); err != nil {
+		return nil, err
+	}
+
+	sg, err := c.findSecurityGroup(input.GroupName)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.findInstances(input.InstanceId); err != nil {
+		return nil, err
+	}
+	out := &computing.RegisterInstancesWithSecurityGroupOutput{}
+	for _, id := range input.InstanceId {
+		sg.register(id)
+		out.InstancesSet = append(out.InstancesSet, computing.InstancesSetItem{InstanceId: stringPtr(id)})
+	}
+	return out, nil
+}
+
+func (c *Client) DeregisterInstancesFromSecurityGroup(ctx context.Context, input *computing.DeregisterInstancesFromSecurityGroupInput) (*computing.DeregisterInstancesFromSecurityGroupOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("DeregisterInstancesFromSecurityGroup"); err != nil {
+		return nil, err
+	}
+
+	sg, err := c.findSecurityGroup(input.GroupName)
+	if err != nil {
+		return nil, err
+	}
+	out := &computing.DeregisterInstancesFromSecurityGroupOutput{}
+	for _, id := range input.InstanceId {
+		sg.deregister(id)
+		out.InstancesSet = append(out.InstancesSet, computing.InstancesSetItem{InstanceId: stringPtr(id)})
+	}
+	return out, nil
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws/awserr"
+
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud"
+	nferrors "github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/errors"
+)
+
+const (
+	codeInvalidAction  = "InvalidAction"
+	codeNotImplemented = "NotImplemented"
+)
+
+var (
+	clientType  = reflect.TypeOf((*cloud.Client)(nil)).Elem()
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// Server serves the backend over HTTP like the computing endpoint, so that the client of the SDK
+// can send requests to it, run it with net/http/httptest and give its URL as the endpoint of the client
+type Server struct {
+	Backend *Client
+	// Credentials maps access keys to secret keys, the signatures of requests are verified with them
+	// unless it is empty
+	Credentials map[string]string
+}
+
+// NewServer returns the server of the backend which does not verify the signatures
+func NewServer(backend *Client) *Server {
+	return &Server{Backend: backend}
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "Client.MalformedRequest", err.Error())
+		return
+	}
+	if err := s.authenticate(r); err != nil {
+		writeError(w, http.StatusUnauthorized, nferrors.AuthFailure, err.Error())
+		return
+	}
+
+	action := r.Form.Get("Action")
+	method, ok := s.operation(action)
+	if !ok {
+		writeError(w, http.StatusBadRequest, codeInvalidAction, fmt.Sprintf("action %q is not supported", action))
+		return
+	}
+	input := reflect.New(method.Type().In(1).Elem())
+	if err := decodeQuery(r.Form, input.Interface()); err != nil {
+		writeError(w, http.StatusBadRequest, "Client.InvalidParameter", err.Error())
+		return
+	}
+
+	out := method.Call([]reflect.Value{reflect.ValueOf(r.Context()), input})
+	if err, _ := out[1].Interface().(error); err != nil {
+		if reqErr, ok := err.(awserr.RequestFailure); ok {
+			writeError(w, reqErr.StatusCode(), reqErr.Code(), reqErr.Message())
+			return
+		}
+		// errors of the fake itself, like operations which are not supported yet
+		writeError(w, http.StatusNotImplemented, codeNotImplemented, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/xml;charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := encodeResponse(xml.NewEncoder(w), action+"Response", out[0].Interface()); err != nil {
+		// the status is already sent, the client fails to decode the response
+		fmt.Fprintf(w, "<!-- %v -->", err)
+	}
+}
+
+// operation returns the method of the backend for the action, only the operations of cloud.Client
+// which take an input and return an output are served, the waiters run in the client
+func (s *Server) operation(action string) (reflect.Value, bool) {
+	m, ok := clientType.MethodByName(action)
+	if !ok {
+		return reflect.Value{}, false
+	}
+	t := m.Type
+	if t.NumIn() != 2 || t.In(0) != contextType || t.In(1).Kind() != reflect.Ptr ||
+		t.NumOut() != 2 || t.Out(1) != errorType {
+		return reflect.Value{}, false
+	}
+	return reflect.ValueOf(s.Backend).MethodByName(action), true
+}
+
+// authenticate verifies the signature version 2 of the request
+func (s *Server) authenticate(r *http.Request) error {
+	if len(s.Credentials) == 0 {
+		return nil
+	}
+	secret, ok := s.Credentials[r.Form.Get("AccessKeyId")]
+	if !ok {
+		return fmt.Errorf("access key %q is not found", r.Form.Get("AccessKeyId"))
+	}
+	if method := r.Form.Get("SignatureMethod"); method != "HmacSHA256" {
+		return fmt.Errorf("signature method %q is not supported", method)
+	}
+
+	keys := make([]string, 0, len(r.Form))
+	for key := range r.Form {
+		if key != "Signature" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	query := make([]string, 0, len(keys))
+	for _, key := range keys {
+		query = append(query, escape(key)+"="+escape(r.Form.Get(key)))
+	}
+	path := r.URL.Path
+	if path == "" {
+		path = "/"
+	}
+
+	hash := hmac.New(sha256.New, []byte(secret))
+	hash.Write([]byte(strings.Join([]string{r.Method, r.Host, path, strings.Join(query, "&")}, "\n")))
+	want := base64.StdEncoding.EncodeToString(hash.Sum(nil))
+	if !hmac.Equal([]byte(want), []byte(r.Form.Get("Signature"))) {
+		return fmt.Errorf("signature does not match")
+	}
+	return nil
+}
+
+func escape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+type errorResponse struct {
+	XMLName   xml.Name `xml:"Response"`
+	Code      string   `xml:"Errors>Error>Code"`
+	Message   string   `xml:"Errors>Error>Message"`
+	RequestID string   `xml:"RequestID"`
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "text/xml;charset=UTF-8")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(&errorResponse{
+		Code:      code,
+		Message:   message,
+		RequestID: "fake-request",
+	})
+}
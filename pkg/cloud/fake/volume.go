@@ -0,0 +1,325 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aokumasan/nifcloud-sdk-go-v2/service/computing"
+
+	nferrors "github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/errors"
+)
+
+const (
+	volumeCreating  = "creating"
+	volumeAvailable = "available"
+	volumeInUse     = "in-use"
+	volumeDeleting  = "deleting"
+
+	attachmentAttaching = "attaching"
+	attachmentAttached  = "attached"
+	attachmentDetaching = "detaching"
+)
+
+type volume struct {
+	id          string
+	size        int64
+	diskType    string
+	description string
+	zone        string
+	createTime  time.Time
+
+	status string
+	// instanceID, device and attachment describe the attachment of the volume, they are empty if it is detached
+	instanceID string
+	device     string
+	attachment string
+
+	// done completes the current transition, nil if the volume is not in transition
+	done  func()
+	steps int
+}
+
+func (v *volume) item() computing.VolumeSetItem {
+	createTime := v.createTime
+	item := computing.VolumeSetItem{
+		VolumeId:         stringPtr(v.id),
+		Size:             stringPtr(strconv.FormatInt(v.size, 10)),
+		DiskType:         stringPtr(v.diskType),
+		Description:      stringPtr(v.description),
+		AvailabilityZone: stringPtr(v.zone),
+		CreateTime:       &createTime,
+		Status:           stringPtr(v.status),
+	}
+	if v.instanceID != "" {
+		item.AttachmentSet = []computing.AttachmentSetItem{
+			{
+				VolumeId:   stringPtr(v.id),
+				InstanceId: stringPtr(v.instanceID),
+				Device:     stringPtr(v.device),
+				Status:     stringPtr(v.attachment),
+			},
+		}
+	}
+	return item
+}
+
+// transitionVolume starts the transition of the volume which done completes
+func (c *Client) transitionVolume(v *volume, done func()) {
+	v.done = done
+	v.steps = c.TransitionSteps
+	if v.steps <= 0 {
+		c.completeVolume(v)
+	}
+}
+
+// advanceVolumes takes a step of the transitions, it is called every time volumes are observed
+func (c *Client) advanceVolumes() {
+	for _, v := range c.sortedVolumes() {
+		if v.done == nil {
+			continue
+		}
+		if v.steps <= 0 {
+			c.completeVolume(v)
+			continue
+		}
+		v.steps--
+	}
+}
+
+func (c *Client) completeVolume(v *volume) {
+	done := v.done
+	v.done = nil
+	v.steps = 0
+	done()
+}
+
+func (c *Client) sortedVolumes() []*volume {
+	res := make([]*volume, 0, len(c.volumes))
+	for _, v := range c.volumes {
+		res = append(res, v)
+	}
+	sort.Slice(res, func(a, b int) bool { return res[a].id < res[b].id })
+	return res
+}
+
+func (c *Client) findVolume(id *string) (*volume, error) {
+	v, ok := c.volumes[stringValue(id)]
+	if !ok {
+		return nil, NewError(nferrors.VolumeNotFound)
+	}
+	return v, nil
+}
+
+// nextDevice returns the first free SCSI slot of the instance, the root disk uses the slot 0
+func (c *Client) nextDevice(instanceID string) string {
+	used := map[string]bool{}
+	for _, v := range c.volumes {
+		if v.instanceID == instanceID {
+			used[v.device] = true
+		}
+	}
+	for slot := 1; ; slot++ {
+		if device := fmt.Sprintf("SCSI (0:%d)", slot); !used[device] {
+			return device
+		}
+	}
+}
+
+func (c *Client) attach(v *volume, instanceID string) {
+	v.status = volumeInUse
+	v.device = c.nextDevice(instanceID)
+	v.instanceID = instanceID
+	v.attachment = attachmentAttaching
+	c.transitionVolume(v, func() { v.attachment = attachmentAttached })
+}
+
+func (c *Client) detach(v *volume) {
+	v.attachment = attachmentDetaching
+	c.transitionVolume(v, func() {
+		v.status = volumeAvailable
+		v.instanceID = ""
+		v.device = ""
+		v.attachment = ""
+	})
+}
+
+// CreateVolume creates the volume attached to the instance, as the API does not create detached volumes
+func (c *Client) CreateVolume(ctx context.Context, input *computing.CreateVolumeInput) (*computing.CreateVolumeOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("CreateVolume"); err != nil {
+		return nil, err
+	}
+
+	i, ok := c.instances[stringValue(input.InstanceId)]
+	if !ok {
+		return nil, NewError(nferrors.InvalidParameter)
+	}
+	n := c.nextID()
+	id := stringValue(input.VolumeId)
+	if id == "" {
+		id = fmt.Sprintf("fakevol%d", n)
+	}
+	if _, ok := c.volumes[id]; ok {
+		return nil, NewError(nferrors.VolumeInUse)
+	}
+
+	v := &volume{
+		id:          id,
+		diskType:    stringValue(input.DiskType),
+		description: stringValue(input.Description),
+		zone:        i.zone,
+		createTime:  time.Now(),
+		status:      volumeCreating,
+		instanceID:  i.id,
+		device:      c.nextDevice(i.id),
+		attachment:  attachmentAttaching,
+	}
+	if input.Size != nil {
+		v.size = *input.Size
+	}
+	if v.diskType == "" {
+		v.diskType = "1"
+	}
+	c.volumes[id] = v
+	c.transitionVolume(v, func() {
+		v.status = volumeInUse
+		v.attachment = attachmentAttached
+	})
+
+	return &computing.CreateVolumeOutput{
+		VolumeId:         stringPtr(v.id),
+		Size:             stringPtr(strconv.FormatInt(v.size, 10)),
+		DiskType:         stringPtr(v.diskType),
+		AvailabilityZone: stringPtr(v.zone),
+		Status:           stringPtr(v.status),
+	}, nil
+}
+
+func (c *Client) AttachVolume(ctx context.Context, input *computing.AttachVolumeInput) (*computing.AttachVolumeOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("AttachVolume"); err != nil {
+		return nil, err
+	}
+
+	v, err := c.findVolume(input.VolumeId)
+	if err != nil {
+		return nil, err
+	}
+	i, ok := c.instances[stringValue(input.InstanceId)]
+	if !ok {
+		return nil, NewError(nferrors.InvalidParameter)
+	}
+	switch {
+	case v.done != nil:
+		return nil, NewError(nferrors.VolumeProcessing)
+	case v.status != volumeAvailable:
+		return nil, NewError(nferrors.VolumeInUse)
+	}
+
+	c.attach(v, i.id)
+	return &computing.AttachVolumeOutput{
+		VolumeId:   stringPtr(v.id),
+		InstanceId: stringPtr(v.instanceID),
+		Device:     stringPtr(v.device),
+		Status:     stringPtr(v.attachment),
+	}, nil
+}
+
+func (c *Client) DetachVolume(ctx context.Context, input *computing.DetachVolumeInput) (*computing.DetachVolumeOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("DetachVolume"); err != nil {
+		return nil, err
+	}
+
+	v, err := c.findVolume(input.VolumeId)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case v.done != nil:
+		return nil, NewError(nferrors.VolumeProcessing)
+	case v.instanceID == "":
+		return nil, NewError(nferrors.VolumeNotInUse)
+	case input.InstanceId != nil && stringValue(input.InstanceId) != v.instanceID:
+		return nil, NewError(nferrors.InvalidParameter)
+	}
+
+	out := &computing.DetachVolumeOutput{
+		VolumeId:   stringPtr(v.id),
+		InstanceId: stringPtr(v.instanceID),
+		Device:     stringPtr(v.device),
+	}
+	c.detach(v)
+	out.Status = stringPtr(v.attachment)
+	return out, nil
+}
+
+func (c *Client) DeleteVolume(ctx context.Context, input *computing.DeleteVolumeInput) (*computing.DeleteVolumeOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("DeleteVolume"); err != nil {
+		return nil, err
+	}
+
+	v, err := c.findVolume(input.VolumeId)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case v.done != nil:
+		return nil, NewError(nferrors.VolumeProcessing)
+	case v.status != volumeAvailable:
+		return nil, NewError(nferrors.VolumeInUse)
+	}
+
+	v.status = volumeDeleting
+	c.transitionVolume(v, func() { delete(c.volumes, v.id) })
+	return &computing.DeleteVolumeOutput{Return: boolPtr(true)}, nil
+}
+
+func (c *Client) DescribeVolumes(ctx context.Context, input *computing.DescribeVolumesInput) (*computing.DescribeVolumesOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.record("DescribeVolumes"); err != nil {
+		return nil, err
+	}
+
+	c.advanceVolumes()
+	out := &computing.DescribeVolumesOutput{}
+	if len(input.VolumeId) == 0 {
+		for _, v := range c.sortedVolumes() {
+			out.VolumeSet = append(out.VolumeSet, v.item())
+		}
+		return out, nil
+	}
+	for _, id := range input.VolumeId {
+		v, err := c.findVolume(&id)
+		if err != nil {
+			return nil, err
+		}
+		out.VolumeSet = append(out.VolumeSet, v.item())
+	}
+	return out, nil
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
+)
+
+var (
+	clusterInstancesDesc = prometheus.NewDesc(
+		"nifcloud_cluster_instances",
+		"Number of nifcloud instances managed for the cluster, including the bastion",
+		[]string{"namespace", "cluster"}, nil,
+	)
+	clusterAddressesDesc = prometheus.NewDesc(
+		"nifcloud_cluster_addresses",
+		"Number of public IPs allocated by the provider for the cluster",
+		[]string{"namespace", "cluster"}, nil,
+	)
+)
+
+// ClusterResourceCollector counts the resources of each cluster from the status of the objects on every scrape,
+// the objects are read from the cache of the manager, so scrapes do not call the nifcloud API
+type ClusterResourceCollector struct {
+	client client.Reader
+}
+
+// RegisterClusterResourceCollector registers the collector which reads the objects with the client
+func RegisterClusterResourceCollector(c client.Reader) error {
+	return metrics.Registry.Register(&ClusterResourceCollector{client: c})
+}
+
+// Describe implements prometheus.Collector
+func (c *ClusterResourceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- clusterInstancesDesc
+	ch <- clusterAddressesDesc
+}
+
+type clusterKey struct {
+	namespace string
+	name      string
+}
+
+// Collect implements prometheus.Collector
+func (c *ClusterResourceCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx := context.Background()
+
+	nifcloudClusters := &infrav1alpha3.NifcloudClusterList{}
+	if err := c.client.List(ctx, nifcloudClusters); err != nil {
+		ch <- prometheus.NewInvalidMetric(clusterInstancesDesc, err)
+		return
+	}
+	machines := &clusterv1.MachineList{}
+	if err := c.client.List(ctx, machines); err != nil {
+		ch <- prometheus.NewInvalidMetric(clusterInstancesDesc, err)
+		return
+	}
+	nifcloudMachines := &infrav1alpha3.NifcloudMachineList{}
+	if err := c.client.List(ctx, nifcloudMachines); err != nil {
+		ch <- prometheus.NewInvalidMetric(clusterInstancesDesc, err)
+		return
+	}
+
+	instances := map[clusterKey]int{}
+	addresses := map[clusterKey]int{}
+	for i := range nifcloudClusters.Items {
+		nifcloudCluster := &nifcloudClusters.Items[i]
+		name := ownerClusterName(nifcloudCluster)
+		if name == "" {
+			continue
+		}
+		key := clusterKey{namespace: nifcloudCluster.Namespace, name: name}
+		instances[key] = 0
+		addresses[key] = 0
+		if nifcloudCluster.Status.Bastion != nil {
+			instances[key]++
+		}
+		if addr := nifcloudCluster.Status.Network.EndpointAddress; addr != nil && !addr.Unmanaged {
+			addresses[key]++
+		}
+	}
+
+	// NifcloudMachines know their clusters only through the Machines which refer to them
+	clusterOf := map[types.NamespacedName]string{}
+	for _, machine := range machines.Items {
+		ref := machine.Spec.InfrastructureRef
+		if ref.Kind != "NifcloudMachine" {
+			continue
+		}
+		clusterOf[types.NamespacedName{Namespace: machine.Namespace, Name: ref.Name}] = machine.Labels[clusterv1.ClusterLabelName]
+	}
+	for _, nifcloudMachine := range nifcloudMachines.Items {
+		if nifcloudMachine.Status.InstanceState == nil {
+			continue
+		}
+		name := clusterOf[types.NamespacedName{Namespace: nifcloudMachine.Namespace, Name: nifcloudMachine.Name}]
+		if name == "" {
+			continue
+		}
+		instances[clusterKey{namespace: nifcloudMachine.Namespace, name: name}]++
+	}
+
+	for key, n := range instances {
+		ch <- prometheus.MustNewConstMetric(clusterInstancesDesc, prometheus.GaugeValue, float64(n), key.namespace, key.name)
+	}
+	for key, n := range addresses {
+		ch <- prometheus.MustNewConstMetric(clusterAddressesDesc, prometheus.GaugeValue, float64(n), key.namespace, key.name)
+	}
+}
+
+// ownerClusterName returns the name of the Cluster which owns the NifcloudCluster
+func ownerClusterName(nifcloudCluster *infrav1alpha3.NifcloudCluster) string {
+	for _, ref := range nifcloudCluster.OwnerReferences {
+		gv, err := schema.ParseGroupVersion(ref.APIVersion)
+		if err != nil {
+			continue
+		}
+		if ref.Kind == "Cluster" && gv.Group == clusterv1.GroupVersion.Group {
+			return ref.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
+)
+
+func TestClusterResourceCollector(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clusterv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := infrav1alpha3.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	running := infrav1alpha3.InstanceRunning
+	nifcloudCluster := func(name string, network infrav1alpha3.Network, bastion *infrav1alpha3.Instance) *infrav1alpha3.NifcloudCluster {
+		return &infrav1alpha3.NifcloudCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				OwnerReferences: []metav1.OwnerReference{
+					{APIVersion: clusterv1.GroupVersion.String(), Kind: "Cluster", Name: name},
+				},
+			},
+			Status: infrav1alpha3.NifcloudClusterStatus{Network: network, Bastion: bastion},
+		}
+	}
+	machine := func(name, cluster string) *clusterv1.Machine {
+		return &clusterv1.Machine{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels:    map[string]string{clusterv1.ClusterLabelName: cluster},
+			},
+			Spec: clusterv1.MachineSpec{
+				InfrastructureRef: corev1.ObjectReference{Kind: "NifcloudMachine", Name: name},
+			},
+		}
+	}
+	nifcloudMachine := func(name string, state *infrav1alpha3.InstanceState) *infrav1alpha3.NifcloudMachine {
+		return &infrav1alpha3.NifcloudMachine{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Status:     infrav1alpha3.NifcloudMachineStatus{InstanceState: state},
+		}
+	}
+	objects := []runtime.Object{
+		nifcloudCluster("managed", infrav1alpha3.Network{EndpointAddress: &infrav1alpha3.Address{PublicIP: "203.0.113.1"}}, &infrav1alpha3.Instance{ID: "bastion"}),
+		nifcloudCluster("unmanaged", infrav1alpha3.Network{EndpointAddress: &infrav1alpha3.Address{PublicIP: "203.0.113.2", Unmanaged: true}}, nil),
+		machine("managed-0", "managed"),
+		machine("managed-1", "managed"),
+		machine("unmanaged-0", "unmanaged"),
+		nifcloudMachine("managed-0", &running),
+		nifcloudMachine("managed-1", nil),
+		nifcloudMachine("unmanaged-0", &running),
+	}
+	c := &ClusterResourceCollector{client: fake.NewFakeClientWithScheme(scheme, objects...)}
+
+	expected := `
+# HELP nifcloud_cluster_addresses Number of public IPs allocated by the provider for the cluster
+# TYPE nifcloud_cluster_addresses gauge
+nifcloud_cluster_addresses{cluster="managed",namespace="default"} 1
+nifcloud_cluster_addresses{cluster="unmanaged",namespace="default"} 0
+# HELP nifcloud_cluster_instances Number of nifcloud instances managed for the cluster, including the bastion
+# TYPE nifcloud_cluster_instances gauge
+nifcloud_cluster_instances{cluster="managed",namespace="default"} 2
+nifcloud_cluster_instances{cluster="unmanaged",namespace="default"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics exports metrics of the requests to the nifcloud API and the resources managed for clusters,
+// they are registered with the registry of controller-runtime and served by the manager.
+package metrics
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	nferrors "github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/errors"
+)
+
+const (
+	// unknownErrorCode labels the errors which do not come from the nifcloud API, like network errors
+	unknownErrorCode = "Unknown"
+
+	// results of waiters
+	WaitSucceeded = "succeeded"
+	WaitTimedOut  = "timeout"
+	WaitFailed    = "failed"
+)
+
+var (
+	apiRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "nifcloud_api_requests_total",
+		Help: "Total number of requests to the nifcloud API",
+	}, []string{"operation"})
+
+	apiRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "nifcloud_api_request_duration_seconds",
+		Help:    "Latency of requests to the nifcloud API",
+		Buckets: prometheus.ExponentialBuckets(0.05, 2, 10),
+	}, []string{"operation"})
+
+	apiRequestErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "nifcloud_api_request_errors_total",
+		Help: "Total number of failed requests to the nifcloud API by the error code",
+	}, []string{"operation", "code"})
+
+	waitDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "nifcloud_wait_duration_seconds",
+		Help:    "Time spent by waiters for nifcloud resources",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 10),
+	}, []string{"result"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(apiRequests, apiRequestDuration, apiRequestErrors, waitDuration)
+}
+
+// ObserveRequest records a request to the nifcloud API with its latency and error code
+func ObserveRequest(operation string, duration time.Duration, err error) {
+	apiRequests.WithLabelValues(operation).Inc()
+	apiRequestDuration.WithLabelValues(operation).Observe(duration.Seconds())
+	if err == nil {
+		return
+	}
+	code, ok := nferrors.Code(errors.Cause(err))
+	if !ok || code == "" {
+		code = unknownErrorCode
+	}
+	apiRequestErrors.WithLabelValues(operation, code).Inc()
+}
+
+// ObserveWait records how long a waiter took and how it ended
+func ObserveWait(duration time.Duration, err error) {
+	result := WaitSucceeded
+	switch {
+	case err == wait.ErrWaitTimeout:
+		result = WaitTimedOut
+	case err != nil:
+		result = WaitFailed
+	}
+	waitDuration.WithLabelValues(result).Observe(duration.Seconds())
+}
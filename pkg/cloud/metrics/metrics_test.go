@@ -0,0 +1,62 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	nferrors "github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/errors"
+)
+
+func TestObserveRequest(t *testing.T) {
+	ObserveRequest("DescribeInstances", time.Second, nil)
+	ObserveRequest("DescribeInstances", time.Second, awserr.New(nferrors.InvalidInstanceID, "not found", nil))
+	ObserveRequest("DescribeInstances", time.Second, errors.New("connection refused"))
+
+	if got := testutil.ToFloat64(apiRequests.WithLabelValues("DescribeInstances")); got != 3 {
+		t.Errorf("expected 3 requests, got %v", got)
+	}
+	for code, want := range map[string]float64{nferrors.InvalidInstanceID: 1, unknownErrorCode: 1} {
+		if got := testutil.ToFloat64(apiRequestErrors.WithLabelValues("DescribeInstances", code)); got != want {
+			t.Errorf("expected %v errors with code %q, got %v", want, code, got)
+		}
+	}
+}
+
+func TestObserveWait(t *testing.T) {
+	ObserveWait(time.Second, nil)
+	ObserveWait(time.Second, wait.ErrWaitTimeout)
+	ObserveWait(time.Second, errors.New("failed"))
+
+	for _, result := range []string{WaitSucceeded, WaitTimedOut, WaitFailed} {
+		m := &dto.Metric{}
+		if err := waitDuration.WithLabelValues(result).(prometheus.Metric).Write(m); err != nil {
+			t.Fatal(err)
+		}
+		if got := m.GetHistogram().GetSampleCount(); got != 1 {
+			t.Errorf("expected 1 wait with result %q, got %d", result, got)
+		}
+	}
+}
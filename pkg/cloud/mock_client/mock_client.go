@@ -111,6 +111,21 @@ func (mr *MockClientMockRecorder) DisassociateAddress(arg0, arg1 interface{}) *g
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DisassociateAddress", reflect.TypeOf((*MockClient)(nil).DisassociateAddress), arg0, arg1)
 }
 
+// NiftyModifyAddressAttribute mocks base method
+func (m *MockClient) NiftyModifyAddressAttribute(arg0 context.Context, arg1 *computing.NiftyModifyAddressAttributeInput) (*computing.NiftyModifyAddressAttributeOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NiftyModifyAddressAttribute", arg0, arg1)
+	ret0, _ := ret[0].(*computing.NiftyModifyAddressAttributeOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NiftyModifyAddressAttribute indicates an expected call of NiftyModifyAddressAttribute
+func (mr *MockClientMockRecorder) NiftyModifyAddressAttribute(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NiftyModifyAddressAttribute", reflect.TypeOf((*MockClient)(nil).NiftyModifyAddressAttribute), arg0, arg1)
+}
+
 // DescribeInstances mocks base method
 func (m *MockClient) DescribeInstances(arg0 context.Context, arg1 *computing.DescribeInstancesInput) (*computing.DescribeInstancesOutput, error) {
 	m.ctrl.T.Helper()
@@ -306,6 +321,366 @@ func (mr *MockClientMockRecorder) AssociateAddress(arg0, arg1 interface{}) *gomo
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AssociateAddress", reflect.TypeOf((*MockClient)(nil).AssociateAddress), arg0, arg1)
 }
 
+// CreateLoadBalancer mocks base method
+func (m *MockClient) CreateLoadBalancer(arg0 context.Context, arg1 *computing.CreateLoadBalancerInput) (*computing.CreateLoadBalancerOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateLoadBalancer", arg0, arg1)
+	ret0, _ := ret[0].(*computing.CreateLoadBalancerOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateLoadBalancer indicates an expected call of CreateLoadBalancer
+func (mr *MockClientMockRecorder) CreateLoadBalancer(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateLoadBalancer", reflect.TypeOf((*MockClient)(nil).CreateLoadBalancer), arg0, arg1)
+}
+
+// DeleteLoadBalancer mocks base method
+func (m *MockClient) DeleteLoadBalancer(arg0 context.Context, arg1 *computing.DeleteLoadBalancerInput) (*computing.DeleteLoadBalancerOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteLoadBalancer", arg0, arg1)
+	ret0, _ := ret[0].(*computing.DeleteLoadBalancerOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteLoadBalancer indicates an expected call of DeleteLoadBalancer
+func (mr *MockClientMockRecorder) DeleteLoadBalancer(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteLoadBalancer", reflect.TypeOf((*MockClient)(nil).DeleteLoadBalancer), arg0, arg1)
+}
+
+// DescribeLoadBalancers mocks base method
+func (m *MockClient) DescribeLoadBalancers(arg0 context.Context, arg1 *computing.DescribeLoadBalancersInput) (*computing.DescribeLoadBalancersOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DescribeLoadBalancers", arg0, arg1)
+	ret0, _ := ret[0].(*computing.DescribeLoadBalancersOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DescribeLoadBalancers indicates an expected call of DescribeLoadBalancers
+func (mr *MockClientMockRecorder) DescribeLoadBalancers(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DescribeLoadBalancers", reflect.TypeOf((*MockClient)(nil).DescribeLoadBalancers), arg0, arg1)
+}
+
+// ConfigureHealthCheck mocks base method
+func (m *MockClient) ConfigureHealthCheck(arg0 context.Context, arg1 *computing.ConfigureHealthCheckInput) (*computing.ConfigureHealthCheckOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConfigureHealthCheck", arg0, arg1)
+	ret0, _ := ret[0].(*computing.ConfigureHealthCheckOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConfigureHealthCheck indicates an expected call of ConfigureHealthCheck
+func (mr *MockClientMockRecorder) ConfigureHealthCheck(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConfigureHealthCheck", reflect.TypeOf((*MockClient)(nil).ConfigureHealthCheck), arg0, arg1)
+}
+
+// RegisterInstancesWithLoadBalancer mocks base method
+func (m *MockClient) RegisterInstancesWithLoadBalancer(arg0 context.Context, arg1 *computing.RegisterInstancesWithLoadBalancerInput) (*computing.RegisterInstancesWithLoadBalancerOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RegisterInstancesWithLoadBalancer", arg0, arg1)
+	ret0, _ := ret[0].(*computing.RegisterInstancesWithLoadBalancerOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RegisterInstancesWithLoadBalancer indicates an expected call of RegisterInstancesWithLoadBalancer
+func (mr *MockClientMockRecorder) RegisterInstancesWithLoadBalancer(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegisterInstancesWithLoadBalancer", reflect.TypeOf((*MockClient)(nil).RegisterInstancesWithLoadBalancer), arg0, arg1)
+}
+
+// DeregisterInstancesFromLoadBalancer mocks base method
+func (m *MockClient) DeregisterInstancesFromLoadBalancer(arg0 context.Context, arg1 *computing.DeregisterInstancesFromLoadBalancerInput) (*computing.DeregisterInstancesFromLoadBalancerOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeregisterInstancesFromLoadBalancer", arg0, arg1)
+	ret0, _ := ret[0].(*computing.DeregisterInstancesFromLoadBalancerOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeregisterInstancesFromLoadBalancer indicates an expected call of DeregisterInstancesFromLoadBalancer
+func (mr *MockClientMockRecorder) DeregisterInstancesFromLoadBalancer(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeregisterInstancesFromLoadBalancer", reflect.TypeOf((*MockClient)(nil).DeregisterInstancesFromLoadBalancer), arg0, arg1)
+}
+
+// NiftyCreatePrivateLan mocks base method
+func (m *MockClient) NiftyCreatePrivateLan(arg0 context.Context, arg1 *computing.NiftyCreatePrivateLanInput) (*computing.NiftyCreatePrivateLanOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NiftyCreatePrivateLan", arg0, arg1)
+	ret0, _ := ret[0].(*computing.NiftyCreatePrivateLanOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NiftyCreatePrivateLan indicates an expected call of NiftyCreatePrivateLan
+func (mr *MockClientMockRecorder) NiftyCreatePrivateLan(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NiftyCreatePrivateLan", reflect.TypeOf((*MockClient)(nil).NiftyCreatePrivateLan), arg0, arg1)
+}
+
+// NiftyDeletePrivateLan mocks base method
+func (m *MockClient) NiftyDeletePrivateLan(arg0 context.Context, arg1 *computing.NiftyDeletePrivateLanInput) (*computing.NiftyDeletePrivateLanOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NiftyDeletePrivateLan", arg0, arg1)
+	ret0, _ := ret[0].(*computing.NiftyDeletePrivateLanOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NiftyDeletePrivateLan indicates an expected call of NiftyDeletePrivateLan
+func (mr *MockClientMockRecorder) NiftyDeletePrivateLan(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NiftyDeletePrivateLan", reflect.TypeOf((*MockClient)(nil).NiftyDeletePrivateLan), arg0, arg1)
+}
+
+// NiftyDescribePrivateLans mocks base method
+func (m *MockClient) NiftyDescribePrivateLans(arg0 context.Context, arg1 *computing.NiftyDescribePrivateLansInput) (*computing.NiftyDescribePrivateLansOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NiftyDescribePrivateLans", arg0, arg1)
+	ret0, _ := ret[0].(*computing.NiftyDescribePrivateLansOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NiftyDescribePrivateLans indicates an expected call of NiftyDescribePrivateLans
+func (mr *MockClientMockRecorder) NiftyDescribePrivateLans(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NiftyDescribePrivateLans", reflect.TypeOf((*MockClient)(nil).NiftyDescribePrivateLans), arg0, arg1)
+}
+
+// NiftyCreateRouter mocks base method
+func (m *MockClient) NiftyCreateRouter(arg0 context.Context, arg1 *computing.NiftyCreateRouterInput) (*computing.NiftyCreateRouterOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NiftyCreateRouter", arg0, arg1)
+	ret0, _ := ret[0].(*computing.NiftyCreateRouterOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NiftyCreateRouter indicates an expected call of NiftyCreateRouter
+func (mr *MockClientMockRecorder) NiftyCreateRouter(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NiftyCreateRouter", reflect.TypeOf((*MockClient)(nil).NiftyCreateRouter), arg0, arg1)
+}
+
+// NiftyDeleteRouter mocks base method
+func (m *MockClient) NiftyDeleteRouter(arg0 context.Context, arg1 *computing.NiftyDeleteRouterInput) (*computing.NiftyDeleteRouterOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NiftyDeleteRouter", arg0, arg1)
+	ret0, _ := ret[0].(*computing.NiftyDeleteRouterOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NiftyDeleteRouter indicates an expected call of NiftyDeleteRouter
+func (mr *MockClientMockRecorder) NiftyDeleteRouter(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NiftyDeleteRouter", reflect.TypeOf((*MockClient)(nil).NiftyDeleteRouter), arg0, arg1)
+}
+
+// NiftyDescribeRouters mocks base method
+func (m *MockClient) NiftyDescribeRouters(arg0 context.Context, arg1 *computing.NiftyDescribeRoutersInput) (*computing.NiftyDescribeRoutersOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NiftyDescribeRouters", arg0, arg1)
+	ret0, _ := ret[0].(*computing.NiftyDescribeRoutersOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NiftyDescribeRouters indicates an expected call of NiftyDescribeRouters
+func (mr *MockClientMockRecorder) NiftyDescribeRouters(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NiftyDescribeRouters", reflect.TypeOf((*MockClient)(nil).NiftyDescribeRouters), arg0, arg1)
+}
+
+// NiftyCreateDhcpConfig mocks base method
+func (m *MockClient) NiftyCreateDhcpConfig(arg0 context.Context, arg1 *computing.NiftyCreateDhcpConfigInput) (*computing.NiftyCreateDhcpConfigOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NiftyCreateDhcpConfig", arg0, arg1)
+	ret0, _ := ret[0].(*computing.NiftyCreateDhcpConfigOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NiftyCreateDhcpConfig indicates an expected call of NiftyCreateDhcpConfig
+func (mr *MockClientMockRecorder) NiftyCreateDhcpConfig(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NiftyCreateDhcpConfig", reflect.TypeOf((*MockClient)(nil).NiftyCreateDhcpConfig), arg0, arg1)
+}
+
+// NiftyCreateDhcpIpAddressPool mocks base method
+func (m *MockClient) NiftyCreateDhcpIpAddressPool(arg0 context.Context, arg1 *computing.NiftyCreateDhcpIpAddressPoolInput) (*computing.NiftyCreateDhcpIpAddressPoolOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NiftyCreateDhcpIpAddressPool", arg0, arg1)
+	ret0, _ := ret[0].(*computing.NiftyCreateDhcpIpAddressPoolOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NiftyCreateDhcpIpAddressPool indicates an expected call of NiftyCreateDhcpIpAddressPool
+func (mr *MockClientMockRecorder) NiftyCreateDhcpIpAddressPool(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NiftyCreateDhcpIpAddressPool", reflect.TypeOf((*MockClient)(nil).NiftyCreateDhcpIpAddressPool), arg0, arg1)
+}
+
+// NiftyDeleteDhcpConfig mocks base method
+func (m *MockClient) NiftyDeleteDhcpConfig(arg0 context.Context, arg1 *computing.NiftyDeleteDhcpConfigInput) (*computing.NiftyDeleteDhcpConfigOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NiftyDeleteDhcpConfig", arg0, arg1)
+	ret0, _ := ret[0].(*computing.NiftyDeleteDhcpConfigOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NiftyDeleteDhcpConfig indicates an expected call of NiftyDeleteDhcpConfig
+func (mr *MockClientMockRecorder) NiftyDeleteDhcpConfig(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NiftyDeleteDhcpConfig", reflect.TypeOf((*MockClient)(nil).NiftyDeleteDhcpConfig), arg0, arg1)
+}
+
+// NiftyDescribeDhcpConfigs mocks base method
+func (m *MockClient) NiftyDescribeDhcpConfigs(arg0 context.Context, arg1 *computing.NiftyDescribeDhcpConfigsInput) (*computing.NiftyDescribeDhcpConfigsOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NiftyDescribeDhcpConfigs", arg0, arg1)
+	ret0, _ := ret[0].(*computing.NiftyDescribeDhcpConfigsOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NiftyDescribeDhcpConfigs indicates an expected call of NiftyDescribeDhcpConfigs
+func (mr *MockClientMockRecorder) NiftyDescribeDhcpConfigs(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NiftyDescribeDhcpConfigs", reflect.TypeOf((*MockClient)(nil).NiftyDescribeDhcpConfigs), arg0, arg1)
+}
+
+// CreateVolume mocks base method
+func (m *MockClient) CreateVolume(arg0 context.Context, arg1 *computing.CreateVolumeInput) (*computing.CreateVolumeOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateVolume", arg0, arg1)
+	ret0, _ := ret[0].(*computing.CreateVolumeOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateVolume indicates an expected call of CreateVolume
+func (mr *MockClientMockRecorder) CreateVolume(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateVolume", reflect.TypeOf((*MockClient)(nil).CreateVolume), arg0, arg1)
+}
+
+// AttachVolume mocks base method
+func (m *MockClient) AttachVolume(arg0 context.Context, arg1 *computing.AttachVolumeInput) (*computing.AttachVolumeOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AttachVolume", arg0, arg1)
+	ret0, _ := ret[0].(*computing.AttachVolumeOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AttachVolume indicates an expected call of AttachVolume
+func (mr *MockClientMockRecorder) AttachVolume(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AttachVolume", reflect.TypeOf((*MockClient)(nil).AttachVolume), arg0, arg1)
+}
+
+// DetachVolume mocks base method
+func (m *MockClient) DetachVolume(arg0 context.Context, arg1 *computing.DetachVolumeInput) (*computing.DetachVolumeOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DetachVolume", arg0, arg1)
+	ret0, _ := ret[0].(*computing.DetachVolumeOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DetachVolume indicates an expected call of DetachVolume
+func (mr *MockClientMockRecorder) DetachVolume(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DetachVolume", reflect.TypeOf((*MockClient)(nil).DetachVolume), arg0, arg1)
+}
+
+// DeleteVolume mocks base method
+func (m *MockClient) DeleteVolume(arg0 context.Context, arg1 *computing.DeleteVolumeInput) (*computing.DeleteVolumeOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteVolume", arg0, arg1)
+	ret0, _ := ret[0].(*computing.DeleteVolumeOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteVolume indicates an expected call of DeleteVolume
+func (mr *MockClientMockRecorder) DeleteVolume(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteVolume", reflect.TypeOf((*MockClient)(nil).DeleteVolume), arg0, arg1)
+}
+
+// DescribeVolumes mocks base method
+func (m *MockClient) DescribeVolumes(arg0 context.Context, arg1 *computing.DescribeVolumesInput) (*computing.DescribeVolumesOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DescribeVolumes", arg0, arg1)
+	ret0, _ := ret[0].(*computing.DescribeVolumesOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DescribeVolumes indicates an expected call of DescribeVolumes
+func (mr *MockClientMockRecorder) DescribeVolumes(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DescribeVolumes", reflect.TypeOf((*MockClient)(nil).DescribeVolumes), arg0, arg1)
+}
+
+// ImportKeyPair mocks base method
+func (m *MockClient) ImportKeyPair(arg0 context.Context, arg1 *computing.ImportKeyPairInput) (*computing.ImportKeyPairOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ImportKeyPair", arg0, arg1)
+	ret0, _ := ret[0].(*computing.ImportKeyPairOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ImportKeyPair indicates an expected call of ImportKeyPair
+func (mr *MockClientMockRecorder) ImportKeyPair(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ImportKeyPair", reflect.TypeOf((*MockClient)(nil).ImportKeyPair), arg0, arg1)
+}
+
+// DeleteKeyPair mocks base method
+func (m *MockClient) DeleteKeyPair(arg0 context.Context, arg1 *computing.DeleteKeyPairInput) (*computing.DeleteKeyPairOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteKeyPair", arg0, arg1)
+	ret0, _ := ret[0].(*computing.DeleteKeyPairOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteKeyPair indicates an expected call of DeleteKeyPair
+func (mr *MockClientMockRecorder) DeleteKeyPair(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteKeyPair", reflect.TypeOf((*MockClient)(nil).DeleteKeyPair), arg0, arg1)
+}
+
+// DescribeKeyPairs mocks base method
+func (m *MockClient) DescribeKeyPairs(arg0 context.Context, arg1 *computing.DescribeKeyPairsInput) (*computing.DescribeKeyPairsOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DescribeKeyPairs", arg0, arg1)
+	ret0, _ := ret[0].(*computing.DescribeKeyPairsOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DescribeKeyPairs indicates an expected call of DescribeKeyPairs
+func (mr *MockClientMockRecorder) DescribeKeyPairs(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DescribeKeyPairs", reflect.TypeOf((*MockClient)(nil).DescribeKeyPairs), arg0, arg1)
+}
+
 // WaitUntilInstanceStopped mocks base method
 func (m *MockClient) WaitUntilInstanceStopped(arg0 context.Context, arg1 *computing.DescribeInstancesInput) error {
 	m.ctrl.T.Helper()
@@ -18,26 +18,38 @@ package scope
 
 import (
 	"context"
+	"crypto/md5"
+	"encoding/hex"
 	"fmt"
-	"os"
+	"strings"
 
 	"github.com/go-logr/logr"
-	infrav1alpha2 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha2"
-	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/scope/nifcloud"
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/klog/klogr"
-	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
 	"sigs.k8s.io/cluster-api/util/patch"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+const (
+	// SSHPublicKeySecretKey is the key of the public key in the secret of the ssh key when it is not specified
+	SSHPublicKeySecretKey = "publicKey"
+
+	keyPairNamePrefix = "capi"
+)
+
 // ClusterScopeParams include input paramater to create new scope for cluster
 type ClusterScopeParams struct {
 	NifcloudClients
 	Client client.Client
 	Logger logr.Logger
+	// ClientCache shares the clients among scopes, the default cache is used when it is nil
+	ClientCache *ClientCache
 
 	Cluster         *clusterv1.Cluster
-	NifcloudCluster *infrav1alpha2.NifcloudCluster
+	NifcloudCluster *infrav1alpha3.NifcloudCluster
 }
 
 // NewClusterScope creates a new cluster scope from a specified prams
@@ -52,11 +64,15 @@ func NewClusterScope(params ClusterScopeParams) (*ClusterScope, error) {
 	if params.Logger == nil {
 		params.Logger = klogr.New()
 	}
+	if params.ClientCache == nil {
+		params.ClientCache = defaultClientCache
+	}
 	if params.NifcloudClients.Computing == nil {
-		accKey := os.Getenv("NIFCLOUD_ACCESS_KEY")
-		secKey := os.Getenv("NIFCLOUD_SECRET_KEY")
-		region := os.Getenv("NIFCLOUD_REGION")
-		cmpClient, err := nifcloud.New(accKey, secKey, region)
+		identity, creds, err := GetCredentials(context.TODO(), params.Client, params.NifcloudCluster)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get nifcloud credentials: %w", err)
+		}
+		cmpClient, err := params.ClientCache.Client(identity, creds)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create nifcloud client: %w", err)
 		}
@@ -86,15 +102,15 @@ type ClusterScope struct {
 	patchHelper *patch.Helper
 
 	NifcloudClients
-	NifcloudCluster *infrav1alpha2.NifcloudCluster
+	NifcloudCluster *infrav1alpha3.NifcloudCluster
 	Cluster         *clusterv1.Cluster
 }
 
-func (s *ClusterScope) Network() *infrav1alpha2.Network {
+func (s *ClusterScope) Network() *infrav1alpha3.Network {
 	return &s.NifcloudCluster.Status.Network
 }
 
-func (s *ClusterScope) SecurityGroups() map[infrav1alpha2.SecurityGroupRole]infrav1alpha2.SecurityGroup {
+func (s *ClusterScope) SecurityGroups() map[infrav1alpha3.SecurityGroupRole]infrav1alpha3.SecurityGroup {
 	return s.NifcloudCluster.Status.Network.SecurityGroups
 }
 
@@ -102,6 +118,43 @@ func (s *ClusterScope) Name() string {
 	return s.Cluster.Name
 }
 
+// KeyPairName returns the name of the key pair imported from the ssh key of the cluster,
+// it is derived from the namespace and the name because nifcloud accepts only short alphanumeric names
+func (s *ClusterScope) KeyPairName() string {
+	hashed := md5.Sum([]byte(s.Cluster.Namespace + "/" + s.Cluster.Name))
+	return keyPairNamePrefix + hex.EncodeToString(hashed[:])[:16]
+}
+
+// SSHPublicKey returns the public key given by the ssh key of the cluster,
+// the secret is read on every call like the credentials
+func (s *ClusterScope) SSHPublicKey(ctx context.Context) (string, error) {
+	spec := s.NifcloudCluster.Spec.SSHKey
+	if spec == nil {
+		return "", errors.New("ssh key is not specified")
+	}
+	if spec.SecretRef == nil {
+		return strings.TrimSpace(spec.PublicKey), nil
+	}
+	if s.client == nil {
+		return "", errors.New("client is required to read the secret of the ssh key")
+	}
+
+	key := client.ObjectKey{Namespace: s.NifcloudCluster.Namespace, Name: spec.SecretRef.Name}
+	secret := &corev1.Secret{}
+	if err := s.client.Get(ctx, key, secret); err != nil {
+		return "", errors.Wrapf(err, "failed to get ssh key secret %s", key)
+	}
+	dataKey := spec.SecretRef.Key
+	if dataKey == "" {
+		dataKey = SSHPublicKeySecretKey
+	}
+	publicKey := strings.TrimSpace(string(secret.Data[dataKey]))
+	if publicKey == "" {
+		return "", errors.Errorf("ssh key secret %s must have %q key", key, dataKey)
+	}
+	return publicKey, nil
+}
+
 func (s *ClusterScope) Close() error {
 	return s.patchHelper.Patch(context.TODO(), s.NifcloudCluster)
 }
@@ -0,0 +1,164 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scope
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/scope/nifcloud"
+)
+
+const (
+	// keys of the credentials in the secret
+	AccessKeySecretKey = "accessKey"
+	SecretKeySecretKey = "secretKey"
+	RegionSecretKey    = "region"
+
+	// identity of the credentials given by environment variables
+	environmentIdentity = "environment"
+)
+
+// Credentials are the keys and the region to access nifcloud
+type Credentials struct {
+	AccessKey string
+	SecretKey string
+	Region    string
+}
+
+// hash identifies the credentials, it only detects that the credentials of an identity are rotated
+func (c Credentials) hash() string {
+	hashed := sha256.Sum256([]byte(c.AccessKey + "\x00" + c.SecretKey + "\x00" + c.Region))
+	return hex.EncodeToString(hashed[:])
+}
+
+// GetCredentials resolves the credentials of the cluster and returns them with the key of the identity
+// the secret is read on every call, so rotated credentials are used by the next reconciliation
+func GetCredentials(ctx context.Context, c client.Client, nifcloudCluster *infrav1alpha3.NifcloudCluster) (string, Credentials, error) {
+	ref := nifcloudCluster.Spec.IdentityRef
+	if ref == nil {
+		return environmentIdentity, Credentials{
+			AccessKey: os.Getenv("NIFCLOUD_ACCESS_KEY"),
+			SecretKey: os.Getenv("NIFCLOUD_SECRET_KEY"),
+			Region:    os.Getenv("NIFCLOUD_REGION"),
+		}, nil
+	}
+	if c == nil {
+		return "", Credentials{}, errors.New("client is required to resolve the identity of the cluster")
+	}
+
+	var key client.ObjectKey
+	switch ref.Kind {
+	case infrav1alpha3.IdentityKindSecret:
+		key = client.ObjectKey{Namespace: nifcloudCluster.Namespace, Name: ref.Name}
+	case infrav1alpha3.IdentityKindClusterIdentity:
+		identity := &infrav1alpha3.NifcloudClusterIdentity{}
+		if err := c.Get(ctx, client.ObjectKey{Name: ref.Name}, identity); err != nil {
+			return "", Credentials{}, errors.Wrapf(err, "failed to get NifcloudClusterIdentity %q", ref.Name)
+		}
+		if !identityAllowed(identity, nifcloudCluster.Namespace) {
+			return "", Credentials{}, errors.Errorf("NifcloudClusterIdentity %q is not allowed to be used in namespace %q", ref.Name, nifcloudCluster.Namespace)
+		}
+		if identity.Spec.SecretRef.Namespace == "" {
+			return "", Credentials{}, errors.Errorf("NifcloudClusterIdentity %q does not specify the namespace of the secret", ref.Name)
+		}
+		key = client.ObjectKey{Namespace: identity.Spec.SecretRef.Namespace, Name: identity.Spec.SecretRef.Name}
+	default:
+		return "", Credentials{}, errors.Errorf("unknown kind of identity %q", ref.Kind)
+	}
+
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, key, secret); err != nil {
+		return "", Credentials{}, errors.Wrapf(err, "failed to get credentials secret %s", key)
+	}
+	creds := Credentials{
+		AccessKey: string(secret.Data[AccessKeySecretKey]),
+		SecretKey: string(secret.Data[SecretKeySecretKey]),
+		Region:    string(secret.Data[RegionSecretKey]),
+	}
+	if creds.AccessKey == "" || creds.SecretKey == "" {
+		return "", Credentials{}, errors.Errorf("credentials secret %s must have %q and %q keys", key, AccessKeySecretKey, SecretKeySecretKey)
+	}
+	// region of the cluster is used when the secret is shared among regions
+	if creds.Region == "" {
+		creds.Region = nifcloudCluster.Spec.Region
+	}
+	return key.String(), creds, nil
+}
+
+func identityAllowed(identity *infrav1alpha3.NifcloudClusterIdentity, namespace string) bool {
+	if len(identity.Spec.AllowedNamespaces) == 0 {
+		return true
+	}
+	for _, ns := range identity.Spec.AllowedNamespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientCache keeps a client per identity, and replaces it when the credentials of the identity change
+type ClientCache struct {
+	factory cloud.ClientFactory
+
+	mu      sync.Mutex
+	clients map[string]cachedClient
+}
+
+type cachedClient struct {
+	hash   string
+	client cloud.Client
+}
+
+// NewClientCache returns a cache which creates clients with the factory
+func NewClientCache(factory cloud.ClientFactory) *ClientCache {
+	return &ClientCache{
+		factory: factory,
+		clients: make(map[string]cachedClient),
+	}
+}
+
+// defaultClientCache is used by the scopes which are not given a cache
+var defaultClientCache = NewClientCache(nifcloud.NewNifcloudClientFactory(nifcloud.DefaultClientOptions()))
+
+// Client returns the client of the identity
+func (c *ClientCache) Client(identity string, creds Credentials) (cloud.Client, error) {
+	hash := creds.hash()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, ok := c.clients[identity]; ok && cached.hash == hash {
+		return cached.client, nil
+	}
+
+	client, err := c.factory.CreateClient(creds.AccessKey, creds.SecretKey, creds.Region)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create nifcloud client for %s", identity)
+	}
+	c.clients[identity] = cachedClient{hash: hash, client: client}
+	return client, nil
+}
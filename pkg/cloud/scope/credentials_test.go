@@ -0,0 +1,176 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scope
+
+import (
+	"context"
+	"testing"
+
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/mock_client"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newCredentialsSecret(namespace, name string, data map[string]string) *corev1.Secret {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Data:       map[string][]byte{},
+	}
+	for k, v := range data {
+		secret.Data[k] = []byte(v)
+	}
+	return secret
+}
+
+func TestGetCredentials(t *testing.T) {
+	scheme, err := setupScheme()
+	if err != nil {
+		t.Fatalf("failed to setup scheme: %v", err)
+	}
+	objects := []runtime.Object{
+		newCredentialsSecret("default", "credentials", map[string]string{
+			AccessKeySecretKey: "access",
+			SecretKeySecretKey: "secret",
+			RegionSecretKey:    "jp-west-1",
+		}),
+		newCredentialsSecret("default", "without-region", map[string]string{
+			AccessKeySecretKey: "access",
+			SecretKeySecretKey: "secret",
+		}),
+		newCredentialsSecret("default", "broken", map[string]string{
+			AccessKeySecretKey: "access",
+		}),
+		newCredentialsSecret("capn-system", "shared", map[string]string{
+			AccessKeySecretKey: "shared-access",
+			SecretKeySecretKey: "shared-secret",
+			RegionSecretKey:    "jp-east-1",
+		}),
+		&infrav1alpha3.NifcloudClusterIdentity{
+			ObjectMeta: metav1.ObjectMeta{Name: "shared"},
+			Spec: infrav1alpha3.NifcloudClusterIdentitySpec{
+				SecretRef:         corev1.SecretReference{Namespace: "capn-system", Name: "shared"},
+				AllowedNamespaces: []string{"default"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		namespace    string
+		ref          *infrav1alpha3.NifcloudIdentityReference
+		wantIdentity string
+		want         Credentials
+		wantErr      bool
+	}{
+		{
+			name:         "secret in the namespace of the cluster",
+			namespace:    "default",
+			ref:          &infrav1alpha3.NifcloudIdentityReference{Kind: infrav1alpha3.IdentityKindSecret, Name: "credentials"},
+			wantIdentity: "default/credentials",
+			want:         Credentials{AccessKey: "access", SecretKey: "secret", Region: "jp-west-1"},
+		},
+		{
+			name:         "region of the cluster is used when secret does not have it",
+			namespace:    "default",
+			ref:          &infrav1alpha3.NifcloudIdentityReference{Kind: infrav1alpha3.IdentityKindSecret, Name: "without-region"},
+			wantIdentity: "default/without-region",
+			want:         Credentials{AccessKey: "access", SecretKey: "secret", Region: "jp-east-4"},
+		},
+		{
+			name:      "secret without secret key",
+			namespace: "default",
+			ref:       &infrav1alpha3.NifcloudIdentityReference{Kind: infrav1alpha3.IdentityKindSecret, Name: "broken"},
+			wantErr:   true,
+		},
+		{
+			name:      "secret in another namespace is not referred directly",
+			namespace: "default",
+			ref:       &infrav1alpha3.NifcloudIdentityReference{Kind: infrav1alpha3.IdentityKindSecret, Name: "shared"},
+			wantErr:   true,
+		},
+		{
+			name:         "cluster identity",
+			namespace:    "default",
+			ref:          &infrav1alpha3.NifcloudIdentityReference{Kind: infrav1alpha3.IdentityKindClusterIdentity, Name: "shared"},
+			wantIdentity: "capn-system/shared",
+			want:         Credentials{AccessKey: "shared-access", SecretKey: "shared-secret", Region: "jp-east-1"},
+		},
+		{
+			name:      "cluster identity not allowed in the namespace",
+			namespace: "other",
+			ref:       &infrav1alpha3.NifcloudIdentityReference{Kind: infrav1alpha3.IdentityKindClusterIdentity, Name: "shared"},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewFakeClientWithScheme(scheme, objects...)
+			nifcloudCluster := &infrav1alpha3.NifcloudCluster{
+				ObjectMeta: metav1.ObjectMeta{Namespace: tt.namespace, Name: "test-cluster"},
+				Spec:       infrav1alpha3.NifcloudClusterSpec{Region: "jp-east-4", IdentityRef: tt.ref},
+			}
+			identity, got, err := GetCredentials(context.TODO(), c, nifcloudCluster)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error[%v], wantErr[%v]", err, tt.wantErr)
+			}
+			if identity != tt.wantIdentity || got != tt.want {
+				t.Errorf("got[%s %+v], want[%s %+v]", identity, got, tt.wantIdentity, tt.want)
+			}
+		})
+	}
+}
+
+// countingFactory creates mock clients and counts them
+type countingFactory struct {
+	created int
+}
+
+func (f *countingFactory) CreateClient(_, _, _ string) (cloud.Client, error) {
+	f.created++
+	return &mock_client.MockClient{}, nil
+}
+
+func TestClientCache_Client(t *testing.T) {
+	factory := &countingFactory{}
+	cache := NewClientCache(factory)
+	creds := Credentials{AccessKey: "access", SecretKey: "secret", Region: "jp-east-1"}
+
+	first, err := cache.Client("default/credentials", creds)
+	if err != nil {
+		t.Fatalf("did not expect error: %v", err)
+	}
+	if second, _ := cache.Client("default/credentials", creds); second != first || factory.created != 1 {
+		t.Errorf("client of the same credentials must be reused, created %d clients", factory.created)
+	}
+	if _, err := cache.Client("default/other", creds); err != nil || factory.created != 2 {
+		t.Errorf("each identity must have its own client, created %d clients", factory.created)
+	}
+
+	// rotation of the secret key replaces the client of the identity
+	creds.SecretKey = "rotated"
+	rotated, err := cache.Client("default/credentials", creds)
+	if err != nil {
+		t.Fatalf("did not expect error: %v", err)
+	}
+	if rotated == first || factory.created != 3 {
+		t.Errorf("client must be recreated after rotation, created %d clients", factory.created)
+	}
+}
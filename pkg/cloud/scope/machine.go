@@ -18,11 +18,13 @@ package scope
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/md5"
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"strings"
 	"text/template"
 
 	capierrors "sigs.k8s.io/cluster-api/errors"
@@ -31,13 +33,13 @@ import (
 	"github.com/aokumasan/nifcloud-sdk-go-v2/service/computing"
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
-	infrav1alpha2 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha2"
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
 	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/userdata"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/klog/klogr"
 	"k8s.io/utils/pointer"
 
-	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
 	"sigs.k8s.io/cluster-api/controllers/noderefutil"
 	"sigs.k8s.io/cluster-api/util"
 	"sigs.k8s.io/cluster-api/util/patch"
@@ -47,6 +49,16 @@ import (
 const (
 	// nifcloud requirements
 	maxInstanceIDName = 15
+	maxUserDataSize   = 8 * 1024
+
+	// kubeadm bootstrap data asks cloud-init for the hostname with this placeholder
+	hostnamePlaceholder = "'{{ ds.meta_data.hostname }}'"
+
+	// bootstrap providers store bootstrap data in this key of the secret
+	bootstrapDataSecretKey = "value"
+
+	// nifcloud attaches a volume of "GB" with this number of bytes per GB
+	volumeSizeUnit = 1024 * 1024 * 1024
 )
 
 // MachineScopeParams include input paramater to create new scope for machine
@@ -56,8 +68,8 @@ type MachineScopeParams struct {
 	Logger          logr.Logger
 	Cluster         *clusterv1.Cluster
 	Machine         *clusterv1.Machine
-	NifcloudCluster *infrav1alpha2.NifcloudCluster
-	NifcloudMachine *infrav1alpha2.NifcloudMachine
+	NifcloudCluster *infrav1alpha3.NifcloudCluster
+	NifcloudMachine *infrav1alpha3.NifcloudMachine
 }
 
 // NewMachineScope creates a new machine scope from a specified prams
@@ -107,8 +119,11 @@ type MachineScope struct {
 
 	Cluster         *clusterv1.Cluster
 	Machine         *clusterv1.Machine
-	NifcloudCluster *infrav1alpha2.NifcloudCluster
-	NifcloudMachine *infrav1alpha2.NifcloudMachine
+	NifcloudCluster *infrav1alpha3.NifcloudCluster
+	NifcloudMachine *infrav1alpha3.NifcloudMachine
+
+	// bootstrapData is the decoded bootstrap data loaded by LoadBootstrapData
+	bootstrapData []byte
 }
 
 func (m *MachineScope) Name() string {
@@ -143,8 +158,12 @@ func (m *MachineScope) SetProviderID(v string) {
 
 // GetInstanceIDConved returns the expression of InstanceID in nifcloud
 func (m *MachineScope) GetInstanceIDConved() string {
-	instanceID := m.Name()
-	hashed := md5.Sum([]byte(instanceID))
+	return InstanceIDFromName(m.Name())
+}
+
+// InstanceIDFromName returns the instance id in nifcloud of the NifcloudMachine with the name
+func InstanceIDFromName(name string) string {
+	hashed := md5.Sum([]byte(name))
 	tmp := fmt.Sprintf("%s", hex.EncodeToString(hashed[:]))
 	return tmp[:maxInstanceIDName]
 }
@@ -162,16 +181,26 @@ func (m *MachineScope) GetInstanceUID() (*string, error) {
 	return pointer.StringPtr(parsed.ID()), nil
 }
 
-func (m *MachineScope) GetInstanceState() *infrav1alpha2.InstanceState {
+func (m *MachineScope) GetInstanceState() *infrav1alpha3.InstanceState {
 	return m.NifcloudMachine.Status.InstanceState
 }
 
-func (m *MachineScope) SetInstanceState(i infrav1alpha2.InstanceState) {
+func (m *MachineScope) SetInstanceState(i infrav1alpha3.InstanceState) {
 	m.NifcloudMachine.Status.InstanceState = &i
 }
 
 func (m *MachineScope) SetAddresses(addrs []corev1.NodeAddress) {
-	m.NifcloudMachine.Status.Address = addrs
+	m.NifcloudMachine.Status.Addresses = addrs
+}
+
+// IsControlPlaneEndpointAttached returns whether the instance has been attached to the control plane endpoint
+func (m *MachineScope) IsControlPlaneEndpointAttached() bool {
+	return m.NifcloudMachine.Status.ControlPlaneEndpointAttached
+}
+
+// SetControlPlaneEndpointAttached records whether the instance is attached to the control plane endpoint
+func (m *MachineScope) SetControlPlaneEndpointAttached(attached bool) {
+	m.NifcloudMachine.Status.ControlPlaneEndpointAttached = attached
 }
 
 func (m *MachineScope) SetReady() {
@@ -182,21 +211,95 @@ func (m *MachineScope) SetNotReady() {
 	m.NifcloudMachine.Status.Ready = false
 }
 
+// LoadBootstrapData loads bootstrap data of the machine
+// machines refer to the secret by spec.bootstrap.dataSecretName,
+// otherwise base64 encoded spec.bootstrap.data, which is deprecated in v1alpha3, is used.
+// it returns false when bootstrap data is not yet available
+func (m *MachineScope) LoadBootstrapData(ctx context.Context) (bool, error) {
+	if m.Machine.Spec.Bootstrap.DataSecretName != nil {
+		secret := &corev1.Secret{}
+		key := client.ObjectKey{Namespace: m.Machine.Namespace, Name: *m.Machine.Spec.Bootstrap.DataSecretName}
+		if err := m.client.Get(ctx, key, secret); err != nil {
+			return false, errors.Wrapf(err, "failed to retrieve bootstrap data secret %s", key)
+		}
+		value, ok := secret.Data[bootstrapDataSecretKey]
+		if !ok {
+			return false, errors.Errorf("bootstrap data secret %s is missing %q key", key, bootstrapDataSecretKey)
+		}
+		m.bootstrapData = value
+		return true, nil
+	}
+
+	if m.Machine.Spec.Bootstrap.Data == nil {
+		return false, nil
+	}
+	d, err := base64.StdEncoding.DecodeString(*m.Machine.Spec.Bootstrap.Data)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to decode bootstrap data")
+	}
+	m.bootstrapData = d
+	return true, nil
+}
+
+// GetRawBootstrapData returns decoded bootstrap data
 func (m *MachineScope) GetRawBootstrapData() []byte {
-	return []byte(*m.Machine.Spec.Bootstrap.Data)
+	return m.bootstrapData
 }
 
-// GetBootstrapData returns bootstrap data from machines
+// GetBootstrapData returns base64 encoded bootstrap data
 func (m *MachineScope) GetBootstrapData() (string, error) {
-	if m.Machine.Spec.Bootstrap.Data == nil {
-		return "", fmt.Errorf("error retrieving bootstrap data: machine's bootstrap.dta is nil")
+	if m.bootstrapData == nil {
+		return "", fmt.Errorf("error retrieving bootstrap data: bootstrap data is not loaded")
 	}
 
 	return base64.StdEncoding.EncodeToString(m.GetRawBootstrapData()), nil
 }
 
-// GetRawUserData returns userdata of each instance from script template
+// GetBootstrapCloudConfig returns decoded bootstrap data whose hostname is replaced to instance-id
+func (m *MachineScope) GetBootstrapCloudConfig() ([]byte, error) {
+	if m.bootstrapData == nil {
+		return nil, fmt.Errorf("error retrieving bootstrap data: bootstrap data is not loaded")
+	}
+	// be careful to set instance-id: same name at `service/computing`
+	return []byte(strings.ReplaceAll(string(m.bootstrapData), hostnamePlaceholder, m.GetInstanceIDConved())), nil
+}
+
+// BootstrapDelivery returns how bootstrap data is delivered to this machine
+func (m *MachineScope) BootstrapDelivery() infrav1alpha3.BootstrapDelivery {
+	if m.NifcloudMachine.Spec.BootstrapDelivery == "" {
+		return infrav1alpha3.BootstrapDeliveryUserData
+	}
+	return m.NifcloudMachine.Spec.BootstrapDelivery
+}
+
+// GetRawUserData returns userdata of each instance according to its bootstrap delivery
 func (m *MachineScope) GetRawUserData() ([]byte, error) {
+	if m.BootstrapDelivery() == infrav1alpha3.BootstrapDeliverySCP {
+		return m.getWatcherUserData()
+	}
+
+	cloudConfig, err := m.GetBootstrapCloudConfig()
+	if err != nil {
+		return nil, err
+	}
+	var parts []userdata.Part
+	if mounts := m.VolumeMounts(); len(mounts) > 0 {
+		script, err := userdata.VolumeScript(mounts)
+		if err != nil {
+			return nil, err
+		}
+		// scripts run in the order of the parts, volumes are mounted before docker starts
+		parts = append(parts, userdata.ShellScriptPart("volumes.sh", script))
+	}
+	parts = append(parts,
+		userdata.ShellScriptPart("setup.sh", []byte(userdata.SetupScriptTemplate)),
+		userdata.CloudConfigPart("bootstrap.cfg", cloudConfig),
+	)
+	return userdata.NewMultipart(parts...)
+}
+
+// getWatcherUserData returns the script waiting for bootstrap data sent over SSH
+func (m *MachineScope) getWatcherUserData() ([]byte, error) {
 	tpl, err := template.New("userdata").Parse(userdata.ScriptTemplate)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create template")
@@ -204,6 +307,13 @@ func (m *MachineScope) GetRawUserData() ([]byte, error) {
 	// be careful to set instance-id: same name at `service/computing`
 	instanceID := m.GetInstanceIDConved()
 	var out bytes.Buffer
+	if mounts := m.VolumeMounts(); len(mounts) > 0 {
+		script, err := userdata.VolumeScript(mounts)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(script)
+	}
 	if err := tpl.Execute(&out, map[string]string{
 		"default_hostname": "{{ ds.meta_data.hostname }}",
 		"instance_id":      instanceID,
@@ -213,28 +323,86 @@ func (m *MachineScope) GetRawUserData() ([]byte, error) {
 	return out.Bytes(), nil
 }
 
+// GetUserData returns base64 encoded userdata
+// userdata is compressed by gzip when it exceeds nifcloud limit
 func (m *MachineScope) GetUserData() (string, error) {
 	d, err := m.GetRawUserData()
 	if err != nil {
 		return "", err
 	}
+	if len(d) > maxUserDataSize {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(d); err != nil {
+			return "", errors.Wrap(err, "failed to compress userdata")
+		}
+		if err := gz.Close(); err != nil {
+			return "", errors.Wrap(err, "failed to compress userdata")
+		}
+		d = buf.Bytes()
+	}
+	if len(d) > maxUserDataSize {
+		return "", errors.Errorf("userdata is %d bytes, exceeding the limit of %d bytes even after compression: set bootstrapDelivery to %q",
+			len(d), maxUserDataSize, infrav1alpha3.BootstrapDeliverySCP)
+	}
 	return base64.StdEncoding.EncodeToString(d), nil
 }
 
-func (m *MachineScope) SetErrorReason(v capierrors.MachineStatusError) {
-	m.NifcloudMachine.Status.ErrorReason = &v
+// VolumeMounts returns where the volumes of the machine are mounted,
+// the devices are not known when the userdata is rendered, so the volumes are identified by their labels and sizes
+func (m *MachineScope) VolumeMounts() []userdata.VolumeMount {
+	mounts := make([]userdata.VolumeMount, 0, len(m.NifcloudMachine.Spec.Volumes))
+	for _, v := range m.NifcloudMachine.Spec.Volumes {
+		mounts = append(mounts, userdata.VolumeMount{
+			Label:     volumeLabel(v.Name),
+			Size:      v.Size * volumeSizeUnit,
+			MountPath: v.MountPoint(),
+		})
+	}
+	return mounts
+}
+
+// volumeLabel returns the filesystem label of the volume, which fits the limit of ext4
+func volumeLabel(name string) string {
+	hashed := md5.Sum([]byte(name))
+	return "capi" + hex.EncodeToString(hashed[:])[:12]
+}
+
+// KubernetesVersion returns the kubernetes version of the machine without the leading "v"
+func (m *MachineScope) KubernetesVersion() string {
+	if m.Machine.Spec.Version == nil {
+		return ""
+	}
+	return strings.TrimPrefix(*m.Machine.Spec.Version, "v")
+}
+
+// SetImageID records the image which the instance is created from
+func (m *MachineScope) SetImageID(id string) {
+	m.NifcloudMachine.Status.ImageID = id
+}
+
+// SetVolumes records the observed volumes of the machine
+func (m *MachineScope) SetVolumes(v []infrav1alpha3.VolumeStatus) {
+	m.NifcloudMachine.Status.Volumes = v
+}
+
+func (m *MachineScope) SetFailureReason(v capierrors.MachineStatusError) {
+	m.NifcloudMachine.Status.FailureReason = &v
 }
 
-func (m *MachineScope) SetErrorMessage(v error) {
-	m.NifcloudMachine.Status.ErrorMessage = pointer.StringPtr(v.Error())
+func (m *MachineScope) SetFailureMessage(v error) {
+	m.NifcloudMachine.Status.FailureMessage = pointer.StringPtr(v.Error())
 }
 
-func (m *MachineScope) SetSendBootstrap() {
+// SetSendBootstrap marks bootstrap data as delivered through the given path
+func (m *MachineScope) SetSendBootstrap(d infrav1alpha3.BootstrapDelivery) {
 	m.NifcloudMachine.Status.SendBootstrap = true
+	m.NifcloudMachine.Status.BootstrapDelivery = d
 }
 
 func (m *MachineScope) UnsetSendBootstrap() {
 	m.NifcloudMachine.Status.SendBootstrap = false
+	m.NifcloudMachine.Status.BootstrapDelivery = ""
 }
 
 func (m *MachineScope) IsSendBootstrap() bool {
@@ -17,24 +17,28 @@ limitations under the License.
 package scope
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/base64"
 	"fmt"
+	"io/ioutil"
 	"strings"
 	"testing"
 
 	"github.com/aokumasan/nifcloud-sdk-go-v2/nifcloud"
-	infrav1alpha2 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha2"
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/utils/pointer"
-	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 func setupScheme() (*runtime.Scheme, error) {
 	scheme := runtime.NewScheme()
-	if err := infrav1alpha2.AddToScheme(scheme); err != nil {
+	if err := infrav1alpha3.AddToScheme(scheme); err != nil {
 		return nil, err
 	}
 	if err := clusterv1.AddToScheme(scheme); err != nil {
@@ -58,7 +62,9 @@ func newMachine(clusterName, machineName string) *clusterv1.Machine {
 		},
 		Spec: clusterv1.MachineSpec{
 			Bootstrap: clusterv1.Bootstrap{
-				Data: pointer.StringPtr(machineName),
+				Data: pointer.StringPtr(base64.StdEncoding.EncodeToString([]byte(
+					fmt.Sprintf("#cloud-config\n# %s\nnodeRegistration:\n  name: '{{ ds.meta_data.hostname }}'\n", machineName),
+				))),
 			},
 		},
 	}
@@ -73,8 +79,8 @@ func newCluster(clusterName string) *clusterv1.Cluster {
 	}
 }
 
-func newNifcloudCluster(clusterName string) *infrav1alpha2.NifcloudCluster {
-	return &infrav1alpha2.NifcloudCluster{
+func newNifcloudCluster(clusterName string) *infrav1alpha3.NifcloudCluster {
+	return &infrav1alpha3.NifcloudCluster{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      clusterName,
 			Namespace: "default",
@@ -82,8 +88,8 @@ func newNifcloudCluster(clusterName string) *infrav1alpha2.NifcloudCluster {
 	}
 }
 
-func newNifcloudMachine(clusterName, machineName string) *infrav1alpha2.NifcloudMachine {
-	return &infrav1alpha2.NifcloudMachine{
+func newNifcloudMachine(clusterName, machineName string) *infrav1alpha3.NifcloudMachine {
+	return &infrav1alpha3.NifcloudMachine{
 		ObjectMeta: metav1.ObjectMeta{
 			Labels: map[string]string{
 				"cluster.x-k8s.io/cluster-name": clusterName,
@@ -91,7 +97,7 @@ func newNifcloudMachine(clusterName, machineName string) *infrav1alpha2.Nifcloud
 			Name:      clusterName,
 			Namespace: "default",
 		},
-		Spec: infrav1alpha2.NifcloudMachineSpec{
+		Spec: infrav1alpha3.NifcloudMachineSpec{
 			ProviderID: nifcloud.String("nifcloud:///test-instance-0"),
 		},
 	}
@@ -113,7 +119,7 @@ func setupMachineScope() (*MachineScope, error) {
 	}
 
 	client := fake.NewFakeClientWithScheme(scheme, initObjects...)
-	return NewMachineScope(
+	scope, err := NewMachineScope(
 		MachineScopeParams{
 			Client:          client,
 			Machine:         machine,
@@ -122,6 +128,13 @@ func setupMachineScope() (*MachineScope, error) {
 			NifcloudMachine: nifcloudMachine,
 		},
 	)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := scope.LoadBootstrapData(context.TODO()); err != nil {
+		return nil, err
+	}
+	return scope, nil
 }
 
 func TestGetUserDataIsBase64Encoded(t *testing.T) {
@@ -163,3 +176,169 @@ func TestGetUserDataIsTemplateFilled(t *testing.T) {
 	}
 	fmt.Println(string(d))
 }
+
+func TestGetUserDataDelivery(t *testing.T) {
+	cases := []struct {
+		name     string
+		delivery infrav1alpha3.BootstrapDelivery
+		volumes  []infrav1alpha3.Volume
+		contains []string
+		excludes []string
+	}{
+		{
+			name:     "userdata delivery embeds bootstrap data",
+			delivery: "",
+			contains: []string{"multipart/mixed", "text/x-shellscript", "text/cloud-config", "nodeRegistration:"},
+			excludes: []string{"inotifywait", "{{ ds.meta_data.hostname }}", "mount_volume"},
+		},
+		{
+			name:     "scp delivery waits for bootstrap data",
+			delivery: infrav1alpha3.BootstrapDeliverySCP,
+			contains: []string{"inotifywait", "bootstrap.cfg"},
+			excludes: []string{"multipart/mixed", "nodeRegistration:"},
+		},
+		{
+			name:     "userdata delivery mounts volumes",
+			delivery: infrav1alpha3.BootstrapDeliveryUserData,
+			volumes: []infrav1alpha3.Volume{
+				{Name: "etcd", Size: 100, Purpose: infrav1alpha3.VolumePurposeEtcd},
+				{Name: "data", Size: 100, Purpose: infrav1alpha3.VolumePurposeData, MountPath: "/mnt/data"},
+			},
+			contains: []string{"volumes.sh", "mount_volume " + volumeLabel("etcd") + " 107374182400 /var/lib/etcd", "mount_volume " + volumeLabel("data") + " 107374182400 /mnt/data", "by-label", "nodeRegistration:"},
+		},
+		{
+			name:     "scp delivery mounts volumes",
+			delivery: infrav1alpha3.BootstrapDeliverySCP,
+			volumes:  []infrav1alpha3.Volume{{Name: "docker", Size: 200, Purpose: infrav1alpha3.VolumePurposeContainerRuntime}},
+			contains: []string{"mount_volume " + volumeLabel("docker") + " 214748364800 /var/lib/docker", "inotifywait"},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			scope, err := setupMachineScope()
+			if err != nil {
+				t.Fatal(err)
+			}
+			scope.NifcloudMachine.Spec.BootstrapDelivery = tt.delivery
+			scope.NifcloudMachine.Spec.Volumes = tt.volumes
+
+			d, err := scope.GetRawUserData()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, c := range tt.contains {
+				if !strings.Contains(string(d), c) {
+					t.Errorf("userdata does not contain %q", c)
+				}
+			}
+			for _, e := range tt.excludes {
+				if strings.Contains(string(d), e) {
+					t.Errorf("userdata unexpectedly contains %q", e)
+				}
+			}
+		})
+	}
+}
+
+func TestGetUserDataIsCompressed(t *testing.T) {
+	scope, err := setupMachineScope()
+	if err != nil {
+		t.Fatal(err)
+	}
+	large := "#cloud-config\n# " + strings.Repeat("a", 2*maxUserDataSize) + "\n"
+	scope.Machine.Spec.Bootstrap.Data = pointer.StringPtr(base64.StdEncoding.EncodeToString([]byte(large)))
+	if _, err := scope.LoadBootstrapData(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	userData, err := scope.GetUserData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := base64.StdEncoding.DecodeString(userData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(d))
+	if err != nil {
+		t.Fatalf("userdata is not compressed: %v", err)
+	}
+	raw, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(raw), large) {
+		t.Fatal("compressed userdata does not contain bootstrap data")
+	}
+}
+
+func TestLoadBootstrapData(t *testing.T) {
+	scheme, err := setupScheme()
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-machine-0-bootstrap", Namespace: "default"},
+		Data:       map[string][]byte{"value": []byte("#cloud-config\n# from secret\n")},
+	}
+
+	cases := []struct {
+		name       string
+		objects    []runtime.Object
+		secretName *string
+		data       *string
+		want       string
+		ok         bool
+		wantErr    bool
+	}{
+		{
+			name:       "read data from the secret",
+			objects:    []runtime.Object{secret},
+			secretName: pointer.StringPtr("test-machine-0-bootstrap"),
+			want:       "#cloud-config\n# from secret\n",
+			ok:         true,
+		},
+		{
+			name:       "secret does not exist yet",
+			secretName: pointer.StringPtr("test-machine-0-bootstrap"),
+			wantErr:    true,
+		},
+		{
+			name: "fall back to inline data",
+			data: pointer.StringPtr(base64.StdEncoding.EncodeToString([]byte("#cloud-config\n# inline\n"))),
+			want: "#cloud-config\n# inline\n",
+			ok:   true,
+		},
+		{
+			name: "data is not yet available",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			machine := newMachine("test-cluster", "test-machine-0")
+			machine.Spec.Bootstrap.DataSecretName = tt.secretName
+			machine.Spec.Bootstrap.Data = tt.data
+			scope, err := NewMachineScope(MachineScopeParams{
+				Client:          fake.NewFakeClientWithScheme(scheme, tt.objects...),
+				Machine:         machine,
+				Cluster:         newCluster("test-cluster"),
+				NifcloudCluster: newNifcloudCluster("test-cluster"),
+				NifcloudMachine: newNifcloudMachine("test-cluster", "test-machine-0"),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ok, err := scope.LoadBootstrapData(context.TODO())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error[%v], wantErr[%v]", err, tt.wantErr)
+			}
+			if ok != tt.ok {
+				t.Errorf("got ok[%v], want[%v]", ok, tt.ok)
+			}
+			if got := string(scope.GetRawBootstrapData()); got != tt.want {
+				t.Errorf("got data[%q], want[%q]", got, tt.want)
+			}
+		})
+	}
+}
@@ -18,6 +18,7 @@ package nifcloud
 
 import (
 	"context"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/pkg/errors"
@@ -25,40 +26,63 @@ import (
 	nc "github.com/aokumasan/nifcloud-sdk-go-v2/nifcloud"
 	"github.com/aokumasan/nifcloud-sdk-go-v2/service/computing"
 	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/metrics"
 )
 
 type nifcloudClientFactory struct {
+	options ClientOptions
 }
 
 func (nf *nifcloudClientFactory) CreateClient(accessKey, secretKey, region string) (cloud.Client, error) {
-	client, err := New(accessKey, secretKey, region)
+	client, err := New(accessKey, secretKey, region, nf.options)
 	if err != nil {
 		return nil, err
 	}
 	return client, err
 }
 
-func NewNifcloudClientFactory() cloud.ClientFactory {
-	return &nifcloudClientFactory{}
+// NewNifcloudClientFactory returns a factory which creates clients with the options
+func NewNifcloudClientFactory(options ClientOptions) cloud.ClientFactory {
+	return &nifcloudClientFactory{options: options}
 }
 
 type nifcloud struct {
-	client *computing.Client
+	client        *computing.Client
+	waiterOptions []aws.WaiterOption
 }
 
-func New(accessKey, secretKey, region string) (cloud.Client, error) {
-	return &nifcloud{
-		client: getNifcloudComputingClient(accessKey, secretKey, region),
-	}, nil
+func New(accessKey, secretKey, region string, options ClientOptions) (cloud.Client, error) {
+	nc := &nifcloud{
+		client: getNifcloudComputingClient(accessKey, secretKey, region, options),
+	}
+	if options.WaiterDelay > 0 {
+		nc.waiterOptions = append(nc.waiterOptions, aws.WithWaiterDelay(aws.ConstantWaiterDelay(options.WaiterDelay)))
+	}
+	return nc, nil
 }
 
-func getNifcloudComputingClient(accessKey, secretKey, region string) *computing.Client {
+func getNifcloudComputingClient(accessKey, secretKey, region string, options ClientOptions) *computing.Client {
 	cfg := nc.NewConfig(
 		accessKey,
 		secretKey,
 		region,
 	)
-	return computing.New(cfg)
+	if options.Endpoint != "" {
+		cfg.EndpointResolver = aws.ResolveWithEndpointURL(options.Endpoint)
+	}
+	cfg.Retryer = newRetryer(options.MaxRetries)
+	client := computing.New(cfg)
+	if limiter := newLimiter(options); limiter != nil {
+		client.Handlers.Sign.PushFrontNamed(rateLimitHandler(limiter))
+	}
+	// every request made by the client is observed when it completes
+	client.Handlers.Complete.PushBackNamed(aws.NamedHandler{
+		Name: "nifcloud.metrics",
+		Fn: func(r *aws.Request) {
+			metrics.ObserveRequest(r.Operation.Name, time.Since(r.Time), r.Error)
+		},
+	})
+	return client
 }
 
 func (nc *nifcloud) AllocateAddress(ctx context.Context, input *computing.AllocateAddressInput) (*computing.AllocateAddressOutput, error) {
@@ -106,6 +130,15 @@ func (nc *nifcloud) DisassociateAddress(ctx context.Context, input *computing.Di
 	return res.DisassociateAddressOutput, nil
 }
 
+func (nc *nifcloud) NiftyModifyAddressAttribute(ctx context.Context, input *computing.NiftyModifyAddressAttributeInput) (*computing.NiftyModifyAddressAttributeOutput, error) {
+	request := nc.client.NiftyModifyAddressAttributeRequest(input)
+	res, err := request.Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return res.NiftyModifyAddressAttributeOutput, nil
+}
+
 func (nc *nifcloud) DescribeInstances(ctx context.Context, input *computing.DescribeInstancesInput) (*computing.DescribeInstancesOutput, error) {
 	request := nc.client.DescribeInstancesRequest(input)
 	res, err := request.Send(ctx)
@@ -223,14 +256,230 @@ func (nc *nifcloud) AssociateAddress(ctx context.Context, input *computing.Assoc
 	return res.AssociateAddressOutput, nil
 }
 
+func (nc *nifcloud) CreateLoadBalancer(ctx context.Context, input *computing.CreateLoadBalancerInput) (*computing.CreateLoadBalancerOutput, error) {
+	request := nc.client.CreateLoadBalancerRequest(input)
+	res, err := request.Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return res.CreateLoadBalancerOutput, nil
+}
+
+func (nc *nifcloud) DeleteLoadBalancer(ctx context.Context, input *computing.DeleteLoadBalancerInput) (*computing.DeleteLoadBalancerOutput, error) {
+	request := nc.client.DeleteLoadBalancerRequest(input)
+	res, err := request.Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return res.DeleteLoadBalancerOutput, nil
+}
+
+func (nc *nifcloud) DescribeLoadBalancers(ctx context.Context, input *computing.DescribeLoadBalancersInput) (*computing.DescribeLoadBalancersOutput, error) {
+	request := nc.client.DescribeLoadBalancersRequest(input)
+	res, err := request.Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return res.DescribeLoadBalancersOutput, nil
+}
+
+func (nc *nifcloud) ConfigureHealthCheck(ctx context.Context, input *computing.ConfigureHealthCheckInput) (*computing.ConfigureHealthCheckOutput, error) {
+	request := nc.client.ConfigureHealthCheckRequest(input)
+	res, err := request.Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return res.ConfigureHealthCheckOutput, nil
+}
+
+func (nc *nifcloud) RegisterInstancesWithLoadBalancer(ctx context.Context, input *computing.RegisterInstancesWithLoadBalancerInput) (*computing.RegisterInstancesWithLoadBalancerOutput, error) {
+	request := nc.client.RegisterInstancesWithLoadBalancerRequest(input)
+	res, err := request.Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return res.RegisterInstancesWithLoadBalancerOutput, nil
+}
+
+func (nc *nifcloud) DeregisterInstancesFromLoadBalancer(ctx context.Context, input *computing.DeregisterInstancesFromLoadBalancerInput) (*computing.DeregisterInstancesFromLoadBalancerOutput, error) {
+	request := nc.client.DeregisterInstancesFromLoadBalancerRequest(input)
+	res, err := request.Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return res.DeregisterInstancesFromLoadBalancerOutput, nil
+}
+
+func (nc *nifcloud) NiftyCreatePrivateLan(ctx context.Context, input *computing.NiftyCreatePrivateLanInput) (*computing.NiftyCreatePrivateLanOutput, error) {
+	request := nc.client.NiftyCreatePrivateLanRequest(input)
+	res, err := request.Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return res.NiftyCreatePrivateLanOutput, nil
+}
+
+func (nc *nifcloud) NiftyDeletePrivateLan(ctx context.Context, input *computing.NiftyDeletePrivateLanInput) (*computing.NiftyDeletePrivateLanOutput, error) {
+	request := nc.client.NiftyDeletePrivateLanRequest(input)
+	res, err := request.Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return res.NiftyDeletePrivateLanOutput, nil
+}
+
+func (nc *nifcloud) NiftyDescribePrivateLans(ctx context.Context, input *computing.NiftyDescribePrivateLansInput) (*computing.NiftyDescribePrivateLansOutput, error) {
+	request := nc.client.NiftyDescribePrivateLansRequest(input)
+	res, err := request.Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return res.NiftyDescribePrivateLansOutput, nil
+}
+
+func (nc *nifcloud) NiftyCreateRouter(ctx context.Context, input *computing.NiftyCreateRouterInput) (*computing.NiftyCreateRouterOutput, error) {
+	request := nc.client.NiftyCreateRouterRequest(input)
+	res, err := request.Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return res.NiftyCreateRouterOutput, nil
+}
+
+func (nc *nifcloud) NiftyDeleteRouter(ctx context.Context, input *computing.NiftyDeleteRouterInput) (*computing.NiftyDeleteRouterOutput, error) {
+	request := nc.client.NiftyDeleteRouterRequest(input)
+	res, err := request.Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return res.NiftyDeleteRouterOutput, nil
+}
+
+func (nc *nifcloud) NiftyDescribeRouters(ctx context.Context, input *computing.NiftyDescribeRoutersInput) (*computing.NiftyDescribeRoutersOutput, error) {
+	request := nc.client.NiftyDescribeRoutersRequest(input)
+	res, err := request.Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return res.NiftyDescribeRoutersOutput, nil
+}
+
+func (nc *nifcloud) NiftyCreateDhcpConfig(ctx context.Context, input *computing.NiftyCreateDhcpConfigInput) (*computing.NiftyCreateDhcpConfigOutput, error) {
+	request := nc.client.NiftyCreateDhcpConfigRequest(input)
+	res, err := request.Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return res.NiftyCreateDhcpConfigOutput, nil
+}
+
+func (nc *nifcloud) NiftyCreateDhcpIpAddressPool(ctx context.Context, input *computing.NiftyCreateDhcpIpAddressPoolInput) (*computing.NiftyCreateDhcpIpAddressPoolOutput, error) {
+	request := nc.client.NiftyCreateDhcpIpAddressPoolRequest(input)
+	res, err := request.Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return res.NiftyCreateDhcpIpAddressPoolOutput, nil
+}
+
+func (nc *nifcloud) NiftyDeleteDhcpConfig(ctx context.Context, input *computing.NiftyDeleteDhcpConfigInput) (*computing.NiftyDeleteDhcpConfigOutput, error) {
+	request := nc.client.NiftyDeleteDhcpConfigRequest(input)
+	res, err := request.Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return res.NiftyDeleteDhcpConfigOutput, nil
+}
+
+func (nc *nifcloud) NiftyDescribeDhcpConfigs(ctx context.Context, input *computing.NiftyDescribeDhcpConfigsInput) (*computing.NiftyDescribeDhcpConfigsOutput, error) {
+	request := nc.client.NiftyDescribeDhcpConfigsRequest(input)
+	res, err := request.Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return res.NiftyDescribeDhcpConfigsOutput, nil
+}
+
+func (nc *nifcloud) CreateVolume(ctx context.Context, input *computing.CreateVolumeInput) (*computing.CreateVolumeOutput, error) {
+	request := nc.client.CreateVolumeRequest(input)
+	res, err := request.Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return res.CreateVolumeOutput, nil
+}
+
+func (nc *nifcloud) AttachVolume(ctx context.Context, input *computing.AttachVolumeInput) (*computing.AttachVolumeOutput, error) {
+	request := nc.client.AttachVolumeRequest(input)
+	res, err := request.Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return res.AttachVolumeOutput, nil
+}
+
+func (nc *nifcloud) DetachVolume(ctx context.Context, input *computing.DetachVolumeInput) (*computing.DetachVolumeOutput, error) {
+	request := nc.client.DetachVolumeRequest(input)
+	res, err := request.Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return res.DetachVolumeOutput, nil
+}
+
+func (nc *nifcloud) DeleteVolume(ctx context.Context, input *computing.DeleteVolumeInput) (*computing.DeleteVolumeOutput, error) {
+	request := nc.client.DeleteVolumeRequest(input)
+	res, err := request.Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return res.DeleteVolumeOutput, nil
+}
+
+func (nc *nifcloud) DescribeVolumes(ctx context.Context, input *computing.DescribeVolumesInput) (*computing.DescribeVolumesOutput, error) {
+	request := nc.client.DescribeVolumesRequest(input)
+	res, err := request.Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return res.DescribeVolumesOutput, nil
+}
+
+func (nc *nifcloud) ImportKeyPair(ctx context.Context, input *computing.ImportKeyPairInput) (*computing.ImportKeyPairOutput, error) {
+	request := nc.client.ImportKeyPairRequest(input)
+	res, err := request.Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return res.ImportKeyPairOutput, nil
+}
+
+func (nc *nifcloud) DeleteKeyPair(ctx context.Context, input *computing.DeleteKeyPairInput) (*computing.DeleteKeyPairOutput, error) {
+	request := nc.client.DeleteKeyPairRequest(input)
+	res, err := request.Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return res.DeleteKeyPairOutput, nil
+}
+
+func (nc *nifcloud) DescribeKeyPairs(ctx context.Context, input *computing.DescribeKeyPairsInput) (*computing.DescribeKeyPairsOutput, error) {
+	request := nc.client.DescribeKeyPairsRequest(input)
+	res, err := request.Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return res.DescribeKeyPairsOutput, nil
+}
+
 func (nc *nifcloud) WaitUntilInstanceStopped(ctx context.Context, input *computing.DescribeInstancesInput) error {
-	return nc.client.WaitUntilInstanceStopped(ctx, input, []aws.WaiterOption{}...)
+	return nc.client.WaitUntilInstanceStopped(ctx, input, nc.waiterOptions...)
 }
 
 func (nc *nifcloud) WaitUntilInstanceDeleted(ctx context.Context, input *computing.DescribeInstancesInput) error {
-	return nc.client.WaitUntilInstanceDeleted(ctx, input, []aws.WaiterOption{}...)
+	return nc.client.WaitUntilInstanceDeleted(ctx, input, nc.waiterOptions...)
 }
 
 func (nc *nifcloud) WaitUntilInstanceRunning(ctx context.Context, input *computing.DescribeInstancesInput) error {
-	return nc.client.WaitUntilInstanceRunning(ctx, input, []aws.WaiterOption{}...)
+	return nc.client.WaitUntilInstanceRunning(ctx, input, nc.waiterOptions...)
 }
@@ -0,0 +1,356 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nifcloud
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	nc "github.com/aokumasan/nifcloud-sdk-go-v2/nifcloud"
+	"github.com/aokumasan/nifcloud-sdk-go-v2/service/computing"
+
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud"
+	nferrors "github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/errors"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/fake"
+)
+
+// newTestClient returns the client which sends requests to the local server of the backend,
+// callers close the server
+func newTestClient(t *testing.T, backend *fake.Client, secretKey string, options ClientOptions) (cloud.Client, *httptest.Server) {
+	t.Helper()
+	server := httptest.NewServer(&fake.Server{
+		Backend:     backend,
+		Credentials: map[string]string{"access": "secret"},
+	})
+
+	options.Endpoint = server.URL
+	client, err := New("access", secretKey, "jp-east-1", options)
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	return client, server
+}
+
+func TestNifcloud_requests(t *testing.T) {
+	ctx := context.TODO()
+	backend := fake.NewClient()
+	backend.TransitionSteps = 2
+	client, server := newTestClient(t, backend, "secret", ClientOptions{WaiterDelay: time.Millisecond})
+	defer server.Close()
+
+	var publicIP string
+	steps := []struct {
+		name string
+		do   func(t *testing.T)
+	}{
+		{
+			name: "create security group with rules",
+			do: func(t *testing.T) {
+				if _, err := client.CreateSecurityGroup(ctx, &computing.CreateSecurityGroupInput{
+					GroupName:        nc.String("testcp"),
+					GroupDescription: nc.String(`{"cluster":"test","role":"controlplane"}`),
+				}); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := client.CreateSecurityGroup(ctx, &computing.CreateSecurityGroupInput{GroupName: nc.String("testnode")}); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := client.AuthorizeSecurityGroupIngress(ctx, &computing.AuthorizeSecurityGroupIngressInput{
+					GroupName: nc.String("testcp"),
+					IpPermissions: []computing.RequestIpPermissionsStruct{
+						{
+							IpProtocol:      nc.String("TCP"),
+							FromPort:        nc.Int64(6443),
+							ToPort:          nc.Int64(6443),
+							RequestIpRanges: []computing.RequestIpRangesStruct{{CidrIp: nc.String("192.0.2.0/24")}},
+						},
+						{
+							IpProtocol:    nc.String("ANY"),
+							RequestGroups: []computing.RequestGroupsStruct{{GroupName: nc.String("testnode")}},
+						},
+					},
+				}); err != nil {
+					t.Fatal(err)
+				}
+
+				out, err := client.DescribeSecurityGroups(ctx, &computing.DescribeSecurityGroupsInput{
+					Filter: []computing.RequestFilterStruct{{Name: nc.String("group-name"), RequestValue: []string{"testcp"}}},
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(out.SecurityGroupInfo) != 1 {
+					t.Fatalf("expected a security group, got %v", out.SecurityGroupInfo)
+				}
+				sg := out.SecurityGroupInfo[0]
+				if got := nc.StringValue(sg.GroupDescription); got != `{"cluster":"test","role":"controlplane"}` {
+					t.Errorf("unexpected description %q", got)
+				}
+				if len(sg.IpPermissions) != 2 {
+					t.Fatalf("expected 2 rules, got %v", sg.IpPermissions)
+				}
+				if rule := sg.IpPermissions[0]; nc.Int64Value(rule.FromPort) != 6443 || nc.StringValue(rule.IpRanges[0].CidrIp) != "192.0.2.0/24" {
+					t.Errorf("unexpected rule %v", rule)
+				}
+				if rule := sg.IpPermissions[1]; nc.StringValue(rule.Groups[0].GroupName) != "testnode" {
+					t.Errorf("unexpected rule %v", rule)
+				}
+			},
+		},
+		{
+			name: "run instance and wait for it to be running",
+			do: func(t *testing.T) {
+				out, err := client.RunInstances(ctx, &computing.RunInstancesInput{
+					InstanceId:    nc.String("test"),
+					Description:   nc.String("cluster:test,role:control-plane"),
+					SecurityGroup: []string{"testcp"},
+					NetworkInterface: []computing.RequestNetworkInterfaceStruct{
+						{DeviceIndex: nc.Int64(0), NetworkId: nc.String("net-COMMON_GLOBAL")},
+						{DeviceIndex: nc.Int64(1), NetworkId: nc.String("net-COMMON_PRIVATE")},
+					},
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if state := nc.StringValue(out.InstancesSet[0].InstanceState.Name); state != "pending" {
+					t.Errorf("expected pending instance, got %q", state)
+				}
+
+				calls := backend.Calls("DescribeInstances")
+				if err := client.WaitUntilInstanceRunning(ctx, &computing.DescribeInstancesInput{InstanceId: []string{"test"}}); err != nil {
+					t.Fatal(err)
+				}
+				if n := backend.Calls("DescribeInstances") - calls; n < 2 {
+					t.Errorf("expected the waiter to poll the instance, got %d requests", n)
+				}
+
+				described, err := client.DescribeInstances(ctx, &computing.DescribeInstancesInput{InstanceId: []string{"test"}})
+				if err != nil {
+					t.Fatal(err)
+				}
+				instance := described.ReservationSet[0].InstancesSet[0]
+				if got := nc.StringValue(described.ReservationSet[0].Description); got != "cluster:test,role:control-plane" {
+					t.Errorf("unexpected description %q", got)
+				}
+				if len(instance.NetworkInterfaceSet) != 2 || instance.NetworkInterfaceSet[0].Association == nil {
+					t.Errorf("unexpected network interfaces %v", instance.NetworkInterfaceSet)
+				}
+				if instance.LaunchTime == nil || instance.LaunchTime.IsZero() {
+					t.Errorf("expected launch time, got %v", instance.LaunchTime)
+				}
+			},
+		},
+		{
+			name: "associate address",
+			do: func(t *testing.T) {
+				allocated, err := client.AllocateAddress(ctx, &computing.AllocateAddressInput{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				publicIP = nc.StringValue(allocated.PublicIp)
+				if _, err := client.AssociateAddress(ctx, &computing.AssociateAddressInput{
+					PublicIp:   allocated.PublicIp,
+					InstanceId: nc.String("test"),
+				}); err != nil {
+					t.Fatal(err)
+				}
+
+				out, err := client.DescribeAddresses(ctx, &computing.DescribeAddressesInput{PublicIp: []string{publicIP}})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if id := nc.StringValue(out.AddressesSet[0].InstanceId); id != "test" {
+					t.Errorf("expected the address to be associated with the instance, got %q", id)
+				}
+			},
+		},
+		{
+			name: "describe unknown address",
+			do: func(t *testing.T) {
+				_, err := client.DescribeAddresses(ctx, &computing.DescribeAddressesInput{PublicIp: []string{"192.0.2.1"}})
+				if !nferrors.IsNotFound(err) {
+					t.Errorf("expected not found error, got %v", err)
+				}
+			},
+		},
+		{
+			name: "create and detach volume",
+			do: func(t *testing.T) {
+				created, err := client.CreateVolume(ctx, &computing.CreateVolumeInput{
+					InstanceId: nc.String("test"),
+					Size:       nc.Int64(100),
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				backend.Advance()
+
+				out, err := client.DescribeVolumes(ctx, &computing.DescribeVolumesInput{VolumeId: []string{nc.StringValue(created.VolumeId)}})
+				if err != nil {
+					t.Fatal(err)
+				}
+				v := out.VolumeSet[0]
+				if size := nc.StringValue(v.Size); size != "100" {
+					t.Errorf("expected size 100, got %q", size)
+				}
+				if len(v.AttachmentSet) != 1 || nc.StringValue(v.AttachmentSet[0].InstanceId) != "test" {
+					t.Fatalf("expected the volume to be attached to the instance, got %+v", v.AttachmentSet)
+				}
+				if _, err := client.DetachVolume(ctx, &computing.DetachVolumeInput{VolumeId: created.VolumeId, InstanceId: nc.String("test")}); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "import and delete key pair",
+			do: func(t *testing.T) {
+				material := base64.StdEncoding.EncodeToString([]byte("ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAILNuZbHsU2Yywz610ov4KhgmVxcbjcRFbPvpn2nEpt7k capi@example.com"))
+				if _, err := client.ImportKeyPair(ctx, &computing.ImportKeyPairInput{
+					KeyName:           nc.String("testkey"),
+					PublicKeyMaterial: nc.String(material),
+					Description:       nc.String("cluster:test"),
+				}); err != nil {
+					t.Fatal(err)
+				}
+
+				out, err := client.DescribeKeyPairs(ctx, &computing.DescribeKeyPairsInput{KeyName: []string{"testkey"}})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(out.KeySet) != 1 || nc.StringValue(out.KeySet[0].Description) != "cluster:test" || nc.StringValue(out.KeySet[0].KeyFingerprint) == "" {
+					t.Fatalf("expected the imported key pair, got %+v", out.KeySet)
+				}
+				if _, err := client.DeleteKeyPair(ctx, &computing.DeleteKeyPairInput{KeyName: nc.String("testkey")}); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := client.DescribeKeyPairs(ctx, &computing.DescribeKeyPairsInput{KeyName: []string{"testkey"}}); !nferrors.IsNotFound(err) {
+					t.Errorf("expected not found error, got %v", err)
+				}
+			},
+		},
+		{
+			name: "terminate instance and wait for it to be deleted",
+			do: func(t *testing.T) {
+				if _, err := client.StopInstances(ctx, &computing.StopInstancesInput{InstanceId: []string{"test"}}); err != nil {
+					t.Fatal(err)
+				}
+				if err := client.WaitUntilInstanceStopped(ctx, &computing.DescribeInstancesInput{InstanceId: []string{"test"}}); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := client.TerminateInstances(ctx, &computing.TerminateInstancesInput{InstanceId: []string{"test"}}); err != nil {
+					t.Fatal(err)
+				}
+				if err := client.WaitUntilInstanceDeleted(ctx, &computing.DescribeInstancesInput{InstanceId: []string{"test"}}); err != nil {
+					t.Fatal(err)
+				}
+
+				out, err := client.DescribeAddresses(ctx, &computing.DescribeAddressesInput{PublicIp: []string{publicIP}})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if id := nc.StringValue(out.AddressesSet[0].InstanceId); id != "" {
+					t.Errorf("expected the address to be disassociated, got %q", id)
+				}
+			},
+		},
+	}
+	for _, step := range steps {
+		if !t.Run(step.name, step.do) {
+			break
+		}
+	}
+}
+
+func TestNifcloud_errors(t *testing.T) {
+	ctx := context.TODO()
+
+	tests := []struct {
+		name      string
+		secretKey string
+		setup     func(backend *fake.Client)
+		do        func(client cloud.Client) error
+		wantCode  string
+		wantCalls int
+	}{
+		{
+			name:      "wrong secret key",
+			secretKey: "wrong",
+			setup:     func(backend *fake.Client) {},
+			do: func(client cloud.Client) error {
+				_, err := client.DescribeInstances(ctx, &computing.DescribeInstancesInput{})
+				return err
+			},
+			wantCode: nferrors.AuthFailure,
+		},
+		{
+			name:      "retry throttled request",
+			secretKey: "secret",
+			setup: func(backend *fake.Client) {
+				backend.InjectError("DescribeInstances", fake.NewError(nferrors.Throttling))
+			},
+			do: func(client cloud.Client) error {
+				_, err := client.DescribeInstances(ctx, &computing.DescribeInstancesInput{})
+				return err
+			},
+			wantCalls: 2,
+		},
+		{
+			name:      "do not retry client error",
+			secretKey: "secret",
+			setup:     func(backend *fake.Client) {},
+			do: func(client cloud.Client) error {
+				_, err := client.DescribeInstances(ctx, &computing.DescribeInstancesInput{InstanceId: []string{"unknown"}})
+				return err
+			},
+			wantCode:  nferrors.InvalidParameter,
+			wantCalls: 1,
+		},
+		{
+			name:      "operation which the backend does not support",
+			secretKey: "secret",
+			setup:     func(backend *fake.Client) {},
+			do: func(client cloud.Client) error {
+				_, err := client.NiftyDescribePrivateLans(ctx, &computing.NiftyDescribePrivateLansInput{})
+				return err
+			},
+			wantCode: "NotImplemented",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := fake.NewClient()
+			tt.setup(backend)
+			client, server := newTestClient(t, backend, tt.secretKey, ClientOptions{MaxRetries: 1})
+			defer server.Close()
+
+			err := tt.do(client)
+			code, _ := nferrors.Code(err)
+			if code != tt.wantCode {
+				t.Errorf("expected error code %q, got %v", tt.wantCode, err)
+			}
+			if tt.wantCalls > 0 {
+				if n := backend.Calls("DescribeInstances"); n != tt.wantCalls {
+					t.Errorf("expected %d requests, got %d", tt.wantCalls, n)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nifcloud
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"golang.org/x/time/rate"
+
+	nferrors "github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/errors"
+)
+
+// ClientOptions tunes the endpoint, the rate limit and the retries of the requests made by a client,
+// the limit is applied to each client, that is each account used by the clusters
+type ClientOptions struct {
+	// Endpoint replaces the URL of the computing API resolved from the region, if not empty
+	Endpoint string
+	// WaiterDelay replaces the interval of the waiters of the SDK, if not zero
+	WaiterDelay time.Duration
+	// QPS is the number of requests per second, the limit is disabled with 0
+	QPS float64
+	// Burst is the number of requests allowed at once beyond QPS
+	Burst int
+	// MaxRetries is the number of retries of the requests which fail with retryable errors
+	MaxRetries int
+}
+
+// DefaultClientOptions returns the options used unless the manager is configured
+func DefaultClientOptions() ClientOptions {
+	return ClientOptions{
+		QPS:        10,
+		Burst:      20,
+		MaxRetries: aws.DefaultRetryerMaxNumRetries,
+	}
+}
+
+// retryer retries the requests which fail with the errors classified as retryable by nferrors.IsRetryable,
+// in addition to the errors retried by the SDK like connection errors
+type retryer struct {
+	aws.DefaultRetryer
+}
+
+func newRetryer(maxRetries int) retryer {
+	return retryer{
+		DefaultRetryer: aws.NewDefaultRetryer(func(d *aws.DefaultRetryer) {
+			d.NumMaxRetries = maxRetries
+		}),
+	}
+}
+
+// ShouldRetry implements aws.Retryer
+func (r retryer) ShouldRetry(req *aws.Request) bool {
+	if req.Retryable != nil {
+		return *req.Retryable
+	}
+	return nferrors.IsRetryable(req.Error) || r.DefaultRetryer.ShouldRetry(req)
+}
+
+// newLimiter returns the token bucket of the options, or nil if the limit is disabled
+func newLimiter(options ClientOptions) *rate.Limiter {
+	if options.QPS <= 0 {
+		return nil
+	}
+	// the bucket needs a token at least, or no request is allowed
+	burst := options.Burst
+	if burst < 1 {
+		burst = 1
+	}
+	return rate.NewLimiter(rate.Limit(options.QPS), burst)
+}
+
+// rateLimitHandler makes every attempt of the requests wait for the token bucket,
+// it goes before signing so that the signature is not expired while waiting
+func rateLimitHandler(limiter *rate.Limiter) aws.NamedHandler {
+	return aws.NamedHandler{
+		Name: "nifcloud.ratelimit",
+		Fn: func(r *aws.Request) {
+			if err := limiter.Wait(r.Context()); err != nil {
+				r.Error = err
+			}
+		},
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nifcloud
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/awserr"
+
+	nferrors "github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/errors"
+)
+
+func TestRetryer_ShouldRetry(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "throttling code",
+			err:  awserr.New(nferrors.Throttling, "rate exceeded", nil),
+			want: true,
+		},
+		{
+			name: "too many requests",
+			err:  awserr.NewRequestFailure(awserr.New("Unknown", "too many requests", nil), http.StatusTooManyRequests, ""),
+			want: true,
+		},
+		{
+			name: "server error",
+			err:  awserr.NewRequestFailure(awserr.New("Server.InternalError", "internal error", nil), http.StatusInternalServerError, ""),
+			want: true,
+		},
+		{
+			name: "resource in transition",
+			err:  awserr.New(nferrors.SecurityGroupProcessing, "processing", nil),
+			want: true,
+		},
+		{
+			name: "not found",
+			err:  awserr.NewRequestFailure(awserr.New(nferrors.InvalidInstanceID, "not found", nil), http.StatusBadRequest, ""),
+		},
+		{
+			name: "not implemented",
+			err:  awserr.NewRequestFailure(awserr.New("NotImplemented", "not implemented", nil), http.StatusNotImplemented, ""),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRetryer(3)
+			if got := r.ShouldRetry(&aws.Request{Error: tt.err}); got != tt.want {
+				t.Errorf("ShouldRetry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewLimiter(t *testing.T) {
+	if limiter := newLimiter(ClientOptions{}); limiter != nil {
+		t.Errorf("expected no limit with zero QPS")
+	}
+
+	limiter := newLimiter(ClientOptions{QPS: 1})
+	if limiter == nil {
+		t.Fatal("expected a limiter")
+	}
+	handler := rateLimitHandler(limiter)
+
+	// the first request takes the token, and the next one has to wait for a second
+	r := &aws.Request{HTTPRequest: &http.Request{}}
+	r.SetContext(context.Background())
+	handler.Fn(r)
+	if r.Error != nil {
+		t.Fatalf("did not expect error: %v", r.Error)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	r.SetContext(ctx)
+	handler.Fn(r)
+	if r.Error == nil {
+		t.Errorf("expected the request to be limited")
+	}
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package computing
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+
+	"github.com/aokumasan/nifcloud-sdk-go-v2/nifcloud"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/cluster-api/util/record"
+
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
+	nferrors "github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/errors"
+)
+
+const (
+	bastionRole = "bastion"
+	// nifcloud limits the length of instance id
+	maxBastionInstanceID = 15
+)
+
+// ReconcileBastion creates the bastion of the cluster when it is enabled, or deletes it otherwise
+func (s *Service) ReconcileBastion() error {
+	if !s.scope.NifcloudCluster.Spec.Bastion.Enabled {
+		if s.scope.NifcloudCluster.Status.Bastion == nil {
+			return nil
+		}
+		return s.DeleteBastion()
+	}
+
+	s.scope.V(2).Info("Reconciling bastion host")
+
+	id := s.getBastionInstanceID()
+	instance, err := s.InstanceIfExists(nifcloud.String(id))
+	if err != nil {
+		return err
+	}
+	if instance != nil && !instance.Tag.IsOwnedBy(s.scope.Name(), bastionRole) {
+		record.Warnf(s.scope.NifcloudCluster, "FailedCreateBastion", "Bastion %q exists but is not owned by the cluster", id)
+		return errors.Errorf("bastion %q exists but is not owned by the cluster", id)
+	}
+	if instance == nil {
+		instance, err = s.createBastion(id)
+		if err != nil {
+			record.Warnf(s.scope.NifcloudCluster, "FailedCreateBastion", "Failed to create bastion %q: %v", id, err)
+			return err
+		}
+		record.Eventf(s.scope.NifcloudCluster, "SuccessfulCreateBastion", "Created bastion %q", instance.ID)
+	}
+
+	s.scope.NifcloudCluster.Status.Bastion = instance
+	s.scope.V(2).Info("Reconcile bastion completed successfully", "instance-id", instance.ID, "public-ip", instance.PublicIP)
+	return nil
+}
+
+// DeleteBastion takes the next step to terminate the bastion of the cluster,
+// status of the bastion is cleared once the instance disappears
+func (s *Service) DeleteBastion() error {
+	id := s.getBastionInstanceID()
+	instance, err := s.InstanceIfExists(nifcloud.String(id))
+	if err != nil {
+		return err
+	}
+	if instance == nil {
+		if s.scope.NifcloudCluster.Status.Bastion != nil {
+			record.Eventf(s.scope.NifcloudCluster, "SuccessfulDeleteBastion", "Deleted bastion %q", id)
+		}
+		s.scope.NifcloudCluster.Status.Bastion = nil
+		return nil
+	}
+	if !instance.Tag.IsOwnedBy(s.scope.Name(), bastionRole) {
+		s.scope.Info("Skip deleting bastion which is not owned by the cluster", "instance-id", id)
+		s.scope.NifcloudCluster.Status.Bastion = nil
+		return nil
+	}
+
+	s.scope.V(2).Info("Deleting bastion host", "instance-id", id, "state", instance.State)
+	if err := s.DeleteInstance(instance); err != nil {
+		record.Warnf(s.scope.NifcloudCluster, "FailedDeleteBastion", "Failed to delete bastion %q: %v", id, err)
+		return err
+	}
+
+	s.scope.NifcloudCluster.Status.Bastion = instance
+	return nil
+}
+
+// BastionInProgress returns true while the bastion is not yet running or not yet deleted
+func (s *Service) BastionInProgress() bool {
+	bastion := s.scope.NifcloudCluster.Status.Bastion
+	if bastion == nil {
+		return false
+	}
+	return !s.scope.NifcloudCluster.Spec.Bastion.Enabled || bastion.State != infrav1alpha3.InstanceRunning
+}
+
+func (s *Service) createBastion(id string) (*infrav1alpha3.Instance, error) {
+	spec := s.scope.NifcloudCluster.Spec.Bastion
+
+	sg, ok := s.scope.SecurityGroups()[infrav1alpha3.SecurityGroupBastion]
+	if !ok {
+		return nil, nferrors.NewFailedDependency(
+			errors.Errorf("%s security group not available", infrav1alpha3.SecurityGroupBastion),
+		)
+	}
+
+	input := &infrav1alpha3.Instance{
+		ID:                id,
+		Type:              spec.InstanceType,
+		ImageID:           spec.ImageID,
+		SSHKeyName:        s.sshKeyName(s.scope.NifcloudCluster.Spec.SSHKeyName),
+		SecurityGroups:    []string{sg.Name},
+		NetworkInterfaces: s.getNetworkInterfaces(nil, infrav1alpha3.PublicTypePublic),
+		Tag: infrav1alpha3.BuildTags(infrav1alpha3.BuildParams{
+			ClusterName: s.scope.Name(),
+			Role:        nifcloud.String(bastionRole),
+		}),
+	}
+	if input.Type == "" {
+		input.Type = infrav1alpha3.DefaultBastionInstanceType
+	}
+	if input.ImageID == "" {
+		// the webhook requires the image, no image is guessed for the bastion
+		return nil, errors.New("imageID of the bastion is not specified")
+	}
+
+	s.scope.V(2).Info("Running bastion instance", "instance-id", id)
+	return s.runInstance(bastionRole, input)
+}
+
+// getBastionInstanceID returns the instance id of the bastion, which is unique to the cluster
+// the id recorded in the status is kept so that the bastion created before is still found
+func (s *Service) getBastionInstanceID() string {
+	if bastion := s.scope.NifcloudCluster.Status.Bastion; bastion != nil && bastion.ID != "" {
+		return bastion.ID
+	}
+	hashed := md5.Sum([]byte(s.scope.Cluster.Namespace + "/" + s.scope.Name() + "/" + bastionRole))
+	return hex.EncodeToString(hashed[:])[:maxBastionInstanceID]
+}
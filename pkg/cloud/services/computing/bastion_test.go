@@ -0,0 +1,239 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package computing
+
+import (
+	"testing"
+
+	"github.com/aokumasan/nifcloud-sdk-go-v2/nifcloud"
+	"github.com/aokumasan/nifcloud-sdk-go-v2/service/computing"
+	"github.com/golang/mock/gomock"
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
+	nferrors "github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/errors"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/mock_client"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/scope"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+)
+
+// describeBastion returns the bastion with the requested id in the state
+func describeBastion(state infrav1alpha3.InstanceState) func(interface{}, *computing.DescribeInstancesInput) (*computing.DescribeInstancesOutput, error) {
+	return func(_ interface{}, input *computing.DescribeInstancesInput) (*computing.DescribeInstancesOutput, error) {
+		return &computing.DescribeInstancesOutput{
+			ReservationSet: []computing.ReservationSetItem{
+				{
+					InstancesSet: []computing.InstancesSetItem{
+						{
+							InstanceId:       nifcloud.String(input.InstanceId[0]),
+							InstanceUniqueId: nifcloud.String("i-0001"),
+							InstanceType:     nifcloud.String(infrav1alpha3.DefaultBastionInstanceType),
+							InstanceState:    &computing.InstanceState{Name: nifcloud.String(string(state))},
+							Placement:        &computing.Placement{AvailabilityZone: nifcloud.String("east-11")},
+							ImageId:          nifcloud.String("image-0001"),
+							KeyName:          nifcloud.String(defaultSSHKeyName),
+							IpAddress:        nifcloud.String("203.0.113.10"),
+							PrivateIpAddress: nifcloud.String("10.0.0.10"),
+							Description:      nifcloud.String("cluster:test-cluster,role:bastion"),
+						},
+					},
+				},
+			},
+		}, nil
+	}
+}
+
+// describeForeignBastion returns the bastion with the requested id which belongs to another cluster
+func describeForeignBastion(_ interface{}, input *computing.DescribeInstancesInput) (*computing.DescribeInstancesOutput, error) {
+	out, _ := describeBastion(infrav1alpha3.InstanceRunning)(nil, input)
+	out.ReservationSet[0].InstancesSet[0].Description = nifcloud.String("cluster:other-cluster,role:bastion")
+	return out, nil
+}
+
+func TestService_ReconcileBastion(t *testing.T) {
+	bastionID := NewService(&scope.ClusterScope{
+		Cluster:         &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster"}},
+		NifcloudCluster: &infrav1alpha3.NifcloudCluster{},
+	}).getBastionInstanceID()
+
+	tests := []struct {
+		name      string
+		spec      infrav1alpha3.BastionSpec
+		status    *infrav1alpha3.Instance
+		expect    func(t *testing.T, m *mock_client.MockClientMockRecorder)
+		wantState infrav1alpha3.InstanceState
+		wantErr   bool
+	}{
+		{
+			name: "create bastion when it does not exist",
+			spec: infrav1alpha3.BastionSpec{Enabled: true, ImageID: "image-0001"},
+			expect: func(t *testing.T, m *mock_client.MockClientMockRecorder) {
+				gomock.InOrder(
+					m.DescribeInstances(gomock.Any(), gomock.Any()).
+						Return(nil, nferrors.NewNotFound(errors.New("not found"))),
+					m.RunInstances(gomock.Any(), gomock.Any()).
+						DoAndReturn(func(_ interface{}, input *computing.RunInstancesInput) (*computing.RunInstancesOutput, error) {
+							if nifcloud.StringValue(input.InstanceType) != infrav1alpha3.DefaultBastionInstanceType {
+								t.Errorf("unexpected instance type: %v", nifcloud.StringValue(input.InstanceType))
+							}
+							if nifcloud.StringValue(input.ImageId) != "image-0001" {
+								t.Errorf("unexpected image: %v", nifcloud.StringValue(input.ImageId))
+							}
+							if len(input.SecurityGroup) != 1 || input.SecurityGroup[0] != "bastion-group" {
+								t.Errorf("unexpected security groups: %v", input.SecurityGroup)
+							}
+							return &computing.RunInstancesOutput{
+								InstancesSet: []computing.InstancesSetItem{{InstanceId: input.InstanceId}},
+							}, nil
+						}),
+				)
+			},
+			wantState: infrav1alpha3.InstancePending,
+		},
+		{
+			name: "adopt existing bastion",
+			spec: infrav1alpha3.BastionSpec{Enabled: true, ImageID: "image-0001"},
+			expect: func(t *testing.T, m *mock_client.MockClientMockRecorder) {
+				m.DescribeInstances(gomock.Any(), gomock.Any()).DoAndReturn(describeBastion(infrav1alpha3.InstanceRunning))
+			},
+			wantState: infrav1alpha3.InstanceRunning,
+		},
+		{
+			name: "bastion without image",
+			spec: infrav1alpha3.BastionSpec{Enabled: true},
+			expect: func(t *testing.T, m *mock_client.MockClientMockRecorder) {
+				m.DescribeInstances(gomock.Any(), gomock.Any()).
+					Return(nil, nferrors.NewNotFound(errors.New("not found")))
+			},
+			wantErr: true,
+		},
+		{
+			name: "bastion with the same id owned by another cluster",
+			spec: infrav1alpha3.BastionSpec{Enabled: true, ImageID: "image-0001"},
+			expect: func(t *testing.T, m *mock_client.MockClientMockRecorder) {
+				m.DescribeInstances(gomock.Any(), gomock.Any()).DoAndReturn(describeForeignBastion)
+			},
+			wantErr: true,
+		},
+		{
+			name:   "keep the id of bastion recorded in status",
+			spec:   infrav1alpha3.BastionSpec{Enabled: true, ImageID: "image-0001"},
+			status: &infrav1alpha3.Instance{ID: "oldbastion"},
+			expect: func(t *testing.T, m *mock_client.MockClientMockRecorder) {
+				m.DescribeInstances(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ interface{}, input *computing.DescribeInstancesInput) (*computing.DescribeInstancesOutput, error) {
+						if input.InstanceId[0] != "oldbastion" {
+							t.Errorf("unexpected instance is described: %v", input.InstanceId)
+						}
+						return describeBastion(infrav1alpha3.InstanceRunning)(nil, input)
+					})
+			},
+			wantState: infrav1alpha3.InstanceRunning,
+		},
+		{
+			name:   "do nothing when disabled bastion is not recorded",
+			expect: func(t *testing.T, m *mock_client.MockClientMockRecorder) {},
+		},
+		{
+			name:   "do not delete bastion owned by another cluster",
+			status: &infrav1alpha3.Instance{ID: bastionID},
+			expect: func(t *testing.T, m *mock_client.MockClientMockRecorder) {
+				m.DescribeInstances(gomock.Any(), gomock.Any()).DoAndReturn(describeForeignBastion)
+			},
+		},
+		{
+			name:   "stop bastion when it is disabled",
+			status: &infrav1alpha3.Instance{ID: bastionID},
+			expect: func(t *testing.T, m *mock_client.MockClientMockRecorder) {
+				gomock.InOrder(
+					m.DescribeInstances(gomock.Any(), gomock.Any()).DoAndReturn(describeBastion(infrav1alpha3.InstanceRunning)),
+					m.StopInstances(gomock.Any(), gomock.Any()).Return(&computing.StopInstancesOutput{}, nil),
+				)
+			},
+			wantState: infrav1alpha3.InstanceRunning,
+		},
+		{
+			name:   "terminate stopped bastion",
+			status: &infrav1alpha3.Instance{ID: bastionID},
+			expect: func(t *testing.T, m *mock_client.MockClientMockRecorder) {
+				gomock.InOrder(
+					m.DescribeInstances(gomock.Any(), gomock.Any()).DoAndReturn(describeBastion(infrav1alpha3.InstanceStopped)),
+					m.TerminateInstances(gomock.Any(), gomock.Any()).Return(&computing.TerminateInstancesOutput{}, nil),
+				)
+			},
+			wantState: infrav1alpha3.InstanceStopped,
+		},
+		{
+			name:   "clear status after bastion disappears",
+			status: &infrav1alpha3.Instance{ID: "stale"},
+			expect: func(t *testing.T, m *mock_client.MockClientMockRecorder) {
+				m.DescribeInstances(gomock.Any(), gomock.Any()).
+					Return(nil, nferrors.NewNotFound(errors.New("not found")))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			mockSvc := mock_client.NewMockClient(mockCtrl)
+
+			scope, err := scope.NewClusterScope(scope.ClusterScopeParams{
+				Cluster: &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster"}},
+				NifcloudClients: scope.NifcloudClients{
+					Computing: mockSvc,
+				},
+				NifcloudCluster: &infrav1alpha3.NifcloudCluster{
+					Spec: infrav1alpha3.NifcloudClusterSpec{Bastion: tt.spec},
+					Status: infrav1alpha3.NifcloudClusterStatus{
+						Network: infrav1alpha3.Network{
+							SecurityGroups: map[infrav1alpha3.SecurityGroupRole]infrav1alpha3.SecurityGroup{
+								infrav1alpha3.SecurityGroupBastion: {Name: "bastion-group"},
+							},
+						},
+						Bastion: tt.status,
+					},
+				},
+			})
+			if err != nil {
+				t.Fatalf("Failed to create test context: %v", err)
+			}
+			tt.expect(t, mockSvc.EXPECT())
+
+			err = NewService(scope).ReconcileBastion()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("did not expect error: %v", err)
+			}
+			bastion := scope.NifcloudCluster.Status.Bastion
+			if tt.wantState == "" {
+				if bastion != nil {
+					t.Errorf("bastion status is not cleaned up: %+v", bastion)
+				}
+				return
+			}
+			if bastion == nil || bastion.State != tt.wantState || bastion.ID != NewService(scope).getBastionInstanceID() {
+				t.Errorf("unexpected bastion status: %+v", bastion)
+			}
+		})
+	}
+}
@@ -19,6 +19,9 @@ package computing
 import (
 	"context"
 	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/pkg/errors"
 	"k8s.io/utils/pointer"
@@ -28,19 +31,20 @@ import (
 
 	"github.com/aokumasan/nifcloud-sdk-go-v2/nifcloud"
 	"github.com/aokumasan/nifcloud-sdk-go-v2/service/computing"
-	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha2"
-	infrav1alpha2 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha2"
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
 	nferrors "github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/errors"
 	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/scope"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/conditions"
 )
 
 const (
 	defaultSSHKeyName     = "default"
 	defaultMachineOwnerID = "niftycloud"
-	defaultMachineBaseOS  = ""
+
+	imageAvailable = "available"
 )
 
-func (s *Service) InstanceIfExists(id *string) (*infrav1alpha2.Instance, error) {
+func (s *Service) InstanceIfExists(id *string) (*infrav1alpha3.Instance, error) {
 	if id == nil {
 		s.scope.Info("Instance does not have an instance id")
 		return nil, nil
@@ -72,7 +76,7 @@ func (s *Service) InstanceIfExists(id *string) (*infrav1alpha2.Instance, error)
 	return nil, nil
 }
 
-func (s *Service) GetRunningInstanceByTag(scope *scope.MachineScope) (*infrav1alpha2.Instance, error) {
+func (s *Service) GetRunningInstanceByTag(scope *scope.MachineScope) (*infrav1alpha3.Instance, error) {
 	s.scope.V(2).Info("Looking for existing machine instance by tags")
 
 	input := &computing.DescribeInstancesInput{}
@@ -104,7 +108,7 @@ func (s *Service) GetRunningInstanceByTag(scope *scope.MachineScope) (*infrav1al
 func (s *Service) FilterInstancesByTag(vs []computing.ReservationSetItem, tags map[string]string) []computing.ReservationSetItem {
 	var filtered []computing.ReservationSetItem
 	for _, v := range vs {
-		iTag := v1alpha2.ParseTags(nifcloud.StringValue(v.Description))
+		iTag := infrav1alpha3.ParseTags(nifcloud.StringValue(v.Description))
 		ok := true
 		for key, val := range iTag {
 			if tags[key] != val {
@@ -119,18 +123,18 @@ func (s *Service) FilterInstancesByTag(vs []computing.ReservationSetItem, tags m
 	return filtered
 }
 
-func (s *Service) CreateInstance(scope *scope.MachineScope) (*infrav1alpha2.Instance, error) {
+func (s *Service) CreateInstance(scope *scope.MachineScope) (*infrav1alpha3.Instance, error) {
 	s.scope.V(2).Info("Creating an instance for a machine")
 
 	instanceID := scope.GetInstanceIDConved()
-	input := &infrav1alpha2.Instance{
+	input := &infrav1alpha3.Instance{
 		ID:                instanceID,
 		Type:              scope.NifcloudMachine.Spec.InstanceType,
-		NetworkInterfaces: scope.NifcloudMachine.Spec.NetworkInterfaces,
+		NetworkInterfaces: s.getNetworkInterfaces(scope.NifcloudMachine.Spec.NetworkInterfaces, scope.NifcloudMachine.Spec.PublicType),
 	}
 
 	// create tags
-	input.Tag = v1alpha2.BuildTags(v1alpha2.BuildParams{
+	input.Tag = infrav1alpha3.BuildTags(infrav1alpha3.BuildParams{
 		ClusterName: s.scope.Name(),
 		Role:        nifcloud.String(scope.Role()),
 	})
@@ -139,11 +143,17 @@ func (s *Service) CreateInstance(scope *scope.MachineScope) (*infrav1alpha2.Inst
 	if scope.NifcloudMachine.Spec.ImageID != "" {
 		input.ImageID = scope.NifcloudMachine.Spec.ImageID
 	} else {
-		input.ImageID, err = s.defaultImageLookup()
+		input.ImageID, err = s.lookupImage(scope.NifcloudMachine.Spec.ImageLookup, infrav1alpha3.ImageLookupParams{
+			KubernetesVersion: scope.KubernetesVersion(),
+		})
 		if err != nil {
+			record.Warnf(scope.NifcloudMachine, "FailedLookupImage", "Failed to look up image: %v", err)
+			conditions.MarkFalse(scope.NifcloudMachine, infrav1alpha3.InstanceReadyCondition,
+				infrav1alpha3.ImageNotFoundReason, infrav1alpha3.ConditionSeverityError, "%v", err)
 			return nil, err
 		}
 	}
+	scope.SetImageID(input.ImageID)
 
 	// set userdata
 	userData, err := scope.GetUserData()
@@ -160,45 +170,174 @@ func (s *Service) CreateInstance(scope *scope.MachineScope) (*infrav1alpha2.Inst
 	input.SecurityGroups = append(input.SecurityGroups, ids...)
 
 	// set SSH key
-	input.SSHKeyName = defaultSSHKeyName
-	if scope.NifcloudMachine.Spec.KeyName != "" {
-		input.SSHKeyName = scope.NifcloudMachine.Spec.KeyName
-	} else {
-		input.SSHKeyName = defaultSSHKeyName
-	}
+	input.SSHKeyName = s.sshKeyName(scope.NifcloudMachine.Spec.KeyName)
 
 	s.scope.V(2).Info("Running instance", "machine-role", scope.Role())
 	out, err := s.runInstance(scope.Role(), input)
 	if err != nil {
 		record.Warnf(scope.NifcloudMachine, "FailedCreate", "Failed to create instance: %v", err)
+		conditions.MarkFalse(scope.NifcloudMachine, infrav1alpha3.InstanceReadyCondition,
+			infrav1alpha3.InstanceProvisionFailedReason, infrav1alpha3.ConditionSeverityError, "%v", err)
 		return nil, err
 	}
 
-	if len(input.NetworkInterfaces) > 0 {
-		for _, id := range input.NetworkInterfaces {
-			// TODO: attach interface
-			s.scope.V(2).Info("Attaching security groups to provide network interface", "groups", "[TODO]", "interface", id)
+	record.Eventf(scope.NifcloudMachine, "SuccessfulCreate", "Created new instance [%s/%s]", scope.Role(), out.ID)
+	conditions.MarkFalse(scope.NifcloudMachine, infrav1alpha3.InstanceReadyCondition,
+		infrav1alpha3.InstanceNotReadyReason, infrav1alpha3.ConditionSeverityInfo, "instance is %s", out.State)
+	if scope.BootstrapDelivery() == infrav1alpha3.BootstrapDeliveryUserData {
+		// bootstrap data reaches the instance in userdata
+		conditions.MarkTrue(scope.NifcloudMachine, infrav1alpha3.BootstrapDeliveredCondition)
+	}
+	return out, nil
+}
+
+// AttachControlPlaneEndpoint puts the running control plane instance behind the load balancer,
+// or associates the reserved endpoint address with it
+func (s *Service) AttachControlPlaneEndpoint(instanceID string) error {
+	if s.scope.Network().APIServerLoadBalancer != nil {
+		return s.RegisterInstanceWithLoadBalancer(instanceID)
+	}
+	return s.attachAddress(instanceID, s.scope.NifcloudCluster.Spec.ControlPlaneEndpoint.Host)
+}
+
+// DetachControlPlaneEndpoint takes the next step to detach the instance from the control plane endpoint,
+// it returns true once neither the load balancer nor the addresses of the cluster refer to the instance
+func (s *Service) DetachControlPlaneEndpoint(instanceID string) (bool, error) {
+	if lb := s.scope.Network().APIServerLoadBalancer; lb != nil {
+		current, err := s.describeLoadBalancer(lb.Name)
+		if err != nil {
+			return false, err
+		}
+		if current != nil && hasInstance(current, instanceID) {
+			return false, s.DeregisterInstanceFromLoadBalancer(instanceID)
 		}
 	}
 
-	// set reserved ip addr to controlplane
-	labels := scope.Machine.GetLabels()
-	if labels["cluster.x-k8s.io/control-plane"] == "true" {
-		if err := s.attachAddress(out.ID, scope.NifcloudCluster.Status.APIEndpoints[0].Host); err != nil {
-			return out, err
+	ips, err := s.describeClusterAddressesOfInstance(instanceID)
+	if err != nil {
+		return false, err
+	}
+	for _, ip := range ips {
+		s.scope.V(2).Info("Disassociating address from instance", "public-ip", ip, "instance-id", instanceID)
+		_, err := s.scope.NifcloudClients.Computing.DisassociateAddress(context.TODO(), &computing.DisassociateAddressInput{
+			PublicIp: nifcloud.String(ip),
+		})
+		if err != nil && !nferrors.IsNotFound(err) {
+			return false, errors.Wrapf(err, "failed to disassociate address %q from instance %q", ip, instanceID)
 		}
 	}
+	return len(ips) == 0, nil
+}
 
-	record.Eventf(scope.NifcloudMachine, "SuccessfulCreate", "Created new instance [%s/%s]", scope.Role(), out.ID)
-	return out, nil
+// describeClusterAddressesOfInstance returns the addresses of the cluster which are associated with the instance,
+// they are the endpoint address and the addresses tagged for the cluster
+func (s *Service) describeClusterAddressesOfInstance(instanceID string) ([]string, error) {
+	out, err := s.scope.NifcloudClients.Computing.DescribeAddresses(context.TODO(), &computing.DescribeAddressesInput{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to describe addresses")
+	}
+
+	endpoint := s.scope.NifcloudCluster.Spec.ControlPlaneEndpoint.Host
+	if addr := s.scope.Network().EndpointAddress; addr != nil {
+		endpoint = addr.PublicIP
+	}
+	var ips []string
+	for _, addr := range out.AddressesSet {
+		if nifcloud.StringValue(addr.InstanceId) != instanceID {
+			continue
+		}
+		ip := nifcloud.StringValue(addr.PublicIp)
+		if ip == endpoint || infrav1alpha3.ParseTags(nifcloud.StringValue(addr.Description))["cluster"] == s.scope.Name() {
+			ips = append(ips, ip)
+		}
+	}
+	return ips, nil
+}
+
+// DeregisterInstanceFromSecurityGroups takes the next step to remove the instance from the security groups of the cluster,
+// it returns true once none of the security groups has the instance
+func (s *Service) DeregisterInstanceFromSecurityGroups(instanceID string) (bool, error) {
+	names := make([]string, 0, len(s.scope.SecurityGroups()))
+	for _, sg := range s.scope.SecurityGroups() {
+		names = append(names, sg.Name)
+	}
+	if len(names) == 0 {
+		return true, nil
+	}
+	sort.Strings(names)
+
+	out, err := s.scope.NifcloudClients.Computing.DescribeSecurityGroups(context.TODO(), &computing.DescribeSecurityGroupsInput{
+		Filter: []computing.RequestFilterStruct{
+			{
+				Name:         nifcloud.String("group-name"),
+				RequestValue: names,
+			},
+		},
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "failed to describe security groups")
+	}
+
+	deregistered := true
+	for _, group := range out.SecurityGroupInfo {
+		registered := false
+		for _, instance := range group.InstancesSet {
+			if nifcloud.StringValue(instance.InstanceId) == instanceID {
+				registered = true
+				break
+			}
+		}
+		if !registered {
+			continue
+		}
+
+		deregistered = false
+		name := nifcloud.StringValue(group.GroupName)
+		s.scope.V(2).Info("Deregistering instance from security group", "instance-id", instanceID, "security-group", name)
+		_, err := s.scope.NifcloudClients.Computing.DeregisterInstancesFromSecurityGroup(context.TODO(), &computing.DeregisterInstancesFromSecurityGroupInput{
+			GroupName:  nifcloud.String(name),
+			InstanceId: []string{instanceID},
+		})
+		switch {
+		case nferrors.IsSecurityGroupProcessing(err):
+			// the request is retried by the next reconciliation
+			s.scope.V(2).Info("Security group is processing another request", "security-group", name)
+		case err != nil:
+			return false, errors.Wrapf(err, "failed to deregister instance %q from security group %q", instanceID, name)
+		}
+	}
+	return deregistered, nil
+}
+
+// getNetworkInterfaces returns network ids which the instance is connected to.
+// the private LAN of the cluster replaces the common private network.
+func (s *Service) getNetworkInterfaces(ids []string, publicType infrav1alpha3.PublicType) []string {
+	lan := s.scope.Network().PrivateLAN
+	if lan == nil {
+		return ids
+	}
+
+	res := []string{}
+	for _, id := range ids {
+		if id == infrav1alpha3.NetworkCommonPrivate || id == lan.ID {
+			continue
+		}
+		res = append(res, id)
+	}
+	if len(res) == 0 && publicType != infrav1alpha3.PublicTypePrivate {
+		res = append(res, infrav1alpha3.NetworkCommonGlobal)
+	}
+	return append(res, lan.ID)
 }
 
 func (s *Service) GetCoreSecurityGroup(scope *scope.MachineScope) ([]string, error) {
-	sgRoles := []infrav1alpha2.SecurityGroupRole{}
+	sgRoles := []infrav1alpha3.SecurityGroupRole{}
 
 	switch scope.Role() {
-	case "node", "control-plane":
-		sgRoles = append(sgRoles, infrav1alpha2.SecurityGroupControlPlane)
+	case "control-plane":
+		sgRoles = append(sgRoles, infrav1alpha3.SecurityGroupControlPlane)
+	case "node":
+		sgRoles = append(sgRoles, infrav1alpha3.SecurityGroupNode)
 	default:
 		return nil, errors.Errorf("Unknown node role %q", scope.Role())
 	}
@@ -214,32 +353,19 @@ func (s *Service) GetCoreSecurityGroup(scope *scope.MachineScope) ([]string, err
 	return ids, nil
 }
 
-func (s *Service) StopAndTerminateInstanceWithTimeout(instanceID string) error {
-	ctx := context.TODO()
-	input := &computing.DescribeInstancesInput{
-		InstanceId: []string{instanceID},
-	}
-
-	// stopping server before terminating
-	if err := s.StopInstance(instanceID); err != nil {
-		return err
-	}
-	s.scope.V(2).Info("Waiting for Nifcloud server to stop", "instance-id", instanceID)
-
-	if err := s.scope.NifcloudClients.Computing.WaitUntilInstanceStopped(ctx, input); err != nil {
-		return fmt.Errorf("failed to wait for instance %q stopping: %w", instanceID, err)
-	}
-
-	if err := s.TerminateInstance(instanceID); err != nil {
-		return err
-	}
-	s.scope.V(2).Info("Waiting for Nifcloud server to terminate", "intance-id", instanceID)
-
-	if err := s.scope.NifcloudClients.Computing.WaitUntilInstanceDeleted(ctx, input); err != nil {
-		return fmt.Errorf("failed to wait for instance %q termination: %w", instanceID, err)
+// DeleteInstance takes the next step to delete the observed instance without waiting for it,
+// callers observe the instance again later until it disappears
+func (s *Service) DeleteInstance(instance *infrav1alpha3.Instance) error {
+	switch instance.State {
+	case infrav1alpha3.InstanceStopped:
+		return s.TerminateInstance(instance.ID)
+	case infrav1alpha3.InstancePending, infrav1alpha3.InstanceWaiting:
+		s.scope.V(2).Info("Waiting for instance state transition", "instance-id", instance.ID, "state", instance.State)
+		return nil
+	default:
+		// nifcloud terminates only stopped instances
+		return s.StopInstance(instance.ID)
 	}
-
-	return nil
 }
 
 func (s *Service) TerminateInstance(instanceID string) error {
@@ -270,8 +396,8 @@ func (s *Service) StopInstance(instanceID string) error {
 	return nil
 }
 
-func (s *Service) runInstance(role string, i *infrav1alpha2.Instance) (*infrav1alpha2.Instance, error) {
-	apiTermination := infrav1alpha2.ApiTermination
+func (s *Service) runInstance(role string, i *infrav1alpha3.Instance) (*infrav1alpha3.Instance, error) {
+	apiTermination := infrav1alpha3.ApiTermination
 	input := &computing.RunInstancesInput{
 		InstanceId:            &i.ID,
 		InstanceType:          &i.Type,
@@ -287,67 +413,59 @@ func (s *Service) runInstance(role string, i *infrav1alpha2.Instance) (*infrav1a
 	if len(i.NetworkInterfaces) > 0 {
 		netInterfaces := make([]computing.RequestNetworkInterfaceStruct, 0, len(i.NetworkInterfaces))
 		for index, id := range i.NetworkInterfaces {
-			idx := int64(index)
 			netInterfaces = append(netInterfaces, computing.RequestNetworkInterfaceStruct{
-				DeviceIndex: &idx,
-				NetworkId:   &id,
+				DeviceIndex: nifcloud.Int64(int64(index)),
+				NetworkId:   nifcloud.String(id),
 			})
 		}
 		input.NetworkInterface = netInterfaces
-	} else {
-		if len(i.SecurityGroups) > 0 {
-			input.SecurityGroup = i.SecurityGroups
-		}
+	}
+	if len(i.SecurityGroups) > 0 {
+		input.SecurityGroup = i.SecurityGroups
 	}
 
 	// tag to instance Description
 	input.Description = i.Tag.ConvToString()
 
-	ctx := context.TODO()
-	creating, err := s.scope.NifcloudClients.Computing.RunInstances(ctx, input)
+	creating, err := s.scope.NifcloudClients.Computing.RunInstances(context.TODO(), input)
 	if err != nil {
 		return nil, fmt.Errorf("failed to run instance: %w", err)
 	}
-
-	instanceID := *creating.InstancesSet[0].InstanceId
-	s.scope.V(2).Info("Waiting for instance to be in running state", "instance-id", instanceID)
-
 	if len(creating.InstancesSet) == 0 {
 		return nil, fmt.Errorf("no instance returned for reservation: %v", creating.String())
 	}
 
-	describeInput := &computing.DescribeInstancesInput{
-		InstanceId: []string{instanceID},
-	}
-	if err := s.scope.NifcloudClients.Computing.WaitUntilInstanceRunning(ctx, describeInput); err != nil {
-		return nil, fmt.Errorf("failed to wait for instance %q running: %w", instanceID, err)
+	// the instance is still pending, it is observed by following reconciliations
+	created, err := s.SDKToInstance(creating.InstancesSet[0])
+	if err != nil {
+		return nil, err
 	}
-
-	running, err := s.scope.NifcloudClients.Computing.DescribeInstances(ctx, describeInput)
-	switch {
-	case nferrors.IsNotFound(err):
-		return nil, nil
-	case err != nil:
-		return nil, fmt.Errorf("failed to describe instance[%q]: %w", instanceID, err)
+	if created.State == "" {
+		created.State = infrav1alpha3.InstancePending
 	}
-
-	return s.SDKToInstance(running.ReservationSet[0].InstancesSet[0])
+	s.scope.V(2).Info("Requested instance to run", "instance-id", created.ID)
+	return created, nil
 }
 
-func (s *Service) SDKToInstance(v computing.InstancesSetItem) (*infrav1alpha2.Instance, error) {
-	i := &infrav1alpha2.Instance{
-		UID:        *v.InstanceUniqueId,
-		ID:         *v.InstanceId,
-		Zone:       *v.Placement.AvailabilityZone,
-		State:      infrav1alpha2.InstanceState(*v.InstanceState.Name),
-		Type:       *v.InstanceType,
-		ImageID:    *v.ImageId,
-		SSHKeyName: *v.KeyName,
-		PublicIP:   *v.IpAddress,
-		PrivateIP:  *v.PrivateIpAddress,
+func (s *Service) SDKToInstance(v computing.InstancesSetItem) (*infrav1alpha3.Instance, error) {
+	// instances which are just requested to run do not have every field
+	i := &infrav1alpha3.Instance{
+		UID:        nifcloud.StringValue(v.InstanceUniqueId),
+		ID:         nifcloud.StringValue(v.InstanceId),
+		Type:       nifcloud.StringValue(v.InstanceType),
+		ImageID:    nifcloud.StringValue(v.ImageId),
+		SSHKeyName: nifcloud.StringValue(v.KeyName),
+		PublicIP:   nifcloud.StringValue(v.IpAddress),
+		PrivateIP:  nifcloud.StringValue(v.PrivateIpAddress),
+	}
+	if v.Placement != nil {
+		i.Zone = nifcloud.StringValue(v.Placement.AvailabilityZone)
+	}
+	if v.InstanceState != nil {
+		i.State = infrav1alpha3.InstanceState(nifcloud.StringValue(v.InstanceState.Name))
 	}
 
-	i.Tag = v1alpha2.ParseTags(*v.Description)
+	i.Tag = infrav1alpha3.ParseTags(nifcloud.StringValue(v.Description))
 
 	// TODO: security groups
 
@@ -361,21 +479,22 @@ func (s *Service) getInstanceAddresses(instance *computing.InstancesSetItem) []c
 	for _, ni := range instance.NetworkInterfaceSet {
 		privateDNSAddress := corev1.NodeAddress{
 			Type:    corev1.NodeInternalDNS,
-			Address: *ni.PrivateDnsName,
+			Address: nifcloud.StringValue(ni.PrivateDnsName),
 		}
 		privateIPAddress := corev1.NodeAddress{
-			Type: corev1.NodeInternalIP,
+			Type:    corev1.NodeInternalIP,
+			Address: nifcloud.StringValue(ni.PrivateIpAddress),
 		}
 		addresses = append(addresses, privateDNSAddress, privateIPAddress)
 
 		if ni.Association != nil {
 			publicDNSAddress := corev1.NodeAddress{
 				Type:    corev1.NodeExternalDNS,
-				Address: *ni.Association.PublicDnsName,
+				Address: nifcloud.StringValue(ni.Association.PublicDnsName),
 			}
 			publicIPAddress := corev1.NodeAddress{
 				Type:    corev1.NodeExternalIP,
-				Address: *ni.Association.PublicIp,
+				Address: nifcloud.StringValue(ni.Association.PublicIp),
 			}
 			addresses = append(addresses, publicDNSAddress, publicIPAddress)
 		}
@@ -384,39 +503,72 @@ func (s *Service) getInstanceAddresses(instance *computing.InstancesSetItem) []c
 }
 
 func (s *Service) attachAddress(instanceID, ip string) error {
-	ctx := context.TODO()
-	_, err := s.scope.NifcloudClients.Computing.AssociateAddress(ctx, &computing.AssociateAddressInput{
+	_, err := s.scope.NifcloudClients.Computing.AssociateAddress(context.TODO(), &computing.AssociateAddressInput{
 		PublicIp:   nifcloud.String(ip),
 		InstanceId: nifcloud.String(instanceID),
 	})
 	if err != nil {
-		return err
+		return errors.Wrapf(err, "failed to associate address %q with instance %q", ip, instanceID)
 	}
-
-	describeInput := &computing.DescribeInstancesInput{
-		InstanceId: []string{instanceID},
-	}
-	if err := s.scope.NifcloudClients.Computing.WaitUntilInstanceRunning(ctx, describeInput); err != nil {
-		return errors.Wrapf(err, "failed to wait for instance %q running", instanceID)
-	}
-
 	return nil
 }
 
-func (s *Service) defaultImageLookup() (string, error) {
-	baseOS := defaultMachineBaseOS
-	ownerID := defaultMachineOwnerID
-	input := &computing.DescribeImagesInput{
-		ImageName: []string{baseOS},
-		Owner:     []string{ownerID},
+// lookupImage returns the newest image which matches the image lookup,
+// images are ordered by the launch time, then by the name and the id for the images launched at the same time.
+// an empty lookup is an error, the setup script of the userdata supports only some os families
+// and no image is guessed
+func (s *Service) lookupImage(l *infrav1alpha3.ImageLookup, params infrav1alpha3.ImageLookupParams) (string, error) {
+	if l == nil || *l == (infrav1alpha3.ImageLookup{}) {
+		return "", errors.New("neither imageID nor imageLookup is specified")
 	}
-	out, err := s.scope.NifcloudClients.Computing.DescribeImages(context.TODO(), input)
+	lookup := *l
+	if lookup.Owner == "" {
+		lookup.Owner = defaultMachineOwnerID
+	}
+	name, err := lookup.Name(params)
 	if err != nil {
-		return "", fmt.Errorf("fail to find image[%q]: %w", baseOS, err)
+		return "", err
 	}
-	if len(out.ImagesSet) == 0 {
-		return "", fmt.Errorf("no Images found: %q", baseOS)
+
+	out, err := s.scope.NifcloudClients.Computing.DescribeImages(context.TODO(), &computing.DescribeImagesInput{
+		Owner: []string{lookup.Owner},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to describe images of owner %q: %w", lookup.Owner, err)
 	}
-	s.scope.V(2).Info("Found and using an existing Image", "image-id", out.ImagesSet[0].ImageId)
-	return *out.ImagesSet[0].ImageId, nil
+
+	var images []computing.ImagesSetItem
+	for _, image := range out.ImagesSet {
+		if state := nifcloud.StringValue(image.ImageState); state != "" && state != imageAvailable {
+			continue
+		}
+		if lookup.OSFamily != "" && !strings.EqualFold(nifcloud.StringValue(image.Platform), lookup.OSFamily) {
+			continue
+		}
+		if name != "" {
+			// the pattern is validated by the webhook
+			if ok, _ := filepath.Match(name, nifcloud.StringValue(image.Name)); !ok {
+				continue
+			}
+		}
+		images = append(images, image)
+	}
+	if len(images) == 0 {
+		return "", fmt.Errorf("no image matches name %q, owner %q and os family %q", name, lookup.Owner, lookup.OSFamily)
+	}
+
+	sort.Slice(images, func(i, j int) bool {
+		a, b := images[i], images[j]
+		at, bt := nifcloud.TimeValue(a.LaunchTime), nifcloud.TimeValue(b.LaunchTime)
+		if !at.Equal(bt) {
+			return at.After(bt)
+		}
+		if an, bn := nifcloud.StringValue(a.Name), nifcloud.StringValue(b.Name); an != bn {
+			return an > bn
+		}
+		return nifcloud.StringValue(a.ImageId) > nifcloud.StringValue(b.ImageId)
+	})
+	id := nifcloud.StringValue(images[0].ImageId)
+	s.scope.V(2).Info("Found and using an existing Image", "image-id", id, "image-name", nifcloud.StringValue(images[0].Name))
+	return id, nil
 }
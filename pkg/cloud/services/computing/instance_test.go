@@ -20,15 +20,23 @@ import (
 	"context"
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/aokumasan/nifcloud-sdk-go-v2/nifcloud"
 	"github.com/aokumasan/nifcloud-sdk-go-v2/service/computing"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/golang/mock/gomock"
 	"github.com/pkg/errors"
-	infrav1alpha2 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha2"
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
 	nferrors "github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/errors"
+	nffake "github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/fake"
 	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/mock_client"
 	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/scope"
-	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 func TestService_InstanceIfExists(t *testing.T) {
@@ -40,7 +48,7 @@ func TestService_InstanceIfExists(t *testing.T) {
 		name       string
 		instanceID string
 		expect     func(m *mock_client.MockClientMockRecorder)
-		check      func(instance *infrav1alpha2.Instance, err error)
+		check      func(instance *infrav1alpha3.Instance, err error)
 	}{
 		{
 			name:       "does not exists",
@@ -51,7 +59,7 @@ func TestService_InstanceIfExists(t *testing.T) {
 				}).
 					Return(nil, nferrors.NewNotFound(errors.New("not found")))
 			},
-			check: func(instance *infrav1alpha2.Instance, err error) {
+			check: func(instance *infrav1alpha3.Instance, err error) {
 				if err != nil {
 					t.Fatalf("did not expect error: %v", err)
 				}
@@ -70,8 +78,8 @@ func TestService_InstanceIfExists(t *testing.T) {
 				NifcloudClients: scope.NifcloudClients{
 					Computing: mockSvc,
 				},
-				NifcloudCluster: &infrav1alpha2.NifcloudCluster{
-					Spec: infrav1alpha2.NifcloudClusterSpec{},
+				NifcloudCluster: &infrav1alpha3.NifcloudCluster{
+					Spec: infrav1alpha3.NifcloudClusterSpec{},
 				},
 			})
 			if err != nil {
@@ -88,33 +96,86 @@ func TestService_InstanceIfExists(t *testing.T) {
 }
 
 func TestService_GetRunningInstanceByTag(t *testing.T) {
-	type fields struct {
-		scope *scope.ClusterScope
-	}
-	type args struct {
-		scope *scope.MachineScope
+	ctx := context.TODO()
+	scheme := runtime.NewScheme()
+	if err := infrav1alpha3.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
 	}
+
 	tests := []struct {
 		name    string
-		fields  fields
-		args    args
-		want    *infrav1alpha2.Instance
+		setup   func(c *nffake.Client, id string)
+		wantID  string
 		wantErr bool
 	}{
-		// TODO: Add test cases.
+		{
+			name:  "no instance",
+			setup: func(c *nffake.Client, id string) {},
+		},
+		{
+			name: "instance tagged for the cluster and the role",
+			setup: func(c *nffake.Client, id string) {
+				c.RunInstances(ctx, &computing.RunInstancesInput{
+					InstanceId:  nifcloud.String(id),
+					Description: infrav1alpha3.BuildTags(infrav1alpha3.BuildParams{ClusterName: "test", Role: nifcloud.String("node")}).ConvToString(),
+				})
+			},
+			wantID: scope.InstanceIDFromName("test-machine"),
+		},
+		{
+			name: "instance tagged for another cluster",
+			setup: func(c *nffake.Client, id string) {
+				c.RunInstances(ctx, &computing.RunInstancesInput{
+					InstanceId:  nifcloud.String(id),
+					Description: infrav1alpha3.BuildTags(infrav1alpha3.BuildParams{ClusterName: "other", Role: nifcloud.String("node")}).ConvToString(),
+				})
+			},
+		},
+		{
+			name: "failed to describe instances",
+			setup: func(c *nffake.Client, id string) {
+				c.InjectError("DescribeInstances", nffake.NewError(nferrors.AuthFailure))
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			s := &Service{
-				scope: tt.fields.scope,
+			client := nffake.NewClient()
+			tt.setup(client, scope.InstanceIDFromName("test-machine"))
+
+			clusterScope, err := scope.NewClusterScope(scope.ClusterScopeParams{
+				Cluster:         &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test"}},
+				NifcloudClients: scope.NifcloudClients{Computing: client},
+				NifcloudCluster: &infrav1alpha3.NifcloudCluster{},
+			})
+			if err != nil {
+				t.Fatal(err)
 			}
-			got, err := s.GetRunningInstanceByTag(tt.args.scope)
+			nifcloudMachine := &infrav1alpha3.NifcloudMachine{ObjectMeta: metav1.ObjectMeta{Name: "test-machine"}}
+			machineScope, err := scope.NewMachineScope(scope.MachineScopeParams{
+				Client:          fake.NewFakeClientWithScheme(scheme, nifcloudMachine),
+				Cluster:         clusterScope.Cluster,
+				Machine:         &clusterv1.Machine{},
+				NifcloudCluster: clusterScope.NifcloudCluster,
+				NifcloudMachine: nifcloudMachine,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s := NewService(clusterScope)
+			got, err := s.GetRunningInstanceByTag(machineScope)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Service.GetRunningInstanceByTag() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("Service.GetRunningInstance() = %v, want %v", got, tt.want)
+			gotID := ""
+			if got != nil {
+				gotID = got.ID
+			}
+			if gotID != tt.wantID {
+				t.Errorf("Service.GetRunningInstance() = %v, want instance %q", got, tt.wantID)
 			}
 		})
 	}
@@ -131,7 +192,7 @@ func TestService_CreateInstance(t *testing.T) {
 		name    string
 		fields  fields
 		args    args
-		want    *infrav1alpha2.Instance
+		want    *infrav1alpha3.Instance
 		wantErr bool
 	}{
 		// TODO: Add test cases.
@@ -159,13 +220,13 @@ func TestService_runInstance(t *testing.T) {
 	}
 	type args struct {
 		role string
-		i    *infrav1alpha2.Instance
+		i    *infrav1alpha3.Instance
 	}
 	tests := []struct {
 		name    string
 		fields  fields
 		args    args
-		want    *infrav1alpha2.Instance
+		want    *infrav1alpha3.Instance
 		wantErr bool
 	}{
 		// TODO: Add test cases.
@@ -198,10 +259,22 @@ func TestService_SDKToInstance(t *testing.T) {
 		name    string
 		fields  fields
 		args    args
-		want    *infrav1alpha2.Instance
+		want    *infrav1alpha3.Instance
 		wantErr bool
 	}{
-		// TODO: Add test cases.
+		{
+			name: "instance just requested to run",
+			args: args{v: computing.InstancesSetItem{
+				InstanceId:    nifcloud.String("test"),
+				InstanceState: &computing.InstanceState{Name: nifcloud.String("pending")},
+			}},
+			want: &infrav1alpha3.Instance{
+				ID:        "test",
+				State:     infrav1alpha3.InstancePending,
+				Tag:       infrav1alpha3.Tag{},
+				Addresses: []corev1.NodeAddress{},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -220,34 +293,315 @@ func TestService_SDKToInstance(t *testing.T) {
 	}
 }
 
-func TestService_defaultImageLookup(t *testing.T) {
-	type fields struct {
-		scope *scope.ClusterScope
+func TestService_lookupImage(t *testing.T) {
+	older := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(24 * time.Hour)
+	image := func(id, name, owner, platform, state string, launched time.Time) computing.ImagesSetItem {
+		return computing.ImagesSetItem{
+			ImageId:         nifcloud.String(id),
+			Name:            nifcloud.String(name),
+			ImageOwnerAlias: nifcloud.String(owner),
+			Platform:        nifcloud.String(platform),
+			ImageState:      nifcloud.String(state),
+			LaunchTime:      nifcloud.Time(launched),
+		}
 	}
-	type args struct {
-		kubernetesVersion string
+	images := []computing.ImagesSetItem{
+		image("10", "Ubuntu Server 18.04 LTS", "niftycloud", "Ubuntu", "available", older),
+		image("11", "CentOS 7.6", "niftycloud", "CentOS", "available", newer),
+		image("20", "capi-ubuntu-1.17.3-a", "self", "Ubuntu", "available", older),
+		image("21", "capi-ubuntu-1.17.3-b", "self", "Ubuntu", "available", older),
+		image("22", "capi-ubuntu-1.16.8", "self", "Ubuntu", "available", newer),
+		image("23", "capi-ubuntu-1.17.3-c", "self", "Ubuntu", "pending", newer),
 	}
+
 	tests := []struct {
 		name    string
-		fields  fields
-		args    args
+		lookup  *infrav1alpha3.ImageLookup
+		params  infrav1alpha3.ImageLookupParams
+		fault   error
 		want    string
 		wantErr bool
 	}{
-		// TODO: Add test cases.
+		{
+			name:    "no lookup is an error",
+			wantErr: true,
+		},
+		{
+			name:    "empty lookup is an error",
+			lookup:  &infrav1alpha3.ImageLookup{},
+			wantErr: true,
+		},
+		{
+			name:   "newest public image of the os family",
+			lookup: &infrav1alpha3.ImageLookup{OSFamily: "centos"},
+			want:   "11",
+		},
+		{
+			name:   "public image of the os family",
+			lookup: &infrav1alpha3.ImageLookup{OSFamily: "ubuntu"},
+			want:   "10",
+		},
+		{
+			name:   "newest image of the owner",
+			lookup: &infrav1alpha3.ImageLookup{Owner: "self"},
+			want:   "22",
+		},
+		{
+			name:   "name pattern with the kubernetes version, ties are broken by the name",
+			lookup: &infrav1alpha3.ImageLookup{NamePattern: "capi-ubuntu-{{.KubernetesVersion}}-*", Owner: "self"},
+			params: infrav1alpha3.ImageLookupParams{KubernetesVersion: "1.17.3"},
+			want:   "21",
+		},
+		{
+			name:    "no image matches",
+			lookup:  &infrav1alpha3.ImageLookup{NamePattern: "capi-ubuntu-{{.KubernetesVersion}}-*", Owner: "self"},
+			params:  infrav1alpha3.ImageLookupParams{KubernetesVersion: "1.18.0"},
+			wantErr: true,
+		},
+		{
+			name:    "failed to describe images",
+			fault:   nffake.NewError(nferrors.AuthFailure),
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			s := &Service{
-				scope: tt.fields.scope,
+			client := nffake.NewClient()
+			client.SetImages(images...)
+			if tt.fault != nil {
+				client.InjectError("DescribeImages", tt.fault)
 			}
-			got, err := s.defaultImageLookup()
+			clusterScope, err := scope.NewClusterScope(scope.ClusterScopeParams{
+				Cluster:         &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test"}},
+				NifcloudClients: scope.NifcloudClients{Computing: client},
+				NifcloudCluster: &infrav1alpha3.NifcloudCluster{},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s := NewService(clusterScope)
+			got, err := s.lookupImage(tt.lookup, tt.params)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("Service.defaultImageLookup() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("Service.lookupImage() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 			if got != tt.want {
-				t.Errorf("Service.defaultImageLookup() = %v, want %v", got, tt.want)
+				t.Errorf("Service.lookupImage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_DeleteInstance(t *testing.T) {
+	tests := []struct {
+		name   string
+		state  infrav1alpha3.InstanceState
+		expect func(m *mock_client.MockClientMockRecorder)
+	}{
+		{
+			name:  "stop running instance",
+			state: infrav1alpha3.InstanceRunning,
+			expect: func(m *mock_client.MockClientMockRecorder) {
+				m.StopInstances(gomock.Any(), gomock.Any()).Return(&computing.StopInstancesOutput{}, nil)
+			},
+		},
+		{
+			name:  "terminate stopped instance",
+			state: infrav1alpha3.InstanceStopped,
+			expect: func(m *mock_client.MockClientMockRecorder) {
+				m.TerminateInstances(gomock.Any(), gomock.Any()).Return(&computing.TerminateInstancesOutput{}, nil)
+			},
+		},
+		{
+			name:   "wait for pending instance",
+			state:  infrav1alpha3.InstancePending,
+			expect: func(m *mock_client.MockClientMockRecorder) {},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			mockSvc := mock_client.NewMockClient(mockCtrl)
+
+			scope, err := scope.NewClusterScope(scope.ClusterScopeParams{
+				Cluster:         &clusterv1.Cluster{},
+				NifcloudClients: scope.NifcloudClients{Computing: mockSvc},
+				NifcloudCluster: &infrav1alpha3.NifcloudCluster{},
+			})
+			if err != nil {
+				t.Fatalf("Failed to create test context: %v", err)
+			}
+			tt.expect(mockSvc.EXPECT())
+
+			if err := NewService(scope).DeleteInstance(&infrav1alpha3.Instance{ID: "test", State: tt.state}); err != nil {
+				t.Fatalf("did not expect error: %v", err)
+			}
+		})
+	}
+}
+
+func TestService_DetachControlPlaneEndpoint(t *testing.T) {
+	addresses := &computing.DescribeAddressesOutput{
+		AddressesSet: []computing.AddressesSetItem{
+			{PublicIp: nifcloud.String("203.0.113.1"), InstanceId: nifcloud.String("test")},
+			{PublicIp: nifcloud.String("203.0.113.2"), InstanceId: nifcloud.String("test"), Description: nifcloud.String("cluster:test-cluster,role:ENDPOINT")},
+			{PublicIp: nifcloud.String("203.0.113.3"), InstanceId: nifcloud.String("test"), Description: nifcloud.String("cluster:other-cluster,role:ENDPOINT")},
+			{PublicIp: nifcloud.String("203.0.113.4"), InstanceId: nifcloud.String("other")},
+		},
+	}
+	tests := []struct {
+		name         string
+		lb           *infrav1alpha3.LoadBalancer
+		expect       func(m *mock_client.MockClientMockRecorder)
+		wantDetached bool
+	}{
+		{
+			name: "deregister the instance from the load balancer",
+			lb:   &infrav1alpha3.LoadBalancer{Name: "test-lb", Port: apiEndpointPort, Instances: []string{"test"}},
+			expect: func(m *mock_client.MockClientMockRecorder) {
+				m.DescribeLoadBalancers(gomock.Any(), gomock.Any()).
+					Return(&computing.DescribeLoadBalancersOutput{
+						LoadBalancerDescriptions: []computing.LoadBalancerDescriptionsMemberItem{{
+							LoadBalancerName: nifcloud.String("test-lb"),
+							Instances:        []computing.InstancesMemberItem{{InstanceId: nifcloud.String("test")}},
+						}},
+					}, nil)
+				m.DeregisterInstancesFromLoadBalancer(gomock.Any(), gomock.Any()).
+					Return(&computing.DeregisterInstancesFromLoadBalancerOutput{}, nil)
+			},
+		},
+		{
+			name: "disassociate the addresses of the cluster",
+			expect: func(m *mock_client.MockClientMockRecorder) {
+				m.DescribeAddresses(gomock.Any(), gomock.Any()).Return(addresses, nil)
+				m.DisassociateAddress(gomock.Any(), &computing.DisassociateAddressInput{PublicIp: nifcloud.String("203.0.113.1")}).
+					Return(&computing.DisassociateAddressOutput{}, nil)
+				m.DisassociateAddress(gomock.Any(), &computing.DisassociateAddressInput{PublicIp: nifcloud.String("203.0.113.2")}).
+					Return(&computing.DisassociateAddressOutput{}, nil)
+			},
+		},
+		{
+			name: "detached from the load balancer and the addresses",
+			lb:   &infrav1alpha3.LoadBalancer{Name: "test-lb", Port: apiEndpointPort},
+			expect: func(m *mock_client.MockClientMockRecorder) {
+				m.DescribeLoadBalancers(gomock.Any(), gomock.Any()).
+					Return(&computing.DescribeLoadBalancersOutput{
+						LoadBalancerDescriptions: []computing.LoadBalancerDescriptionsMemberItem{{LoadBalancerName: nifcloud.String("test-lb")}},
+					}, nil)
+				m.DescribeAddresses(gomock.Any(), gomock.Any()).
+					Return(&computing.DescribeAddressesOutput{AddressesSet: addresses.AddressesSet[3:]}, nil)
+			},
+			wantDetached: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			mockSvc := mock_client.NewMockClient(mockCtrl)
+
+			scope, err := scope.NewClusterScope(scope.ClusterScopeParams{
+				Cluster:         &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster"}},
+				NifcloudClients: scope.NifcloudClients{Computing: mockSvc},
+				NifcloudCluster: &infrav1alpha3.NifcloudCluster{
+					Status: infrav1alpha3.NifcloudClusterStatus{
+						Network: infrav1alpha3.Network{
+							APIServerLoadBalancer: tt.lb,
+							EndpointAddress:       &infrav1alpha3.Address{PublicIP: "203.0.113.1", Unmanaged: true},
+						},
+					},
+				},
+			})
+			if err != nil {
+				t.Fatalf("Failed to create test context: %v", err)
+			}
+			tt.expect(mockSvc.EXPECT())
+
+			detached, err := NewService(scope).DetachControlPlaneEndpoint("test")
+			if err != nil {
+				t.Fatalf("did not expect error: %v", err)
+			}
+			if detached != tt.wantDetached {
+				t.Errorf("expected detached %v, got %v", tt.wantDetached, detached)
+			}
+		})
+	}
+}
+
+func TestService_DeregisterInstanceFromSecurityGroups(t *testing.T) {
+	groups := func(instances ...string) *computing.DescribeSecurityGroupsOutput {
+		out := &computing.DescribeSecurityGroupsOutput{
+			SecurityGroupInfo: []computing.SecurityGroupInfoSetItem{{GroupName: nifcloud.String("testcp")}},
+		}
+		for _, id := range instances {
+			out.SecurityGroupInfo[0].InstancesSet = append(out.SecurityGroupInfo[0].InstancesSet, computing.InstancesSetItem{InstanceId: nifcloud.String(id)})
+		}
+		return out
+	}
+	tests := []struct {
+		name             string
+		expect           func(m *mock_client.MockClientMockRecorder)
+		wantDeregistered bool
+	}{
+		{
+			name: "deregister the instance",
+			expect: func(m *mock_client.MockClientMockRecorder) {
+				m.DescribeSecurityGroups(gomock.Any(), gomock.Any()).Return(groups("other", "test"), nil)
+				m.DeregisterInstancesFromSecurityGroup(gomock.Any(), &computing.DeregisterInstancesFromSecurityGroupInput{
+					GroupName:  nifcloud.String("testcp"),
+					InstanceId: []string{"test"},
+				}).Return(&computing.DeregisterInstancesFromSecurityGroupOutput{}, nil)
+			},
+		},
+		{
+			name: "retry while the security group is processing",
+			expect: func(m *mock_client.MockClientMockRecorder) {
+				m.DescribeSecurityGroups(gomock.Any(), gomock.Any()).Return(groups("test"), nil)
+				m.DeregisterInstancesFromSecurityGroup(gomock.Any(), gomock.Any()).
+					Return(nil, awserr.New(nferrors.SecurityGroupProcessing, "processing", nil))
+			},
+		},
+		{
+			name: "deregistered",
+			expect: func(m *mock_client.MockClientMockRecorder) {
+				m.DescribeSecurityGroups(gomock.Any(), gomock.Any()).Return(groups("other"), nil)
+			},
+			wantDeregistered: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			mockSvc := mock_client.NewMockClient(mockCtrl)
+
+			scope, err := scope.NewClusterScope(scope.ClusterScopeParams{
+				Cluster:         &clusterv1.Cluster{},
+				NifcloudClients: scope.NifcloudClients{Computing: mockSvc},
+				NifcloudCluster: &infrav1alpha3.NifcloudCluster{
+					Status: infrav1alpha3.NifcloudClusterStatus{
+						Network: infrav1alpha3.Network{
+							SecurityGroups: map[infrav1alpha3.SecurityGroupRole]infrav1alpha3.SecurityGroup{
+								infrav1alpha3.SecurityGroupControlPlane: {Name: "testcp"},
+							},
+						},
+					},
+				},
+			})
+			if err != nil {
+				t.Fatalf("Failed to create test context: %v", err)
+			}
+			tt.expect(mockSvc.EXPECT())
+
+			deregistered, err := NewService(scope).DeregisterInstanceFromSecurityGroups("test")
+			if err != nil {
+				t.Fatalf("did not expect error: %v", err)
+			}
+			if deregistered != tt.wantDeregistered {
+				t.Errorf("expected deregistered %v, got %v", tt.wantDeregistered, deregistered)
 			}
 		})
 	}
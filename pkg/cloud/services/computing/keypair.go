@@ -0,0 +1,147 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package computing
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/aokumasan/nifcloud-sdk-go-v2/nifcloud"
+	"github.com/aokumasan/nifcloud-sdk-go-v2/service/computing"
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
+	nferrors "github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/errors"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/conditions"
+	"sigs.k8s.io/cluster-api/util/record"
+)
+
+// keyPairRole is the role in the description of the key pair imported for the cluster
+const keyPairRole = "sshkey"
+
+// ReconcileKeyPair imports the ssh key of the cluster as a key pair owned by the cluster,
+// the key pair is imported once and kept as it is, even if the public key in the secret changes
+func (s *Service) ReconcileKeyPair() error {
+	if s.scope.NifcloudCluster.Spec.SSHKey == nil {
+		return nil
+	}
+	s.scope.V(2).Info("Reconciling key pair")
+
+	if err := s.reconcileKeyPair(); err != nil {
+		conditions.MarkFalse(s.scope.NifcloudCluster, infrav1alpha3.SSHKeyReadyCondition,
+			infrav1alpha3.SSHKeyImportFailedReason, infrav1alpha3.ConditionSeverityError, "%v", err)
+		return err
+	}
+	conditions.MarkTrue(s.scope.NifcloudCluster, infrav1alpha3.SSHKeyReadyCondition)
+	return nil
+}
+
+func (s *Service) reconcileKeyPair() error {
+	name := s.scope.KeyPairName()
+	key, err := s.describeKeyPair(name)
+	if err != nil {
+		return err
+	}
+	if key != nil {
+		if !infrav1alpha3.ParseTags(nifcloud.StringValue(key.Description)).IsOwnedBy(s.scope.Name(), keyPairRole) {
+			return fmt.Errorf("key pair %q exists but is not owned by the cluster", name)
+		}
+		s.scope.NifcloudCluster.Status.KeyPairName = name
+		return nil
+	}
+
+	publicKey, err := s.scope.SSHPublicKey(context.TODO())
+	if err != nil {
+		return err
+	}
+	tags := infrav1alpha3.BuildTags(infrav1alpha3.BuildParams{
+		ClusterName: s.scope.Name(),
+		Role:        nifcloud.String(keyPairRole),
+	})
+	if _, err := s.scope.NifcloudClients.Computing.ImportKeyPair(context.TODO(), &computing.ImportKeyPairInput{
+		KeyName:           nifcloud.String(name),
+		PublicKeyMaterial: nifcloud.String(base64.StdEncoding.EncodeToString([]byte(publicKey))),
+		Description:       tags.ConvToString(),
+	}); err != nil {
+		record.Warnf(s.scope.NifcloudCluster, "FailedImportKeyPair", "Failed to import key pair %q: %v", name, err)
+		return fmt.Errorf("failed to import key pair %q: %w", name, err)
+	}
+	record.Eventf(s.scope.NifcloudCluster, "SuccessfulImportKeyPair", "Imported key pair %q", name)
+	s.scope.NifcloudCluster.Status.KeyPairName = name
+	return nil
+}
+
+// DeleteKeyPair deletes the key pair imported for the cluster,
+// it has to be called after the bastion and the machines which use it are deleted
+func (s *Service) DeleteKeyPair() error {
+	name := s.scope.NifcloudCluster.Status.KeyPairName
+	if name == "" {
+		return nil
+	}
+	s.scope.V(2).Info("Deleting key pair", "key-name", name)
+
+	key, err := s.describeKeyPair(name)
+	if err != nil {
+		return err
+	}
+	if key == nil || !infrav1alpha3.ParseTags(nifcloud.StringValue(key.Description)).IsOwnedBy(s.scope.Name(), keyPairRole) {
+		s.scope.V(2).Info("Skip deleting key pair which is not owned by the cluster", "key-name", name)
+		s.scope.NifcloudCluster.Status.KeyPairName = ""
+		return nil
+	}
+
+	if _, err := s.scope.NifcloudClients.Computing.DeleteKeyPair(context.TODO(), &computing.DeleteKeyPairInput{
+		KeyName: nifcloud.String(name),
+	}); err != nil && !nferrors.IsNotFound(err) {
+		record.Warnf(s.scope.NifcloudCluster, "FailedDeleteKeyPair", "Failed to delete key pair %q: %v", name, err)
+		return fmt.Errorf("failed to delete key pair %q: %w", name, err)
+	}
+	record.Eventf(s.scope.NifcloudCluster, "SuccessfulDeleteKeyPair", "Deleted key pair %q", name)
+	s.scope.NifcloudCluster.Status.KeyPairName = ""
+	return nil
+}
+
+// describeKeyPair returns the key pair which has the name, or nil if not found
+func (s *Service) describeKeyPair(name string) (*computing.KeySetItem, error) {
+	out, err := s.scope.NifcloudClients.Computing.DescribeKeyPairs(context.TODO(), &computing.DescribeKeyPairsInput{
+		KeyName: []string{name},
+	})
+	if err != nil && !nferrors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to describe key pair %q: %w", name, err)
+	}
+	if out == nil {
+		return nil, nil
+	}
+	for i := range out.KeySet {
+		if nifcloud.StringValue(out.KeySet[i].KeyName) == name {
+			return &out.KeySet[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// sshKeyName returns the key name given to the resource, or the key pair of the cluster,
+// the key pair named "default" is used when neither of them is given
+func (s *Service) sshKeyName(name string) string {
+	if name != "" {
+		return name
+	}
+	if name := s.scope.NifcloudCluster.Status.KeyPairName; name != "" {
+		return name
+	}
+	s.scope.Info("No ssh key is given, the default key pair is used", "key-name", defaultSSHKeyName)
+	return defaultSSHKeyName
+}
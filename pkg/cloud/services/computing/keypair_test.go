@@ -0,0 +1,298 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package computing
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/aokumasan/nifcloud-sdk-go-v2/nifcloud"
+	"github.com/aokumasan/nifcloud-sdk-go-v2/service/computing"
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
+	nferrors "github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/errors"
+	nffake "github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/fake"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/scope"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/conditions"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const testPublicKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAILNuZbHsU2Yywz610ov4KhgmVxcbjcRFbPvpn2nEpt7k capi@example.com"
+
+// newKeyPairTestScope returns the scope of the cluster which has the ssh key,
+// the objects are served by the client of the scope
+func newKeyPairTestScope(t *testing.T, client *nffake.Client, sshKey *infrav1alpha3.SSHKeySpec, objs ...runtime.Object) *scope.ClusterScope {
+	scheme := runtime.NewScheme()
+	if err := infrav1alpha3.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	nifcloudCluster := &infrav1alpha3.NifcloudCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+		Spec:       infrav1alpha3.NifcloudClusterSpec{SSHKey: sshKey},
+	}
+	clusterScope, err := scope.NewClusterScope(scope.ClusterScopeParams{
+		Client:          fake.NewFakeClientWithScheme(scheme, append(objs, nifcloudCluster)...),
+		Cluster:         &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"}},
+		NifcloudClients: scope.NifcloudClients{Computing: client},
+		NifcloudCluster: nifcloudCluster,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clusterScope
+}
+
+func importTestKeyPair(t *testing.T, client *nffake.Client, name, clusterName string) {
+	t.Helper()
+	tags := infrav1alpha3.BuildTags(infrav1alpha3.BuildParams{ClusterName: clusterName, Role: nifcloud.String(keyPairRole)})
+	if _, err := client.ImportKeyPair(context.TODO(), &computing.ImportKeyPairInput{
+		KeyName:           nifcloud.String(name),
+		PublicKeyMaterial: nifcloud.String(base64.StdEncoding.EncodeToString([]byte(testPublicKey))),
+		Description:       tags.ConvToString(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestService_ReconcileKeyPair(t *testing.T) {
+	secret := func(data map[string][]byte) *corev1.Secret {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "ssh-key", Namespace: "default"}, Data: data}
+	}
+
+	tests := []struct {
+		name        string
+		sshKey      *infrav1alpha3.SSHKeySpec
+		objs        []runtime.Object
+		setup       func(c *nffake.Client, name string)
+		wantImports int
+		wantKeyPair bool
+		wantErr     bool
+	}{
+		{
+			name:  "no ssh key",
+			setup: func(c *nffake.Client, name string) {},
+		},
+		{
+			name:        "import inline public key",
+			sshKey:      &infrav1alpha3.SSHKeySpec{PublicKey: testPublicKey},
+			setup:       func(c *nffake.Client, name string) {},
+			wantImports: 1,
+			wantKeyPair: true,
+		},
+		{
+			name:        "import public key in the secret",
+			sshKey:      &infrav1alpha3.SSHKeySpec{SecretRef: &infrav1alpha3.SSHKeySecretReference{Name: "ssh-key"}},
+			objs:        []runtime.Object{secret(map[string][]byte{scope.SSHPublicKeySecretKey: []byte(testPublicKey + "\n")})},
+			setup:       func(c *nffake.Client, name string) {},
+			wantImports: 1,
+			wantKeyPair: true,
+		},
+		{
+			name:        "import public key in the given key of the secret",
+			sshKey:      &infrav1alpha3.SSHKeySpec{SecretRef: &infrav1alpha3.SSHKeySecretReference{Name: "ssh-key", Key: "id_ed25519.pub"}},
+			objs:        []runtime.Object{secret(map[string][]byte{"id_ed25519.pub": []byte(testPublicKey)})},
+			setup:       func(c *nffake.Client, name string) {},
+			wantImports: 1,
+			wantKeyPair: true,
+		},
+		{
+			name:    "secret without the public key",
+			sshKey:  &infrav1alpha3.SSHKeySpec{SecretRef: &infrav1alpha3.SSHKeySecretReference{Name: "ssh-key"}},
+			objs:    []runtime.Object{secret(map[string][]byte{"id_ed25519.pub": []byte(testPublicKey)})},
+			setup:   func(c *nffake.Client, name string) {},
+			wantErr: true,
+		},
+		{
+			name:    "secret not found",
+			sshKey:  &infrav1alpha3.SSHKeySpec{SecretRef: &infrav1alpha3.SSHKeySecretReference{Name: "ssh-key"}},
+			setup:   func(c *nffake.Client, name string) {},
+			wantErr: true,
+		},
+		{
+			name:   "key pair already imported",
+			sshKey: &infrav1alpha3.SSHKeySpec{PublicKey: testPublicKey},
+			setup: func(c *nffake.Client, name string) {
+				importTestKeyPair(t, c, name, "test")
+			},
+			wantImports: 1,
+			wantKeyPair: true,
+		},
+		{
+			name:   "key pair owned by another cluster",
+			sshKey: &infrav1alpha3.SSHKeySpec{PublicKey: testPublicKey},
+			setup: func(c *nffake.Client, name string) {
+				importTestKeyPair(t, c, name, "other")
+			},
+			wantImports: 1,
+			wantErr:     true,
+		},
+		{
+			name:   "failed to import key pair",
+			sshKey: &infrav1alpha3.SSHKeySpec{PublicKey: testPublicKey},
+			setup: func(c *nffake.Client, name string) {
+				c.InjectError("ImportKeyPair", nffake.NewError(nferrors.AuthFailure))
+			},
+			wantImports: 1,
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := nffake.NewClient()
+			clusterScope := newKeyPairTestScope(t, client, tt.sshKey, tt.objs...)
+			tt.setup(client, clusterScope.KeyPairName())
+
+			s := NewService(clusterScope)
+			err := s.ReconcileKeyPair()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Service.ReconcileKeyPair() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := client.Calls("ImportKeyPair"); got != tt.wantImports {
+				t.Errorf("expected %d imports, got %d", tt.wantImports, got)
+			}
+
+			wantName := ""
+			if tt.wantKeyPair {
+				wantName = clusterScope.KeyPairName()
+			}
+			if got := clusterScope.NifcloudCluster.Status.KeyPairName; got != wantName {
+				t.Errorf("expected key pair name %q in status, got %q", wantName, got)
+			}
+			if tt.sshKey != nil && conditions.IsTrue(clusterScope.NifcloudCluster, infrav1alpha3.SSHKeyReadyCondition) == tt.wantErr {
+				t.Errorf("expected %s condition to be %v", infrav1alpha3.SSHKeyReadyCondition, !tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestService_DeleteKeyPair(t *testing.T) {
+	tests := []struct {
+		name          string
+		setup         func(c *nffake.Client, name string)
+		statusName    bool
+		wantDeletes   int
+		wantRemaining bool
+		wantErr       bool
+	}{
+		{
+			name:  "no key pair imported",
+			setup: func(c *nffake.Client, name string) {},
+		},
+		{
+			name: "delete owned key pair",
+			setup: func(c *nffake.Client, name string) {
+				importTestKeyPair(t, c, name, "test")
+			},
+			statusName:  true,
+			wantDeletes: 1,
+		},
+		{
+			name:       "key pair already deleted",
+			setup:      func(c *nffake.Client, name string) {},
+			statusName: true,
+		},
+		{
+			name: "keep key pair owned by another cluster",
+			setup: func(c *nffake.Client, name string) {
+				importTestKeyPair(t, c, name, "other")
+			},
+			statusName:    true,
+			wantRemaining: true,
+		},
+		{
+			name: "failed to delete key pair",
+			setup: func(c *nffake.Client, name string) {
+				importTestKeyPair(t, c, name, "test")
+				c.InjectError("DeleteKeyPair", nffake.NewError(nferrors.AuthFailure))
+			},
+			statusName:    true,
+			wantDeletes:   1,
+			wantRemaining: true,
+			wantErr:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := nffake.NewClient()
+			clusterScope := newKeyPairTestScope(t, client, &infrav1alpha3.SSHKeySpec{PublicKey: testPublicKey})
+			name := clusterScope.KeyPairName()
+			tt.setup(client, name)
+			if tt.statusName {
+				clusterScope.NifcloudCluster.Status.KeyPairName = name
+			}
+
+			s := NewService(clusterScope)
+			err := s.DeleteKeyPair()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Service.DeleteKeyPair() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := client.Calls("DeleteKeyPair"); got != tt.wantDeletes {
+				t.Errorf("expected %d deletes, got %d", tt.wantDeletes, got)
+			}
+			_, err = client.DescribeKeyPairs(context.TODO(), &computing.DescribeKeyPairsInput{KeyName: []string{name}})
+			if remaining := err == nil; remaining != tt.wantRemaining {
+				t.Errorf("expected key pair to remain %v, got %v", tt.wantRemaining, remaining)
+			}
+			if got := clusterScope.NifcloudCluster.Status.KeyPairName; (got != "") != tt.wantErr {
+				t.Errorf("unexpected key pair name %q in status", got)
+			}
+		})
+	}
+}
+
+func TestService_sshKeyName(t *testing.T) {
+	tests := []struct {
+		name        string
+		keyName     string
+		keyPairName string
+		want        string
+	}{
+		{
+			name:        "key name of the resource",
+			keyName:     "mykey",
+			keyPairName: "capikey",
+			want:        "mykey",
+		},
+		{
+			name:        "key pair of the cluster",
+			keyPairName: "capikey",
+			want:        "capikey",
+		},
+		{
+			name: "default key pair",
+			want: defaultSSHKeyName,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clusterScope := newKeyPairTestScope(t, nffake.NewClient(), nil)
+			clusterScope.NifcloudCluster.Status.KeyPairName = tt.keyPairName
+
+			s := NewService(clusterScope)
+			if got := s.sshKeyName(tt.keyName); got != tt.want {
+				t.Errorf("Service.sshKeyName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
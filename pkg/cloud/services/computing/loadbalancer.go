@@ -0,0 +1,362 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package computing
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+
+	"github.com/aokumasan/nifcloud-sdk-go-v2/nifcloud"
+	"github.com/aokumasan/nifcloud-sdk-go-v2/service/computing"
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
+	nferrors "github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/errors"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/cluster-api/util/record"
+)
+
+const (
+	maxResourceName            = 15
+	minResourceHash            = 6
+	loadBalancerRole           = "apiserver"
+	defaultNetworkVolume       = 10
+	defaultBalancingType       = 1
+	defaultHealthCheckInterval = 10
+	defaultUnhealthyThreshold  = 3
+)
+
+var nonAlphanumeric = regexp.MustCompile("[^a-zA-Z0-9]")
+
+// reconcileLoadBalancer makes sure that the load balancer in front of control plane exists
+func (s *Service) reconcileLoadBalancer() error {
+	s.scope.V(2).Info("Reconciling load balancer")
+
+	spec := s.getLoadBalancerSpec()
+	if spec.Name != "" {
+		return s.reconcileExistingLoadBalancer(spec.Name)
+	}
+
+	name := s.getLoadBalancerName()
+	if recorded := s.scope.Network().APIServerLoadBalancer; recorded != nil && !recorded.Unmanaged && recorded.Name != "" {
+		name = recorded.Name
+	}
+	lb, err := s.describeLoadBalancer(name)
+	if err != nil {
+		return err
+	}
+	if lb != nil && !s.isLoadBalancerOwned(lb) {
+		record.Warnf(s.scope.NifcloudCluster, "FailedReconcileLoadBalancer", "Load balancer %q exists but is not owned by the cluster", name)
+		return errors.Errorf("load balancer %q exists but is not owned by the cluster", name)
+	}
+	if lb == nil {
+		if err := s.createLoadBalancer(name, spec); err != nil {
+			return err
+		}
+		// the load balancer cannot be tagged, the status is the only record of its ownership
+		s.scope.Network().APIServerLoadBalancer = &infrav1alpha3.LoadBalancer{Name: name, Port: apiEndpointPort}
+		lb, err = s.describeLoadBalancer(name)
+		if err != nil {
+			return err
+		}
+		if lb == nil {
+			return errors.Errorf("load balancer %q is not found after creation", name)
+		}
+	}
+
+	want := s.getLoadBalancerHealthCheck(spec)
+	if lb.HealthCheck != want {
+		if err := s.configureHealthCheck(lb.Name, want); err != nil {
+			return err
+		}
+		lb.HealthCheck = want
+	}
+
+	s.scope.Network().APIServerLoadBalancer = lb
+	s.scope.NifcloudCluster.Spec.ControlPlaneEndpoint = infrav1alpha3.APIEndpoint{
+		Host: lb.DNSName,
+		Port: int32(lb.Port),
+	}
+
+	s.scope.V(2).Info("Reconcile load balancer completed successfully", "load-balancer", lb.Name, "dns-name", lb.DNSName)
+	return nil
+}
+
+// reconcileExistingLoadBalancer makes sure that the load balancer given in the spec exists,
+// its listener and health check are used as-is
+func (s *Service) reconcileExistingLoadBalancer(name string) error {
+	lb, err := s.describeLoadBalancer(name)
+	if err != nil {
+		return err
+	}
+	if lb == nil {
+		return errors.Errorf("load balancer %q listening on port %d is not found", name, apiEndpointPort)
+	}
+	lb.Unmanaged = true
+
+	s.scope.Network().APIServerLoadBalancer = lb
+	if s.scope.NifcloudCluster.Spec.ControlPlaneEndpoint.IsZero() {
+		s.scope.NifcloudCluster.Spec.ControlPlaneEndpoint = infrav1alpha3.APIEndpoint{
+			Host: lb.DNSName,
+			Port: int32(lb.Port),
+		}
+	}
+
+	s.scope.V(2).Info("Reconcile unmanaged load balancer completed successfully", "load-balancer", lb.Name, "dns-name", lb.DNSName)
+	return nil
+}
+
+// isLoadBalancerOwned reports whether the existing load balancer was created for the cluster.
+// A load balancer cannot be tagged, so it is owned only when it is recorded in the status,
+// one with the same name is never adopted
+func (s *Service) isLoadBalancerOwned(lb *infrav1alpha3.LoadBalancer) bool {
+	recorded := s.scope.Network().APIServerLoadBalancer
+	return recorded != nil && !recorded.Unmanaged && recorded.Name == lb.Name
+}
+
+// deleteLoadBalancer deletes the load balancer in front of control plane
+func (s *Service) deleteLoadBalancer() error {
+	lb := s.scope.Network().APIServerLoadBalancer
+	if lb == nil {
+		return nil
+	}
+	if lb.Unmanaged {
+		s.scope.V(2).Info("Skip deleting unmanaged load balancer", "load-balancer", lb.Name)
+		s.scope.Network().APIServerLoadBalancer = nil
+		return nil
+	}
+	s.scope.V(2).Info("Deleting load balancer", "load-balancer", lb.Name)
+
+	_, err := s.scope.NifcloudClients.Computing.DeleteLoadBalancer(context.TODO(), &computing.DeleteLoadBalancerInput{
+		LoadBalancerName: nifcloud.String(lb.Name),
+		LoadBalancerPort: nifcloud.Int64(lb.Port),
+		InstancePort:     nifcloud.Int64(lb.Port),
+	})
+	if err != nil && !nferrors.IsNotFound(err) {
+		record.Warnf(s.scope.NifcloudCluster, "FailedDeleteLoadBalancer", "Failed to delete load balancer %q: %v", lb.Name, err)
+		return errors.Wrapf(err, "failed to delete load balancer %q", lb.Name)
+	}
+	record.Eventf(s.scope.NifcloudCluster, "SuccessfulDeleteLoadBalancer", "Deleted load balancer %q", lb.Name)
+
+	s.scope.Network().APIServerLoadBalancer = nil
+	return nil
+}
+
+// RegisterInstanceWithLoadBalancer adds a control plane instance to balancing targets
+func (s *Service) RegisterInstanceWithLoadBalancer(instanceID string) error {
+	lb := s.scope.Network().APIServerLoadBalancer
+	if lb == nil {
+		return nferrors.NewFailedDependency(errors.New("load balancer is not available"))
+	}
+	// the status is not patched by the machine reconciler, so the current instances are described
+	current, err := s.describeLoadBalancer(lb.Name)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return nferrors.NewFailedDependency(errors.Errorf("load balancer %q is not found", lb.Name))
+	}
+	if hasInstance(current, instanceID) {
+		return nil
+	}
+
+	s.scope.V(2).Info("Registering instance with load balancer", "instance-id", instanceID, "load-balancer", lb.Name)
+	_, err = s.scope.NifcloudClients.Computing.RegisterInstancesWithLoadBalancer(context.TODO(), &computing.RegisterInstancesWithLoadBalancerInput{
+		LoadBalancerName: nifcloud.String(lb.Name),
+		LoadBalancerPort: nifcloud.Int64(lb.Port),
+		InstancePort:     nifcloud.Int64(lb.Port),
+		Instances: []computing.RequestInstancesStruct{
+			{InstanceId: nifcloud.String(instanceID)},
+		},
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to register instance %q with load balancer %q", instanceID, lb.Name)
+	}
+	return nil
+}
+
+// DeregisterInstanceFromLoadBalancer removes a control plane instance from balancing targets
+func (s *Service) DeregisterInstanceFromLoadBalancer(instanceID string) error {
+	lb := s.scope.Network().APIServerLoadBalancer
+	if lb == nil {
+		return nil
+	}
+
+	s.scope.V(2).Info("Deregistering instance from load balancer", "instance-id", instanceID, "load-balancer", lb.Name)
+	_, err := s.scope.NifcloudClients.Computing.DeregisterInstancesFromLoadBalancer(context.TODO(), &computing.DeregisterInstancesFromLoadBalancerInput{
+		LoadBalancerName: nifcloud.String(lb.Name),
+		LoadBalancerPort: nifcloud.Int64(lb.Port),
+		InstancePort:     nifcloud.Int64(lb.Port),
+		Instances: []computing.RequestInstancesStruct{
+			{InstanceId: nifcloud.String(instanceID)},
+		},
+	})
+	if err != nil && !nferrors.IsNotFound(err) {
+		return errors.Wrapf(err, "failed to deregister instance %q from load balancer %q", instanceID, lb.Name)
+	}
+	return nil
+}
+
+func (s *Service) createLoadBalancer(name string, spec *infrav1alpha3.LoadBalancerSpec) error {
+	volume := spec.NetworkVolume
+	if volume == 0 {
+		volume = defaultNetworkVolume
+	}
+	balancing := spec.BalancingType
+	if balancing == 0 {
+		balancing = defaultBalancingType
+	}
+
+	_, err := s.scope.NifcloudClients.Computing.CreateLoadBalancer(context.TODO(), &computing.CreateLoadBalancerInput{
+		LoadBalancerName:  nifcloud.String(name),
+		AvailabilityZones: []string{s.scope.NifcloudCluster.Spec.Zone},
+		NetworkVolume:     nifcloud.Int64(volume),
+		Listeners: []computing.RequestListenersStruct{
+			{
+				LoadBalancerPort: nifcloud.Int64(apiEndpointPort),
+				InstancePort:     nifcloud.Int64(apiEndpointPort),
+				BalancingType:    nifcloud.Int64(balancing),
+			},
+		},
+	})
+	if err != nil {
+		record.Warnf(s.scope.NifcloudCluster, "FailedCreateLoadBalancer", "Failed to create load balancer %q: %v", name, err)
+		return errors.Wrapf(err, "failed to create load balancer %q", name)
+	}
+	record.Eventf(s.scope.NifcloudCluster, "SuccessfulCreateLoadBalancer", "Created load balancer %q", name)
+	return nil
+}
+
+func (s *Service) configureHealthCheck(name string, hc infrav1alpha3.LoadBalancerHealthCheck) error {
+	_, err := s.scope.NifcloudClients.Computing.ConfigureHealthCheck(context.TODO(), &computing.ConfigureHealthCheckInput{
+		LoadBalancerName: nifcloud.String(name),
+		LoadBalancerPort: nifcloud.Int64(apiEndpointPort),
+		InstancePort:     nifcloud.Int64(apiEndpointPort),
+		HealthCheck: &computing.RequestHealthCheckStruct{
+			Target:             nifcloud.String(hc.Target),
+			Interval:           nifcloud.Int64(hc.Interval),
+			UnhealthyThreshold: nifcloud.Int64(hc.UnhealthyThreshold),
+		},
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to configure health check of load balancer %q", name)
+	}
+	s.scope.V(2).Info("Configured health check of load balancer", "load-balancer", name, "health-check", hc)
+	return nil
+}
+
+func (s *Service) describeLoadBalancer(name string) (*infrav1alpha3.LoadBalancer, error) {
+	out, err := s.scope.NifcloudClients.Computing.DescribeLoadBalancers(context.TODO(), &computing.DescribeLoadBalancersInput{
+		LoadBalancerNames: []computing.RequestLoadBalancerNamesStruct{
+			{
+				LoadBalancerName: nifcloud.String(name),
+				LoadBalancerPort: nifcloud.Int64(apiEndpointPort),
+				InstancePort:     nifcloud.Int64(apiEndpointPort),
+			},
+		},
+	})
+	switch {
+	case nferrors.IsNotFound(err):
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrapf(err, "failed to describe load balancer %q", name)
+	}
+
+	for _, v := range out.LoadBalancerDescriptions {
+		if nifcloud.StringValue(v.LoadBalancerName) != name {
+			continue
+		}
+		return loadBalancerFromSDKType(&v), nil
+	}
+	return nil, nil
+}
+
+func loadBalancerFromSDKType(v *computing.LoadBalancerDescriptionsMemberItem) *infrav1alpha3.LoadBalancer {
+	lb := &infrav1alpha3.LoadBalancer{
+		Name:    nifcloud.StringValue(v.LoadBalancerName),
+		DNSName: nifcloud.StringValue(v.DNSName),
+		Port:    apiEndpointPort,
+	}
+	if v.HealthCheck != nil {
+		lb.HealthCheck = infrav1alpha3.LoadBalancerHealthCheck{
+			Target:             nifcloud.StringValue(v.HealthCheck.Target),
+			Interval:           nifcloud.Int64Value(v.HealthCheck.Interval),
+			UnhealthyThreshold: nifcloud.Int64Value(v.HealthCheck.UnhealthyThreshold),
+		}
+	}
+	for _, i := range v.Instances {
+		lb.Instances = append(lb.Instances, nifcloud.StringValue(i.InstanceId))
+	}
+	return lb
+}
+
+func (s *Service) getLoadBalancerSpec() *infrav1alpha3.LoadBalancerSpec {
+	if s.scope.NifcloudCluster.Spec.ControlPlaneLoadBalancer == nil {
+		return &infrav1alpha3.LoadBalancerSpec{}
+	}
+	return s.scope.NifcloudCluster.Spec.ControlPlaneLoadBalancer
+}
+
+func (s *Service) getLoadBalancerHealthCheck(spec *infrav1alpha3.LoadBalancerSpec) infrav1alpha3.LoadBalancerHealthCheck {
+	hc := infrav1alpha3.LoadBalancerHealthCheck{
+		Target:             fmt.Sprintf("TCP:%d", apiEndpointPort),
+		Interval:           defaultHealthCheckInterval,
+		UnhealthyThreshold: defaultUnhealthyThreshold,
+	}
+	if spec.HealthCheck == nil {
+		return hc
+	}
+	if spec.HealthCheck.Target != "" {
+		hc.Target = spec.HealthCheck.Target
+	}
+	if spec.HealthCheck.Interval != 0 {
+		hc.Interval = spec.HealthCheck.Interval
+	}
+	if spec.HealthCheck.UnhealthyThreshold != 0 {
+		hc.UnhealthyThreshold = spec.HealthCheck.UnhealthyThreshold
+	}
+	return hc
+}
+
+// getLoadBalancerName returns the name of load balancer which only accepts alphanumeric characters
+func (s *Service) getLoadBalancerName() string {
+	return s.getResourceName(loadBalancerRole)
+}
+
+// getResourceName returns the alphanumeric name of the cluster resource for the role,
+// the cluster name is shortened to keep the hash of the namespace, the name and the role,
+// otherwise the roles and the clusters sharing a long prefix get the same name
+func (s *Service) getResourceName(role string) string {
+	prefix := nonAlphanumeric.ReplaceAllString(s.scope.Name(), "")
+	if len(prefix) > maxResourceName-minResourceHash {
+		prefix = prefix[:maxResourceName-minResourceHash]
+	}
+	hashed := md5.Sum([]byte(s.scope.Cluster.Namespace + "/" + s.scope.Name() + "/" + role))
+	tmp := fmt.Sprintf("%s%v", prefix, hex.EncodeToString(hashed[:]))
+	return tmp[:maxResourceName]
+}
+
+// hasInstance returns whether the instance is registered with the load balancer
+func hasInstance(lb *infrav1alpha3.LoadBalancer, instanceID string) bool {
+	for _, id := range lb.Instances {
+		if id == instanceID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,296 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package computing
+
+import (
+	"testing"
+
+	"github.com/aokumasan/nifcloud-sdk-go-v2/nifcloud"
+	"github.com/aokumasan/nifcloud-sdk-go-v2/service/computing"
+	"github.com/golang/mock/gomock"
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
+	nferrors "github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/errors"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/mock_client"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/scope"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+)
+
+func TestService_reconcileLoadBalancer(t *testing.T) {
+	lbName := NewService(&scope.ClusterScope{
+		Cluster: &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster"}},
+	}).getLoadBalancerName()
+	describeOutput := func(name string, interval int64) *computing.DescribeLoadBalancersOutput {
+		return &computing.DescribeLoadBalancersOutput{
+			LoadBalancerDescriptions: []computing.LoadBalancerDescriptionsMemberItem{
+				{
+					LoadBalancerName: nifcloud.String(name),
+					DNSName:          nifcloud.String("203.0.113.10"),
+					HealthCheck: &computing.HealthCheck{
+						Target:             nifcloud.String("TCP:6443"),
+						Interval:           nifcloud.Int64(interval),
+						UnhealthyThreshold: nifcloud.Int64(3),
+					},
+					Instances: []computing.InstancesMemberItem{
+						{InstanceId: nifcloud.String("cp0")},
+					},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name          string
+		spec          *infrav1alpha3.LoadBalancerSpec
+		status        *infrav1alpha3.LoadBalancer
+		expect        func(m *mock_client.MockClientMockRecorder)
+		wantUnmanaged bool
+		wantErr       bool
+	}{
+		{
+			name: "create load balancer when it does not exist",
+			spec: &infrav1alpha3.LoadBalancerSpec{},
+			expect: func(m *mock_client.MockClientMockRecorder) {
+				gomock.InOrder(
+					m.DescribeLoadBalancers(gomock.Any(), gomock.Any()).
+						Return(nil, nferrors.NewNotFound(errors.New("not found"))),
+					m.CreateLoadBalancer(gomock.Any(), gomock.Any()).
+						Return(&computing.CreateLoadBalancerOutput{DNSName: nifcloud.String("203.0.113.10")}, nil),
+					m.DescribeLoadBalancers(gomock.Any(), gomock.Any()).
+						Return(describeOutput(lbName, 10), nil),
+				)
+			},
+		},
+		{
+			name: "configure health check which differs from spec",
+			spec: &infrav1alpha3.LoadBalancerSpec{
+				HealthCheck: &infrav1alpha3.LoadBalancerHealthCheck{Interval: 30},
+			},
+			status: &infrav1alpha3.LoadBalancer{Name: lbName, Port: apiEndpointPort},
+			expect: func(m *mock_client.MockClientMockRecorder) {
+				m.DescribeLoadBalancers(gomock.Any(), gomock.Any()).
+					Return(describeOutput(lbName, 10), nil)
+				m.ConfigureHealthCheck(gomock.Any(), gomock.Any()).
+					Return(&computing.ConfigureHealthCheckOutput{}, nil)
+			},
+		},
+		{
+			name: "load balancer with the same name serving other instances",
+			spec: &infrav1alpha3.LoadBalancerSpec{},
+			expect: func(m *mock_client.MockClientMockRecorder) {
+				m.DescribeLoadBalancers(gomock.Any(), gomock.Any()).
+					Return(describeOutput(lbName, 10), nil)
+			},
+			wantErr: true,
+		},
+		{
+			name: "load balancer with the same name which is not recorded in status",
+			spec: &infrav1alpha3.LoadBalancerSpec{},
+			expect: func(m *mock_client.MockClientMockRecorder) {
+				out := describeOutput(lbName, 10)
+				out.LoadBalancerDescriptions[0].Instances = nil
+				m.DescribeLoadBalancers(gomock.Any(), gomock.Any()).Return(out, nil)
+			},
+			wantErr: true,
+		},
+		{
+			name: "use existing load balancer as-is",
+			spec: &infrav1alpha3.LoadBalancerSpec{Name: "existinglb"},
+			expect: func(m *mock_client.MockClientMockRecorder) {
+				m.DescribeLoadBalancers(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ interface{}, input *computing.DescribeLoadBalancersInput) (*computing.DescribeLoadBalancersOutput, error) {
+						if name := nifcloud.StringValue(input.LoadBalancerNames[0].LoadBalancerName); name != "existinglb" {
+							t.Errorf("unexpected load balancer is described: %s", name)
+						}
+						// the health check differs from the default, but it is not configured
+						return describeOutput("existinglb", 30), nil
+					})
+			},
+			wantUnmanaged: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			mockSvc := mock_client.NewMockClient(mockCtrl)
+
+			scope, err := scope.NewClusterScope(scope.ClusterScopeParams{
+				Cluster: &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster"}},
+				NifcloudClients: scope.NifcloudClients{
+					Computing: mockSvc,
+				},
+				NifcloudCluster: &infrav1alpha3.NifcloudCluster{
+					Spec: infrav1alpha3.NifcloudClusterSpec{
+						ControlPlaneLoadBalancer: tt.spec,
+					},
+				},
+			})
+			if err != nil {
+				t.Fatalf("Failed to create test context: %v", err)
+			}
+			scope.Network().APIServerLoadBalancer = tt.status
+
+			tt.expect(mockSvc.EXPECT())
+
+			service := NewService(scope)
+			err = service.reconcileLoadBalancer()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("did not expect error: %v", err)
+			}
+			endpoint := scope.NifcloudCluster.Spec.ControlPlaneEndpoint
+			if endpoint.Host != "203.0.113.10" || endpoint.Port != 6443 {
+				t.Errorf("unexpected control plane endpoint: %+v", endpoint)
+			}
+			if lb := scope.Network().APIServerLoadBalancer; lb == nil || len(lb.Instances) != 1 || lb.Unmanaged != tt.wantUnmanaged {
+				t.Errorf("unexpected load balancer status: %+v", lb)
+			}
+		})
+	}
+}
+
+func TestService_RegisterInstanceWithLoadBalancer(t *testing.T) {
+	describeOutput := func(instances ...string) *computing.DescribeLoadBalancersOutput {
+		lb := computing.LoadBalancerDescriptionsMemberItem{LoadBalancerName: nifcloud.String("lb")}
+		for _, id := range instances {
+			lb.Instances = append(lb.Instances, computing.InstancesMemberItem{InstanceId: nifcloud.String(id)})
+		}
+		return &computing.DescribeLoadBalancersOutput{LoadBalancerDescriptions: []computing.LoadBalancerDescriptionsMemberItem{lb}}
+	}
+
+	tests := []struct {
+		name    string
+		expect  func(m *mock_client.MockClientMockRecorder)
+		wantErr bool
+	}{
+		{
+			name: "register instance which is not a target",
+			expect: func(m *mock_client.MockClientMockRecorder) {
+				gomock.InOrder(
+					m.DescribeLoadBalancers(gomock.Any(), gomock.Any()).Return(describeOutput("cp0"), nil),
+					m.RegisterInstancesWithLoadBalancer(gomock.Any(), gomock.Any()).
+						Return(&computing.RegisterInstancesWithLoadBalancerOutput{}, nil),
+				)
+			},
+		},
+		{
+			name: "skip instance which is already a target even if the status does not know it",
+			expect: func(m *mock_client.MockClientMockRecorder) {
+				m.DescribeLoadBalancers(gomock.Any(), gomock.Any()).Return(describeOutput("cp0", "cp1"), nil)
+			},
+		},
+		{
+			name: "load balancer disappears",
+			expect: func(m *mock_client.MockClientMockRecorder) {
+				m.DescribeLoadBalancers(gomock.Any(), gomock.Any()).
+					Return(nil, nferrors.NewNotFound(errors.New("not found")))
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			mockSvc := mock_client.NewMockClient(mockCtrl)
+
+			scope, err := scope.NewClusterScope(scope.ClusterScopeParams{
+				Cluster:         &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster"}},
+				NifcloudClients: scope.NifcloudClients{Computing: mockSvc},
+				NifcloudCluster: &infrav1alpha3.NifcloudCluster{},
+			})
+			if err != nil {
+				t.Fatalf("Failed to create test context: %v", err)
+			}
+			// the status of the machine's cluster scope is stale
+			scope.Network().APIServerLoadBalancer = &infrav1alpha3.LoadBalancer{Name: "lb", Port: apiEndpointPort, Instances: []string{"cp0"}}
+			tt.expect(mockSvc.EXPECT())
+
+			err = NewService(scope).RegisterInstanceWithLoadBalancer("cp1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestService_getLoadBalancerName(t *testing.T) {
+	scope, err := scope.NewClusterScope(scope.ClusterScopeParams{
+		Cluster:         &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "my-cluster"}},
+		NifcloudClients: scope.NifcloudClients{Computing: mock_client.NewMockClient(gomock.NewController(t))},
+		NifcloudCluster: &infrav1alpha3.NifcloudCluster{},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create test context: %v", err)
+	}
+
+	got := NewService(scope).getLoadBalancerName()
+	if len(got) != maxResourceName {
+		t.Errorf("length of %q is not %d", got, maxResourceName)
+	}
+	if nonAlphanumeric.MatchString(got) {
+		t.Errorf("%q contains non alphanumeric characters", got)
+	}
+}
+
+func TestService_getResourceName(t *testing.T) {
+	name := func(namespace, clusterName, role string) string {
+		return NewService(&scope.ClusterScope{
+			Cluster: &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: clusterName, Namespace: namespace}},
+		}).getResourceName(role)
+	}
+
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{
+			name: "roles of a cluster with a long name",
+			a:    name("default", "averylongclustername", loadBalancerRole),
+			b:    name("default", "averylongclustername", privateLANRole),
+		},
+		{
+			name: "clusters sharing a long prefix",
+			a:    name("default", "averylongclustername-a", routerRole),
+			b:    name("default", "averylongclustername-b", routerRole),
+		},
+		{
+			name: "clusters with the same name in different namespaces",
+			a:    name("default", "test-cluster", routerRole),
+			b:    name("other", "test-cluster", routerRole),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.a == tt.b {
+				t.Errorf("resource names collide: %q", tt.a)
+			}
+			for _, n := range []string{tt.a, tt.b} {
+				if len(n) != maxResourceName || nonAlphanumeric.MatchString(n) {
+					t.Errorf("%q is not an alphanumeric name of %d characters", n, maxResourceName)
+				}
+			}
+		})
+	}
+}
@@ -21,14 +21,16 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"fmt"
+	"net"
 
 	"github.com/aokumasan/nifcloud-sdk-go-v2/nifcloud"
 	"github.com/aokumasan/nifcloud-sdk-go-v2/service/computing"
 	"github.com/chyeh/pubip"
 	"github.com/pkg/errors"
-	infrav1alpha2 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha2"
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
 	nferrors "github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/errors"
 	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/services/wait"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/conditions"
 	"go.uber.org/multierr"
 	"sigs.k8s.io/cluster-api/util/record"
 )
@@ -37,11 +39,15 @@ const (
 	IPProtocolTCP        = "TCP"
 	IPProtocolUDP        = "UDP"
 	maxSecurityGroupName = 15
+	minSecurityGroupHash = 6
 	anyIPv4CidrBlock     = "0.0.0.0/0"
 	apiEndpointPort      = 6443
 	endPoint             = "ENDPOINT"
 )
 
+// publicIP looks up the public IP of the controller, replaced in tests
+var publicIP = pubip.Get
+
 type SecurityGroupRole struct {
 	Cluster string `json:"cluster"`
 	Role    string `json:"role"`
@@ -50,11 +56,23 @@ type SecurityGroupRole struct {
 func (s *Service) ReconcileNetwork() error {
 	s.scope.V(2).Info("Reconciling network for cluster", "cluster-name", s.scope.Cluster.Name, "cluster-namespace", s.scope.Cluster.Namespace)
 
-	if err := s.reconcileSecurityGroups(); err != nil {
+	if err := s.reconcilePrivateLAN(); err != nil {
+		return err
+	}
+
+	if err := s.reconcileRouter(); err != nil {
 		return err
 	}
 
+	// endpoint goes first because ingress rules may refer to the load balancer address
 	if err := s.reconcileEndpoint(apiEndpointPort); err != nil {
+		conditions.MarkFalse(s.scope.NifcloudCluster, infrav1alpha3.EndpointReadyCondition,
+			infrav1alpha3.EndpointAllocationFailedReason, infrav1alpha3.ConditionSeverityError, "%v", err)
+		return err
+	}
+	conditions.MarkTrue(s.scope.NifcloudCluster, infrav1alpha3.EndpointReadyCondition)
+
+	if err := s.reconcileSecurityGroups(); err != nil {
 		return err
 	}
 
@@ -65,6 +83,15 @@ func (s *Service) ReconcileNetwork() error {
 func (s *Service) DeleteNetwork() error {
 	s.scope.V(2).Info("Deleting network")
 
+	// router holds the private LAN, so it has to be deleted first
+	if err := s.deleteRouter(); err != nil {
+		return err
+	}
+
+	if err := s.deletePrivateLAN(); err != nil {
+		return err
+	}
+
 	if err := s.deleteSecurityGroups(); err != nil {
 		return err
 	}
@@ -76,6 +103,19 @@ func (s *Service) DeleteNetwork() error {
 func (s *Service) DeleteEndpoint() error {
 	s.scope.V(2).Info("Delete Endpoint")
 
+	if s.scope.Network().APIServerLoadBalancer != nil {
+		if err := s.deleteLoadBalancer(); err != nil {
+			return err
+		}
+		s.scope.V(2).Info("Delete endpoint completed successfully")
+		return nil
+	}
+
+	if addr := s.scope.Network().EndpointAddress; (addr != nil && addr.Unmanaged) || s.scope.NifcloudCluster.Spec.NetworkSpec.EndpointIP != "" {
+		s.scope.V(2).Info("Skip releasing unmanaged endpoint IP", "public-ip", s.scope.NifcloudCluster.Spec.ControlPlaneEndpoint.Host)
+		return nil
+	}
+
 	if err := s.releaseAddress(); err != nil {
 		return err
 	}
@@ -88,26 +128,38 @@ func (s *Service) reconcileSecurityGroups() error {
 	s.scope.V(2).Info("Reconciling security groups")
 
 	if s.scope.Network().SecurityGroups == nil {
-		s.scope.Network().SecurityGroups = make(map[infrav1alpha2.SecurityGroupRole]infrav1alpha2.SecurityGroup)
+		s.scope.Network().SecurityGroups = make(map[infrav1alpha3.SecurityGroupRole]infrav1alpha3.SecurityGroup)
 	}
 
-	sgs, err := s.describeSecurityGroupsByName()
-	if err != nil {
-		return err
-	}
 	// security group roles to handle with reconciliation loop
-	roles := []infrav1alpha2.SecurityGroupRole{
-		infrav1alpha2.SecurityGroupControlPlane,
+	roles := s.securityGroupRoles()
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, s.securityGroupNameForRole(role))
+	}
+	sgs, err := s.describeSecurityGroupsByName(names)
+	if err != nil {
+		return s.securityGroupsFailed(infrav1alpha3.SecurityGroupReconciliationFailedReason, err)
 	}
 	// make sure that security groups are valid or created
 	for _, role := range roles {
 		sg := s.getDefaultSecurityGroup(role)
 		exists, ok := sgs[*sg.GroupName]
+		_, unmanaged := s.scope.NifcloudCluster.Spec.NetworkSpec.SecurityGroupOverrides[role]
+		if unmanaged {
+			if !ok {
+				err := errors.Errorf("security group %q given for role %q is not found", *sg.GroupName, role)
+				return s.securityGroupsFailed(infrav1alpha3.SecurityGroupReconciliationFailedReason, err)
+			}
+			exists.Unmanaged = true
+			s.scope.SecurityGroups()[role] = exists
+			continue
+		}
 		if !ok {
 			if err := s.createSecurityGroupWithTag(role, sg); err != nil {
-				return err
+				return s.securityGroupsFailed(infrav1alpha3.SecurityGroupReconciliationFailedReason, err)
 			}
-			s.scope.SecurityGroups()[role] = infrav1alpha2.SecurityGroup{
+			s.scope.SecurityGroups()[role] = infrav1alpha3.SecurityGroup{
 				Name: *sg.GroupName,
 			}
 			s.scope.V(2).Info("Created security group for role", "role", role, "security-group", s.scope.SecurityGroups()[role])
@@ -118,12 +170,15 @@ func (s *Service) reconcileSecurityGroups() error {
 	}
 
 	// update security group to attouch ingress rules
-	for i := range s.scope.SecurityGroups() {
-		sg := s.scope.SecurityGroups()[i]
+	for _, role := range roles {
+		sg := s.scope.SecurityGroups()[role]
+		if sg.Unmanaged {
+			continue
+		}
 		current := sg.IngressRules
-		want, err := s.getSecurityGroupIngressRules(i)
+		want, err := s.getSecurityGroupIngressRules(role)
 		if err != nil {
-			return err
+			return s.securityGroupsFailed(infrav1alpha3.IngressRulesAuthorizationFailedReason, err)
 		}
 
 		toRevoke := current.Difference(want)
@@ -134,7 +189,8 @@ func (s *Service) reconcileSecurityGroups() error {
 				}
 				return true, nil
 			}, nferrors.SecurityGroupProcessing); err != nil {
-				return errors.Wrapf(err, "failed to revoke security group ingress rules for %q", sg.Name)
+				return s.securityGroupsFailed(infrav1alpha3.IngressRulesAuthorizationFailedReason,
+					errors.Wrapf(err, "failed to revoke security group ingress rules for %q", sg.Name))
 			}
 
 			s.scope.V(2).Info("revoked ingress rules from security group", "revoked-ingress-rules", toRevoke, "security-group-name", sg.Name)
@@ -147,48 +203,187 @@ func (s *Service) reconcileSecurityGroups() error {
 				}
 				return true, nil
 			}, nferrors.SecurityGroupProcessing); err != nil {
-				return err
+				return s.securityGroupsFailed(infrav1alpha3.IngressRulesAuthorizationFailedReason,
+					errors.Wrapf(err, "failed to authorize security group ingress rules for %q", sg.Name))
 			}
 
 			s.scope.V(2).Info("Authorized ingress rules in security group", "authorized-ingress-rules", toAuthorize, "security-group-name", sg.Name)
 		}
 	}
 
+	conditions.MarkTrue(s.scope.NifcloudCluster, infrav1alpha3.SecurityGroupsReadyCondition)
 	return nil
 }
 
+// securityGroupsFailed reports the failure in the condition of the cluster and returns the error
+func (s *Service) securityGroupsFailed(reason string, err error) error {
+	conditions.MarkFalse(s.scope.NifcloudCluster, infrav1alpha3.SecurityGroupsReadyCondition,
+		reason, infrav1alpha3.ConditionSeverityError, "%v", err)
+	return err
+}
+
 func (s *Service) reconcileEndpoint(endpointPort int) error {
 	s.scope.V(2).Info("Reconcile API endpoint")
 
+	if s.scope.NifcloudCluster.Spec.ControlPlaneLoadBalancer != nil {
+		return s.reconcileLoadBalancer()
+	}
+
+	if ip := s.scope.NifcloudCluster.Spec.NetworkSpec.EndpointIP; ip != "" {
+		return s.reconcileExistingAddress(ip, endpointPort)
+	}
+
 	ip, err := s.getOrAllocateAddress(endPoint)
 	if err != nil {
 		return fmt.Errorf("failed to create IP addres: %w", err)
 	}
 
-	if len(s.scope.NifcloudCluster.Status.APIEndpoints) == 0 {
-		s.scope.NifcloudCluster.Status.APIEndpoints = []infrav1alpha2.APIEndpoint{
-			{
-				Host: ip,
-				Port: int32(endpointPort),
-			},
+	if s.scope.NifcloudCluster.Spec.ControlPlaneEndpoint.IsZero() {
+		s.scope.NifcloudCluster.Spec.ControlPlaneEndpoint = infrav1alpha3.APIEndpoint{
+			Host: ip,
+			Port: int32(endpointPort),
 		}
 	}
 
 	return nil
 }
 
+// reconcileExistingAddress makes sure that the public IP given in the spec exists and uses it as the endpoint
+func (s *Service) reconcileExistingAddress(ip string, endpointPort int) error {
+	addr, err := s.describeAddress(ip)
+	if err != nil {
+		return err
+	}
+	if addr == nil {
+		return fmt.Errorf("endpoint IP %q is not found", ip)
+	}
+
+	s.scope.Network().EndpointAddress = &infrav1alpha3.Address{PublicIP: ip, Unmanaged: true}
+	if s.scope.NifcloudCluster.Spec.ControlPlaneEndpoint.IsZero() {
+		s.scope.NifcloudCluster.Spec.ControlPlaneEndpoint = infrav1alpha3.APIEndpoint{
+			Host: ip,
+			Port: int32(endpointPort),
+		}
+	}
+	return nil
+}
+
+// getOrAllocateAddress returns the address owned by the cluster for the role,
+// the ownership is kept as tags in the description of the address
 func (s *Service) getOrAllocateAddress(role string) (string, error) {
-	out, err := s.scope.NifcloudClients.Computing.DescribeAddresses(context.TODO(), nil)
+	// the address recorded in the status
+	if addr := s.scope.Network().EndpointAddress; addr != nil {
+		if err := s.ensureAddressOwned(addr.PublicIP, role); err != nil {
+			return "", err
+		}
+		return addr.PublicIP, nil
+	}
+
+	// the endpoint of clusters created before the address was recorded in the status
+	if host := s.scope.NifcloudCluster.Spec.ControlPlaneEndpoint.Host; host != "" {
+		if err := s.ensureAddressOwned(host, role); err != nil {
+			return "", err
+		}
+		s.scope.Network().EndpointAddress = &infrav1alpha3.Address{PublicIP: host}
+		return host, nil
+	}
+
+	// the address tagged in a previous reconciliation which failed to update the status
+	ip, err := s.findOwnedAddress(role)
+	if err != nil {
+		return "", err
+	}
+	if ip != "" {
+		s.scope.Network().EndpointAddress = &infrav1alpha3.Address{PublicIP: ip}
+		return ip, nil
+	}
+
+	ip, err = s.allocateAddress(role)
+	if err != nil {
+		return "", err
+	}
+	// record the address before tagging it, so that it is not leaked when tagging fails
+	s.scope.Network().EndpointAddress = &infrav1alpha3.Address{PublicIP: ip}
+	if err := s.tagAddress(ip, role); err != nil {
+		return "", err
+	}
+	record.Eventf(s.scope.NifcloudCluster, "SuccessfulAllocateAddress", "Allocated address %q for role %q", ip, role)
+
+	return ip, nil
+}
+
+// ensureAddressOwned makes sure that the address exists and is tagged for the cluster,
+// addresses which belong to other clusters are never taken over
+func (s *Service) ensureAddressOwned(ip, role string) error {
+	addr, err := s.describeAddress(ip)
+	if err != nil {
+		return err
+	}
+	if addr == nil {
+		return fmt.Errorf("address %q of the cluster is not found", ip)
+	}
+
+	tags := infrav1alpha3.ParseTags(nifcloud.StringValue(addr.Description))
+	if tags.IsOwnedBy(s.scope.Name(), role) {
+		return nil
+	}
+	if owner, ok := tags["cluster"]; ok && owner != s.scope.Name() {
+		return fmt.Errorf("address %q is owned by cluster %q", ip, owner)
+	}
+	return s.tagAddress(ip, role)
+}
+
+// findOwnedAddress looks up the address tagged for the cluster, it returns empty string if not found
+func (s *Service) findOwnedAddress(role string) (string, error) {
+	out, err := s.scope.NifcloudClients.Computing.DescribeAddresses(context.TODO(), &computing.DescribeAddressesInput{})
 	if err != nil {
 		return "", fmt.Errorf("failed to describe address: %w", err)
 	}
 
 	for _, addr := range out.AddressesSet {
-		if addr.PublicIp != nil {
+		if addr.PublicIp == nil {
+			continue
+		}
+		if infrav1alpha3.ParseTags(nifcloud.StringValue(addr.Description)).IsOwnedBy(s.scope.Name(), role) {
 			return nifcloud.StringValue(addr.PublicIp), nil
 		}
 	}
-	return s.allocateAddress(role)
+	return "", nil
+}
+
+// describeAddress returns the address which has the public IP, or nil if not found
+func (s *Service) describeAddress(ip string) (*computing.AddressesSetItem, error) {
+	out, err := s.scope.NifcloudClients.Computing.DescribeAddresses(context.TODO(), &computing.DescribeAddressesInput{
+		PublicIp: []string{ip},
+	})
+	if err != nil && !nferrors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to describe address %q: %w", ip, err)
+	}
+	if out == nil {
+		return nil, nil
+	}
+	for i := range out.AddressesSet {
+		if nifcloud.StringValue(out.AddressesSet[i].PublicIp) == ip {
+			return &out.AddressesSet[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// tagAddress writes the ownership of the cluster into the description of the address
+func (s *Service) tagAddress(ip, role string) error {
+	tags := infrav1alpha3.BuildTags(infrav1alpha3.BuildParams{
+		ClusterName: s.scope.Name(),
+		Role:        nifcloud.String(role),
+	})
+	if _, err := s.scope.NifcloudClients.Computing.NiftyModifyAddressAttribute(context.TODO(), &computing.NiftyModifyAddressAttributeInput{
+		PublicIp:  nifcloud.String(ip),
+		Attribute: nifcloud.String("description"),
+		Value:     tags.ConvToString(),
+	}); err != nil {
+		return fmt.Errorf("failed to tag address %q: %w", ip, err)
+	}
+	return nil
 }
 
 func (s *Service) allocateAddress(role string) (string, error) {
@@ -205,20 +400,42 @@ func (s *Service) allocateAddress(role string) (string, error) {
 	return *out.PublicIp, nil
 }
 
+// releaseAddress releases the endpoint address only if it is owned by the cluster
 func (s *Service) releaseAddress() error {
-	for _, e := range s.scope.NifcloudCluster.Status.APIEndpoints {
-		params := &computing.ReleaseAddressInput{
-			PublicIp: &e.Host,
-		}
-		if _, err := s.scope.NifcloudClients.Computing.ReleaseAddress(context.TODO(), params); err != nil {
-			return err
-		}
+	ip := s.scope.NifcloudCluster.Spec.ControlPlaneEndpoint.Host
+	if addr := s.scope.Network().EndpointAddress; addr != nil {
+		ip = addr.PublicIP
+	}
+	if ip == "" {
+		return nil
+	}
+
+	addr, err := s.describeAddress(ip)
+	if err != nil {
+		return err
+	}
+	if addr == nil || !infrav1alpha3.ParseTags(nifcloud.StringValue(addr.Description)).IsOwnedBy(s.scope.Name(), endPoint) {
+		s.scope.V(2).Info("Skip releasing address which is not owned by the cluster", "public-ip", ip)
+		s.scope.Network().EndpointAddress = nil
+		return nil
+	}
+
+	params := &computing.ReleaseAddressInput{
+		PublicIp: nifcloud.String(ip),
 	}
+	if _, err := s.scope.NifcloudClients.Computing.ReleaseAddress(context.TODO(), params); err != nil {
+		return err
+	}
+	record.Eventf(s.scope.NifcloudCluster, "SuccessfulReleaseAddress", "Released address %q", ip)
+	s.scope.Network().EndpointAddress = nil
 	return nil
 }
 
 func (s *Service) deleteSecurityGroups() error {
 	for _, sg := range s.scope.SecurityGroups() {
+		if sg.Unmanaged {
+			continue
+		}
 		current := sg.IngressRules
 		if err := s.revokeSecurityGroupIngressRules(sg.Name, current); nferrors.IsIgnorableSecurityGroupError(err) != nil {
 			return err
@@ -228,6 +445,10 @@ func (s *Service) deleteSecurityGroups() error {
 
 	var errs error
 	for _, sg := range s.scope.SecurityGroups() {
+		if sg.Unmanaged {
+			s.scope.V(2).Info("Skip deleting unmanaged security group", "security-group-name", sg.Name)
+			continue
+		}
 		if err := s.deleteSecurityGroup(&sg); err != nil {
 			errs = multierr.Append(errs, err)
 		}
@@ -236,7 +457,7 @@ func (s *Service) deleteSecurityGroups() error {
 	return errs
 }
 
-func (s *Service) deleteSecurityGroup(sg *infrav1alpha2.SecurityGroup) error {
+func (s *Service) deleteSecurityGroup(sg *infrav1alpha3.SecurityGroup) error {
 	input := &computing.DeleteSecurityGroupInput{
 		GroupName: nifcloud.String(sg.Name),
 	}
@@ -249,12 +470,12 @@ func (s *Service) deleteSecurityGroup(sg *infrav1alpha2.SecurityGroup) error {
 	return nil
 }
 
-func (s *Service) describeSecurityGroupsByName() (map[string]infrav1alpha2.SecurityGroup, error) {
+func (s *Service) describeSecurityGroupsByName(names []string) (map[string]infrav1alpha3.SecurityGroup, error) {
 	input := &computing.DescribeSecurityGroupsInput{
 		Filter: []computing.RequestFilterStruct{
 			computing.RequestFilterStruct{
 				Name:         nifcloud.String("group-name"),
-				RequestValue: []string{s.scope.Name()},
+				RequestValue: names,
 			},
 		},
 	}
@@ -263,9 +484,9 @@ func (s *Service) describeSecurityGroupsByName() (map[string]infrav1alpha2.Secur
 		return nil, errors.Wrap(err, "failed to describe security groups")
 	}
 
-	res := make(map[string]infrav1alpha2.SecurityGroup)
+	res := make(map[string]infrav1alpha3.SecurityGroup)
 	for _, sgi := range out.SecurityGroupInfo {
-		sg := infrav1alpha2.SecurityGroup{
+		sg := infrav1alpha3.SecurityGroup{
 			ID:   *sgi.OwnerId,
 			Name: *sgi.GroupName,
 		}
@@ -277,7 +498,7 @@ func (s *Service) describeSecurityGroupsByName() (map[string]infrav1alpha2.Secur
 	return res, nil
 }
 
-func (s *Service) createSecurityGroupWithTag(role infrav1alpha2.SecurityGroupRole, input *computing.SecurityGroupInfoSetItem) error {
+func (s *Service) createSecurityGroupWithTag(role infrav1alpha3.SecurityGroupRole, input *computing.SecurityGroupInfoSetItem) error {
 	_, err := s.scope.NifcloudClients.Computing.CreateSecurityGroup(context.TODO(), &computing.CreateSecurityGroupInput{
 		GroupName:        input.GroupName,
 		GroupDescription: nifcloud.String(fmt.Sprintf("{\"cluster\":\"%s\",\"role\":\"%s\"}", s.scope.Name(), role)),
@@ -291,20 +512,46 @@ func (s *Service) createSecurityGroupWithTag(role infrav1alpha2.SecurityGroupRol
 	return nil
 }
 
-func (s *Service) getSecurityGroupName(clusterName string, role infrav1alpha2.SecurityGroupRole) string {
+// getSecurityGroupName returns the name of the security group for the role
+// the cluster name is shortened to keep the role hash, otherwise every role gets the same name
+func (s *Service) getSecurityGroupName(clusterName string, role infrav1alpha3.SecurityGroupRole) string {
+	if len(clusterName) > maxSecurityGroupName-minSecurityGroupHash {
+		clusterName = clusterName[:maxSecurityGroupName-minSecurityGroupHash]
+	}
 	hashed := md5.Sum([]byte(role))
 	tmp := fmt.Sprintf("%s%v", clusterName, hex.EncodeToString(hashed[:]))
 	return tmp[:maxSecurityGroupName]
 }
 
-func (s *Service) getDefaultSecurityGroup(role infrav1alpha2.SecurityGroupRole) *computing.SecurityGroupInfoSetItem {
-	name := s.getSecurityGroupName(s.scope.Name(), role)
+// securityGroupNameForRole returns the name of the existing security group given for the role,
+// or the name of the security group which the controller manages
+func (s *Service) securityGroupNameForRole(role infrav1alpha3.SecurityGroupRole) string {
+	if name := s.scope.NifcloudCluster.Spec.NetworkSpec.SecurityGroupOverrides[role]; name != "" {
+		return name
+	}
+	return s.getSecurityGroupName(s.scope.Name(), role)
+}
+
+// securityGroupRoles returns the roles of the security groups which the cluster needs
+func (s *Service) securityGroupRoles() []infrav1alpha3.SecurityGroupRole {
+	roles := []infrav1alpha3.SecurityGroupRole{
+		infrav1alpha3.SecurityGroupControlPlane,
+		infrav1alpha3.SecurityGroupNode,
+	}
+	if s.scope.NifcloudCluster.Spec.Bastion.Enabled {
+		roles = append(roles, infrav1alpha3.SecurityGroupBastion)
+	}
+	return roles
+}
+
+func (s *Service) getDefaultSecurityGroup(role infrav1alpha3.SecurityGroupRole) *computing.SecurityGroupInfoSetItem {
+	name := s.securityGroupNameForRole(role)
 	return &computing.SecurityGroupInfoSetItem{
 		GroupName: nifcloud.String(name),
 	}
 }
 
-func (s *Service) authorizeSecurityGroupIngressRules(name string, rules infrav1alpha2.IngressRules) error {
+func (s *Service) authorizeSecurityGroupIngressRules(name string, rules infrav1alpha3.IngressRules) error {
 	input := &computing.AuthorizeSecurityGroupIngressInput{GroupName: nifcloud.String(name)}
 	for _, rule := range rules {
 		// to adopt nifcloud requirement
@@ -320,7 +567,7 @@ func (s *Service) authorizeSecurityGroupIngressRules(name string, rules infrav1a
 	return nil
 }
 
-func (s *Service) revokeSecurityGroupIngressRules(name string, rules infrav1alpha2.IngressRules) error {
+func (s *Service) revokeSecurityGroupIngressRules(name string, rules infrav1alpha3.IngressRules) error {
 	input := &computing.RevokeSecurityGroupIngressInput{GroupName: nifcloud.String(name)}
 	for _, rule := range rules {
 		input.IpPermissions = append(input.IpPermissions, *ingressRuleToSDKType(rule))
@@ -334,7 +581,7 @@ func (s *Service) revokeSecurityGroupIngressRules(name string, rules infrav1alph
 	return nil
 }
 
-func (s *Service) sanitizeRole(name string, i infrav1alpha2.IngressRule) *infrav1alpha2.IngressRule {
+func (s *Service) sanitizeRole(name string, i infrav1alpha3.IngressRule) *infrav1alpha3.IngressRule {
 	var groups []string
 	for _, group := range i.SourceSecurityGroupName {
 		if group != name {
@@ -345,9 +592,9 @@ func (s *Service) sanitizeRole(name string, i infrav1alpha2.IngressRule) *infrav
 	return &i
 }
 
-func ingressRuleToSDKType(i *infrav1alpha2.IngressRule) (res *computing.RequestIpPermissionsStruct) {
+func ingressRuleToSDKType(i *infrav1alpha3.IngressRule) (res *computing.RequestIpPermissionsStruct) {
 	switch i.Protocol {
-	case infrav1alpha2.SecurityGroupProtocolTCP, infrav1alpha2.SecurityGroupProtocolUDP:
+	case infrav1alpha3.SecurityGroupProtocolTCP, infrav1alpha3.SecurityGroupProtocolUDP:
 		res = &computing.RequestIpPermissionsStruct{
 			IpProtocol: nifcloud.String(string(i.Protocol)),
 			FromPort:   nifcloud.Int64(i.FromPort),
@@ -377,17 +624,17 @@ func ingressRuleToSDKType(i *infrav1alpha2.IngressRule) (res *computing.RequestI
 	return res
 }
 
-func ingressRuleFromSDKType(v *computing.IpPermissionsSetItem) (res *infrav1alpha2.IngressRule) {
+func ingressRuleFromSDKType(v *computing.IpPermissionsSetItem) (res *infrav1alpha3.IngressRule) {
 	switch *v.IpProtocol {
 	case IPProtocolTCP, IPProtocolUDP:
-		res = &infrav1alpha2.IngressRule{
-			Protocol: infrav1alpha2.SecurityGroupProtocol(*v.IpProtocol),
+		res = &infrav1alpha3.IngressRule{
+			Protocol: infrav1alpha3.SecurityGroupProtocol(*v.IpProtocol),
 			FromPort: *v.FromPort,
 			ToPort:   *v.ToPort,
 		}
 	default:
-		res = &infrav1alpha2.IngressRule{
-			Protocol: infrav1alpha2.SecurityGroupProtocol(*v.IpProtocol),
+		res = &infrav1alpha3.IngressRule{
+			Protocol: infrav1alpha3.SecurityGroupProtocol(*v.IpProtocol),
 		}
 	}
 
@@ -406,36 +653,135 @@ func ingressRuleFromSDKType(v *computing.IpPermissionsSetItem) (res *infrav1alph
 	return res
 }
 
-func (s *Service) defaultSSHAsIP(ip string) *infrav1alpha2.IngressRule {
-	return &infrav1alpha2.IngressRule{
+func (s *Service) defaultSSHAsIP(ip string) *infrav1alpha3.IngressRule {
+	return &infrav1alpha3.IngressRule{
 		Description: "SSH",
-		Protocol:    infrav1alpha2.SecurityGroupProtocolTCP,
+		Protocol:    infrav1alpha3.SecurityGroupProtocolTCP,
 		FromPort:    22,
 		ToPort:      22,
 		CidrBlocks:  []string{ip},
 	}
 }
 
-func (s *Service) getSecurityGroupIngressRules(role infrav1alpha2.SecurityGroupRole) (infrav1alpha2.IngressRules, error) {
-	hostIP, err := pubip.Get()
-	if err != nil {
-		return nil, err
-	}
+// getSecurityGroupIngressRules returns the rules authorized to the security group of the role
+// nifcloud allows any traffic between members of the same group, so etcd and the other
+// control plane traffic stays inside the control plane group and only cross-group rules are listed
+func (s *Service) getSecurityGroupIngressRules(role infrav1alpha3.SecurityGroupRole) (infrav1alpha3.IngressRules, error) {
+	controlPlaneGroup := s.securityGroupNameForRole(infrav1alpha3.SecurityGroupControlPlane)
+	nodeGroup := s.securityGroupNameForRole(infrav1alpha3.SecurityGroupNode)
 
+	rules := infrav1alpha3.IngressRules{}
 	switch role {
-	// TODO: divide groups to each role
-	case infrav1alpha2.SecurityGroupControlPlane, infrav1alpha2.SecurityGroupNode:
-		return infrav1alpha2.IngressRules{
-			s.defaultSSHAsIP(hostIP.String()),
-			{
+	case infrav1alpha3.SecurityGroupBastion:
+		if cidrs := s.scope.NifcloudCluster.Spec.Bastion.AllowedCIDRBlocks; len(cidrs) > 0 {
+			rules = append(rules, &infrav1alpha3.IngressRule{
+				Description: "SSH",
+				Protocol:    infrav1alpha3.SecurityGroupProtocolTCP,
+				FromPort:    22,
+				ToPort:      22,
+				CidrBlocks:  append([]string{}, cidrs...),
+			})
+		}
+	case infrav1alpha3.SecurityGroupControlPlane:
+		rules = append(rules,
+			&infrav1alpha3.IngressRule{
+				Description:             "Kubernetes API",
+				Protocol:                infrav1alpha3.SecurityGroupProtocolTCP,
+				FromPort:                6443,
+				ToPort:                  6443,
+				SourceSecurityGroupName: []string{nodeGroup},
+			},
+			kubeletIngressRule(nodeGroup),
+		)
+		rules = append(rules, cniIngressRules(nodeGroup)...)
+		// the load balancer is allowed only by its address, a host name cannot be a cidr block
+		if lb := s.scope.Network().APIServerLoadBalancer; lb != nil && net.ParseIP(lb.DNSName) != nil {
+			rules = append(rules, &infrav1alpha3.IngressRule{
+				Description: "Kubernetes API from load balancer",
+				Protocol:    infrav1alpha3.SecurityGroupProtocolTCP,
+				FromPort:    6443,
+				ToPort:      6443,
+				CidrBlocks:  []string{lb.DNSName + "/32"},
+			})
+		}
+	case infrav1alpha3.SecurityGroupNode:
+		rules = append(rules,
+			kubeletIngressRule(controlPlaneGroup),
+			&infrav1alpha3.IngressRule{
+				Description:             "Node Port Services",
+				Protocol:                infrav1alpha3.SecurityGroupProtocolTCP,
+				FromPort:                30000,
+				ToPort:                  32767,
+				SourceSecurityGroupName: []string{controlPlaneGroup},
+			},
+		)
+		rules = append(rules, cniIngressRules(controlPlaneGroup)...)
+	default:
+		return nil, errors.Errorf("Cannot determine ingress rules for unknown security group role %q", role)
+	}
+
+	// machines are reachable over SSH only through the bastion when it is enabled
+	if role != infrav1alpha3.SecurityGroupBastion && s.scope.NifcloudCluster.Spec.Bastion.Enabled {
+		rules = append(rules, &infrav1alpha3.IngressRule{
+			Description:             "SSH from bastion",
+			Protocol:                infrav1alpha3.SecurityGroupProtocolTCP,
+			FromPort:                22,
+			ToPort:                  22,
+			SourceSecurityGroupName: []string{s.securityGroupNameForRole(infrav1alpha3.SecurityGroupBastion)},
+		})
+	}
+
+	if s.scope.NifcloudCluster.Spec.AllowControllerIP {
+		hostIP, err := publicIP()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to look up the public IP of the controller")
+		}
+		rules = append(rules, s.defaultSSHAsIP(hostIP.String()))
+		if role == infrav1alpha3.SecurityGroupControlPlane {
+			rules = append(rules, &infrav1alpha3.IngressRule{
 				Description: "Kubernetes API",
-				Protocol:    infrav1alpha2.SecurityGroupProtocolTCP,
+				Protocol:    infrav1alpha3.SecurityGroupProtocolTCP,
 				FromPort:    6443,
 				ToPort:      6443,
 				CidrBlocks:  []string{hostIP.String()},
-			},
-		}, nil
+			})
+		}
 	}
 
-	return nil, errors.Errorf("Cannot determine ingress rules for unknown security group role %q", role)
+	// copy user rules, Difference sorts the cidr blocks in place
+	for _, rule := range s.scope.NifcloudCluster.Spec.IngressRules[role] {
+		rules = append(rules, rule.DeepCopy())
+	}
+	return rules, nil
+}
+
+func kubeletIngressRule(source string) *infrav1alpha3.IngressRule {
+	return &infrav1alpha3.IngressRule{
+		Description:             "Kubelet API",
+		Protocol:                infrav1alpha3.SecurityGroupProtocolTCP,
+		FromPort:                10250,
+		ToPort:                  10250,
+		SourceSecurityGroupName: []string{source},
+	}
+}
+
+// cniIngressRules returns the rules for calico, nifcloud cannot authorize IP-in-IP
+// so pods of different groups talk over VXLAN
+func cniIngressRules(source string) infrav1alpha3.IngressRules {
+	return infrav1alpha3.IngressRules{
+		{
+			Description:             "Calico BGP",
+			Protocol:                infrav1alpha3.SecurityGroupProtocolTCP,
+			FromPort:                179,
+			ToPort:                  179,
+			SourceSecurityGroupName: []string{source},
+		},
+		{
+			Description:             "Calico VXLAN",
+			Protocol:                infrav1alpha3.SecurityGroupProtocolUDP,
+			FromPort:                4789,
+			ToPort:                  4789,
+			SourceSecurityGroupName: []string{source},
+		},
+	}
 }
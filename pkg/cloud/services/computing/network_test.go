@@ -0,0 +1,485 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package computing
+
+import (
+	"net"
+	"testing"
+
+	"github.com/aokumasan/nifcloud-sdk-go-v2/nifcloud"
+	"github.com/aokumasan/nifcloud-sdk-go-v2/service/computing"
+	"github.com/golang/mock/gomock"
+	"github.com/google/go-cmp/cmp"
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
+	nferrors "github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/errors"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/mock_client"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/scope"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+)
+
+func TestService_getSecurityGroupIngressRules(t *testing.T) {
+	userRule := &infrav1alpha3.IngressRule{
+		Description: "SSH from office",
+		Protocol:    infrav1alpha3.SecurityGroupProtocolTCP,
+		FromPort:    22,
+		ToPort:      22,
+		CidrBlocks:  []string{"198.51.100.0/24"},
+	}
+	// names of the groups of "test-cluster"
+	controlPlane := (&Service{}).getSecurityGroupName("test-cluster", infrav1alpha3.SecurityGroupControlPlane)
+	node := (&Service{}).getSecurityGroupName("test-cluster", infrav1alpha3.SecurityGroupNode)
+	bastion := (&Service{}).getSecurityGroupName("test-cluster", infrav1alpha3.SecurityGroupBastion)
+	tcp := func(desc string, port int64, source string) *infrav1alpha3.IngressRule {
+		return &infrav1alpha3.IngressRule{
+			Description:             desc,
+			Protocol:                infrav1alpha3.SecurityGroupProtocolTCP,
+			FromPort:                port,
+			ToPort:                  port,
+			SourceSecurityGroupName: []string{source},
+		}
+	}
+	cni := func(source string) infrav1alpha3.IngressRules {
+		return infrav1alpha3.IngressRules{
+			tcp("Calico BGP", 179, source),
+			{Description: "Calico VXLAN", Protocol: infrav1alpha3.SecurityGroupProtocolUDP, FromPort: 4789, ToPort: 4789, SourceSecurityGroupName: []string{source}},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		role     infrav1alpha3.SecurityGroupRole
+		spec     infrav1alpha3.NifcloudClusterSpec
+		lb       *infrav1alpha3.LoadBalancer
+		lookup   func() (net.IP, error)
+		want     infrav1alpha3.IngressRules
+		wantErr  bool
+		noLookup bool
+	}{
+		{
+			name: "control plane accepts API, kubelet and CNI from nodes",
+			role: infrav1alpha3.SecurityGroupControlPlane,
+			want: append(infrav1alpha3.IngressRules{
+				tcp("Kubernetes API", 6443, node),
+				tcp("Kubelet API", 10250, node),
+			}, cni(node)...),
+			noLookup: true,
+		},
+		{
+			name: "control plane accepts API from the address of load balancer",
+			role: infrav1alpha3.SecurityGroupControlPlane,
+			lb:   &infrav1alpha3.LoadBalancer{Name: "lb", DNSName: "203.0.113.10"},
+			want: append(append(infrav1alpha3.IngressRules{
+				tcp("Kubernetes API", 6443, node),
+				tcp("Kubelet API", 10250, node),
+			}, cni(node)...),
+				&infrav1alpha3.IngressRule{Description: "Kubernetes API from load balancer", Protocol: infrav1alpha3.SecurityGroupProtocolTCP, FromPort: 6443, ToPort: 6443, CidrBlocks: []string{"203.0.113.10/32"}},
+			),
+			noLookup: true,
+		},
+		{
+			name: "host name of load balancer is not allowed",
+			role: infrav1alpha3.SecurityGroupControlPlane,
+			lb:   &infrav1alpha3.LoadBalancer{Name: "lb", DNSName: "lb.example.com"},
+			want: append(infrav1alpha3.IngressRules{
+				tcp("Kubernetes API", 6443, node),
+				tcp("Kubelet API", 10250, node),
+			}, cni(node)...),
+			noLookup: true,
+		},
+		{
+			name: "node accepts kubelet, node ports and CNI from control plane",
+			role: infrav1alpha3.SecurityGroupNode,
+			want: append(infrav1alpha3.IngressRules{
+				tcp("Kubelet API", 10250, controlPlane),
+				{Description: "Node Port Services", Protocol: infrav1alpha3.SecurityGroupProtocolTCP, FromPort: 30000, ToPort: 32767, SourceSecurityGroupName: []string{controlPlane}},
+			}, cni(controlPlane)...),
+			noLookup: true,
+		},
+		{
+			name: "node accepts SSH from bastion",
+			role: infrav1alpha3.SecurityGroupNode,
+			spec: infrav1alpha3.NifcloudClusterSpec{Bastion: infrav1alpha3.BastionSpec{Enabled: true}},
+			want: append(append(infrav1alpha3.IngressRules{
+				tcp("Kubelet API", 10250, controlPlane),
+				{Description: "Node Port Services", Protocol: infrav1alpha3.SecurityGroupProtocolTCP, FromPort: 30000, ToPort: 32767, SourceSecurityGroupName: []string{controlPlane}},
+			}, cni(controlPlane)...), tcp("SSH from bastion", 22, bastion)),
+			noLookup: true,
+		},
+		{
+			name: "bastion accepts SSH from allowed cidr blocks",
+			role: infrav1alpha3.SecurityGroupBastion,
+			spec: infrav1alpha3.NifcloudClusterSpec{
+				Bastion: infrav1alpha3.BastionSpec{Enabled: true, AllowedCIDRBlocks: []string{"198.51.100.0/24"}},
+			},
+			want: infrav1alpha3.IngressRules{
+				{Description: "SSH", Protocol: infrav1alpha3.SecurityGroupProtocolTCP, FromPort: 22, ToPort: 22, CidrBlocks: []string{"198.51.100.0/24"}},
+			},
+			noLookup: true,
+		},
+		{
+			name: "user rules of the role",
+			role: infrav1alpha3.SecurityGroupBastion,
+			spec: infrav1alpha3.NifcloudClusterSpec{
+				Bastion: infrav1alpha3.BastionSpec{Enabled: true},
+				IngressRules: map[infrav1alpha3.SecurityGroupRole]infrav1alpha3.IngressRules{
+					infrav1alpha3.SecurityGroupBastion: {userRule},
+					infrav1alpha3.SecurityGroupNode:    {{Protocol: infrav1alpha3.SecurityGroupProtocolAny, CidrBlocks: []string{"10.0.0.0/8"}}},
+				},
+			},
+			want:     infrav1alpha3.IngressRules{userRule},
+			noLookup: true,
+		},
+		{
+			name: "allow the public IP of the controller",
+			role: infrav1alpha3.SecurityGroupControlPlane,
+			spec: infrav1alpha3.NifcloudClusterSpec{AllowControllerIP: true},
+			lookup: func() (net.IP, error) {
+				return net.ParseIP("203.0.113.5"), nil
+			},
+			want: append(append(infrav1alpha3.IngressRules{
+				tcp("Kubernetes API", 6443, node),
+				tcp("Kubelet API", 10250, node),
+			}, cni(node)...),
+				&infrav1alpha3.IngressRule{Description: "SSH", Protocol: infrav1alpha3.SecurityGroupProtocolTCP, FromPort: 22, ToPort: 22, CidrBlocks: []string{"203.0.113.5"}},
+				&infrav1alpha3.IngressRule{Description: "Kubernetes API", Protocol: infrav1alpha3.SecurityGroupProtocolTCP, FromPort: 6443, ToPort: 6443, CidrBlocks: []string{"203.0.113.5"}},
+			),
+		},
+		{
+			name: "lookup failure",
+			role: infrav1alpha3.SecurityGroupControlPlane,
+			spec: infrav1alpha3.NifcloudClusterSpec{AllowControllerIP: true},
+			lookup: func() (net.IP, error) {
+				return nil, errors.New("no internet access")
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(f func() (net.IP, error)) { publicIP = f }(publicIP)
+			publicIP = tt.lookup
+			if tt.noLookup {
+				publicIP = func() (net.IP, error) {
+					t.Fatal("public IP must not be looked up")
+					return nil, nil
+				}
+			}
+
+			scope, err := scope.NewClusterScope(scope.ClusterScopeParams{
+				Cluster: &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster"}},
+				NifcloudClients: scope.NifcloudClients{
+					Computing: mock_client.NewMockClient(gomock.NewController(t)),
+				},
+				NifcloudCluster: &infrav1alpha3.NifcloudCluster{Spec: tt.spec},
+			})
+			if err != nil {
+				t.Fatalf("Failed to create test context: %v", err)
+			}
+			scope.Network().APIServerLoadBalancer = tt.lb
+
+			got, err := NewService(scope).getSecurityGroupIngressRules(tt.role)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error[%v], wantErr[%v]", err, tt.wantErr)
+			}
+			if !cmp.Equal(got, tt.want) {
+				t.Errorf("unexpected rules (-want +got):\n%s", cmp.Diff(tt.want, got))
+			}
+		})
+	}
+}
+
+func TestService_getSecurityGroupName(t *testing.T) {
+	s := &Service{}
+	for _, name := range []string{"short", "a-very-long-cluster-name"} {
+		roles := map[string]infrav1alpha3.SecurityGroupRole{}
+		for _, role := range []infrav1alpha3.SecurityGroupRole{
+			infrav1alpha3.SecurityGroupBastion,
+			infrav1alpha3.SecurityGroupControlPlane,
+			infrav1alpha3.SecurityGroupNode,
+		} {
+			got := s.getSecurityGroupName(name, role)
+			if len(got) != maxSecurityGroupName {
+				t.Errorf("length of %q must be %d", got, maxSecurityGroupName)
+			}
+			if other, ok := roles[got]; ok {
+				t.Errorf("roles %q and %q of cluster %q share the name %q", other, role, name, got)
+			}
+			roles[got] = role
+		}
+	}
+}
+
+func TestService_reconcileEndpoint_existingIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		expect  func(m *mock_client.MockClientMockRecorder)
+		wantErr bool
+	}{
+		{
+			name: "use the endpoint IP as-is",
+			expect: func(m *mock_client.MockClientMockRecorder) {
+				m.DescribeAddresses(gomock.Any(), &computing.DescribeAddressesInput{PublicIp: []string{"203.0.113.1"}}).
+					Return(&computing.DescribeAddressesOutput{
+						AddressesSet: []computing.AddressesSetItem{{PublicIp: nifcloud.String("203.0.113.1")}},
+					}, nil)
+			},
+		},
+		{
+			name: "endpoint IP does not exist",
+			expect: func(m *mock_client.MockClientMockRecorder) {
+				m.DescribeAddresses(gomock.Any(), gomock.Any()).
+					Return(nil, nferrors.NewNotFound(errors.New("not found")))
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			mockSvc := mock_client.NewMockClient(mockCtrl)
+
+			scope, err := scope.NewClusterScope(scope.ClusterScopeParams{
+				Cluster: &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster"}},
+				NifcloudClients: scope.NifcloudClients{
+					Computing: mockSvc,
+				},
+				NifcloudCluster: &infrav1alpha3.NifcloudCluster{
+					Spec: infrav1alpha3.NifcloudClusterSpec{
+						NetworkSpec: infrav1alpha3.NetworkSpec{EndpointIP: "203.0.113.1"},
+					},
+				},
+			})
+			if err != nil {
+				t.Fatalf("Failed to create test context: %v", err)
+			}
+			tt.expect(mockSvc.EXPECT())
+
+			service := NewService(scope)
+			err = service.reconcileEndpoint(apiEndpointPort)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("reconcileEndpoint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if endpoint := scope.NifcloudCluster.Spec.ControlPlaneEndpoint; endpoint.Host != "203.0.113.1" || endpoint.Port != apiEndpointPort {
+				t.Errorf("unexpected control plane endpoint: %+v", endpoint)
+			}
+			if addr := scope.Network().EndpointAddress; addr == nil || !addr.Unmanaged {
+				t.Errorf("unexpected endpoint address: %+v", addr)
+			}
+
+			// the address given in the spec is never released
+			if err := service.DeleteEndpoint(); err != nil {
+				t.Errorf("did not expect error: %v", err)
+			}
+		})
+	}
+}
+
+func TestService_reconcileEndpoint_ownedAddress(t *testing.T) {
+	owned := "cluster:test-cluster,role:ENDPOINT"
+	tests := []struct {
+		name     string
+		status   *infrav1alpha3.Address
+		endpoint infrav1alpha3.APIEndpoint
+		expect   func(m *mock_client.MockClientMockRecorder)
+		wantIP   string
+		wantErr  bool
+	}{
+		{
+			name: "reuse the address owned by the cluster",
+			expect: func(m *mock_client.MockClientMockRecorder) {
+				m.DescribeAddresses(gomock.Any(), &computing.DescribeAddressesInput{}).
+					Return(&computing.DescribeAddressesOutput{
+						AddressesSet: []computing.AddressesSetItem{
+							{PublicIp: nifcloud.String("203.0.113.1"), Description: nifcloud.String("cluster:other-cluster,role:ENDPOINT")},
+							{PublicIp: nifcloud.String("203.0.113.2")},
+							{PublicIp: nifcloud.String("203.0.113.3"), Description: nifcloud.String(owned)},
+						},
+					}, nil)
+			},
+			wantIP: "203.0.113.3",
+		},
+		{
+			name: "allocate and tag a new address when no address is owned",
+			expect: func(m *mock_client.MockClientMockRecorder) {
+				m.DescribeAddresses(gomock.Any(), &computing.DescribeAddressesInput{}).
+					Return(&computing.DescribeAddressesOutput{
+						AddressesSet: []computing.AddressesSetItem{
+							{PublicIp: nifcloud.String("203.0.113.1"), Description: nifcloud.String("cluster:other-cluster,role:ENDPOINT")},
+						},
+					}, nil)
+				m.AllocateAddress(gomock.Any(), gomock.Any()).
+					Return(&computing.AllocateAddressOutput{PublicIp: nifcloud.String("203.0.113.4")}, nil)
+				m.NiftyModifyAddressAttribute(gomock.Any(), gomock.Any()).
+					Do(func(_, in interface{}) {
+						input := in.(*computing.NiftyModifyAddressAttributeInput)
+						if nifcloud.StringValue(input.PublicIp) != "203.0.113.4" {
+							t.Errorf("unexpected address is tagged: %v", nifcloud.StringValue(input.PublicIp))
+						}
+						if !infrav1alpha3.ParseTags(nifcloud.StringValue(input.Value)).IsOwnedBy("test-cluster", endPoint) {
+							t.Errorf("unexpected tags: %v", nifcloud.StringValue(input.Value))
+						}
+					}).
+					Return(&computing.NiftyModifyAddressAttributeOutput{}, nil)
+			},
+			wantIP: "203.0.113.4",
+		},
+		{
+			name:   "keep the address recorded in the status",
+			status: &infrav1alpha3.Address{PublicIP: "203.0.113.3"},
+			expect: func(m *mock_client.MockClientMockRecorder) {
+				m.DescribeAddresses(gomock.Any(), &computing.DescribeAddressesInput{PublicIp: []string{"203.0.113.3"}}).
+					Return(&computing.DescribeAddressesOutput{
+						AddressesSet: []computing.AddressesSetItem{{PublicIp: nifcloud.String("203.0.113.3"), Description: nifcloud.String(owned)}},
+					}, nil)
+			},
+			wantIP: "203.0.113.3",
+		},
+		{
+			name:     "never take over the endpoint owned by other clusters",
+			endpoint: infrav1alpha3.APIEndpoint{Host: "203.0.113.1", Port: apiEndpointPort},
+			expect: func(m *mock_client.MockClientMockRecorder) {
+				m.DescribeAddresses(gomock.Any(), &computing.DescribeAddressesInput{PublicIp: []string{"203.0.113.1"}}).
+					Return(&computing.DescribeAddressesOutput{
+						AddressesSet: []computing.AddressesSetItem{
+							{PublicIp: nifcloud.String("203.0.113.1"), Description: nifcloud.String("cluster:other-cluster,role:ENDPOINT")},
+						},
+					}, nil)
+			},
+			wantErr: true,
+		},
+		{
+			name:   "address in the status is gone",
+			status: &infrav1alpha3.Address{PublicIP: "203.0.113.3"},
+			expect: func(m *mock_client.MockClientMockRecorder) {
+				m.DescribeAddresses(gomock.Any(), gomock.Any()).
+					Return(nil, nferrors.NewNotFound(errors.New("not found")))
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			mockSvc := mock_client.NewMockClient(mockCtrl)
+
+			scope, err := scope.NewClusterScope(scope.ClusterScopeParams{
+				Cluster: &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster"}},
+				NifcloudClients: scope.NifcloudClients{
+					Computing: mockSvc,
+				},
+				NifcloudCluster: &infrav1alpha3.NifcloudCluster{
+					ObjectMeta: metav1.ObjectMeta{Name: "test-cluster"},
+					Spec: infrav1alpha3.NifcloudClusterSpec{
+						ControlPlaneEndpoint: tt.endpoint,
+					},
+					Status: infrav1alpha3.NifcloudClusterStatus{
+						Network: infrav1alpha3.Network{EndpointAddress: tt.status},
+					},
+				},
+			})
+			if err != nil {
+				t.Fatalf("Failed to create test context: %v", err)
+			}
+			tt.expect(mockSvc.EXPECT())
+
+			service := NewService(scope)
+			err = service.reconcileEndpoint(apiEndpointPort)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("reconcileEndpoint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if endpoint := scope.NifcloudCluster.Spec.ControlPlaneEndpoint; endpoint.Host != tt.wantIP || endpoint.Port != apiEndpointPort {
+				t.Errorf("unexpected control plane endpoint: %+v", endpoint)
+			}
+			if addr := scope.Network().EndpointAddress; addr == nil || addr.PublicIP != tt.wantIP || addr.Unmanaged {
+				t.Errorf("unexpected endpoint address: %+v", addr)
+			}
+		})
+	}
+}
+
+func TestService_releaseAddress(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+		wantRelease bool
+	}{
+		{
+			name:        "release the address owned by the cluster",
+			description: "cluster:test-cluster,role:ENDPOINT",
+			wantRelease: true,
+		},
+		{
+			name:        "keep the address owned by other clusters",
+			description: "cluster:other-cluster,role:ENDPOINT",
+		},
+		{
+			name: "keep the address without tags",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			mockSvc := mock_client.NewMockClient(mockCtrl)
+
+			scope, err := scope.NewClusterScope(scope.ClusterScopeParams{
+				Cluster: &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster"}},
+				NifcloudClients: scope.NifcloudClients{
+					Computing: mockSvc,
+				},
+				NifcloudCluster: &infrav1alpha3.NifcloudCluster{
+					ObjectMeta: metav1.ObjectMeta{Name: "test-cluster"},
+					Spec: infrav1alpha3.NifcloudClusterSpec{
+						ControlPlaneEndpoint: infrav1alpha3.APIEndpoint{Host: "203.0.113.1", Port: apiEndpointPort},
+					},
+					Status: infrav1alpha3.NifcloudClusterStatus{
+						Network: infrav1alpha3.Network{EndpointAddress: &infrav1alpha3.Address{PublicIP: "203.0.113.1"}},
+					},
+				},
+			})
+			if err != nil {
+				t.Fatalf("Failed to create test context: %v", err)
+			}
+			mockSvc.EXPECT().DescribeAddresses(gomock.Any(), &computing.DescribeAddressesInput{PublicIp: []string{"203.0.113.1"}}).
+				Return(&computing.DescribeAddressesOutput{
+					AddressesSet: []computing.AddressesSetItem{{PublicIp: nifcloud.String("203.0.113.1"), Description: nifcloud.String(tt.description)}},
+				}, nil)
+			if tt.wantRelease {
+				mockSvc.EXPECT().ReleaseAddress(gomock.Any(), &computing.ReleaseAddressInput{PublicIp: nifcloud.String("203.0.113.1")}).
+					Return(&computing.ReleaseAddressOutput{}, nil)
+			}
+
+			service := NewService(scope)
+			if err := service.DeleteEndpoint(); err != nil {
+				t.Fatalf("did not expect error: %v", err)
+			}
+			if addr := scope.Network().EndpointAddress; addr != nil {
+				t.Errorf("endpoint address is not cleared: %+v", addr)
+			}
+		})
+	}
+}
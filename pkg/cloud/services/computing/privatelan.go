@@ -0,0 +1,392 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package computing
+
+import (
+	"context"
+
+	"github.com/aokumasan/nifcloud-sdk-go-v2/nifcloud"
+	"github.com/aokumasan/nifcloud-sdk-go-v2/service/computing"
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
+	nferrors "github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/errors"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/services/wait"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/cluster-api/util/record"
+)
+
+const (
+	privateLANRole    = "privatelan"
+	routerRole        = "router"
+	defaultRouterType = "small"
+	stateAvailable    = "available"
+)
+
+// reconcilePrivateLAN makes sure that the private LAN of the cluster exists and is available
+func (s *Service) reconcilePrivateLAN() error {
+	spec := s.scope.NifcloudCluster.Spec.NetworkSpec.PrivateLAN
+	if spec == nil {
+		return nil
+	}
+	s.scope.V(2).Info("Reconciling private LAN")
+
+	name := s.getResourceName(privateLANRole)
+	// the name recorded by the earlier reconciliation is kept, the naming may have changed since then
+	if current := s.scope.Network().PrivateLAN; current != nil && !current.Unmanaged && current.Name != "" {
+		name = current.Name
+	}
+	describe := func() (*infrav1alpha3.PrivateLAN, error) { return s.describePrivateLAN(name) }
+	if spec.ID != "" {
+		// the existing private LAN is used as-is
+		name = spec.ID
+		describe = func() (*infrav1alpha3.PrivateLAN, error) { return s.describePrivateLANByID(spec.ID) }
+	}
+
+	lan, err := describe()
+	if err != nil {
+		return err
+	}
+	if lan == nil {
+		if spec.ID != "" {
+			return errors.Errorf("private LAN %q is not found", spec.ID)
+		}
+		if err := s.createPrivateLAN(name, spec); err != nil {
+			return err
+		}
+	}
+
+	// private LAN cannot be connected while it is being created
+	if err := wait.WaitForWithRetryable(wait.NewBackoff(), func() (bool, error) {
+		lan, err = describe()
+		if err != nil {
+			return false, err
+		}
+		return lan != nil && lan.State == stateAvailable, nil
+	}); err != nil {
+		return errors.Wrapf(err, "failed to wait for private LAN %q to be available", name)
+	}
+
+	lan.Unmanaged = spec.ID != ""
+	s.scope.Network().PrivateLAN = lan
+	s.scope.V(2).Info("Reconcile private LAN completed successfully", "private-lan", lan.Name, "network-id", lan.ID)
+	return nil
+}
+
+// reconcileRouter makes sure that the router connected to the private LAN exists and is available
+func (s *Service) reconcileRouter() error {
+	spec := s.scope.NifcloudCluster.Spec.NetworkSpec.PrivateLAN
+	if spec == nil || spec.Router == nil {
+		return nil
+	}
+	lan := s.scope.Network().PrivateLAN
+	if lan == nil {
+		return nferrors.NewFailedDependency(errors.New("private LAN is not available"))
+	}
+	s.scope.V(2).Info("Reconciling router")
+
+	name := s.getResourceName(routerRole)
+	if current := s.scope.Network().Router; current != nil && current.Name != "" {
+		name = current.Name
+	}
+	router, err := s.describeRouter(name)
+	if err != nil {
+		return err
+	}
+	dhcpConfigID := ""
+	if current := s.scope.Network().Router; current != nil {
+		dhcpConfigID = current.DHCPConfigID
+	}
+	if router == nil {
+		if spec.Router.DHCP != nil && dhcpConfigID == "" {
+			dhcpConfigID, err = s.createDhcpConfig(spec.Router.DHCP)
+			if err != nil {
+				return err
+			}
+			// keep the config to clean up even if creating router fails
+			s.scope.Network().Router = &infrav1alpha3.Router{Name: name, DHCPConfigID: dhcpConfigID}
+		}
+		if err := s.createRouter(name, lan.ID, dhcpConfigID, spec); err != nil {
+			return err
+		}
+	}
+
+	if err := wait.WaitForWithRetryable(wait.NewBackoff(), func() (bool, error) {
+		router, err = s.describeRouter(name)
+		if err != nil {
+			return false, err
+		}
+		return router != nil && router.State == stateAvailable, nil
+	}); err != nil {
+		return errors.Wrapf(err, "failed to wait for router %q to be available", name)
+	}
+
+	router.DHCPConfigID = dhcpConfigID
+	s.scope.Network().Router = router
+	s.scope.V(2).Info("Reconcile router completed successfully", "router", router.Name, "router-id", router.ID)
+	return nil
+}
+
+// deleteRouter deletes the router and its DHCP config
+func (s *Service) deleteRouter() error {
+	router := s.scope.Network().Router
+	if router == nil {
+		return nil
+	}
+	s.scope.V(2).Info("Deleting router", "router", router.Name)
+
+	// the router may be created without its id recorded, when the status failed to be written
+	if router.ID == "" && router.Name != "" {
+		current, err := s.describeRouter(router.Name)
+		if err != nil {
+			return err
+		}
+		if current != nil {
+			router.ID = current.ID
+		}
+	}
+
+	if router.ID != "" {
+		_, err := s.scope.NifcloudClients.Computing.NiftyDeleteRouter(context.TODO(), &computing.NiftyDeleteRouterInput{
+			RouterId: nifcloud.String(router.ID),
+		})
+		if err != nil && !nferrors.IsNotFound(err) {
+			record.Warnf(s.scope.NifcloudCluster, "FailedDeleteRouter", "Failed to delete router %q: %v", router.Name, err)
+			return errors.Wrapf(err, "failed to delete router %q", router.Name)
+		}
+
+		// DHCP config and private LAN are in use until the router is gone
+		if err := wait.WaitForWithRetryable(wait.NewBackoff(), func() (bool, error) {
+			current, err := s.describeRouter(router.Name)
+			if err != nil {
+				return false, err
+			}
+			return current == nil, nil
+		}); err != nil {
+			return errors.Wrapf(err, "failed to wait for router %q to be deleted", router.Name)
+		}
+		record.Eventf(s.scope.NifcloudCluster, "SuccessfulDeleteRouter", "Deleted router %q", router.Name)
+	}
+
+	if router.DHCPConfigID != "" {
+		_, err := s.scope.NifcloudClients.Computing.NiftyDeleteDhcpConfig(context.TODO(), &computing.NiftyDeleteDhcpConfigInput{
+			DhcpConfigId: nifcloud.String(router.DHCPConfigID),
+		})
+		if err != nil && !nferrors.IsNotFound(err) {
+			return errors.Wrapf(err, "failed to delete DHCP config %q", router.DHCPConfigID)
+		}
+		s.scope.V(2).Info("Deleted DHCP config", "dhcp-config-id", router.DHCPConfigID)
+	}
+
+	s.scope.Network().Router = nil
+	return nil
+}
+
+// deletePrivateLAN deletes the private LAN of the cluster
+func (s *Service) deletePrivateLAN() error {
+	lan := s.scope.Network().PrivateLAN
+	if lan == nil {
+		return nil
+	}
+	if lan.Unmanaged {
+		s.scope.V(2).Info("Skip deleting unmanaged private LAN", "private-lan", lan.Name, "network-id", lan.ID)
+		s.scope.Network().PrivateLAN = nil
+		return nil
+	}
+	s.scope.V(2).Info("Deleting private LAN", "private-lan", lan.Name)
+
+	_, err := s.scope.NifcloudClients.Computing.NiftyDeletePrivateLan(context.TODO(), &computing.NiftyDeletePrivateLanInput{
+		NetworkId: nifcloud.String(lan.ID),
+	})
+	if err != nil && !nferrors.IsNotFound(err) {
+		record.Warnf(s.scope.NifcloudCluster, "FailedDeletePrivateLAN", "Failed to delete private LAN %q: %v", lan.Name, err)
+		return errors.Wrapf(err, "failed to delete private LAN %q", lan.Name)
+	}
+	record.Eventf(s.scope.NifcloudCluster, "SuccessfulDeletePrivateLAN", "Deleted private LAN %q", lan.Name)
+
+	s.scope.Network().PrivateLAN = nil
+	return nil
+}
+
+func (s *Service) createPrivateLAN(name string, spec *infrav1alpha3.PrivateLANSpec) error {
+	zone := spec.Zone
+	if zone == "" {
+		zone = s.scope.NifcloudCluster.Spec.Zone
+	}
+	tags := infrav1alpha3.BuildTags(infrav1alpha3.BuildParams{
+		ClusterName: s.scope.Name(),
+		Role:        nifcloud.String(privateLANRole),
+	})
+
+	_, err := s.scope.NifcloudClients.Computing.NiftyCreatePrivateLan(context.TODO(), &computing.NiftyCreatePrivateLanInput{
+		PrivateLanName:   nifcloud.String(name),
+		CidrBlock:        nifcloud.String(spec.CidrBlock),
+		AvailabilityZone: nifcloud.String(zone),
+		Description:      tags.ConvToString(),
+	})
+	if err != nil {
+		record.Warnf(s.scope.NifcloudCluster, "FailedCreatePrivateLAN", "Failed to create private LAN %q: %v", name, err)
+		return errors.Wrapf(err, "failed to create private LAN %q", name)
+	}
+	record.Eventf(s.scope.NifcloudCluster, "SuccessfulCreatePrivateLAN", "Created private LAN %q", name)
+	return nil
+}
+
+func (s *Service) createDhcpConfig(spec *infrav1alpha3.DHCPSpec) (string, error) {
+	out, err := s.scope.NifcloudClients.Computing.NiftyCreateDhcpConfig(context.TODO(), &computing.NiftyCreateDhcpConfigInput{})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create DHCP config")
+	}
+	if out.DhcpConfig == nil || out.DhcpConfig.DhcpConfigId == nil {
+		return "", errors.New("no DHCP config returned")
+	}
+	id := nifcloud.StringValue(out.DhcpConfig.DhcpConfigId)
+
+	_, err = s.scope.NifcloudClients.Computing.NiftyCreateDhcpIpAddressPool(context.TODO(), &computing.NiftyCreateDhcpIpAddressPoolInput{
+		DhcpConfigId:   nifcloud.String(id),
+		StartIpAddress: nifcloud.String(spec.StartIPAddress),
+		StopIpAddress:  nifcloud.String(spec.StopIPAddress),
+	})
+	if err != nil {
+		return id, errors.Wrapf(err, "failed to create address pool of DHCP config %q", id)
+	}
+	s.scope.V(2).Info("Created DHCP config", "dhcp-config-id", id)
+	return id, nil
+}
+
+func (s *Service) createRouter(name, networkID, dhcpConfigID string, spec *infrav1alpha3.PrivateLANSpec) error {
+	zone := spec.Zone
+	if zone == "" {
+		zone = s.scope.NifcloudCluster.Spec.Zone
+	}
+	routerType := spec.Router.Type
+	if routerType == "" {
+		routerType = defaultRouterType
+	}
+	tags := infrav1alpha3.BuildTags(infrav1alpha3.BuildParams{
+		ClusterName: s.scope.Name(),
+		Role:        nifcloud.String(routerRole),
+	})
+
+	lanInterface := computing.RequestNetworkInterfaceStruct{
+		NetworkId: nifcloud.String(networkID),
+		IpAddress: nifcloud.String(spec.Router.IPAddress),
+	}
+	if dhcpConfigID != "" {
+		lanInterface.Dhcp = nifcloud.Bool(true)
+		lanInterface.DhcpConfigId = nifcloud.String(dhcpConfigID)
+	}
+
+	_, err := s.scope.NifcloudClients.Computing.NiftyCreateRouter(context.TODO(), &computing.NiftyCreateRouterInput{
+		RouterName:       nifcloud.String(name),
+		AvailabilityZone: nifcloud.String(zone),
+		Type:             nifcloud.String(routerType),
+		Description:      tags.ConvToString(),
+		NetworkInterface: []computing.RequestNetworkInterfaceStruct{
+			{NetworkId: nifcloud.String(infrav1alpha3.NetworkCommonGlobal)},
+			lanInterface,
+		},
+	})
+	if err != nil {
+		record.Warnf(s.scope.NifcloudCluster, "FailedCreateRouter", "Failed to create router %q: %v", name, err)
+		return errors.Wrapf(err, "failed to create router %q", name)
+	}
+	record.Eventf(s.scope.NifcloudCluster, "SuccessfulCreateRouter", "Created router %q", name)
+	return nil
+}
+
+// describePrivateLAN returns the private LAN of the cluster which has the name, or nil if not found,
+// the private LAN which has the name but is owned by another cluster is an error
+func (s *Service) describePrivateLAN(name string) (*infrav1alpha3.PrivateLAN, error) {
+	out, err := s.scope.NifcloudClients.Computing.NiftyDescribePrivateLans(context.TODO(), &computing.NiftyDescribePrivateLansInput{
+		PrivateLanName: []string{name},
+	})
+	switch {
+	case nferrors.IsNotFound(err):
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrapf(err, "failed to describe private LAN %q", name)
+	}
+
+	for _, v := range out.PrivateLanSet {
+		if nifcloud.StringValue(v.PrivateLanName) != name {
+			continue
+		}
+		if !infrav1alpha3.ParseTags(nifcloud.StringValue(v.Description)).IsOwnedBy(s.scope.Name(), privateLANRole) {
+			return nil, errors.Errorf("private LAN %q exists but is not owned by the cluster", name)
+		}
+		return privateLANFromSDKType(&v), nil
+	}
+	return nil, nil
+}
+
+func (s *Service) describePrivateLANByID(id string) (*infrav1alpha3.PrivateLAN, error) {
+	out, err := s.scope.NifcloudClients.Computing.NiftyDescribePrivateLans(context.TODO(), &computing.NiftyDescribePrivateLansInput{
+		NetworkId: []string{id},
+	})
+	switch {
+	case nferrors.IsNotFound(err):
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrapf(err, "failed to describe private LAN %q", id)
+	}
+
+	for _, v := range out.PrivateLanSet {
+		if nifcloud.StringValue(v.NetworkId) != id {
+			continue
+		}
+		return privateLANFromSDKType(&v), nil
+	}
+	return nil, nil
+}
+
+func privateLANFromSDKType(v *computing.PrivateLanSetItem) *infrav1alpha3.PrivateLAN {
+	return &infrav1alpha3.PrivateLAN{
+		ID:        nifcloud.StringValue(v.NetworkId),
+		Name:      nifcloud.StringValue(v.PrivateLanName),
+		CidrBlock: nifcloud.StringValue(v.CidrBlock),
+		Zone:      nifcloud.StringValue(v.AvailabilityZone),
+		State:     nifcloud.StringValue(v.State),
+	}
+}
+
+// describeRouter returns the router of the cluster which has the name, or nil if not found,
+// the router which has the name but is owned by another cluster is an error
+func (s *Service) describeRouter(name string) (*infrav1alpha3.Router, error) {
+	out, err := s.scope.NifcloudClients.Computing.NiftyDescribeRouters(context.TODO(), &computing.NiftyDescribeRoutersInput{
+		RouterName: []string{name},
+	})
+	switch {
+	case nferrors.IsNotFound(err):
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrapf(err, "failed to describe router %q", name)
+	}
+
+	for _, v := range out.RouterSet {
+		if nifcloud.StringValue(v.RouterName) != name {
+			continue
+		}
+		if !infrav1alpha3.ParseTags(nifcloud.StringValue(v.Description)).IsOwnedBy(s.scope.Name(), routerRole) {
+			return nil, errors.Errorf("router %q exists but is not owned by the cluster", name)
+		}
+		return &infrav1alpha3.Router{
+			ID:    nifcloud.StringValue(v.RouterId),
+			Name:  nifcloud.StringValue(v.RouterName),
+			State: nifcloud.StringValue(v.State),
+		}, nil
+	}
+	return nil, nil
+}
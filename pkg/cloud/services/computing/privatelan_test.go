@@ -0,0 +1,373 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package computing
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aokumasan/nifcloud-sdk-go-v2/nifcloud"
+	"github.com/aokumasan/nifcloud-sdk-go-v2/service/computing"
+	"github.com/golang/mock/gomock"
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
+	nferrors "github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/errors"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/mock_client"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/scope"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+)
+
+func newPrivateLANTestScope(t *testing.T, mockSvc *mock_client.MockClient, spec *infrav1alpha3.PrivateLANSpec) *scope.ClusterScope {
+	scope, err := scope.NewClusterScope(scope.ClusterScopeParams{
+		Cluster: &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster"}},
+		NifcloudClients: scope.NifcloudClients{
+			Computing: mockSvc,
+		},
+		NifcloudCluster: &infrav1alpha3.NifcloudCluster{
+			Spec: infrav1alpha3.NifcloudClusterSpec{
+				Zone:        "east-11",
+				NetworkSpec: infrav1alpha3.NetworkSpec{PrivateLAN: spec},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create test context: %v", err)
+	}
+	return scope
+}
+
+// testClusterTags returns the description of the resource owned by the test cluster
+func testClusterTags(role string) *string {
+	return infrav1alpha3.BuildTags(infrav1alpha3.BuildParams{ClusterName: "test-cluster", Role: nifcloud.String(role)}).ConvToString()
+}
+
+// describePrivateLANs returns the private LAN named as requested
+func describePrivateLANs(state string) func(interface{}, *computing.NiftyDescribePrivateLansInput) (*computing.NiftyDescribePrivateLansOutput, error) {
+	return func(_ interface{}, input *computing.NiftyDescribePrivateLansInput) (*computing.NiftyDescribePrivateLansOutput, error) {
+		return &computing.NiftyDescribePrivateLansOutput{
+			PrivateLanSet: []computing.PrivateLanSetItem{
+				{
+					NetworkId:        nifcloud.String("net-0001"),
+					PrivateLanName:   nifcloud.String(input.PrivateLanName[0]),
+					CidrBlock:        nifcloud.String("192.168.0.0/24"),
+					AvailabilityZone: nifcloud.String("east-11"),
+					State:            nifcloud.String(state),
+					Description:      testClusterTags(privateLANRole),
+				},
+			},
+		}, nil
+	}
+}
+
+// describeRouters returns the router named as requested
+func describeRouters(state string) func(interface{}, *computing.NiftyDescribeRoutersInput) (*computing.NiftyDescribeRoutersOutput, error) {
+	return func(_ interface{}, input *computing.NiftyDescribeRoutersInput) (*computing.NiftyDescribeRoutersOutput, error) {
+		return &computing.NiftyDescribeRoutersOutput{
+			RouterSet: []computing.RouterSetItem{
+				{
+					RouterId:    nifcloud.String("rtr-0001"),
+					RouterName:  nifcloud.String(input.RouterName[0]),
+					State:       nifcloud.String(state),
+					Description: testClusterTags(routerRole),
+				},
+			},
+		}, nil
+	}
+}
+
+func TestService_reconcilePrivateLAN(t *testing.T) {
+	tests := []struct {
+		name          string
+		spec          *infrav1alpha3.PrivateLANSpec
+		expect        func(m *mock_client.MockClientMockRecorder)
+		wantErr       bool
+		wantUnmanaged bool
+	}{
+		{
+			name: "create private LAN when it does not exist",
+			spec: &infrav1alpha3.PrivateLANSpec{CidrBlock: "192.168.0.0/24"},
+			expect: func(m *mock_client.MockClientMockRecorder) {
+				gomock.InOrder(
+					m.NiftyDescribePrivateLans(gomock.Any(), gomock.Any()).
+						Return(nil, nferrors.NewNotFound(errors.New("not found"))),
+					m.NiftyCreatePrivateLan(gomock.Any(), gomock.Any()).
+						DoAndReturn(func(_ interface{}, input *computing.NiftyCreatePrivateLanInput) (*computing.NiftyCreatePrivateLanOutput, error) {
+							if nifcloud.StringValue(input.CidrBlock) != "192.168.0.0/24" || nifcloud.StringValue(input.AvailabilityZone) != "east-11" {
+								t.Errorf("unexpected create input: %v", input)
+							}
+							return &computing.NiftyCreatePrivateLanOutput{}, nil
+						}),
+					m.NiftyDescribePrivateLans(gomock.Any(), gomock.Any()).
+						DoAndReturn(describePrivateLANs("pending")),
+					m.NiftyDescribePrivateLans(gomock.Any(), gomock.Any()).
+						DoAndReturn(describePrivateLANs("available")),
+				)
+			},
+		},
+		{
+			name: "adopt existing private LAN",
+			spec: &infrav1alpha3.PrivateLANSpec{CidrBlock: "192.168.0.0/24"},
+			expect: func(m *mock_client.MockClientMockRecorder) {
+				m.NiftyDescribePrivateLans(gomock.Any(), gomock.Any()).
+					DoAndReturn(describePrivateLANs("available")).Times(2)
+			},
+		},
+		{
+			name: "private LAN with the same name owned by another cluster",
+			spec: &infrav1alpha3.PrivateLANSpec{CidrBlock: "192.168.0.0/24"},
+			expect: func(m *mock_client.MockClientMockRecorder) {
+				m.NiftyDescribePrivateLans(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ interface{}, input *computing.NiftyDescribePrivateLansInput) (*computing.NiftyDescribePrivateLansOutput, error) {
+						return &computing.NiftyDescribePrivateLansOutput{
+							PrivateLanSet: []computing.PrivateLanSetItem{
+								{
+									NetworkId:      nifcloud.String("net-0002"),
+									PrivateLanName: nifcloud.String(input.PrivateLanName[0]),
+									State:          nifcloud.String("available"),
+									Description:    infrav1alpha3.BuildTags(infrav1alpha3.BuildParams{ClusterName: "other", Role: nifcloud.String(privateLANRole)}).ConvToString(),
+								},
+							},
+						}, nil
+					})
+			},
+			wantErr: true,
+		},
+		{
+			name: "use private LAN given by id",
+			spec: &infrav1alpha3.PrivateLANSpec{ID: "net-0001"},
+			expect: func(m *mock_client.MockClientMockRecorder) {
+				m.NiftyDescribePrivateLans(gomock.Any(), &computing.NiftyDescribePrivateLansInput{NetworkId: []string{"net-0001"}}).
+					Return(&computing.NiftyDescribePrivateLansOutput{
+						PrivateLanSet: []computing.PrivateLanSetItem{
+							{
+								NetworkId:      nifcloud.String("net-0001"),
+								PrivateLanName: nifcloud.String("existing"),
+								State:          nifcloud.String("available"),
+							},
+						},
+					}, nil).Times(2)
+			},
+			wantUnmanaged: true,
+		},
+		{
+			name: "private LAN given by id does not exist",
+			spec: &infrav1alpha3.PrivateLANSpec{ID: "net-0001"},
+			expect: func(m *mock_client.MockClientMockRecorder) {
+				m.NiftyDescribePrivateLans(gomock.Any(), gomock.Any()).
+					Return(nil, nferrors.NewNotFound(errors.New("not found")))
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			mockSvc := mock_client.NewMockClient(mockCtrl)
+
+			scope := newPrivateLANTestScope(t, mockSvc, tt.spec)
+			tt.expect(mockSvc.EXPECT())
+
+			service := NewService(scope)
+			err := service.reconcilePrivateLAN()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("reconcilePrivateLAN() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if lan := scope.Network().PrivateLAN; lan == nil || lan.ID != "net-0001" || lan.Unmanaged != tt.wantUnmanaged {
+				t.Errorf("unexpected private LAN status: %+v", lan)
+			}
+		})
+	}
+}
+
+func TestService_reconcileRouter(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockSvc := mock_client.NewMockClient(mockCtrl)
+
+	scope := newPrivateLANTestScope(t, mockSvc, &infrav1alpha3.PrivateLANSpec{
+		CidrBlock: "192.168.0.0/24",
+		Router: &infrav1alpha3.RouterSpec{
+			IPAddress: "192.168.0.1",
+			DHCP: &infrav1alpha3.DHCPSpec{
+				StartIPAddress: "192.168.0.100",
+				StopIPAddress:  "192.168.0.200",
+			},
+		},
+	})
+	scope.Network().PrivateLAN = &infrav1alpha3.PrivateLAN{ID: "net-0001"}
+
+	m := mockSvc.EXPECT()
+	gomock.InOrder(
+		m.NiftyDescribeRouters(gomock.Any(), gomock.Any()).
+			Return(nil, nferrors.NewNotFound(errors.New("not found"))),
+		m.NiftyCreateDhcpConfig(gomock.Any(), gomock.Any()).
+			Return(&computing.NiftyCreateDhcpConfigOutput{
+				DhcpConfig: &computing.DhcpConfig{DhcpConfigId: nifcloud.String("dhcp-0001")},
+			}, nil),
+		m.NiftyCreateDhcpIpAddressPool(gomock.Any(), gomock.Any()).
+			Return(&computing.NiftyCreateDhcpIpAddressPoolOutput{}, nil),
+		m.NiftyCreateRouter(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ interface{}, input *computing.NiftyCreateRouterInput) (*computing.NiftyCreateRouterOutput, error) {
+				if len(input.NetworkInterface) != 2 {
+					t.Fatalf("unexpected network interfaces: %v", input.NetworkInterface)
+				}
+				lan := input.NetworkInterface[1]
+				if nifcloud.StringValue(lan.NetworkId) != "net-0001" || nifcloud.StringValue(lan.DhcpConfigId) != "dhcp-0001" {
+					t.Errorf("unexpected private LAN interface: %v", lan)
+				}
+				if nifcloud.StringValue(input.Type) != defaultRouterType {
+					t.Errorf("unexpected router type: %v", nifcloud.StringValue(input.Type))
+				}
+				return &computing.NiftyCreateRouterOutput{}, nil
+			}),
+		m.NiftyDescribeRouters(gomock.Any(), gomock.Any()).
+			DoAndReturn(describeRouters("available")),
+	)
+
+	if err := NewService(scope).reconcileRouter(); err != nil {
+		t.Fatalf("did not expect error: %v", err)
+	}
+	if got := scope.Network().Router; got == nil || got.ID != "rtr-0001" || got.DHCPConfigID != "dhcp-0001" {
+		t.Errorf("unexpected router status: %+v", got)
+	}
+}
+
+func TestService_DeleteNetwork(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockSvc := mock_client.NewMockClient(mockCtrl)
+
+	scope := newPrivateLANTestScope(t, mockSvc, nil)
+	scope.Network().PrivateLAN = &infrav1alpha3.PrivateLAN{ID: "net-0001", Name: "lan"}
+	scope.Network().Router = &infrav1alpha3.Router{ID: "rtr-0001", Name: "router", DHCPConfigID: "dhcp-0001"}
+
+	m := mockSvc.EXPECT()
+	gomock.InOrder(
+		m.NiftyDeleteRouter(gomock.Any(), gomock.Any()).
+			Return(&computing.NiftyDeleteRouterOutput{}, nil),
+		m.NiftyDescribeRouters(gomock.Any(), gomock.Any()).
+			Return(nil, nferrors.NewNotFound(errors.New("not found"))),
+		m.NiftyDeleteDhcpConfig(gomock.Any(), gomock.Any()).
+			Return(&computing.NiftyDeleteDhcpConfigOutput{}, nil),
+		m.NiftyDeletePrivateLan(gomock.Any(), gomock.Any()).
+			Return(&computing.NiftyDeletePrivateLanOutput{}, nil),
+	)
+
+	if err := NewService(scope).DeleteNetwork(); err != nil {
+		t.Fatalf("did not expect error: %v", err)
+	}
+	if scope.Network().PrivateLAN != nil || scope.Network().Router != nil {
+		t.Errorf("network status is not cleaned up: %+v", scope.Network())
+	}
+}
+
+func TestService_deleteRouter_withoutID(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockSvc := mock_client.NewMockClient(mockCtrl)
+
+	// the router is created, but only the name and the DHCP config are recorded
+	scope := newPrivateLANTestScope(t, mockSvc, nil)
+	scope.Network().Router = &infrav1alpha3.Router{Name: "router", DHCPConfigID: "dhcp-0001"}
+
+	m := mockSvc.EXPECT()
+	gomock.InOrder(
+		m.NiftyDescribeRouters(gomock.Any(), gomock.Any()).
+			DoAndReturn(describeRouters("available")),
+		m.NiftyDeleteRouter(gomock.Any(), &computing.NiftyDeleteRouterInput{RouterId: nifcloud.String("rtr-0001")}).
+			Return(&computing.NiftyDeleteRouterOutput{}, nil),
+		m.NiftyDescribeRouters(gomock.Any(), gomock.Any()).
+			Return(nil, nferrors.NewNotFound(errors.New("not found"))),
+		m.NiftyDeleteDhcpConfig(gomock.Any(), gomock.Any()).
+			Return(&computing.NiftyDeleteDhcpConfigOutput{}, nil),
+	)
+
+	if err := NewService(scope).deleteRouter(); err != nil {
+		t.Fatalf("did not expect error: %v", err)
+	}
+	if scope.Network().Router != nil {
+		t.Errorf("router status is not cleaned up: %+v", scope.Network().Router)
+	}
+}
+
+func TestService_DeleteNetwork_unmanaged(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockSvc := mock_client.NewMockClient(mockCtrl)
+
+	// no request is expected for the resources given in the spec
+	scope := newPrivateLANTestScope(t, mockSvc, &infrav1alpha3.PrivateLANSpec{ID: "net-0001"})
+	scope.Network().PrivateLAN = &infrav1alpha3.PrivateLAN{ID: "net-0001", Name: "lan", Unmanaged: true}
+	scope.Network().SecurityGroups = map[infrav1alpha3.SecurityGroupRole]infrav1alpha3.SecurityGroup{
+		infrav1alpha3.SecurityGroupNode: {Name: "existing", Unmanaged: true},
+	}
+
+	if err := NewService(scope).DeleteNetwork(); err != nil {
+		t.Fatalf("did not expect error: %v", err)
+	}
+	if scope.Network().PrivateLAN != nil {
+		t.Errorf("network status is not cleaned up: %+v", scope.Network())
+	}
+}
+
+func TestService_getNetworkInterfaces(t *testing.T) {
+	tests := []struct {
+		name       string
+		lan        *infrav1alpha3.PrivateLAN
+		ids        []string
+		publicType infrav1alpha3.PublicType
+		want       []string
+	}{
+		{
+			name: "keep interfaces without private LAN",
+			ids:  []string{"net-COMMON_GLOBAL", "net-COMMON_PRIVATE"},
+			want: []string{"net-COMMON_GLOBAL", "net-COMMON_PRIVATE"},
+		},
+		{
+			name: "attach private LAN with global network by default",
+			lan:  &infrav1alpha3.PrivateLAN{ID: "net-0001"},
+			want: []string{"net-COMMON_GLOBAL", "net-0001"},
+		},
+		{
+			name: "replace common private network with private LAN",
+			lan:  &infrav1alpha3.PrivateLAN{ID: "net-0001"},
+			ids:  []string{"net-COMMON_GLOBAL", "net-COMMON_PRIVATE", "net-0001"},
+			want: []string{"net-COMMON_GLOBAL", "net-0001"},
+		},
+		{
+			name:       "attach only private LAN to private machine",
+			lan:        &infrav1alpha3.PrivateLAN{ID: "net-0001"},
+			publicType: infrav1alpha3.PublicTypePrivate,
+			want:       []string{"net-0001"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scope := newPrivateLANTestScope(t, mock_client.NewMockClient(gomock.NewController(t)), nil)
+			scope.Network().PrivateLAN = tt.lan
+
+			if got := NewService(scope).getNetworkInterfaces(tt.ids, tt.publicType); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getNetworkInterfaces() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
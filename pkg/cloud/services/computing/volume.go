@@ -0,0 +1,243 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package computing
+
+import (
+	"context"
+	"sort"
+
+	"github.com/aokumasan/nifcloud-sdk-go-v2/nifcloud"
+	"github.com/aokumasan/nifcloud-sdk-go-v2/service/computing"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/cluster-api/util/record"
+
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/scope"
+)
+
+const (
+	volumeAvailable    = "available"
+	attachmentAttached = "attached"
+
+	// volumeTagKey is the tag key of the volume name in the machine spec
+	volumeTagKey = "volume"
+)
+
+// ReconcileVolumes takes the next step to create and attach the volumes of the machine,
+// volumes are created one by one in the order of the spec so that the instance finds them in the order,
+// it returns true once every volume is attached to the instance
+func (s *Service) ReconcileVolumes(scope *scope.MachineScope, instanceID string) (bool, error) {
+	volumes := scope.NifcloudMachine.Spec.Volumes
+	if len(volumes) == 0 {
+		return true, nil
+	}
+
+	current, err := s.describeMachineVolumes(scope)
+	if err != nil {
+		return false, err
+	}
+	statuses := make([]infrav1alpha3.VolumeStatus, 0, len(volumes))
+	for _, v := range volumes {
+		if item, ok := current[v.Name]; ok {
+			statuses = append(statuses, volumeToStatus(v.Name, item))
+		}
+	}
+	scope.SetVolumes(statuses)
+
+	for _, v := range volumes {
+		item, ok := current[v.Name]
+		if !ok {
+			id, err := s.createVolume(scope, instanceID, v)
+			if err != nil {
+				record.Warnf(scope.NifcloudMachine, "FailedCreateVolume", "Failed to create volume %q: %v", v.Name, err)
+				return false, err
+			}
+			record.Eventf(scope.NifcloudMachine, "SuccessfulCreateVolume", "Created volume %q [%s]", v.Name, id)
+			scope.SetVolumes(append(statuses, infrav1alpha3.VolumeStatus{Name: v.Name, ID: id}))
+			return false, nil
+		}
+
+		id := nifcloud.StringValue(item.VolumeId)
+		attachment := volumeAttachment(item)
+		switch {
+		case attachment == nil && nifcloud.StringValue(item.Status) == volumeAvailable:
+			s.scope.V(2).Info("Attaching volume", "volume-id", id, "instance-id", instanceID)
+			_, err := s.scope.NifcloudClients.Computing.AttachVolume(context.TODO(), &computing.AttachVolumeInput{
+				VolumeId:   nifcloud.String(id),
+				InstanceId: nifcloud.String(instanceID),
+			})
+			if err != nil {
+				record.Warnf(scope.NifcloudMachine, "FailedAttachVolume", "Failed to attach volume %q: %v", v.Name, err)
+				return false, errors.Wrapf(err, "failed to attach volume %q to instance %q", id, instanceID)
+			}
+			record.Eventf(scope.NifcloudMachine, "SuccessfulAttachVolume", "Attached volume %q [%s]", v.Name, id)
+			return false, nil
+		case attachment == nil:
+			s.scope.V(2).Info("Waiting for volume state transition", "volume-id", id, "status", nifcloud.StringValue(item.Status))
+			return false, nil
+		case nifcloud.StringValue(attachment.InstanceId) != instanceID:
+			return false, errors.Errorf("volume %q is attached to another instance %q", id, nifcloud.StringValue(attachment.InstanceId))
+		case nifcloud.StringValue(attachment.Status) != attachmentAttached:
+			s.scope.V(2).Info("Waiting for volume to be attached", "volume-id", id, "status", nifcloud.StringValue(attachment.Status))
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// DeleteVolumes takes the next step to detach the volumes from the stopped instance
+// and delete the volumes which are not retained,
+// it returns true once the retained volumes are detached and the others disappear
+func (s *Service) DeleteVolumes(scope *scope.MachineScope, instanceID string) (bool, error) {
+	if len(scope.NifcloudMachine.Spec.Volumes) == 0 && len(scope.NifcloudMachine.Status.Volumes) == 0 {
+		return true, nil
+	}
+
+	retain := map[string]bool{}
+	for _, v := range scope.NifcloudMachine.Spec.Volumes {
+		retain[v.Name] = v.Retain
+	}
+
+	current, err := s.describeMachineVolumes(scope)
+	if err != nil {
+		return false, err
+	}
+	statuses := make([]infrav1alpha3.VolumeStatus, 0, len(current))
+	done := true
+	for _, name := range sortedVolumeNames(current) {
+		item := current[name]
+		statuses = append(statuses, volumeToStatus(name, item))
+		id := nifcloud.StringValue(item.VolumeId)
+
+		if attachment := volumeAttachment(item); attachment != nil {
+			if nifcloud.StringValue(attachment.InstanceId) != instanceID {
+				s.scope.Info("Volume is attached to another instance, leaving it", "volume-id", id, "instance-id", nifcloud.StringValue(attachment.InstanceId))
+				continue
+			}
+			done = false
+			if nifcloud.StringValue(attachment.Status) != attachmentAttached {
+				s.scope.V(2).Info("Waiting for volume state transition", "volume-id", id, "status", nifcloud.StringValue(attachment.Status))
+				continue
+			}
+			s.scope.V(2).Info("Detaching volume", "volume-id", id, "instance-id", instanceID)
+			_, err := s.scope.NifcloudClients.Computing.DetachVolume(context.TODO(), &computing.DetachVolumeInput{
+				VolumeId:   nifcloud.String(id),
+				InstanceId: nifcloud.String(instanceID),
+			})
+			if err != nil {
+				return false, errors.Wrapf(err, "failed to detach volume %q from instance %q", id, instanceID)
+			}
+			record.Eventf(scope.NifcloudMachine, "SuccessfulDetachVolume", "Detached volume %q [%s]", name, id)
+			continue
+		}
+
+		if retain[name] {
+			continue
+		}
+		done = false
+		if nifcloud.StringValue(item.Status) != volumeAvailable {
+			s.scope.V(2).Info("Waiting for volume state transition", "volume-id", id, "status", nifcloud.StringValue(item.Status))
+			continue
+		}
+		s.scope.V(2).Info("Deleting volume", "volume-id", id)
+		if _, err := s.scope.NifcloudClients.Computing.DeleteVolume(context.TODO(), &computing.DeleteVolumeInput{
+			VolumeId: nifcloud.String(id),
+		}); err != nil {
+			return false, errors.Wrapf(err, "failed to delete volume %q", id)
+		}
+		record.Eventf(scope.NifcloudMachine, "SuccessfulDeleteVolume", "Deleted volume %q [%s]", name, id)
+	}
+	scope.SetVolumes(statuses)
+	return done, nil
+}
+
+func (s *Service) createVolume(scope *scope.MachineScope, instanceID string, v infrav1alpha3.Volume) (string, error) {
+	s.scope.V(2).Info("Creating volume", "volume", v.Name, "instance-id", instanceID)
+
+	input := &computing.CreateVolumeInput{
+		InstanceId:  nifcloud.String(instanceID),
+		Size:        nifcloud.Int64(v.Size),
+		Description: s.volumeTags(scope, v.Name).ConvToString(),
+	}
+	if v.DiskType != "" {
+		input.DiskType = nifcloud.String(v.DiskType)
+	}
+	out, err := s.scope.NifcloudClients.Computing.CreateVolume(context.TODO(), input)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to create volume %q for instance %q", v.Name, instanceID)
+	}
+	return nifcloud.StringValue(out.VolumeId), nil
+}
+
+// describeMachineVolumes returns the volumes of the machine by their names,
+// volumes are found by the tags in the description as they are created before their ids are recorded
+func (s *Service) describeMachineVolumes(scope *scope.MachineScope) (map[string]computing.VolumeSetItem, error) {
+	out, err := s.scope.NifcloudClients.Computing.DescribeVolumes(context.TODO(), &computing.DescribeVolumesInput{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to describe volumes")
+	}
+
+	want := s.volumeTags(scope, "")
+	volumes := map[string]computing.VolumeSetItem{}
+	for _, item := range out.VolumeSet {
+		tags := infrav1alpha3.ParseTags(nifcloud.StringValue(item.Description))
+		if tags["cluster"] != want["cluster"] || tags["Name"] != want["Name"] || tags[volumeTagKey] == "" {
+			continue
+		}
+		volumes[tags[volumeTagKey]] = item
+	}
+	return volumes, nil
+}
+
+// volumeTags returns the tags of the volume of the machine
+func (s *Service) volumeTags(scope *scope.MachineScope, name string) infrav1alpha3.Tag {
+	tags := infrav1alpha3.BuildTags(infrav1alpha3.BuildParams{
+		ClusterName: s.scope.Name(),
+		Name:        nifcloud.String(scope.GetInstanceIDConved()),
+	})
+	tags[volumeTagKey] = name
+	return tags
+}
+
+// volumeAttachment returns the attachment of the volume, or nil if the volume is detached
+func volumeAttachment(item computing.VolumeSetItem) *computing.AttachmentSetItem {
+	if len(item.AttachmentSet) == 0 {
+		return nil
+	}
+	return &item.AttachmentSet[0]
+}
+
+func volumeToStatus(name string, item computing.VolumeSetItem) infrav1alpha3.VolumeStatus {
+	status := infrav1alpha3.VolumeStatus{
+		Name:   name,
+		ID:     nifcloud.StringValue(item.VolumeId),
+		Status: nifcloud.StringValue(item.Status),
+	}
+	if attachment := volumeAttachment(item); attachment != nil {
+		status.Device = nifcloud.StringValue(attachment.Device)
+	}
+	return status
+}
+
+func sortedVolumeNames(volumes map[string]computing.VolumeSetItem) []string {
+	names := make([]string, 0, len(volumes))
+	for name := range volumes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
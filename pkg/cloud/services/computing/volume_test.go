@@ -0,0 +1,238 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package computing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aokumasan/nifcloud-sdk-go-v2/nifcloud"
+	"github.com/aokumasan/nifcloud-sdk-go-v2/service/computing"
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
+	nferrors "github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/errors"
+	nffake "github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/fake"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/scope"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var testVolumes = []infrav1alpha3.Volume{
+	{Name: "etcd", Size: 100, Purpose: infrav1alpha3.VolumePurposeEtcd},
+	{Name: "data", Size: 200, DiskType: "2", Purpose: infrav1alpha3.VolumePurposeData, MountPath: "/mnt/data", Retain: true},
+}
+
+// newVolumeTestService returns the service and the scope of the machine which has the volumes,
+// the instance of the machine is running on the client
+func newVolumeTestService(t *testing.T, client *nffake.Client, volumes []infrav1alpha3.Volume) (*Service, *scope.MachineScope, string) {
+	scheme := runtime.NewScheme()
+	if err := infrav1alpha3.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	instanceID := scope.InstanceIDFromName("test-machine")
+	if _, err := client.RunInstances(context.TODO(), &computing.RunInstancesInput{InstanceId: nifcloud.String(instanceID)}); err != nil {
+		t.Fatal(err)
+	}
+	client.Advance()
+
+	clusterScope, err := scope.NewClusterScope(scope.ClusterScopeParams{
+		Cluster:         &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test"}},
+		NifcloudClients: scope.NifcloudClients{Computing: client},
+		NifcloudCluster: &infrav1alpha3.NifcloudCluster{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nifcloudMachine := &infrav1alpha3.NifcloudMachine{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-machine"},
+		Spec:       infrav1alpha3.NifcloudMachineSpec{Volumes: volumes},
+	}
+	machineScope, err := scope.NewMachineScope(scope.MachineScopeParams{
+		Client:          fake.NewFakeClientWithScheme(scheme, nifcloudMachine),
+		Cluster:         clusterScope.Cluster,
+		Machine:         &clusterv1.Machine{},
+		NifcloudCluster: clusterScope.NifcloudCluster,
+		NifcloudMachine: nifcloudMachine,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewService(clusterScope), machineScope, instanceID
+}
+
+// reconcileVolumes calls ReconcileVolumes until every volume is attached
+func reconcileVolumes(t *testing.T, s *Service, machineScope *scope.MachineScope, instanceID string) {
+	for i := 0; i < 10; i++ {
+		attached, err := s.ReconcileVolumes(machineScope, instanceID)
+		if err != nil {
+			t.Fatalf("did not expect error: %v", err)
+		}
+		if attached {
+			return
+		}
+	}
+	t.Fatal("expected the volumes to be attached")
+}
+
+func TestService_ReconcileVolumes(t *testing.T) {
+	client := nffake.NewClient()
+	s, machineScope, instanceID := newVolumeTestService(t, client, testVolumes)
+
+	// the second volume waits for the first one to be attached
+	if attached, err := s.ReconcileVolumes(machineScope, instanceID); err != nil || attached {
+		t.Fatalf("expected the first volume to be created, got attached %v, error %v", attached, err)
+	}
+	if n := client.Calls("CreateVolume"); n != 1 {
+		t.Fatalf("expected a volume to be created, got %d", n)
+	}
+
+	reconcileVolumes(t, s, machineScope, instanceID)
+	if n := client.Calls("CreateVolume"); n != len(testVolumes) {
+		t.Errorf("expected each volume to be created once, got %d", n)
+	}
+	got := machineScope.NifcloudMachine.Status.Volumes
+	if len(got) != len(testVolumes) {
+		t.Fatalf("expected status of %d volumes, got %+v", len(testVolumes), got)
+	}
+	for i, want := range []string{"SCSI (0:1)", "SCSI (0:2)"} {
+		if got[i].Name != testVolumes[i].Name || got[i].ID == "" || got[i].Device != want || got[i].Status != "in-use" {
+			t.Errorf("unexpected status of volume %q: %+v", testVolumes[i].Name, got[i])
+		}
+	}
+
+	out, err := client.DescribeVolumes(context.TODO(), &computing.DescribeVolumesInput{VolumeId: []string{got[1].ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := nifcloud.StringValue(out.VolumeSet[0].Size); size != "200" {
+		t.Errorf("expected the size of the spec, got %q", size)
+	}
+	if diskType := nifcloud.StringValue(out.VolumeSet[0].DiskType); diskType != "2" {
+		t.Errorf("expected the disk type of the spec, got %q", diskType)
+	}
+
+	// attached volumes are left as they are
+	if attached, err := s.ReconcileVolumes(machineScope, instanceID); err != nil || !attached {
+		t.Errorf("expected the volumes to stay attached, got attached %v, error %v", attached, err)
+	}
+	if n := client.Calls("CreateVolume") + client.Calls("AttachVolume"); n != len(testVolumes) {
+		t.Errorf("expected no more requests, got %d", n)
+	}
+}
+
+func TestService_ReconcileVolumes_errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(c *nffake.Client)
+	}{
+		{
+			name: "failed to describe volumes",
+			setup: func(c *nffake.Client) {
+				c.InjectError("DescribeVolumes", nffake.NewError(nferrors.AuthFailure))
+			},
+		},
+		{
+			name: "failed to create volume",
+			setup: func(c *nffake.Client) {
+				c.InjectError("CreateVolume", nffake.NewError(nferrors.InvalidParameter))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := nffake.NewClient()
+			s, machineScope, instanceID := newVolumeTestService(t, client, testVolumes)
+			tt.setup(client)
+
+			if _, err := s.ReconcileVolumes(machineScope, instanceID); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestService_ReconcileVolumes_reattach(t *testing.T) {
+	client := nffake.NewClient()
+	client.TransitionSteps = 0
+	s, machineScope, instanceID := newVolumeTestService(t, client, testVolumes[:1])
+	reconcileVolumes(t, s, machineScope, instanceID)
+
+	// the volume detached by hand is attached again
+	id := machineScope.NifcloudMachine.Status.Volumes[0].ID
+	if _, err := client.DetachVolume(context.TODO(), &computing.DetachVolumeInput{VolumeId: nifcloud.String(id)}); err != nil {
+		t.Fatal(err)
+	}
+	reconcileVolumes(t, s, machineScope, instanceID)
+	if n := client.Calls("AttachVolume"); n != 1 {
+		t.Errorf("expected the volume to be attached once, got %d", n)
+	}
+	if n := client.Calls("CreateVolume"); n != 1 {
+		t.Errorf("expected the volume not to be created again, got %d", n)
+	}
+}
+
+func TestService_DeleteVolumes(t *testing.T) {
+	client := nffake.NewClient()
+	s, machineScope, instanceID := newVolumeTestService(t, client, testVolumes)
+	reconcileVolumes(t, s, machineScope, instanceID)
+	retained := machineScope.NifcloudMachine.Status.Volumes[1].ID
+
+	released := false
+	for i := 0; i < 10 && !released; i++ {
+		var err error
+		if released, err = s.DeleteVolumes(machineScope, instanceID); err != nil {
+			t.Fatalf("did not expect error: %v", err)
+		}
+	}
+	if !released {
+		t.Fatal("expected the volumes to be released")
+	}
+
+	out, err := client.DescribeVolumes(context.TODO(), &computing.DescribeVolumesInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.VolumeSet) != 1 || nifcloud.StringValue(out.VolumeSet[0].VolumeId) != retained {
+		t.Fatalf("expected only the retained volume %q to be kept, got %+v", retained, out.VolumeSet)
+	}
+	if v := out.VolumeSet[0]; nifcloud.StringValue(v.Status) != "available" || len(v.AttachmentSet) != 0 {
+		t.Errorf("expected the retained volume to be detached, got %+v", v)
+	}
+	if n := client.Calls("DetachVolume"); n != len(testVolumes) {
+		t.Errorf("expected each volume to be detached once, got %d", n)
+	}
+	if n := client.Calls("DeleteVolume"); n != 1 {
+		t.Errorf("expected the volume which is not retained to be deleted once, got %d", n)
+	}
+	if got := machineScope.NifcloudMachine.Status.Volumes; len(got) != 1 || got[0].ID != retained || got[0].Device != "" {
+		t.Errorf("expected the status of the retained volume, got %+v", got)
+	}
+}
+
+func TestService_DeleteVolumes_noVolumes(t *testing.T) {
+	client := nffake.NewClient()
+	s, machineScope, instanceID := newVolumeTestService(t, client, nil)
+
+	released, err := s.DeleteVolumes(machineScope, instanceID)
+	if err != nil || !released {
+		t.Errorf("expected no volumes to be released, got released %v, error %v", released, err)
+	}
+	if n := client.Calls("DescribeVolumes"); n != 0 {
+		t.Errorf("expected volumes not to be described, got %d", n)
+	}
+}
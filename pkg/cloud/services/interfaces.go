@@ -17,14 +17,19 @@ limitations under the License.
 package services
 
 import (
-	infrav1alpha2 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha2"
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
 	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/scope"
 )
 
 type NifcloudMachineInterface interface {
-	InstanceIfExists(id *string) (*infrav1alpha2.Instance, error)
-	CreateInstance(scope *scope.MachineScope) (*infrav1alpha2.Instance, error)
-	GetRunningInstanceByTag(scope *scope.MachineScope) (*infrav1alpha2.Instance, error)
-	StopAndTerminateInstanceWithTimeout(id string) error
-	TerminateInstance(id string) error
+	InstanceIfExists(id *string) (*infrav1alpha3.Instance, error)
+	CreateInstance(scope *scope.MachineScope) (*infrav1alpha3.Instance, error)
+	GetRunningInstanceByTag(scope *scope.MachineScope) (*infrav1alpha3.Instance, error)
+	DeleteInstance(instance *infrav1alpha3.Instance) error
+	AttachControlPlaneEndpoint(id string) error
+	DeregisterInstanceFromLoadBalancer(id string) error
+	DetachControlPlaneEndpoint(id string) (bool, error)
+	DeregisterInstanceFromSecurityGroups(id string) (bool, error)
+	ReconcileVolumes(scope *scope.MachineScope, id string) (bool, error)
+	DeleteVolumes(scope *scope.MachineScope, id string) (bool, error)
 }
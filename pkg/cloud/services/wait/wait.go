@@ -21,6 +21,7 @@ import (
 
 	"github.com/pkg/errors"
 	nferrors "github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/errors"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/metrics"
 	"k8s.io/apimachinery/pkg/util/wait"
 )
 
@@ -34,7 +35,12 @@ func NewBackoff() wait.Backoff {
 	}
 }
 
-func WaitForWithRetryable(backoff wait.Backoff, condition wait.ConditionFunc, retryableErrors ...string) error {
+func WaitForWithRetryable(backoff wait.Backoff, condition wait.ConditionFunc, retryableErrors ...string) (err error) {
+	start := time.Now()
+	defer func() {
+		metrics.ObserveWait(time.Since(start), err)
+	}()
+
 	var retErr error
 	waitErr := wait.ExponentialBackoff(backoff, func() (bool, error) {
 		// clear error from previous iteration
@@ -0,0 +1,79 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package userdata
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+)
+
+const (
+	mimeShellScript = "text/x-shellscript"
+	mimeCloudConfig = "text/cloud-config"
+)
+
+// Part is a single document of a multi-part cloud-init userdata
+type Part struct {
+	// ContentType is a cloud-init content type such as text/x-shellscript
+	ContentType string
+	// Filename is a name of the part shown in cloud-init logs
+	Filename string
+	Content  []byte
+}
+
+// ShellScriptPart returns a part which is run as a user script by cloud-init
+func ShellScriptPart(filename string, content []byte) Part {
+	return Part{ContentType: mimeShellScript, Filename: filename, Content: content}
+}
+
+// CloudConfigPart returns a part which is merged into cloud-init cloud-config
+func CloudConfigPart(filename string, content []byte) Part {
+	return Part{ContentType: mimeCloudConfig, Filename: filename, Content: content}
+}
+
+// NewMultipart composes parts into a MIME multi-part document which cloud-init can consume
+// cloud-init runs shell script parts before the runcmd of cloud-config,
+// so packages installed by scripts are available to the bootstrap commands
+func NewMultipart(parts ...Part) ([]byte, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, p := range parts {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", fmt.Sprintf("%s; charset=\"utf-8\"", p.ContentType))
+		header.Set("MIME-Version", "1.0")
+		header.Set("Content-Transfer-Encoding", "7bit")
+		header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", p.Filename))
+		pw, err := w.CreatePart(header)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create userdata part %q: %w", p.Filename, err)
+		}
+		if _, err := pw.Write(p.Content); err != nil {
+			return nil, fmt.Errorf("failed to write userdata part %q: %w", p.Filename, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close userdata: %w", err)
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "Content-Type: multipart/mixed; boundary=%q\n", w.Boundary())
+	fmt.Fprintf(&out, "MIME-Version: 1.0\n\n")
+	out.Write(body.Bytes())
+	return out.Bytes(), nil
+}
@@ -17,14 +17,13 @@ limitations under the License.
 package userdata
 
 const (
-	ScriptTemplate = `#!/bin/bash
+	// SetupScriptTemplate installs the container runtime and kubernetes packages
+	SetupScriptTemplate = `#!/bin/bash
 # update cloud-init
 tdnf install -y yum
 tdnf makecache
 yum update -y cloud-init 
 
-yum install -y inotify-tools
-
 # enable docker
 systemctl enable docker
 systemctl start docker
@@ -59,6 +58,10 @@ echo 'export PATH="${PATH}:/opt/bin"' >> ~/.bash_profile
 # config DNS
 sed -i -e "s/DNS=127.0.0.1/DNS=8.8.8.8/g" /etc/systemd/resolved.conf
 systemctl restart systemd-resolved.service
+`
+
+	// WatcherScriptTemplate waits for bootstrap data copied over SSH and runs cloud-init with it
+	WatcherScriptTemplate = `yum install -y inotify-tools
 
 cat <<"EOF" > /opt/startup.sh
 #!/bin/bash
@@ -110,4 +113,58 @@ EOF
 systemctl enable startup
 systemctl start startup
 `
+
+	// VolumeScriptTemplate waits for the volumes attached after the instance gets running and mounts them.
+	// a volume is formatted with its label and found by the label afterwards, even when it is attached again,
+	// an unformatted volume is the first unused disk of its size in the order of the SCSI address,
+	// as the volumes are attached one by one in the order of the spec
+	VolumeScriptTemplate = `#!/bin/bash
+find_volume() {
+  label=${1}
+  size=${2}
+  if [ -e /dev/disk/by-label/${label} ]; then
+    readlink -f /dev/disk/by-label/${label}
+    return 0
+  fi
+  lsblk -b -d -n -p -o NAME,SIZE,TYPE,HCTL | sort -V -k4 | while read name bytes type hctl; do
+    [ "${type}" = "disk" ] && [ "${bytes}" = "${size}" ] || continue
+    # disks which have partitions or a filesystem are not unused volumes
+    [ "$(lsblk -n -o NAME ${name} | wc -l)" = "1" ] || continue
+    blkid ${name} > /dev/null && continue
+    echo ${name}
+    break
+  done
+}
+
+mount_volume() {
+  label=${1}
+  size=${2}
+  path=${3}
+  device=""
+  for i in $(seq 1 120); do
+    device=$(find_volume ${label} ${size})
+    [ -n "${device}" ] && break
+    sleep 5
+  done
+  if [ -z "${device}" ]; then
+    echo "volume ${label} of ${size} bytes for ${path} is not attached" >&2
+    return 1
+  fi
+  if ! blkid ${device} > /dev/null; then
+    mkfs.ext4 -q -L ${label} ${device}
+    udevadm settle
+  fi
+  mkdir -p ${path}
+  if ! grep -q "^LABEL=${label} " /etc/fstab; then
+    echo "LABEL=${label} ${path} ext4 defaults,nofail 0 2" >> /etc/fstab
+  fi
+  mountpoint -q ${path} || mount ${path}
+}
+{{ range . }}
+mount_volume {{ .Label }} {{ .Size }} {{ .MountPath }}
+{{- end }}
+`
+
+	// ScriptTemplate is the whole userdata script for machines receiving bootstrap data over SSH
+	ScriptTemplate = SetupScriptTemplate + WatcherScriptTemplate
 )
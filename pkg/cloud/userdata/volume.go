@@ -0,0 +1,47 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package userdata
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+// VolumeMount is an additional volume which the userdata formats and mounts
+type VolumeMount struct {
+	// Label is the filesystem label which identifies the volume once it is formatted,
+	// ext4 limits it to 16 characters
+	Label string
+	// Size is the size of the volume in bytes, which finds the volume before it is formatted
+	Size int64
+	// MountPath is where the volume is mounted
+	MountPath string
+}
+
+// VolumeScript returns the script which mounts the volumes, it must run before the container runtime starts
+func VolumeScript(mounts []VolumeMount) ([]byte, error) {
+	tpl, err := template.New("volumes").Parse(VolumeScriptTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse volume script: %w", err)
+	}
+	var out bytes.Buffer
+	if err := tpl.Execute(&out, mounts); err != nil {
+		return nil, fmt.Errorf("failed to render volume script: %w", err)
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package conditions manipulates the conditions of NifcloudCluster and NifcloudMachine
+package conditions
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
+)
+
+// Getter is implemented by the objects which have conditions
+type Getter interface {
+	GetConditions() infrav1alpha3.Conditions
+}
+
+// Setter is implemented by the objects whose conditions can be updated
+type Setter interface {
+	Getter
+	SetConditions(infrav1alpha3.Conditions)
+}
+
+// now returns the transition time, replaced in tests
+var now = metav1.Now
+
+// Get returns the condition of the type, or nil if it is not set
+func Get(from Getter, t infrav1alpha3.ConditionType) *infrav1alpha3.Condition {
+	for _, c := range from.GetConditions() {
+		if c.Type == t {
+			c := c
+			return &c
+		}
+	}
+	return nil
+}
+
+// IsTrue returns true if the condition of the type is True
+func IsTrue(from Getter, t infrav1alpha3.ConditionType) bool {
+	c := Get(from, t)
+	return c != nil && c.Status == corev1.ConditionTrue
+}
+
+// Set adds or replaces the condition of the same type,
+// the last transition time is kept unless the status changes
+func Set(to Setter, condition infrav1alpha3.Condition) {
+	conditions := to.GetConditions()
+	for i := range conditions {
+		if conditions[i].Type != condition.Type {
+			continue
+		}
+		if conditions[i].Status == condition.Status {
+			condition.LastTransitionTime = conditions[i].LastTransitionTime
+		} else {
+			condition.LastTransitionTime = now()
+		}
+		conditions[i] = condition
+		to.SetConditions(conditions)
+		return
+	}
+	condition.LastTransitionTime = now()
+	to.SetConditions(append(conditions, condition))
+}
+
+// MarkTrue sets the condition of the type to True
+func MarkTrue(to Setter, t infrav1alpha3.ConditionType) {
+	Set(to, infrav1alpha3.Condition{
+		Type:   t,
+		Status: corev1.ConditionTrue,
+	})
+}
+
+// MarkFalse sets the condition of the type to False with the reason
+func MarkFalse(to Setter, t infrav1alpha3.ConditionType, reason string, severity infrav1alpha3.ConditionSeverity, messageFormat string, messageArgs ...interface{}) {
+	Set(to, infrav1alpha3.Condition{
+		Type:     t,
+		Status:   corev1.ConditionFalse,
+		Severity: severity,
+		Reason:   reason,
+		Message:  fmt.Sprintf(messageFormat, messageArgs...),
+	})
+}
+
+// SetSummary sets the Ready condition from the conditions of the types,
+// it mirrors the first condition which is not True, in the order of the types
+func SetSummary(to Setter, types ...infrav1alpha3.ConditionType) {
+	for _, t := range types {
+		c := Get(to, t)
+		if c == nil || c.Status == corev1.ConditionTrue {
+			continue
+		}
+		Set(to, infrav1alpha3.Condition{
+			Type:     infrav1alpha3.ReadyCondition,
+			Status:   c.Status,
+			Severity: c.Severity,
+			Reason:   c.Reason,
+			Message:  c.Message,
+		})
+		return
+	}
+	MarkTrue(to, infrav1alpha3.ReadyCondition)
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package conditions
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
+)
+
+func setNow(t *testing.T, tm metav1.Time) {
+	t.Helper()
+	now = func() metav1.Time { return tm }
+}
+
+func TestSet(t *testing.T) {
+	defer func() { now = metav1.Now }()
+	t1 := metav1.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC)
+	t2 := metav1.Date(2020, 4, 1, 0, 1, 0, 0, time.UTC)
+
+	m := &infrav1alpha3.NifcloudMachine{}
+	setNow(t, t1)
+	MarkFalse(m, infrav1alpha3.InstanceReadyCondition, infrav1alpha3.InstanceNotReadyReason, infrav1alpha3.ConditionSeverityInfo, "instance is %s", "pending")
+
+	c := Get(m, infrav1alpha3.InstanceReadyCondition)
+	if c == nil {
+		t.Fatal("condition is not set")
+	}
+	if c.Status != corev1.ConditionFalse || c.Reason != infrav1alpha3.InstanceNotReadyReason || c.Message != "instance is pending" || !c.LastTransitionTime.Equal(&t1) {
+		t.Errorf("unexpected condition: %+v", c)
+	}
+
+	// the same status keeps the transition time
+	setNow(t, t2)
+	MarkFalse(m, infrav1alpha3.InstanceReadyCondition, infrav1alpha3.InstanceNotReadyReason, infrav1alpha3.ConditionSeverityInfo, "instance is %s", "waiting")
+	c = Get(m, infrav1alpha3.InstanceReadyCondition)
+	if c.Message != "instance is waiting" || !c.LastTransitionTime.Equal(&t1) {
+		t.Errorf("unexpected condition: %+v", c)
+	}
+
+	// the new status updates the transition time
+	MarkTrue(m, infrav1alpha3.InstanceReadyCondition)
+	c = Get(m, infrav1alpha3.InstanceReadyCondition)
+	if !IsTrue(m, infrav1alpha3.InstanceReadyCondition) || c.Reason != "" || !c.LastTransitionTime.Equal(&t2) {
+		t.Errorf("unexpected condition: %+v", c)
+	}
+	if len(m.Status.Conditions) != 1 {
+		t.Errorf("conditions are duplicated: %+v", m.Status.Conditions)
+	}
+}
+
+func TestSetSummary(t *testing.T) {
+	tests := []struct {
+		name       string
+		conditions infrav1alpha3.Conditions
+		want       infrav1alpha3.Condition
+	}{
+		{
+			name: "no condition",
+			want: infrav1alpha3.Condition{Type: infrav1alpha3.ReadyCondition, Status: corev1.ConditionTrue},
+		},
+		{
+			name: "all true",
+			conditions: infrav1alpha3.Conditions{
+				{Type: infrav1alpha3.EndpointReadyCondition, Status: corev1.ConditionTrue},
+				{Type: infrav1alpha3.SecurityGroupsReadyCondition, Status: corev1.ConditionTrue},
+			},
+			want: infrav1alpha3.Condition{Type: infrav1alpha3.ReadyCondition, Status: corev1.ConditionTrue},
+		},
+		{
+			name: "first false in order of the types",
+			conditions: infrav1alpha3.Conditions{
+				{
+					Type:     infrav1alpha3.SecurityGroupsReadyCondition,
+					Status:   corev1.ConditionFalse,
+					Severity: infrav1alpha3.ConditionSeverityError,
+					Reason:   infrav1alpha3.IngressRulesAuthorizationFailedReason,
+					Message:  "security group",
+				},
+				{
+					Type:     infrav1alpha3.EndpointReadyCondition,
+					Status:   corev1.ConditionFalse,
+					Severity: infrav1alpha3.ConditionSeverityError,
+					Reason:   infrav1alpha3.EndpointAllocationFailedReason,
+					Message:  "endpoint",
+				},
+			},
+			want: infrav1alpha3.Condition{
+				Type:     infrav1alpha3.ReadyCondition,
+				Status:   corev1.ConditionFalse,
+				Severity: infrav1alpha3.ConditionSeverityError,
+				Reason:   infrav1alpha3.EndpointAllocationFailedReason,
+				Message:  "endpoint",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &infrav1alpha3.NifcloudCluster{}
+			c.Status.Conditions = tt.conditions
+			SetSummary(c, infrav1alpha3.EndpointReadyCondition, infrav1alpha3.SecurityGroupsReadyCondition)
+
+			got := Get(c, infrav1alpha3.ReadyCondition)
+			if got == nil {
+				t.Fatal("ready condition is not set")
+			}
+			got.LastTransitionTime = metav1.Time{}
+			if *got != tt.want {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,412 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gc collects nifcloud resources which are left behind by failed reconciliations.
+// Ownership of the resources is kept only in their descriptions,
+// so resources whose NifcloudCluster or NifcloudMachine no longer exists are orphaned.
+// The descriptions only have the name of the cluster, which may be shared by other management clusters,
+// so a resource is attributed to this management cluster only when the collector has seen its cluster in the account,
+// and an instance of a live cluster only when the collector has seen its NifcloudMachine.
+// A resource is handled only after it is found orphaned by two consecutive collections,
+// so resources created while a collection lists the objects are not collected.
+package gc
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/aokumasan/nifcloud-sdk-go-v2/nifcloud"
+	"github.com/aokumasan/nifcloud-sdk-go-v2/service/computing"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/scope"
+)
+
+const (
+	// kinds of the resources to collect
+	KindInstance      = "Instance"
+	KindSecurityGroup = "SecurityGroup"
+	KindAddress       = "Address"
+
+	// roles of the instances which belong to machines, other instances belong to the cluster
+	controlPlaneRole = "control-plane"
+	nodeRole         = "node"
+)
+
+// Orphan is a nifcloud resource whose owner no longer exists
+type Orphan struct {
+	Kind    string
+	ID      string
+	Cluster string
+	Role    string
+	// State of the instance, which decides the next step to delete it
+	State infrav1alpha3.InstanceState
+}
+
+// Collector periodically finds orphaned resources and deletes them,
+// it only reports them with events and metrics in dry-run mode
+type Collector struct {
+	Client      client.Client
+	ClientCache *scope.ClientCache
+	Log         logr.Logger
+	Recorder    record.EventRecorder
+
+	// Interval is the period between collections
+	Interval time.Duration
+	// DryRun reports orphaned resources without deleting them
+	DryRun bool
+	// Namespace is where the events about orphaned resources are recorded
+	Namespace string
+
+	// accounts are the clients of the accounts used by the clusters seen by the previous collections,
+	// they are kept to collect the resources of an account after its last cluster is deleted
+	accounts map[string]cloud.Client
+	// seen are the names of the clusters seen in each account
+	seen map[string]map[string]bool
+	// owned are the ids of the instances seen with their NifcloudMachines in each account
+	owned map[string]map[string]bool
+	// suspects are the orphans found by the previous collection in each account
+	suspects map[string]map[Orphan]bool
+}
+
+// Start runs the collection every interval until the stop channel is closed,
+// it is added to the manager as a runnable which needs the leader election
+func (c *Collector) Start(stop <-chan struct{}) error {
+	c.Log.Info("Starting orphaned resource collector", "interval", c.Interval, "dry-run", c.DryRun)
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+			if err := c.Collect(context.Background()); err != nil {
+				c.Log.Error(err, "failed to collect orphaned resources")
+			}
+		}
+	}
+}
+
+// Collect finds orphaned resources in every account used by the clusters and deletes them unless dry-run
+func (c *Collector) Collect(ctx context.Context) error {
+	nifcloudClusters := &infrav1alpha3.NifcloudClusterList{}
+	if err := c.Client.List(ctx, nifcloudClusters); err != nil {
+		return errors.Wrap(err, "failed to list NifcloudClusters")
+	}
+	nifcloudMachines := &infrav1alpha3.NifcloudMachineList{}
+	if err := c.Client.List(ctx, nifcloudMachines); err != nil {
+		return errors.Wrap(err, "failed to list NifcloudMachines")
+	}
+	alive := c.accountClusters(ctx, nifcloudClusters.Items)
+	if c.owned == nil {
+		c.owned = map[string]map[string]bool{}
+	}
+	if c.suspects == nil {
+		c.suspects = map[string]map[Orphan]bool{}
+	}
+
+	counts := map[string]int{KindInstance: 0, KindSecurityGroup: 0, KindAddress: 0}
+	var errs error
+	for identity, nc := range c.accounts {
+		o := newOwners(alive[identity], c.seen[identity], c.owned[identity], nifcloudMachines.Items)
+		orphans, err := o.find(ctx, nc)
+		if err != nil {
+			errs = multierr.Append(errs, errors.Wrapf(err, "failed to find orphaned resources with %s", identity))
+			continue
+		}
+		c.owned[identity] = o.nextOwned
+
+		suspects := map[Orphan]bool{}
+		for _, orphan := range orphans {
+			// the state of an instance changes while it is deleted, it does not identify the orphan
+			key := Orphan{Kind: orphan.Kind, ID: orphan.ID, Cluster: orphan.Cluster, Role: orphan.Role}
+			suspects[key] = true
+			if !c.suspects[identity][key] {
+				c.Log.V(2).Info("Found orphaned resource for the first time", "kind", orphan.Kind, "id", orphan.ID)
+				continue
+			}
+			counts[orphan.Kind]++
+			errs = multierr.Append(errs, c.handle(ctx, nc, orphan))
+		}
+		c.suspects[identity] = suspects
+	}
+	for kind, n := range counts {
+		orphanedResources.WithLabelValues(kind).Set(float64(n))
+	}
+	return errs
+}
+
+// accountClusters returns the names of the clusters which exist in each account,
+// and remembers the accounts and the clusters as seen by this management cluster.
+// the credentials of a cluster which cannot be resolved make its account unknown,
+// so the cluster is treated as alive in every account to keep its resources
+func (c *Collector) accountClusters(ctx context.Context, nifcloudClusters []infrav1alpha3.NifcloudCluster) map[string]map[string]bool {
+	if c.accounts == nil {
+		c.accounts = map[string]cloud.Client{}
+	}
+	if c.seen == nil {
+		c.seen = map[string]map[string]bool{}
+	}
+
+	alive := map[string]map[string]bool{}
+	var unresolved []string
+	for i := range nifcloudClusters {
+		nifcloudCluster := &nifcloudClusters[i]
+		name := clusterName(nifcloudCluster)
+		if name == "" {
+			continue
+		}
+		identity, creds, err := scope.GetCredentials(ctx, c.Client, nifcloudCluster)
+		if err != nil {
+			c.Log.Error(err, "failed to get credentials", "nifcloud-cluster", nifcloudCluster.Name, "namespace", nifcloudCluster.Namespace)
+			unresolved = append(unresolved, name)
+			continue
+		}
+		if creds.AccessKey == "" {
+			continue
+		}
+		if _, ok := c.accounts[identity]; !ok {
+			nc, err := c.ClientCache.Client(identity, creds)
+			if err != nil {
+				c.Log.Error(err, "failed to create nifcloud client", "identity", identity)
+				unresolved = append(unresolved, name)
+				continue
+			}
+			c.accounts[identity] = nc
+		}
+		if alive[identity] == nil {
+			alive[identity] = map[string]bool{}
+		}
+		if c.seen[identity] == nil {
+			c.seen[identity] = map[string]bool{}
+		}
+		alive[identity][name] = true
+		c.seen[identity][name] = true
+	}
+
+	for identity := range c.accounts {
+		if alive[identity] == nil {
+			alive[identity] = map[string]bool{}
+		}
+		for _, name := range unresolved {
+			alive[identity][name] = true
+		}
+	}
+	return alive
+}
+
+// clusterName returns the name of the Cluster which owns the NifcloudCluster,
+// resources are tagged with this name
+func clusterName(nifcloudCluster *infrav1alpha3.NifcloudCluster) string {
+	for _, ref := range nifcloudCluster.OwnerReferences {
+		gv, err := schema.ParseGroupVersion(ref.APIVersion)
+		if err != nil {
+			continue
+		}
+		if ref.Kind == "Cluster" && gv.Group == clusterv1.GroupVersion.Group {
+			return ref.Name
+		}
+	}
+	return ""
+}
+
+// handle reports the orphaned resource and requests the next step to delete it
+func (c *Collector) handle(ctx context.Context, nc cloud.Client, o Orphan) error {
+	log := c.Log.WithValues("kind", o.Kind, "id", o.ID, "cluster", o.Cluster, "role", o.Role)
+	ref := &corev1.ObjectReference{Kind: o.Kind, Name: o.ID, Namespace: c.namespace()}
+
+	if c.DryRun {
+		log.Info("Found orphaned resource")
+		c.Recorder.Eventf(ref, corev1.EventTypeNormal, "OrphanedResourceFound", "%s %q of cluster %q is orphaned", o.Kind, o.ID, o.Cluster)
+		return nil
+	}
+
+	action, err := deleteOrphan(ctx, nc, o)
+	if err != nil {
+		orphanedResourcesDeleteErrors.WithLabelValues(o.Kind).Inc()
+		c.Recorder.Eventf(ref, corev1.EventTypeWarning, "FailedDeleteOrphanedResource", "Failed to delete %s %q of cluster %q: %v", o.Kind, o.ID, o.Cluster, err)
+		return errors.Wrapf(err, "failed to delete %s %q", o.Kind, o.ID)
+	}
+	if action == "" {
+		log.V(2).Info("Waiting for state transition of orphaned resource", "state", o.State)
+		return nil
+	}
+
+	log.Info("Requested to delete orphaned resource", "action", action)
+	orphanedResourcesDeleted.WithLabelValues(o.Kind).Inc()
+	c.Recorder.Eventf(ref, corev1.EventTypeNormal, "SuccessfulDeleteOrphanedResource", "Requested to %s %s %q of cluster %q", action, o.Kind, o.ID, o.Cluster)
+	return nil
+}
+
+func (c *Collector) namespace() string {
+	if c.Namespace == "" {
+		return metav1.NamespaceDefault
+	}
+	return c.Namespace
+}
+
+// deleteOrphan requests the next step to delete the resource and returns what is requested,
+// instances have to be stopped before terminated, so they take two collections
+func deleteOrphan(ctx context.Context, nc cloud.Client, o Orphan) (string, error) {
+	switch o.Kind {
+	case KindInstance:
+		switch o.State {
+		case infrav1alpha3.InstanceStopped:
+			_, err := nc.TerminateInstances(ctx, &computing.TerminateInstancesInput{InstanceId: []string{o.ID}})
+			return "terminate", err
+		case infrav1alpha3.InstancePending, infrav1alpha3.InstanceWaiting:
+			return "", nil
+		default:
+			_, err := nc.StopInstances(ctx, &computing.StopInstancesInput{InstanceId: []string{o.ID}})
+			return "stop", err
+		}
+	case KindSecurityGroup:
+		_, err := nc.DeleteSecurityGroup(ctx, &computing.DeleteSecurityGroupInput{GroupName: nifcloud.String(o.ID)})
+		return "delete", err
+	case KindAddress:
+		_, err := nc.ReleaseAddress(ctx, &computing.ReleaseAddressInput{PublicIp: nifcloud.String(o.ID)})
+		return "release", err
+	default:
+		return "", errors.Errorf("unknown kind of resource %q", o.Kind)
+	}
+}
+
+// owners are the clusters of an account and the instances of the machines which exist
+type owners struct {
+	// clusters exist in the account
+	clusters map[string]bool
+	// known clusters have been seen in the account by this management cluster
+	known map[string]bool
+	// owned instances have been seen with their NifcloudMachines by this management cluster
+	owned     map[string]bool
+	instances map[string]bool
+
+	// nextOwned are the owned instances which still exist, found by find
+	nextOwned map[string]bool
+}
+
+func newOwners(clusters, known, owned map[string]bool, nifcloudMachines []infrav1alpha3.NifcloudMachine) *owners {
+	o := &owners{
+		clusters:  clusters,
+		known:     known,
+		owned:     owned,
+		instances: map[string]bool{},
+		nextOwned: map[string]bool{},
+	}
+	for _, nifcloudMachine := range nifcloudMachines {
+		o.instances[scope.InstanceIDFromName(nifcloudMachine.Name)] = true
+		if nifcloudMachine.Spec.InstanceID != "" {
+			o.instances[nifcloudMachine.Spec.InstanceID] = true
+		}
+	}
+	return o
+}
+
+// orphaned returns true if the resource is tagged by the provider and its cluster no longer exists,
+// resources without the tags or of clusters which this management cluster has never seen are never collected
+func (o *owners) orphaned(tags infrav1alpha3.Tag) bool {
+	if tags["cluster"] == "" || tags["role"] == "" {
+		return false
+	}
+	return o.known[tags["cluster"]] && !o.clusters[tags["cluster"]]
+}
+
+// instanceOrphaned returns true if the cluster of the instance no longer exists,
+// or the machine of the instance no longer exists unless the instance belongs to the cluster like the bastion.
+// the machine is only known to be gone when the instance has been seen with its machine,
+// a cluster with the same name may be managed by another management cluster
+func (o *owners) instanceOrphaned(id string, tags infrav1alpha3.Tag) bool {
+	if o.orphaned(tags) {
+		return true
+	}
+	if !o.clusters[tags["cluster"]] {
+		return false
+	}
+	switch tags["role"] {
+	case controlPlaneRole, nodeRole:
+		return o.owned[id] && !o.instances[id]
+	default:
+		return false
+	}
+}
+
+// find lists the resources of the account and returns the orphaned ones
+func (o *owners) find(ctx context.Context, nc cloud.Client) ([]Orphan, error) {
+	var orphans []Orphan
+
+	instances, err := nc.DescribeInstances(ctx, &computing.DescribeInstancesInput{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to describe instances")
+	}
+	for _, reservation := range instances.ReservationSet {
+		for _, instance := range reservation.InstancesSet {
+			id := nifcloud.StringValue(instance.InstanceId)
+			tags := infrav1alpha3.ParseTags(nifcloud.StringValue(instance.Description))
+			if o.instances[id] || o.owned[id] {
+				o.nextOwned[id] = true
+			}
+			if !o.instanceOrphaned(id, tags) {
+				continue
+			}
+			orphan := Orphan{Kind: KindInstance, ID: id, Cluster: tags["cluster"], Role: tags["role"]}
+			if instance.InstanceState != nil {
+				orphan.State = infrav1alpha3.InstanceState(nifcloud.StringValue(instance.InstanceState.Name))
+			}
+			orphans = append(orphans, orphan)
+		}
+	}
+
+	addresses, err := nc.DescribeAddresses(ctx, &computing.DescribeAddressesInput{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to describe addresses")
+	}
+	for _, address := range addresses.AddressesSet {
+		tags := infrav1alpha3.ParseTags(nifcloud.StringValue(address.Description))
+		if !o.orphaned(tags) {
+			continue
+		}
+		orphans = append(orphans, Orphan{Kind: KindAddress, ID: nifcloud.StringValue(address.PublicIp), Cluster: tags["cluster"], Role: tags["role"]})
+	}
+
+	groups, err := nc.DescribeSecurityGroups(ctx, &computing.DescribeSecurityGroupsInput{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to describe security groups")
+	}
+	for _, group := range groups.SecurityGroupInfo {
+		// security groups are tagged with json, see createSecurityGroupWithTag
+		var tags infrav1alpha3.Tag
+		if err := json.Unmarshal([]byte(nifcloud.StringValue(group.GroupDescription)), &tags); err != nil {
+			continue
+		}
+		if !o.orphaned(tags) {
+			continue
+		}
+		orphans = append(orphans, Orphan{Kind: KindSecurityGroup, ID: nifcloud.StringValue(group.GroupName), Cluster: tags["cluster"], Role: tags["role"]})
+	}
+
+	return orphans, nil
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gc
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/aokumasan/nifcloud-sdk-go-v2/nifcloud"
+	"github.com/aokumasan/nifcloud-sdk-go-v2/service/computing"
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/mock_client"
+	"github.com/nifcloud-labs/cluster-api-provider-nifcloud/pkg/cloud/scope"
+)
+
+type mockFactory struct {
+	client cloud.Client
+}
+
+func (f *mockFactory) CreateClient(_, _, _ string) (cloud.Client, error) {
+	return f.client, nil
+}
+
+func instance(id, description string, state infrav1alpha3.InstanceState) computing.InstancesSetItem {
+	return computing.InstancesSetItem{
+		InstanceId:    nifcloud.String(id),
+		Description:   nifcloud.String(description),
+		InstanceState: &computing.InstanceState{Name: nifcloud.String(string(state))},
+	}
+}
+
+func TestCollector_Collect(t *testing.T) {
+	for _, env := range []string{"NIFCLOUD_ACCESS_KEY", "NIFCLOUD_SECRET_KEY"} {
+		defer os.Setenv(env, os.Getenv(env))
+		os.Setenv(env, "test")
+	}
+
+	scheme := runtime.NewScheme()
+	if err := infrav1alpha3.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	objects := []runtime.Object{
+		&infrav1alpha3.NifcloudCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "alive",
+				Namespace: "default",
+				OwnerReferences: []metav1.OwnerReference{
+					{APIVersion: clusterv1.GroupVersion.String(), Kind: "Cluster", Name: "alive"},
+				},
+			},
+		},
+		&infrav1alpha3.NifcloudMachine{
+			ObjectMeta: metav1.ObjectMeta{Name: "alive-controlplane-0", Namespace: "default"},
+		},
+	}
+	dead := &infrav1alpha3.NifcloudCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "dead",
+			Namespace: "default",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: clusterv1.GroupVersion.String(), Kind: "Cluster", Name: "dead"},
+			},
+		},
+	}
+	leaked := &infrav1alpha3.NifcloudMachine{
+		ObjectMeta: metav1.ObjectMeta{Name: "alive-node-0", Namespace: "default"},
+	}
+	aliveMachineID := scope.InstanceIDFromName("alive-controlplane-0")
+	leakedMachineID := scope.InstanceIDFromName("alive-node-0")
+
+	tests := []struct {
+		name   string
+		dryRun bool
+		expect func(m *mock_client.MockClientMockRecorder)
+		want   map[string]int
+	}{
+		{
+			name:   "report orphaned resources in dry-run",
+			dryRun: true,
+			expect: func(m *mock_client.MockClientMockRecorder) {},
+			want:   map[string]int{KindInstance: 2, KindAddress: 1, KindSecurityGroup: 1},
+		},
+		{
+			name: "delete orphaned resources",
+			expect: func(m *mock_client.MockClientMockRecorder) {
+				m.StopInstances(gomock.Any(), &computing.StopInstancesInput{InstanceId: []string{leakedMachineID}}).
+					Return(&computing.StopInstancesOutput{}, nil)
+				m.TerminateInstances(gomock.Any(), &computing.TerminateInstancesInput{InstanceId: []string{"deadcp"}}).
+					Return(&computing.TerminateInstancesOutput{}, nil)
+				m.ReleaseAddress(gomock.Any(), &computing.ReleaseAddressInput{PublicIp: nifcloud.String("203.0.113.2")}).
+					Return(&computing.ReleaseAddressOutput{}, nil)
+				m.DeleteSecurityGroup(gomock.Any(), &computing.DeleteSecurityGroupInput{GroupName: nifcloud.String("deadcp")}).
+					Return(&computing.DeleteSecurityGroupOutput{}, nil)
+			},
+			want: map[string]int{KindInstance: 2, KindAddress: 1, KindSecurityGroup: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			mockSvc := mock_client.NewMockClient(mockCtrl)
+
+			mockSvc.EXPECT().DescribeInstances(gomock.Any(), gomock.Any()).AnyTimes().
+				Return(&computing.DescribeInstancesOutput{
+					ReservationSet: []computing.ReservationSetItem{{
+						InstancesSet: []computing.InstancesSetItem{
+							instance(aliveMachineID, "cluster:alive,role:control-plane", infrav1alpha3.InstanceRunning),
+							instance("alivebastion", "cluster:alive,role:bastion", infrav1alpha3.InstanceRunning),
+							instance(leakedMachineID, "cluster:alive,role:node", infrav1alpha3.InstanceRunning),
+							// instances which have never been seen with their machines may be created right now
+							// or belong to a cluster with the same name of another management cluster
+							instance("unseennode", "cluster:alive,role:node", infrav1alpha3.InstanceRunning),
+							instance("deadcp", "cluster:dead,role:control-plane", infrav1alpha3.InstanceStopped),
+							instance("users", "web server", infrav1alpha3.InstanceRunning),
+							// clusters of other management clusters sharing the account are never seen
+							instance("foreigncp", "cluster:foreign,role:control-plane", infrav1alpha3.InstanceStopped),
+						},
+					}},
+				}, nil)
+			mockSvc.EXPECT().DescribeAddresses(gomock.Any(), gomock.Any()).AnyTimes().
+				Return(&computing.DescribeAddressesOutput{
+					AddressesSet: []computing.AddressesSetItem{
+						{PublicIp: nifcloud.String("203.0.113.1"), Description: nifcloud.String("cluster:alive,role:ENDPOINT")},
+						{PublicIp: nifcloud.String("203.0.113.2"), Description: nifcloud.String("cluster:dead,role:ENDPOINT")},
+						{PublicIp: nifcloud.String("203.0.113.3")},
+					},
+				}, nil)
+			mockSvc.EXPECT().DescribeSecurityGroups(gomock.Any(), gomock.Any()).AnyTimes().
+				Return(&computing.DescribeSecurityGroupsOutput{
+					SecurityGroupInfo: []computing.SecurityGroupInfoSetItem{
+						{GroupName: nifcloud.String("alivecp"), GroupDescription: nifcloud.String(`{"cluster":"alive","role":"controlplane"}`)},
+						{GroupName: nifcloud.String("deadcp"), GroupDescription: nifcloud.String(`{"cluster":"dead","role":"controlplane"}`)},
+						{GroupName: nifcloud.String("users"), GroupDescription: nifcloud.String("web servers")},
+					},
+				}, nil)
+			// the dead cluster and the leaked machine are seen by the first collection, before they are deleted
+			k8sClient := fake.NewFakeClientWithScheme(scheme, append([]runtime.Object{dead.DeepCopy(), leaked.DeepCopy()}, objects...)...)
+			c := &Collector{
+				Client:      k8sClient,
+				ClientCache: scope.NewClientCache(&mockFactory{client: mockSvc}),
+				Log:         log.Log,
+				Recorder:    record.NewFakeRecorder(10),
+				DryRun:      true,
+			}
+			if err := c.Collect(context.TODO()); err != nil {
+				t.Fatalf("did not expect error: %v", err)
+			}
+			if err := k8sClient.Delete(context.TODO(), dead.DeepCopy()); err != nil {
+				t.Fatal(err)
+			}
+			if err := k8sClient.Delete(context.TODO(), leaked.DeepCopy()); err != nil {
+				t.Fatal(err)
+			}
+
+			// resources found orphaned for the first time are not handled yet
+			first := record.NewFakeRecorder(10)
+			c.Recorder = first
+			if err := c.Collect(context.TODO()); err != nil {
+				t.Fatalf("did not expect error: %v", err)
+			}
+			if len(first.Events) != 0 {
+				t.Errorf("expected no events for the first finding, got %d", len(first.Events))
+			}
+			tt.expect(mockSvc.EXPECT())
+
+			recorder := record.NewFakeRecorder(10)
+			c.Recorder = recorder
+			c.DryRun = tt.dryRun
+			if err := c.Collect(context.TODO()); err != nil {
+				t.Fatalf("did not expect error: %v", err)
+			}
+
+			total := 0
+			for kind, want := range tt.want {
+				total += want
+				if got := int(testutil.ToFloat64(orphanedResources.WithLabelValues(kind))); got != want {
+					t.Errorf("expected %d orphaned %s, got %d", want, kind, got)
+				}
+			}
+			if len(recorder.Events) != total {
+				t.Errorf("expected %d events, got %d", total, len(recorder.Events))
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gc
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	// orphanedResources is the number of orphaned resources found by the last collection
+	orphanedResources = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "nifcloud_orphaned_resources",
+		Help: "Number of nifcloud resources whose owners no longer exist, found by the last collection",
+	}, []string{"kind"})
+
+	// orphanedResourcesDeleted is the number of delete requests made for orphaned resources
+	orphanedResourcesDeleted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "nifcloud_orphaned_resources_deleted_total",
+		Help: "Total number of delete requests for orphaned nifcloud resources",
+	}, []string{"kind"})
+
+	// orphanedResourcesDeleteErrors is the number of failed delete requests for orphaned resources
+	orphanedResourcesDeleteErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "nifcloud_orphaned_resources_delete_errors_total",
+		Help: "Total number of failed delete requests for orphaned nifcloud resources",
+	}, []string{"kind"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(orphanedResources, orphanedResourcesDeleted, orphanedResourcesDeleteErrors)
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package paused tells whether reconciliation of cluster-api objects is suspended
+package paused
+
+import (
+	"sync"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+const (
+	// PausedAnnotation is the annotation which pauses reconciliation of the object
+	PausedAnnotation = "cluster.x-k8s.io/paused"
+)
+
+// HasPausedAnnotation returns true if the object has the paused annotation
+func HasPausedAnnotation(o metav1.Object) bool {
+	_, ok := o.GetAnnotations()[PausedAnnotation]
+	return ok
+}
+
+// IsClusterPaused returns true if the Cluster is paused by the annotation or by Spec.Paused
+func IsClusterPaused(cluster *clusterv1.Cluster) bool {
+	if cluster == nil {
+		return false
+	}
+	return cluster.Spec.Paused || HasPausedAnnotation(cluster)
+}
+
+// IsPaused returns true if the Cluster or the object is paused
+func IsPaused(cluster *clusterv1.Cluster, o metav1.Object) bool {
+	return IsClusterPaused(cluster) || HasPausedAnnotation(o)
+}
+
+// Transitions remembers the objects found paused, so that the reconcilers report
+// only when an object becomes paused instead of every time it is skipped.
+// the zero value is ready to use
+type Transitions struct {
+	mu     sync.Mutex
+	paused map[types.UID]bool
+}
+
+// Paused records the object as paused and returns true if it was not paused before
+func (t *Transitions) Paused(o metav1.Object) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.paused == nil {
+		t.paused = map[types.UID]bool{}
+	}
+	if t.paused[o.GetUID()] {
+		return false
+	}
+	t.paused[o.GetUID()] = true
+	return true
+}
+
+// Resumed forgets the object which is reconciled again
+func (t *Transitions) Resumed(o metav1.Object) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.paused, o.GetUID())
+}
+
+// ResourceNotPaused returns the predicate which filters out events of paused objects,
+// a Cluster is also filtered out by Spec.Paused
+func ResourceNotPaused(logger logr.Logger) predicate.Funcs {
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return notPaused(logger, e.Meta, e.Object)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return notPaused(logger, e.MetaNew, e.ObjectNew)
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return notPaused(logger, e.Meta, e.Object)
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return notPaused(logger, e.Meta, e.Object)
+		},
+	}
+}
+
+func notPaused(logger logr.Logger, meta metav1.Object, o runtime.Object) bool {
+	if meta == nil {
+		return true
+	}
+	paused := HasPausedAnnotation(meta)
+	if cluster, ok := o.(*clusterv1.Cluster); ok {
+		paused = IsClusterPaused(cluster)
+	}
+	if paused {
+		logger.V(4).Info("Ignoring event of paused object", "namespace", meta.GetNamespace(), "name", meta.GetName())
+	}
+	return !paused
+}
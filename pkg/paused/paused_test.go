@@ -0,0 +1,111 @@
+/*
+Copyright 2020 FUJITSU CLOUD TECHNOLOGIES LIMITED. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package paused
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	infrav1alpha3 "github.com/nifcloud-labs/cluster-api-provider-nifcloud/api/v1alpha3"
+)
+
+func TestIsPaused(t *testing.T) {
+	tests := []struct {
+		name               string
+		clusterAnnotations map[string]string
+		clusterPaused      bool
+		objectAnnotations  map[string]string
+		want               bool
+	}{
+		{
+			name: "not paused",
+		},
+		{
+			name:               "cluster has paused annotation",
+			clusterAnnotations: map[string]string{PausedAnnotation: ""},
+			want:               true,
+		},
+		{
+			name:              "object has paused annotation",
+			objectAnnotations: map[string]string{PausedAnnotation: "true"},
+			want:              true,
+		},
+		{
+			name:          "cluster spec is paused",
+			clusterPaused: true,
+			want:          true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := &clusterv1.Cluster{
+				ObjectMeta: metav1.ObjectMeta{Annotations: tt.clusterAnnotations},
+				Spec:       clusterv1.ClusterSpec{Paused: tt.clusterPaused},
+			}
+			machine := &infrav1alpha3.NifcloudMachine{ObjectMeta: metav1.ObjectMeta{Annotations: tt.objectAnnotations}}
+			if got := IsPaused(cluster, machine); got != tt.want {
+				t.Errorf("IsPaused() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResourceNotPaused(t *testing.T) {
+	p := ResourceNotPaused(log.Log)
+
+	pausedMachine := &infrav1alpha3.NifcloudMachine{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{PausedAnnotation: ""}},
+	}
+	if p.Create(event.CreateEvent{Meta: pausedMachine, Object: pausedMachine}) {
+		t.Error("event of paused object is not filtered out")
+	}
+
+	// resumed objects are reconciled again
+	machine := &infrav1alpha3.NifcloudMachine{}
+	if !p.Update(event.UpdateEvent{MetaOld: pausedMachine, ObjectOld: pausedMachine, MetaNew: machine, ObjectNew: machine}) {
+		t.Error("event of resumed object is filtered out")
+	}
+
+	pausedCluster := &clusterv1.Cluster{Spec: clusterv1.ClusterSpec{Paused: true}}
+	if p.Generic(event.GenericEvent{Meta: pausedCluster, Object: pausedCluster}) {
+		t.Error("event of paused cluster is not filtered out")
+	}
+}
+
+func TestTransitions(t *testing.T) {
+	var transitions Transitions
+	a := &infrav1alpha3.NifcloudCluster{ObjectMeta: metav1.ObjectMeta{Name: "a", UID: "uid-a"}}
+	b := &infrav1alpha3.NifcloudCluster{ObjectMeta: metav1.ObjectMeta{Name: "b", UID: "uid-b"}}
+
+	if !transitions.Paused(a) {
+		t.Error("expected the first pause of a to be reported")
+	}
+	if transitions.Paused(a) {
+		t.Error("expected a which is still paused not to be reported")
+	}
+	if !transitions.Paused(b) {
+		t.Error("expected the first pause of b to be reported")
+	}
+	transitions.Resumed(a)
+	if !transitions.Paused(a) {
+		t.Error("expected a paused again after resumed to be reported")
+	}
+}